@@ -1,15 +1,20 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"github.com/1340691923/xwl_bi/controller"
 	"github.com/1340691923/xwl_bi/engine/db"
 	"github.com/1340691923/xwl_bi/engine/logs"
 	"github.com/1340691923/xwl_bi/model"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/rbac"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/attr_dict"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/job"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/meta_data"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/report"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/Shopify/sarama"
 	"github.com/gofiber/websocket/v2"
 	"github.com/tidwall/gjson"
 	"go.uber.org/zap"
@@ -98,6 +103,14 @@ func InitClickHouse() (fn func(), err error) {
 func InitRedisPool() (fn func(), err error) {
 	config := model.GlobConfig.Comm.Redis
 
+	//未配置redis地址时退化为进程内缓存 适用于allinone单进程部署
+	if config.Addr == "" {
+		db.RedisPool = db.NewMemRedisPool()
+		log.Println("Redis组件初始化成功！未配置redis地址，使用内存缓存")
+		fn = func() {}
+		return
+	}
+
 	db.RedisPool = db.NewRedisPool(config.Addr, config.Passwd, config.Db, config.MaxIdle, config.MaxActive)
 
 	log.Println(fmt.Sprintf("Redis组件初始化成功！连接：%v，DB：%v，密码:%v MaxIdle:%v MaxActive:%v",
@@ -111,9 +124,49 @@ func InitRedisPool() (fn func(), err error) {
 	return
 }
 
+// allinone单进程部署 上报与消费通过本地持久化队列衔接
+func InitAllInOne() (fn func(), err error) {
+	model.GlobConfig.Comm.Mq.Type = model.MqTypeLocal
+	fn = func() {}
+	return
+}
+
 // 初始化项目启动任务
 func InitTask() (fn func(), err error) {
-	fn = func() {}
+	err = job.Register(
+		&job.Job{
+			Name:    "attr_dict_sync",
+			Remark:  "同步url来源的属性字典",
+			Spec:    "@every 1m",
+			Timeout: 30 * time.Minute,
+			Fn: func(ctx context.Context) error {
+				return attr_dict.SyncDue(ctx)
+			},
+		},
+		&job.Job{
+			Name:       "meta_volume_stat",
+			Remark:     "统计事件与属性的每日上报量",
+			Spec:       "5 * * * *",
+			Timeout:    30 * time.Minute,
+			Retry:      1,
+			RetryDelay: time.Minute,
+			Fn: func(ctx context.Context) error {
+				return meta_data.UpdateAllVolumeStat(ctx)
+			},
+		},
+		&job.Job{
+			Name:   "job_run_clean",
+			Remark: "清理过期的定时任务执行历史",
+			Spec:   "30 3 * * *",
+			Fn: func(ctx context.Context) error {
+				return job.CleanRuns()
+			},
+		},
+	)
+	if err != nil {
+		return
+	}
+	fn = job.Start()
 	return
 }
 
@@ -152,42 +205,62 @@ func InitOpenWinBrowser() (fn func(), err error) {
 	return
 }
 
-//初始化kafka异步生产者
-func InitKafkaAsyncProduce() (fn func(), err error) {
-	config := model.GlobConfig.Comm.Kafka
-	conn, err := db.NewKafkaAsyncProduce(config.Addresses, config.Username, config.Password)
-	if err != nil {
-		return
+//初始化上报数据的消息生产者 comm.mq.type为redis时使用redis stream，否则使用kafka
+func InitMsgProducer() (fn func(), err error) {
+	switch model.GlobConfig.GetMqType() {
+	case model.MqTypeRedis:
+		db.MsgProducer = db.NewRedisStreamProducer(db.RedisPool, model.GlobConfig.Comm.Mq.RedisStream.MaxLen)
+	case model.MqTypeLocal:
+		localCfg := model.GlobConfig.Comm.Mq.Local
+		if db.LocalMq, err = db.OpenLocalQueue(localCfg.GetDir(), localCfg.GetSegmentBytes()); err != nil {
+			return
+		}
+		db.MsgProducer = db.LocalMq
+	default:
+		if db.MsgProducer, err = newKafkaMsgProducer(); err != nil {
+			return
+		}
 	}
-	db.KafkaASyncProducer = conn
+	log.Println(fmt.Sprintf("消息生产者初始化成功！类型：%v", model.GlobConfig.GetMqType()))
 	fn = func() {
-		log.Println("KafkaASyncProducer 关闭了")
-		db.KafkaASyncProducer.Close()
+		log.Println("MsgProducer 关闭了")
+		db.MsgProducer.Close()
 	}
 	return
 }
 
-//初始化kafka同步步生产者
-func InitKafkaSyncProduce() (fn func(), err error) {
+func newKafkaMsgProducer() (producer db.MqProducer, err error) {
 	config := model.GlobConfig.Comm.Kafka
-	conn, err := db.NewKafkaSyncProduce(config.Addresses, config.Username, config.Password)
+	producerType := model.GlobConfig.GetKafkaCfgProducerType()
+	sarCfg, err := sinker.GetSaramaProducerConfig(config, producerType)
 	if err != nil {
 		return
 	}
-	db.KafkaSyncProducer = conn
-
-	fn = func() {
-		log.Println("KafkaSyncProducer 关闭了")
-		db.KafkaSyncProducer.Close()
+	switch producerType {
+	case sinker.AsyncProducer:
+		//初始化kafka异步生产者
+		conn, err := db.NewKafkaAsyncProduce(config.Addresses, sarCfg)
+		if err != nil {
+			return nil, err
+		}
+		producer = db.NewKafkaAsyncMqProducer(conn, func(err *sarama.ProducerError) {
+			logs.Logger.Error(" db.KafkaASyncProducer.Errors", zap.Error(err))
+		})
+	default:
+		//初始化kafka同步步生产者
+		conn, err := db.NewKafkaSyncProduce(config.Addresses, sarCfg)
+		if err != nil {
+			return nil, err
+		}
+		producer = db.NewKafkaSyncMqProducer(conn)
 	}
-
 	return
 }
 
 //
 func InitDebugSarama() (fn func(), err error) {
-	debugSarama := sinker.NewKafkaSarama()
-	err = debugSarama.Init(model.GlobConfig.Comm.Kafka, model.GlobConfig.Comm.Kafka.DebugDataTopicName, model.GlobConfig.Comm.Kafka.DebugDataGroup, func(msg model.InputMessage, markFn func()) {
+	debugSarama := sinker.NewConsumerGroup()
+	err = debugSarama.Init(model.GlobConfig.Comm.Kafka.DebugDataTopicName, model.GlobConfig.Comm.Kafka.DebugDataGroup, func(msg model.InputMessage, markFn func()) {
 
 		distinctId := gjson.GetBytes(msg.Value, "distinct_id").String()
 
@@ -213,7 +286,7 @@ func InitDebugSarama() (fn func(), err error) {
 				return true
 			})
 		}
-
+		markFn()
 	}, func() {
 
 	})
@@ -231,9 +304,22 @@ func InitDebugSarama() (fn func(), err error) {
 	return
 }
 
+//定时清空appid与表id的本地缓存
 func RefreshTableId() (fn func(), err error) {
-	fn = func() {
-		go report.RefreshTableIdMap(5 * time.Minute)
+	err = job.Register(&job.Job{
+		Name:         "report_refresh_table_id",
+		Remark:       "清空上报服务appid与表id的本地缓存",
+		Spec:         "@every 5m",
+		Local:        true,
+		QuietSuccess: true,
+		Fn: func(ctx context.Context) error {
+			report.ClearTableIdMap()
+			return nil
+		},
+	})
+	if err != nil {
+		return
 	}
+	fn = job.Start()
 	return
 }
@@ -0,0 +1,2 @@
+set goos=linux&& go build  -ldflags="-w -s" -o bin/linux/allinone cmd/allinone/main.go
+echo "build success"
\ No newline at end of file
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/1340691923/xwl_bi/application"
+	"github.com/1340691923/xwl_bi/cmd/sinker/geoip"
+	"github.com/1340691923/xwl_bi/cmd/sinker/pipeline"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/router"
+	_ "github.com/ClickHouse/clickhouse-go"
+	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+var (
+	configFileDir  string
+	configFileName string
+	configFileExt  string
+)
+
+func init() {
+	flag.StringVar(&configFileDir, "configFileDir", "config", "配置文件夹名")
+	flag.StringVar(&configFileName, "configFileName", "config", "配置文件名")
+	flag.StringVar(&configFileExt, "configFileExt", "json", "配置文件后缀")
+	flag.Parse()
+}
+
+// 单进程部署：上报服务 + sinker + 管理后台
+// 上报与消费通过本地持久化队列衔接，不依赖kafka；未配置redis地址时使用内存缓存
+// 只需要额外部署 mysql 与 clickhouse
+func main() {
+
+	app := application.NewApp(
+		"allinone",
+		application.WithConfigFileDir(configFileDir),
+		application.WithConfigFileName(configFileName),
+		application.WithConfigFileExt(configFileExt),
+		application.RegisterInitFnObserver(application.InitAllInOne),
+		application.RegisterInitFnObserver(application.InitLogs),
+		application.RegisterInitFnObserver(application.InitMysql),
+		application.RegisterInitFnObserver(application.InitClickHouse),
+		application.RegisterInitFnObserver(application.InitRedisPool),
+		application.RegisterInitFnObserver(application.InitMsgProducer),
+		application.RegisterInitFnObserver(application.InitTask),
+		application.RegisterInitFnObserver(application.InitRbac),
+		application.RegisterInitFnObserver(application.InitOpenWinBrowser),
+		application.RegisterInitFnObserver(application.InitDebugSarama),
+		application.RegisterInitFnObserver(application.RefreshTableId),
+	)
+
+	err := app.
+		InitConfig().
+		NotifyInitFnObservers().
+		Error()
+
+	if err != nil {
+		logs.Logger.Error("allinone 初始化失败", zap.Error(err))
+		panic(err)
+	}
+
+	defer app.Close()
+
+	geoip2, err := geoip.NewGeoip(geoip.GeoipMmdbByte)
+	if err != nil {
+		logs.Logger.Error("Geoip 初始化失败", zap.Error(err))
+		panic(err)
+	}
+
+	defer geoip2.Close()
+
+	//sinker
+	sinkerPipeline := pipeline.NewPipeline(geoip2)
+
+	if err = sinkerPipeline.Start(); err != nil {
+		logs.Logger.Error("sinker 启动失败", zap.Error(err))
+		panic(err)
+	}
+
+	//上报服务
+	server := router.InitReport()
+
+	go func() {
+		port := fmt.Sprintf(":%v", model.GlobConfig.Report.ReportPort)
+		log.Println(fmt.Sprintf("上报服务启动成功 ,地址为: http://127.0.0.1:%v", model.GlobConfig.Report.ReportPort))
+		if err := server.ListenAndServe(port); err != nil {
+			logs.Logger.Error("service err", zap.Error(err))
+			log.Panic(err)
+		}
+	}()
+
+	//管理后台
+	app.RunManager()
+
+	app.WaitForExitSign(func() {
+		logs.Logger.Sugar().Infof("数据上报服务停止中...")
+		if err := server.Shutdown(); err != nil {
+			logs.Logger.Sugar().Infof("数据上报服务停止失败 err", zap.Error(err))
+		} else {
+			logs.Logger.Sugar().Infof("数据上报服务停止成功...")
+		}
+	}, sinkerPipeline.Stop, func() {
+		logs.Logger.Sugar().Infof("allinone 服务停止成功...")
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/1340691923/xwl_bi/model"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
 	"log"
+	"strings"
 )
 
 //初始化clickhouse 表数据
@@ -101,5 +102,127 @@ func Init() {
 		panic(err)
 	}
 
+	_, err = db.ClickHouseSqlx.Exec(`DROP TABLE IF EXISTS xwl_destination_log` + sinker.GetClusterSql() + `;`)
+
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 删除表 xwl_destination_log 失败:%s", err.Error()))
+		panic(err)
+	}
+
+	_, err = db.ClickHouseSqlx.Exec(`
+		
+		CREATE TABLE xwl_destination_log ` + sinker.GetClusterSql() + `
+		(
+		
+			table_id Int64,
+		
+			destination_id Int64,
+		
+			create_time DateTime DEFAULT now(),
+		
+			event_name String,
+		
+			status Int32,
+		
+			http_status Int32,
+		
+			attempts Int32,
+		
+			duration_ms Int64,
+		
+			error_reason String,
+		
+			request_body String,
+		
+			response_body String
+		)
+		ENGINE = ` + sinker.GetMergeTree("xwl_destination_log") + ` 
+		PARTITION BY (toYYYYMMDD(create_time))
+		ORDER BY (toYYYYMMDD(create_time),
+		 table_id,
+		 destination_id,
+		 status)
+		TTL create_time + toIntervalMonth(1)
+		SETTINGS index_granularity = 8192;
+`)
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 建表 xwl_destination_log 失败:%s", err.Error()))
+		panic(err)
+	}
+
+	_, err = db.ClickHouseSqlx.Exec(`DROP DICTIONARY IF EXISTS xwl_attr_dict_dict` + sinker.GetClusterSql() + `;`)
+
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 删除字典 xwl_attr_dict_dict 失败:%s", err.Error()))
+		panic(err)
+	}
+
+	_, err = db.ClickHouseSqlx.Exec(`DROP TABLE IF EXISTS xwl_attr_dict` + sinker.GetClusterSql() + `;`)
+
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 删除表 xwl_attr_dict 失败:%s", err.Error()))
+		panic(err)
+	}
+
+	//每次上传或同步写入新版本 字典只读取各属性的最新版本 旧版本异步删除
+	_, err = db.ClickHouseSqlx.Exec(`
+		
+		CREATE TABLE xwl_attr_dict ` + sinker.GetClusterSql() + `
+		(
+		
+			table_id UInt64,
+		
+			attribute_name String,
+		
+			value String,
+		
+			label String,
+		
+			version UInt64
+		)
+		ENGINE = ` + sinker.GetMergeTree("xwl_attr_dict") + ` 
+		ORDER BY (table_id,
+		 attribute_name,
+		 value)
+		SETTINGS index_granularity = 8192;
+`)
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 建表 xwl_attr_dict 失败:%s", err.Error()))
+		panic(err)
+	}
+
+	ckConfig := model.GlobConfig.Comm.ClickHouse
+	_, err = db.ClickHouseSqlx.Exec(`
+		
+		CREATE DICTIONARY xwl_attr_dict_dict ` + sinker.GetClusterSql() + `
+		(
+		
+			table_id UInt64,
+		
+			attribute_name String,
+		
+			value String,
+		
+			label String
+		)
+		PRIMARY KEY table_id, attribute_name, value
+		SOURCE(CLICKHOUSE(
+			HOST 'localhost' PORT ` + ckConfig.Port + ` USER '` + escapeCkString(ckConfig.Username) + `' PASSWORD '` + escapeCkString(ckConfig.Pwd) + `'
+			DB '` + escapeCkString(ckConfig.DbName) + `' TABLE 'xwl_attr_dict'
+			WHERE '(table_id, attribute_name, version) in (select table_id, attribute_name, max(version) from ` + escapeCkString(ckConfig.DbName) + `.xwl_attr_dict group by table_id, attribute_name)'
+		))
+		LAYOUT(COMPLEX_KEY_HASHED())
+		LIFETIME(MIN 30 MAX 60);
+`)
+	if err != nil {
+		log.Println(fmt.Sprintf("clickhouse 建字典 xwl_attr_dict_dict 失败:%s", err.Error()))
+		panic(err)
+	}
+
 	log.Println("初始化CK数据完成！")
 }
+
+//字典ddl中的字符串字面量转义
+func escapeCkString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -6,19 +6,16 @@ import (
 	"time"
 
 	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
 	"github.com/Shopify/sarama"
 )
 
 //初始化kafka数据
 func Init() {
-	config := sarama.NewConfig()
-
-	config.Version = sarama.V2_0_0_0
-	if model.GlobConfig.Comm.Kafka.Username != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = model.GlobConfig.Comm.Kafka.Username
-		config.Net.SASL.Password = model.GlobConfig.Comm.Kafka.Password
-		config.Net.SASL.Handshake = true
+	config, err := sinker.GetSaramaConfig(model.GlobConfig.Comm.Kafka)
+	if err != nil {
+		log.Println(fmt.Sprintf("kafka 配置不合法:%s", err.Error()))
+		panic(err)
 	}
 
 	config.Consumer.Group.Session.Timeout = 15 * time.Second
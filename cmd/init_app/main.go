@@ -9,6 +9,7 @@ import (
 	"github.com/1340691923/xwl_bi/cmd/init_app/ck"
 	"github.com/1340691923/xwl_bi/cmd/init_app/kafka"
 	"github.com/1340691923/xwl_bi/cmd/init_app/mysql"
+	"github.com/1340691923/xwl_bi/model"
 	_ "github.com/ClickHouse/clickhouse-go"
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -53,7 +54,10 @@ func main() {
 
 	defer app.Close()
 
-	kafka.Init()
+	//redis stream 的stream与消费者组由消费者启动时自动创建
+	if model.GlobConfig.GetMqType() == model.MqTypeKafka {
+		kafka.Init()
+	}
 	ck.Init()
 	mysql.Init()
 	log.Println("数据已全部初始化完毕！")
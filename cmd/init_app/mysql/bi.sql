@@ -29,7 +29,7 @@ CREATE TABLE `attribute`  (
   `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '修改时间',
   `app_id` int(11) NULL DEFAULT 0 COMMENT 'appid',
-  `status` tinyint(4) NULL DEFAULT 0 COMMENT '是否显示 0为不显示 1为显示 默认不显示',
+  `status` tinyint(4) NULL DEFAULT 0 COMMENT '是否显示 0为不显示 1为显示 2为已归档 默认不显示',
   PRIMARY KEY (`id`) USING BTREE,
   UNIQUE INDEX `attribute_name_attribute_source`(`attribute_name`, `attribute_source`, `app_id`) USING BTREE,
   INDEX `attribute_id_source`(`app_id`, `attribute_source`, `attribute_name`) USING BTREE
@@ -72,7 +72,7 @@ CREATE TABLE `gm_role`  (
   `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`) USING BTREE
 ) ENGINE = InnoDB AUTO_INCREMENT = 3 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_general_ci ROW_FORMAT = DYNAMIC;
-INSERT INTO `gm_role` VALUES (1, 'admin', '超级管理员', '[{\"path\":\"/behavior-analysis\",\"component\":\"layout\",\"redirect\":\"/behavior-analysis/index\",\"alwaysShow\":false,\"meta\":{\"title\":\"行为分析\",\"icon\":\"el-icon-link\"},\"children\":[{\"path\":\"event/:id\",\"component\":\"views/behavior-analysis/event\",\"name\":\"event\",\"meta\":{\"title\":\"事件分析\",\"dynamic\":true,\"icon\":\"el-icon-data-line\"}},{\"path\":\"retention/:id\",\"component\":\"views/behavior-analysis/retention\",\"name\":\"retention\",\"meta\":{\"title\":\"留存分析\",\"dynamic\":true,\"icon\":\"el-icon-data-analysis\"}},{\"path\":\"funnel/:id\",\"component\":\"views/behavior-analysis/funnel\",\"name\":\"funnel\",\"meta\":{\"title\":\"漏斗分析\",\"dynamic\":true,\"icon\":\"el-icon-data-board\"}},{\"path\":\"trace/:id\",\"component\":\"views/behavior-analysis/trace\",\"name\":\"trace\",\"meta\":{\"title\":\"智能路径分析\",\"dynamic\":true,\"icon\":\"el-icon-bicycle\"}}]},{\"path\":\"/user-analysis\",\"component\":\"layout\",\"redirect\":\"/user-analysis/attr\",\"alwaysShow\":false,\"meta\":{\"title\":\"用户分析\",\"icon\":\"el-icon-pie-chart\"},\"children\":[{\"path\":\"attr/:id\",\"component\":\"views/user-analysis/index\",\"name\":\"attr\",\"meta\":{\"title\":\"用户属性分析\",\"dynamic\":true,\"icon\":\"el-icon-s-custom\"}},{\"path\":\"group\",\"component\":\"views/user-analysis/group\",\"name\":\"group\",\"meta\":{\"title\":\"用户分群\",\"icon\":\"el-icon-user\"}},{\"isInside\":true,\"path\":\"user_list\",\"component\":\"views/user-analysis/user_list\",\"name\":\"user_list\",\"meta\":{\"title\":\"用户列表\",\"icon\":\"el-icon-user-solid\"}},{\"isInside\":true,\"path\":\"user_info/:uid/:index\",\"component\":\"views/user-analysis/user_info\",\"name\":\"user_info\",\"meta\":{\"title\":\"用户事件详情\",\"dynamic\":true,\"icon\":\"el-icon-s-custom\"}}]},{\"path\":\"/manager\",\"component\":\"layout\",\"redirect\":\"/manager/event\",\"alwaysShow\":false,\"meta\":{\"title\":\"数据管理\",\"icon\":\"el-icon-edit\"},\"children\":[{\"path\":\"event\",\"component\":\"views/manager/event\",\"name\":\"event\",\"meta\":{\"title\":\"事件管理\",\"icon\":\"el-icon-s-management\"}},{\"path\":\"log\",\"component\":\"views/manager/log\",\"name\":\"log\",\"meta\":{\"title\":\"埋点管理\",\"icon\":\"el-icon-notebook-1\"}}]},{\"path\":\"/permission\",\"component\":\"layout\",\"redirect\":\"/permission/role\",\"alwaysShow\":true,\"meta\":{\"title\":\"权限\",\"icon\":\"el-icon-user-solid\"},\"children\":[{\"path\":\"role\",\"component\":\"views/permission/role\",\"name\":\"RolePermission\",\"meta\":{\"title\":\"角色管理\",\"icon\":\"el-icon-s-check\"}},{\"path\":\"user\",\"component\":\"views/permission/user\",\"name\":\"user\",\"meta\":{\"title\":\"用户管理\",\"icon\":\"el-icon-user\"}},{\"path\":\"operater_log\",\"component\":\"views/permission/operater_log\",\"name\":\"operater_log\",\"meta\":{\"title\":\"操作日志列表\",\"icon\":\"el-icon-s-order\"}}]},{\"path\":\"/app\",\"component\":\"layout\",\"children\":[{\"path\":\"/app/app\",\"component\":\"views/app/index\",\"name\":\"index\",\"meta\":{\"title\":\"应用管理\",\"icon\":\"el-icon-s-goods\"}}]}]', '2022-02-24 21:03:07', '2022-01-07 14:56:23');
+INSERT INTO `gm_role` VALUES (1, 'admin', '超级管理员', '[{\"path\":\"/behavior-analysis\",\"component\":\"layout\",\"redirect\":\"/behavior-analysis/index\",\"alwaysShow\":false,\"meta\":{\"title\":\"行为分析\",\"icon\":\"el-icon-link\"},\"children\":[{\"path\":\"event/:id\",\"component\":\"views/behavior-analysis/event\",\"name\":\"event\",\"meta\":{\"title\":\"事件分析\",\"dynamic\":true,\"icon\":\"el-icon-data-line\"}},{\"path\":\"retention/:id\",\"component\":\"views/behavior-analysis/retention\",\"name\":\"retention\",\"meta\":{\"title\":\"留存分析\",\"dynamic\":true,\"icon\":\"el-icon-data-analysis\"}},{\"path\":\"funnel/:id\",\"component\":\"views/behavior-analysis/funnel\",\"name\":\"funnel\",\"meta\":{\"title\":\"漏斗分析\",\"dynamic\":true,\"icon\":\"el-icon-data-board\"}},{\"path\":\"trace/:id\",\"component\":\"views/behavior-analysis/trace\",\"name\":\"trace\",\"meta\":{\"title\":\"智能路径分析\",\"dynamic\":true,\"icon\":\"el-icon-bicycle\"}},{\"path\":\"lifecycle\",\"component\":\"views/behavior-analysis/lifecycle\",\"name\":\"lifecycle\",\"meta\":{\"title\":\"生命周期分析\",\"icon\":\"el-icon-refresh\"}},{\"path\":\"interval\",\"component\":\"views/behavior-analysis/interval\",\"name\":\"interval\",\"meta\":{\"title\":\"间隔分析\",\"icon\":\"el-icon-time\"}},{\"path\":\"distribution\",\"component\":\"views/behavior-analysis/distribution\",\"name\":\"distribution\",\"meta\":{\"title\":\"分布分析\",\"icon\":\"el-icon-s-data\"}},{\"path\":\"ltv/:id\",\"component\":\"views/behavior-analysis/ltv\",\"name\":\"ltv\",\"meta\":{\"title\":\"LTV分析\",\"dynamic\":true,\"icon\":\"el-icon-money\"}},{\"path\":\"attribution\",\"component\":\"views/behavior-analysis/attribution\",\"name\":\"attribution\",\"meta\":{\"title\":\"归因分析\",\"icon\":\"el-icon-aim\"}}]},{\"path\":\"/user-analysis\",\"component\":\"layout\",\"redirect\":\"/user-analysis/attr\",\"alwaysShow\":false,\"meta\":{\"title\":\"用户分析\",\"icon\":\"el-icon-pie-chart\"},\"children\":[{\"path\":\"attr/:id\",\"component\":\"views/user-analysis/index\",\"name\":\"attr\",\"meta\":{\"title\":\"用户属性分析\",\"dynamic\":true,\"icon\":\"el-icon-s-custom\"}},{\"path\":\"group\",\"component\":\"views/user-analysis/group\",\"name\":\"group\",\"meta\":{\"title\":\"用户分群\",\"icon\":\"el-icon-user\"}},{\"isInside\":true,\"path\":\"user_list\",\"component\":\"views/user-analysis/user_list\",\"name\":\"user_list\",\"meta\":{\"title\":\"用户列表\",\"icon\":\"el-icon-user-solid\"}},{\"isInside\":true,\"path\":\"user_info/:uid/:index\",\"component\":\"views/user-analysis/user_info\",\"name\":\"user_info\",\"meta\":{\"title\":\"用户事件详情\",\"dynamic\":true,\"icon\":\"el-icon-s-custom\"}}]},{\"path\":\"/manager\",\"component\":\"layout\",\"redirect\":\"/manager/event\",\"alwaysShow\":false,\"meta\":{\"title\":\"数据管理\",\"icon\":\"el-icon-edit\"},\"children\":[{\"path\":\"event\",\"component\":\"views/manager/event\",\"name\":\"event\",\"meta\":{\"title\":\"事件管理\",\"icon\":\"el-icon-s-management\"}},{\"path\":\"log\",\"component\":\"views/manager/log\",\"name\":\"log\",\"meta\":{\"title\":\"埋点管理\",\"icon\":\"el-icon-notebook-1\"}}]},{\"path\":\"/permission\",\"component\":\"layout\",\"redirect\":\"/permission/role\",\"alwaysShow\":true,\"meta\":{\"title\":\"权限\",\"icon\":\"el-icon-user-solid\"},\"children\":[{\"path\":\"role\",\"component\":\"views/permission/role\",\"name\":\"RolePermission\",\"meta\":{\"title\":\"角色管理\",\"icon\":\"el-icon-s-check\"}},{\"path\":\"user\",\"component\":\"views/permission/user\",\"name\":\"user\",\"meta\":{\"title\":\"用户管理\",\"icon\":\"el-icon-user\"}},{\"path\":\"operater_log\",\"component\":\"views/permission/operater_log\",\"name\":\"operater_log\",\"meta\":{\"title\":\"操作日志列表\",\"icon\":\"el-icon-s-order\"}},{\"path\":\"job\",\"component\":\"views/permission/job\",\"name\":\"job\",\"meta\":{\"title\":\"定时任务\",\"icon\":\"el-icon-alarm-clock\"}}]},{\"path\":\"/app\",\"component\":\"layout\",\"children\":[{\"path\":\"/app/app\",\"component\":\"views/app/index\",\"name\":\"index\",\"meta\":{\"title\":\"应用管理\",\"icon\":\"el-icon-s-goods\"}}]}]', '2022-02-24 21:03:07', '2022-01-07 14:56:23');
 DROP TABLE IF EXISTS `gm_user`;
 CREATE TABLE `gm_user`  (
   `id` int(11) NOT NULL AUTO_INCREMENT,
@@ -167,5 +167,200 @@ CREATE TABLE `user_group` (
   PRIMARY KEY (`id`),
   UNIQUE KEY `user_group_name` (`group_name`,`appid`) USING BTREE,
   KEY `user_group_appid` (`id`,`appid`) USING BTREE
-) ENGINE=InnoDB AUTO_INCREMENT=16 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci
+) ENGINE=InnoDB AUTO_INCREMENT=16 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `destination`;
+CREATE TABLE `destination` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '',
+  `event_names` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT '需要转发的事件名 逗号分隔 为空时转发所有事件',
+  `filter` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT '属性筛选条件 与分析模型的筛选条件格式相同',
+  `payload_template` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT '请求体模板 为空时转发原始数据',
+  `url` varchar(1024) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '',
+  `headers` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT '自定义请求头 json对象',
+  `secret` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '签名密钥 为空时不签名',
+  `timeout` int(11) NOT NULL DEFAULT '5000' COMMENT '请求超时时间 单位毫秒',
+  `max_retries` int(11) NOT NULL DEFAULT '3',
+  `retry_interval` int(11) NOT NULL DEFAULT '1000' COMMENT '首次重试间隔 单位毫秒 之后每次翻倍',
+  `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1启用 0停用',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `destination_name` (`name`,`appid`) USING BTREE,
+  KEY `destination_appid` (`appid`,`status`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `pii_rule`;
+CREATE TABLE `pii_rule` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '',
+  `match_type` varchar(32) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT 'name' COMMENT 'name按属性名匹配 regex按属性名正则匹配',
+  `pattern` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '',
+  `action` varchar(32) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT 'drop删除 hash加盐哈希 truncate_ip截断ip mask部分遮盖',
+  `keep_prefix` int(11) NOT NULL DEFAULT '0' COMMENT 'mask时保留的前缀长度',
+  `keep_suffix` int(11) NOT NULL DEFAULT '0' COMMENT 'mask时保留的后缀长度',
+  `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1启用 0停用',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `pii_rule_name` (`name`,`appid`) USING BTREE,
+  KEY `pii_rule_appid` (`appid`,`status`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `pii_salt`;
+CREATE TABLE `pii_salt` (
+  `appid` int(11) NOT NULL,
+  `salt` varchar(64) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`appid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `virtual_attr`;
+CREATE TABLE `virtual_attr` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `attribute_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '属性名',
+  `show_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '显示名',
+  `expression` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT 'clickhouse表达式',
+  `data_type` int(11) NOT NULL DEFAULT '0' COMMENT '保存时根据表达式推断的数据类型',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `virtual_attr_name` (`attribute_name`,`appid`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `virtual_event`;
+CREATE TABLE `virtual_event` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `event_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '事件名',
+  `show_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '显示名',
+  `definition` text COLLATE utf8mb4_german2_ci NOT NULL COMMENT '组成的事件及筛选条件 json数组',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `virtual_event_name` (`event_name`,`appid`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `attr_dict`;
+CREATE TABLE `attr_dict` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `attribute_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '属性名',
+  `source_type` varchar(20) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT 'csv' COMMENT '来源 csv:上传 url:定时同步',
+  `url` varchar(1024) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '同步地址',
+  `sync_interval` int(11) NOT NULL DEFAULT '0' COMMENT '同步间隔(分钟)',
+  `item_count` int(11) NOT NULL DEFAULT '0' COMMENT '字典条数',
+  `last_sync_time` timestamp NULL DEFAULT NULL COMMENT '上次同步时间',
+  `last_sync_error` varchar(1024) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '上次同步错误',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `attr_dict_name` (`attribute_name`,`appid`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `tracking_plan`;
+CREATE TABLE `tracking_plan` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `enforce_mode` tinyint(4) NOT NULL DEFAULT '0' COMMENT '校验方式 0:不校验 1:记录不合规数据 2:丢弃不合规数据',
+  `version` int(11) NOT NULL DEFAULT '0' COMMENT '生效的版本号',
+  `update_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `tracking_plan_appid` (`appid`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `tracking_plan_version`;
+CREATE TABLE `tracking_plan_version` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `version` int(11) NOT NULL DEFAULT '0' COMMENT '版本号',
+  `content` mediumtext COLLATE utf8mb4_german2_ci NOT NULL COMMENT '埋点方案 json',
+  `remark` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '版本说明',
+  `create_by` int(11) NOT NULL DEFAULT '0',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `tracking_plan_version_appid` (`appid`,`version`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `meta_event_daily`;
+CREATE TABLE `meta_event_daily` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `event_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '事件名',
+  `day` date NOT NULL COMMENT '日期',
+  `count` bigint(20) NOT NULL DEFAULT '0' COMMENT '当日上报量',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `meta_event_daily_day` (`appid`,`event_name`,`day`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `meta_event_stat`;
+CREATE TABLE `meta_event_stat` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `event_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '事件名',
+  `first_seen` datetime NOT NULL COMMENT '首次上报时间',
+  `last_seen` datetime NOT NULL COMMENT '最近上报时间',
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `meta_event_stat_name` (`appid`,`event_name`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `meta_attr_daily`;
+CREATE TABLE `meta_attr_daily` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `attribute_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '事件属性名',
+  `day` date NOT NULL COMMENT '日期',
+  `count` bigint(20) NOT NULL DEFAULT '0' COMMENT '当日该属性有值的上报量',
+  `total` bigint(20) NOT NULL DEFAULT '0' COMMENT '当日携带该属性的事件上报量',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `meta_attr_daily_day` (`appid`,`attribute_name`,`day`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `meta_attr_stat`;
+CREATE TABLE `meta_attr_stat` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `appid` int(11) NOT NULL DEFAULT '0',
+  `attribute_name` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '事件属性名',
+  `first_seen` datetime NOT NULL COMMENT '首次有值的上报时间',
+  `last_seen` datetime NOT NULL COMMENT '最近有值的上报时间',
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `meta_attr_stat_name` (`appid`,`attribute_name`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `job`;
+CREATE TABLE `job` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(64) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '任务名',
+  `remark` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '任务说明',
+  `spec` varchar(64) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT 'cron表达式',
+  `timeout` int(11) NOT NULL DEFAULT '0' COMMENT '超时时间 秒',
+  `retry` int(11) NOT NULL DEFAULT '0' COMMENT '失败重试次数',
+  `is_local` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否每个进程都执行 1为是 0为只在抢到锁的进程执行',
+  `cmd_name` varchar(64) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '注册该任务的服务',
+  `last_status` tinyint(4) NOT NULL DEFAULT '-1' COMMENT '最近执行状态 -1:未执行 0:执行中 1:成功 2:失败 3:超时',
+  `last_error` varchar(1024) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '最近执行错误',
+  `last_start_time` datetime DEFAULT NULL COMMENT '最近执行时间',
+  `last_duration` bigint(20) NOT NULL DEFAULT '0' COMMENT '最近执行耗时 毫秒',
+  `last_host` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '最近执行的进程',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `job_name` (`name`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci;
+DROP TABLE IF EXISTS `job_run`;
+CREATE TABLE `job_run` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `job_name` varchar(64) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '任务名',
+  `trigger_type` varchar(16) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '触发方式 cron:定时 manual:手动',
+  `trigger_by` int(11) NOT NULL DEFAULT '0' COMMENT '手动触发的用户',
+  `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '执行状态 0:执行中 1:成功 2:失败 3:超时',
+  `attempts` int(11) NOT NULL DEFAULT '0' COMMENT '执行次数 包含重试',
+  `error_msg` varchar(1024) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '错误信息',
+  `host` varchar(255) COLLATE utf8mb4_german2_ci NOT NULL DEFAULT '' COMMENT '执行的进程',
+  `start_time` datetime NOT NULL COMMENT '开始时间',
+  `end_time` datetime DEFAULT NULL COMMENT '结束时间',
+  `duration` bigint(20) NOT NULL DEFAULT '0' COMMENT '耗时 毫秒',
+  PRIMARY KEY (`id`),
+  KEY `job_run_name` (`job_name`,`id`) USING BTREE,
+  KEY `job_run_start_time` (`start_time`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_german2_ci
 
@@ -34,11 +34,11 @@ func main() {
 		application.WithConfigFileExt(configFileExt),
 		application.RegisterInitFnObserver(application.InitLogs),
 		application.RegisterInitFnObserver(application.InitMysql),
-		application.RegisterInitFnObserver(application.InitTask),
 		application.RegisterInitFnObserver(application.InitRbac),
 		application.RegisterInitFnObserver(application.InitOpenWinBrowser),
 		application.RegisterInitFnObserver(application.InitClickHouse),
 		application.RegisterInitFnObserver(application.InitRedisPool),
+		application.RegisterInitFnObserver(application.InitTask),
 		application.RegisterInitFnObserver(application.InitDebugSarama),
 	)
 
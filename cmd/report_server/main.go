@@ -4,24 +4,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net/http/pprof"
-	"time"
 
 	"github.com/1340691923/xwl_bi/application"
-	"github.com/1340691923/xwl_bi/controller"
-	"github.com/1340691923/xwl_bi/engine/db"
 	"github.com/1340691923/xwl_bi/engine/logs"
-	"github.com/1340691923/xwl_bi/middleware"
 	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/job"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
+	"github.com/1340691923/xwl_bi/router"
 	_ "github.com/ClickHouse/clickhouse-go"
-	"github.com/buaazp/fasthttprouter"
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/fasthttpadaptor"
 	"go.uber.org/zap"
 )
 
@@ -48,9 +43,8 @@ func main() {
 		application.WithConfigFileName(configFileName),
 		application.WithConfigFileExt(configFileExt),
 		application.RegisterInitFnObserver(application.InitLogs),
-		application.RegisterInitFnObserver(application.InitKafkaSyncProduce),
-		application.RegisterInitFnObserver(application.InitKafkaAsyncProduce),
 		application.RegisterInitFnObserver(application.InitRedisPool),
+		application.RegisterInitFnObserver(application.InitMsgProducer),
 		application.RegisterInitFnObserver(application.InitMysql),
 		application.RegisterInitFnObserver(application.InitClickHouse),
 		application.RegisterInitFnObserver(application.RefreshTableId),
@@ -66,82 +60,26 @@ func main() {
 
 	defer app.Close()
 
-	//获取kafka错误信息
-	go func() {
-		for {
-			select {
-			case err := <-db.KafkaASyncProducer.Errors():
-				logs.Logger.Error(" db.KafkaASyncProducer.Errors", zap.Error(err))
-				time.Sleep(time.Hour)
-			default:
-
-			}
-		}
-	}()
-
-	go sinker.ClearDimsCacheByTimeBylocal(time.Second * 20)
-
-	//定义路由
-	router := fasthttprouter.New()
-
-	router.GET("/debug/pprof/", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Index))
-	router.GET("/debug/pprof/cmdline", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Cmdline))
-	router.GET("/debug/pprof/profile", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Profile))
-	router.GET("/debug/pprof/symbol", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Symbol))
-	router.GET("/debug/pprof/trace", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Trace))
-	router.GET("/debug/pprof/allocs", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("allocs").ServeHTTP))
-	router.GET("/debug/pprof/block", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("block").ServeHTTP))
-	router.GET("/debug/pprof/goroutine", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("goroutine").ServeHTTP))
-	router.GET("/debug/pprof/heap", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("heap").ServeHTTP))
-	router.GET("/debug/pprof/mutex", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("mutex").ServeHTTP))
-	router.GET("/debug/pprof/threadcreate", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("threadcreate").ServeHTTP))
-	router.POST("/test", func(ctx *fasthttp.RequestCtx) {
-		ctx.WriteString(`{"code":0}`)
+	//定时清空表结构缓存
+	err = job.Register(&job.Job{
+		Name:         "report_clear_dims_cache",
+		Remark:       "清空上报服务表结构的本地缓存以及redis缓存",
+		Spec:         "@every 20s",
+		Local:        true,
+		QuietSuccess: true,
+		Fn: func(ctx context.Context) error {
+			sinker.ClearDimsCache()
+			return nil
+		},
 	})
-
-	router.GET("/GetWordParse", controller.GetWordParse)
-
-	//上报路由
-	//写着写着变成了flutter的嵌套语法哈哈哈
-	router.POST(
-		"/sync_json/:typ/:appid/:appkey/:eventName/:debug",
-		//过滤器:允许跨域，打印错误信息
-		middleware.Cors(
-			//过滤器:禁止黑名单UserAgent
-			middleware.WechatSpider(
-				controller.ReportController{}.ReportAction,
-			),
-		),
-	)
-
-	//创建上报服务
-	server := &fasthttp.Server{
-		Handler: router.Handler,
-	}
-
-	//响应读取超时事件
-	if model.GlobConfig.Report.ReadTimeout != 0 {
-		server.ReadTimeout = time.Duration(model.GlobConfig.Report.ReadTimeout) * time.Second
-	}
-
-	//写超时
-	if model.GlobConfig.Report.WriteTimeout != 0 {
-		server.WriteTimeout = time.Duration(model.GlobConfig.Report.WriteTimeout) * time.Second
-	}
-
-	//限制ip并发数
-	if model.GlobConfig.Report.MaxConnsPerIP != 0 {
-		server.MaxConnsPerIP = model.GlobConfig.Report.MaxConnsPerIP
-	}
-
-	//每个连接可以服务无限数量的请求
-	if model.GlobConfig.Report.MaxRequestsPerConn != 0 {
-		server.MaxRequestsPerConn = model.GlobConfig.Report.MaxRequestsPerConn
+	if err != nil {
+		logs.Logger.Error("数据系统 初始化失败", zap.Error(err))
+		panic(err)
 	}
+	job.Start()
 
-	if model.GlobConfig.Report.IdleTimeout != 0 {
-		server.IdleTimeout = time.Duration(model.GlobConfig.Report.IdleTimeout) * time.Second
-	}
+	//创建上报服务
+	server := router.InitReport()
 
 	go func() {
 		port := fmt.Sprintf(":%v", model.GlobConfig.Report.ReportPort)
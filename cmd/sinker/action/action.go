@@ -77,6 +77,18 @@ func MysqlConsumer() {
 	}
 }
 
+//属性被修改类型、归档或删除后清空已知属性缓存 让新上报的数据重新写入元数据
+func ClearMetaCache() {
+	MetaAttrRelationSet.Range(func(key, value interface{}) bool {
+		MetaAttrRelationSet.Delete(key)
+		return true
+	})
+	AttributeMap.Range(func(key, value interface{}) bool {
+		AttributeMap.Delete(key)
+		return true
+	})
+}
+
 func AddMetaEvent(kafkaData model.KafkaData) (err error) {
 	if kafkaData.ReportType == model.EventReportType {
 		b := bytes.Buffer{}
@@ -0,0 +1,422 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/cmd/sinker/action"
+	"github.com/1340691923/xwl_bi/cmd/sinker/geoip"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/consumer_data"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/destination"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/job"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/pii"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/tracking_plan"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.uber.org/zap"
+)
+
+//sinker 数据处理链路 sinker与allinone共用
+type Pipeline struct {
+	geoip *geoip.Geoip2
+	//实时数据仓库
+	realTimeWarehousing *consumer_data.RealTimeWarehousing
+	//上报状态
+	reportAcceptStatus *consumer_data.ReportAcceptStatus
+	//上报数据到clickhouse
+	reportData2CK *consumer_data.ReportData2CK
+	//事件转发投递日志
+	destinationLog *consumer_data.DestinationLog
+	//事件转发
+	destinationDispatcher *destination.Dispatcher
+	//消息流 kafka,redis stream或本地队列
+	realTimeDataSarama  sinker.ConsumerGroup
+	reportData2CKSarama sinker.ConsumerGroup
+	//事件转发使用独立的消费者组 转发慢时不影响入库
+	destinationSarama sinker.ConsumerGroup
+	//停止定时任务
+	stopJob func()
+}
+
+func NewPipeline(geoip2 *geoip.Geoip2) *Pipeline {
+	sinkerC := model.GlobConfig.Sinker
+	realTimeDataSarama := sinker.NewConsumerGroup()
+	destinationLog := consumer_data.NewDestinationLog(sinkerC.DestinationLog)
+	return &Pipeline{
+		geoip:                 geoip2,
+		realTimeWarehousing:   consumer_data.NewRealTimeWarehousing(sinkerC.RealTimeWarehousing),
+		reportAcceptStatus:    consumer_data.NewReportAcceptStatus(sinkerC.ReportAcceptStatus),
+		reportData2CK:         consumer_data.NewReportData2CK(sinkerC.ReportData2CK),
+		destinationLog:        destinationLog,
+		destinationDispatcher: destination.NewDispatcher(sinkerC.Destination, destinationLog),
+		realTimeDataSarama:    realTimeDataSarama,
+		reportData2CKSarama:   realTimeDataSarama.Clone(),
+		destinationSarama:     realTimeDataSarama.Clone(),
+	}
+}
+
+//初始化消费者并开始消费
+func (this *Pipeline) Start() (err error) {
+	//脱敏规则加载失败时不启动 避免原始数据入库
+	if err = pii.Refresh(); err != nil {
+		return
+	}
+	if err = tracking_plan.Refresh(); err != nil {
+		return
+	}
+
+	realTimeWarehousing := this.realTimeWarehousing
+	reportAcceptStatus := this.reportAcceptStatus
+	reportData2CK := this.reportData2CK
+	geoip2 := this.geoip
+
+	//开启协程，读取metaAttrRelationChan、attributeChan、metaEventChan通道，执行DDL操作
+	go action.MysqlConsumer()
+	err = job.Register(
+		&job.Job{
+			Name:         "sinker_clear_dims_cache",
+			Remark:       "清空sinker表结构的本地缓存以及redis缓存",
+			Spec:         "@every 30m",
+			Local:        true,
+			QuietSuccess: true,
+			Fn: func(ctx context.Context) error {
+				sinker.ClearDimsCache()
+				return nil
+			},
+		},
+		&job.Job{
+			Name:         "sinker_cache_version",
+			Remark:       "管理端修改表结构后清空sinker本地缓存",
+			Spec:         "@every 10s",
+			Local:        true,
+			QuietSuccess: true,
+			Fn: func(ctx context.Context) error {
+				return sinker.CheckCacheVersion(action.ClearMetaCache)
+			},
+		},
+	)
+	if err != nil {
+		return
+	}
+	this.stopJob = job.Start()
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	//初始化kafka
+	err = this.realTimeDataSarama.Init(
+		model.GlobConfig.Comm.Kafka.ReportTopicName,
+		model.GlobConfig.Comm.Kafka.RealTimeDataGroup,
+		func(msg model.InputMessage, markFn func()) {
+			//ETL
+			var kafkaData model.KafkaData
+			err = json.Unmarshal(msg.Value, &kafkaData)
+			fmt.Println("realTimeDataSarama.Init kafkaData = ", kafkaData)
+			if err != nil {
+				logs.Logger.Error("json.Unmarshal Err", zap.Error(err))
+				markFn()
+				return
+			}
+			appid, err := strconv.Atoi(kafkaData.TableId)
+			if err != nil {
+				logs.Logger.Error("strconv.Atoi(kafkaData.TableId) Err", zap.Error(err))
+				markFn()
+				return
+			}
+			//添加实时数据
+			err = realTimeWarehousing.Add(&consumer_data.RealTimeWarehousingData{
+				Appid:      int64(appid),
+				EventName:  kafkaData.EventName,
+				CreateTime: kafkaData.ReportTime,
+				Data:       pii.Apply(appid, kafkaData.ReqData),
+			})
+
+			if err != nil {
+				logs.Logger.Error("AddRealTimeData err", zap.Error(err))
+			}
+			markFn()
+
+		}, func() {})
+
+	if err != nil {
+		return
+	}
+
+	err = this.reportData2CKSarama.Init(
+		model.GlobConfig.Comm.Kafka.ReportTopicName,
+		model.GlobConfig.Comm.Kafka.ReportData2CKGroup,
+		func(msg model.InputMessage, markFn func()) {
+
+			var kafkaData model.KafkaData
+
+			err = json.Unmarshal(msg.Value, &kafkaData)
+			if err != nil {
+				logs.Logger.Error("json.Unmarshal Err", zap.Error(err))
+				markFn()
+				return
+			}
+			fmt.Println("reportData2CKSarama.Init kafkaData = ", kafkaData)
+
+			kafkaData.Offset = msg.Offset
+			kafkaData.ConsumptionTime = msg.Timestamp.Format(util.TimeFormat) //格式化时间
+
+			//获取tableid
+			tableId, _ := strconv.Atoi(kafkaData.TableId)
+
+			if kafkaData.Ip != "" {
+				kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_ip", kafkaData.Ip)
+			}
+
+			//埋点方案校验 需在脱敏前进行 脱敏后的值无法匹配枚举与取值范围
+			validator := tracking_plan.GetValidator(tableId)
+			violations := validator.Validate(kafkaData.ReportType, kafkaData.EventName, kafkaData.ReqData)
+
+			//敏感信息脱敏 之后的上报状态与入库数据都不再包含原始值
+			kafkaData.ReqData = pii.Apply(tableId, kafkaData.ReqData)
+
+			//gjson 获取json串里的值
+			gjsonArr := gjson.GetManyBytes(kafkaData.ReqData, "xwl_distinct_id", "xwl_client_time")
+
+			xwlDistinctId := gjsonArr[0].String()
+
+			xwlClientTime := gjsonArr[1].String()
+
+			if kafkaData.EventName == "" {
+				markFn()
+				return
+			}
+
+			//记录不合法信息
+			if xwlDistinctId == "" {
+				logs.Logger.Error("xwl_distinct_id 为空", zap.String("kafkaData.ReqData", util.Bytes2str(kafkaData.ReqData)))
+
+				var eventType = ""
+
+				switch kafkaData.ReportType {
+				case model.UserReportType:
+					eventType = "用户属性类型不合法"
+				case model.EventReportType:
+					eventType = "事件属性类型不合法"
+				}
+				reportAcceptStatus.Add(&consumer_data.ReportAcceptStatusData{
+					PartDate:       kafkaData.ReportTime,
+					TableId:        tableId,
+					ReportType:     eventType,
+					DataName:       kafkaData.EventName,
+					ErrorReason:    "xwl_distinct_id 不能为空",
+					ErrorHandling:  "丢弃数据",
+					ReportData:     util.Bytes2str(kafkaData.ReqData),
+					XwlKafkaOffset: kafkaData.Offset,
+					Status:         consumer_data.FailStatus,
+				})
+				markFn()
+				return
+			}
+
+			//不符合埋点方案 按应用设置丢弃或记录后入库
+			acceptStatus := &consumer_data.ReportAcceptStatusData{
+				PartDate:       kafkaData.ReportTime,
+				TableId:        tableId,
+				DataName:       kafkaData.EventName,
+				XwlKafkaOffset: kafkaData.Offset,
+				Status:         consumer_data.SuccessStatus,
+			}
+			if len(violations) > 0 {
+				acceptStatus.ReportType = kafkaData.GetReportTypeErr()
+				acceptStatus.ErrorReason = "不符合埋点方案:" + strings.Join(violations, ";")
+				acceptStatus.ReportData = util.Bytes2str(kafkaData.ReqData)
+				if validator.Mode == model.TrackingPlanModeReject {
+					acceptStatus.ErrorHandling = "丢弃数据"
+					acceptStatus.Status = consumer_data.FailStatus
+					reportAcceptStatus.Add(acceptStatus)
+					markFn()
+					return
+				}
+				acceptStatus.ErrorHandling = "保留数据"
+				acceptStatus.Status = consumer_data.WarnStatus
+			}
+
+			//通过ip设置地址信息
+			if kafkaData.Ip != "" {
+				province, city, err := geoip2.GetAreaFromIP(kafkaData.Ip)
+				if err != nil {
+					logs.Logger.Sugar().Errorf("err", err)
+				}
+				if province != "" {
+					kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_province", province)
+				}
+				if city != "" {
+					kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_city", city)
+				}
+			}
+			clinetT := util.Str2Time(xwlClientTime, util.TimeFormat)
+			serverT := util.Str2Time(kafkaData.ReportTime, util.TimeFormat)
+
+			//上报时间差
+			if math.Abs(serverT.Sub(clinetT).Minutes()) > 10 {
+				reportAcceptStatus.Add(&consumer_data.ReportAcceptStatusData{
+					PartDate:       kafkaData.ReportTime,
+					TableId:        tableId,
+					ReportType:     kafkaData.GetReportTypeErr(),
+					DataName:       kafkaData.EventName,
+					ErrorReason:    "客户端上报时间误差大于十分钟",
+					ErrorHandling:  "丢弃数据",
+					ReportData:     util.Bytes2str(kafkaData.ReqData),
+					XwlKafkaOffset: kafkaData.Offset,
+					Status:         consumer_data.FailStatus,
+				})
+				logs.Logger.Sugar().Errorf("客户端上报时间误差大于十分钟", xwlClientTime, kafkaData.ReportTime)
+				markFn()
+				return
+			}
+
+			//设置信息
+			kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_part_event", kafkaData.EventName)
+			kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_part_date", xwlClientTime)
+			kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_server_time", kafkaData.ReportTime)
+			kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_kafka_offset", msg.Offset)
+			kafkaData.ReqData, _ = sjson.SetBytes(kafkaData.ReqData, "xwl_kafka_partition", msg.Partition)
+			pp := parser.FastjsonParser{}
+
+			//metric = kafkaData.ReqData的 fastjson.Value类型
+			metric, err := pp.Parse(kafkaData.ReqData)
+			fmt.Println("metric = ", metric)
+
+			//解析开发者上报的json数据
+			if err != nil {
+				logs.Logger.Error("ParseKafkaData err", zap.Error(err))
+				markFn()
+				return
+			}
+
+			//生成表名 通过上报report_type判断时event还是user
+			tableName := kafkaData.GetTableName()
+
+			//新增表结构
+			if err := action.AddTableColumn(
+				kafkaData,
+				func(data consumer_data.ReportAcceptStatusData) { reportAcceptStatus.Add(&data) },
+				tableName,
+				metric,
+			); err != nil {
+				logs.Logger.Error("addTableColumn err", zap.String("tableName", tableName), zap.Error(err))
+				markFn()
+				return
+			}
+
+			//添加元数据
+			if err := action.AddMetaEvent(kafkaData); err != nil {
+				logs.Logger.Error("addMetaEvent err", zap.Error(err))
+			}
+
+			//入库成功
+			if err := reportAcceptStatus.Add(acceptStatus); err != nil {
+				logs.Logger.Error("reportAcceptStatus Add SuccessStatus err", zap.Error(err))
+			}
+			//添加数据到ck用于后台统计
+			if err := reportData2CK.Add(consumer_data.FastjsonMetricData{
+				TableName:      tableName,
+				FastjsonMetric: metric,
+			}); err != nil {
+				logs.Logger.Error("reportData2CK err", zap.Error(err))
+				markFn()
+				return
+			}
+			markFn()
+
+			//logs.Logger.Info("链路所花时长", zap.String("time", time.Now().Sub(startT).String()))
+
+		}, func() {})
+
+	if err != nil {
+		return
+	}
+
+	if err = this.startDestination(); err != nil {
+		return
+	}
+
+	go this.reportData2CKSarama.Run()
+	go this.realTimeDataSarama.Run()
+	go this.destinationSarama.Run()
+	return
+}
+
+//事件转发 只转发事件数据
+func (this *Pipeline) startDestination() (err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	dispatcher := this.destinationDispatcher
+
+	if err = dispatcher.Start(); err != nil {
+		return
+	}
+
+	return this.destinationSarama.Init(
+		model.GlobConfig.Comm.Kafka.ReportTopicName,
+		model.GlobConfig.Comm.Kafka.GetDestinationGroup(),
+		func(msg model.InputMessage, markFn func()) {
+			var kafkaData model.KafkaData
+			if err := json.Unmarshal(msg.Value, &kafkaData); err != nil {
+				logs.Logger.Error("json.Unmarshal Err", zap.Error(err))
+				dispatcher.Skip(msg.Partition, markFn)
+				return
+			}
+			if kafkaData.ReportType != model.EventReportType || kafkaData.EventName == "" {
+				dispatcher.Skip(msg.Partition, markFn)
+				return
+			}
+			appid, err := strconv.Atoi(kafkaData.TableId)
+			if err != nil {
+				logs.Logger.Error("strconv.Atoi(kafkaData.TableId) Err", zap.Error(err))
+				dispatcher.Skip(msg.Partition, markFn)
+				return
+			}
+			//敏感信息脱敏 转发与投递日志都不包含原始值
+			dispatcher.Dispatch(msg.Partition, appid, kafkaData.EventName, kafkaData.ReportTime, pii.Apply(appid, kafkaData.ReqData), markFn)
+		}, func() {})
+}
+
+//停止消费并将缓冲区数据全部写入
+func (this *Pipeline) Stop() {
+	if this.stopJob != nil {
+		this.stopJob()
+	}
+	//先停止投递 释放阻塞在待投递队列上的消费者
+	this.destinationDispatcher.Stop()
+	if err := this.destinationSarama.Stop(); err != nil {
+		logs.Logger.Sugar().Infof("destinationSarama 停止失败", err)
+	}
+	if err := this.reportData2CKSarama.Stop(); err != nil {
+		logs.Logger.Sugar().Infof("reportData2CKSarama 停止失败", err)
+	}
+	if err := this.realTimeDataSarama.Stop(); err != nil {
+		logs.Logger.Sugar().Infof("realTimeDataSarama 停止失败", err)
+	}
+	if err := this.reportData2CK.FlushAll(); err != nil {
+		logs.Logger.Sugar().Infof("清理 reportData2CK FlushAll 失败", err)
+	} else {
+		logs.Logger.Sugar().Infof("清理reportData2CK完毕")
+	}
+	if err := this.realTimeWarehousing.FlushAll(); err != nil {
+		logs.Logger.Sugar().Infof("清理 realTimeWarehousing 失败", err)
+	} else {
+		logs.Logger.Sugar().Infof("清理realTimeWarehousing 完毕")
+	}
+	if err := this.reportAcceptStatus.FlushAll(); err != nil {
+		logs.Logger.Sugar().Infof("清理 reportAcceptStatus 失败", err)
+	} else {
+		logs.Logger.Sugar().Infof("清理reportAcceptStatus 完毕")
+	}
+	if err := this.destinationLog.FlushAll(); err != nil {
+		logs.Logger.Sugar().Infof("清理 destinationLog 失败", err)
+	} else {
+		logs.Logger.Sugar().Infof("清理destinationLog 完毕")
+	}
+}
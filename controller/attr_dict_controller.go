@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/attr_dict"
+	"github.com/gofiber/fiber/v2"
+)
+
+//属性值字典
+type AttrDictController struct {
+	BaseController
+}
+
+//上传csv字典
+func (this AttrDictController) UploadAttrDict(ctx *fiber.Ctx) error {
+	var reqData request.UploadAttrDict
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := attrDictService.Upload(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//保存url同步配置
+func (this AttrDictController) SaveUrlAttrDict(ctx *fiber.Ctx) error {
+	var reqData request.UrlAttrDict
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := attrDictService.SaveUrl(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//立即同步url字典
+func (this AttrDictController) SyncAttrDict(ctx *fiber.Ctx) error {
+	var reqData request.AttrDictId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("字典ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := attrDictService.Sync(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除字典
+func (this AttrDictController) DeleteAttrDict(ctx *fiber.Ctx) error {
+	var reqData request.AttrDictId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("字典ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := attrDictService.Delete(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//字典列表
+func (this AttrDictController) AttrDictList(ctx *fiber.Ctx) error {
+	var reqData request.AttrDictId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := attrDictService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//字典内容
+func (this AttrDictController) AttrDictItems(ctx *fiber.Ctx) error {
+	var reqData request.AttrDictItems
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	attrDictService := attr_dict.AttrDictService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	items, count, err := attrDictService.Items(reqData)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, map[string]interface{}{"list": items, "count": count})
+}
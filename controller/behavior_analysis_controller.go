@@ -136,6 +136,23 @@ func (this BehaviorAnalysisController) FunnelList(ctx *fiber.Ctx) error {
 	return this.Success(ctx, response.SearchSuccess, res)
 }
 
+//漏斗流失用户去向查询
+func (this BehaviorAnalysisController) FunnelDropOffList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.FunnelDropOffCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
 //留存分析查询
 func (this BehaviorAnalysisController) RetentionList(ctx *fiber.Ctx) error {
 
@@ -153,6 +170,91 @@ func (this BehaviorAnalysisController) RetentionList(ctx *fiber.Ctx) error {
 	return this.Success(ctx, response.SearchSuccess, res)
 }
 
+//生命周期分析查询
+func (this BehaviorAnalysisController) LifecycleList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.LifecycleCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//间隔分析查询
+func (this BehaviorAnalysisController) IntervalList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.IntervalCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//分布分析查询
+func (this BehaviorAnalysisController) DistributionList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.DistributionCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//LTV分析查询
+func (this BehaviorAnalysisController) LtvList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.LtvCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//归因分析查询
+func (this BehaviorAnalysisController) AttributionList(ctx *fiber.Ctx) error {
+
+	i, err := analysis.NewAnalysisByCommand(analysis.AttributionCommand, ctx.Body())
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	res, err := analysis.GetAnalysisRes(i)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
 //用户属性分析查询
 func (this BehaviorAnalysisController) UserAttrList(ctx *fiber.Ctx) error {
 
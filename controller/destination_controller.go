@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/destination"
+	"github.com/gofiber/fiber/v2"
+)
+
+//事件转发
+type DestinationController struct {
+	BaseController
+}
+
+//新增事件转发
+func (this DestinationController) AddDestination(ctx *fiber.Ctx) error {
+	var reqData request.Destination
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := destinationService.Add(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//修改事件转发
+func (this DestinationController) ModifyDestination(ctx *fiber.Ctx) error {
+	var reqData request.Destination
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := destinationService.Modify(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//启用或停用事件转发
+func (this DestinationController) ModifyDestinationStatus(ctx *fiber.Ctx) error {
+	var reqData request.ModifyDestinationStatus
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("转发ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := destinationService.ModifyStatus(reqData.Id, reqData.Status); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除事件转发
+func (this DestinationController) DeleteDestination(ctx *fiber.Ctx) error {
+	var reqData request.DestinationId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("转发ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := destinationService.Delete(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//事件转发列表
+func (this DestinationController) DestinationList(ctx *fiber.Ctx) error {
+	var reqData request.DestinationId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := destinationService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//用示例数据测试事件转发
+func (this DestinationController) TestDestination(ctx *fiber.Ctx) error {
+	var reqData request.TestDestination
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("转发ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	result, err := destinationService.Test(reqData.Id, reqData.EventName, reqData.Data)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, result)
+}
+
+//事件转发投递日志
+func (this DestinationController) DestinationLogList(ctx *fiber.Ctx) error {
+	var reqData request.DestinationLogList
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	destinationService := destination.DestinationService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, count, err := destinationService.LogList(reqData)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, map[string]interface{}{"list": list, "count": count})
+}
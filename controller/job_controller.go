@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/job"
+	"github.com/gofiber/fiber/v2"
+)
+
+//定时任务
+type JobController struct {
+	BaseController
+}
+
+//任务列表
+func (this JobController) JobList(ctx *fiber.Ctx) error {
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	jobService := job.JobService{ManagerID: c.UserID}
+
+	list, err := jobService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//任务执行历史
+func (this JobController) JobRuns(ctx *fiber.Ctx) error {
+	var reqData request.JobRuns
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	jobService := job.JobService{ManagerID: c.UserID}
+
+	list, count, err := jobService.Runs(reqData)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, map[string]interface{}{"list": list, "count": count})
+}
+
+//手动触发任务
+func (this JobController) TriggerJob(ctx *fiber.Ctx) error {
+	var reqData request.JobName
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	jobService := job.JobService{ManagerID: c.UserID}
+
+	if err := jobService.Trigger(reqData.Name); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
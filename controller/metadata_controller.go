@@ -30,9 +30,6 @@ func (this MetaDataController) MetaEventList(ctx *fiber.Ctx) error {
 	appid := strconv.Itoa(reqData.Appid)
 
 	metaData := meta_data.MetaDataService{Appid: appid}
-	if err := metaData.UpdateYesterdayCount(); err != nil {
-		return this.Error(ctx, err)
-	}
 	res, err := metaData.MetaEventList()
 	if err != nil {
 		return this.Error(ctx, err)
@@ -212,3 +209,121 @@ func (this MetaDataController) GetAnalyseSelectOptions(ctx *fiber.Ctx) error {
 	}
 	return this.Success(ctx, response.SearchSuccess, res)
 }
+
+//修改属性类型
+func (this MetaDataController) RetypeAttr(ctx *fiber.Ctx) error {
+
+	var reqData request.RetypeAttrReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	if err := metaData.RetypeAttr(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//查看属性类型转换进度
+func (this MetaDataController) AttrRetypeProgress(ctx *fiber.Ctx) error {
+
+	var reqData request.AttrRetypeProgressReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	res, err := metaData.RetypeProgress(reqData)
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//归档属性
+func (this MetaDataController) ArchiveAttr(ctx *fiber.Ctx) error {
+
+	var reqData request.ArchiveAttrReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	if err := metaData.ArchiveAttr(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除属性
+func (this MetaDataController) DropAttr(ctx *fiber.Ctx) error {
+
+	var reqData request.DropAttrReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	if err := metaData.DropAttr(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if err := analysis.ClearCacheByAppid(fmt.Sprintf("%s_%d_%d_*", "GetValues", reqData.Appid, reqData.AttributeSource)); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//事件近30天上报量
+func (this MetaDataController) EventVolume(ctx *fiber.Ctx) error {
+
+	var reqData request.EventVolumeReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	res, err := metaData.EventVolume(reqData.EventName)
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
+
+//事件属性近30天上报量
+func (this MetaDataController) AttrVolume(ctx *fiber.Ctx) error {
+
+	var reqData request.AttrVolumeReq
+
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	metaData := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+
+	res, err := metaData.AttrVolume(reqData.AttributeName)
+
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
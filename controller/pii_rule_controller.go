@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/pii"
+	"github.com/gofiber/fiber/v2"
+)
+
+//敏感信息脱敏规则
+type PiiRuleController struct {
+	BaseController
+}
+
+//新增脱敏规则
+func (this PiiRuleController) AddPiiRule(ctx *fiber.Ctx) error {
+	var reqData request.PiiRule
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	piiRuleService := pii.PiiRuleService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := piiRuleService.Add(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//修改脱敏规则
+func (this PiiRuleController) ModifyPiiRule(ctx *fiber.Ctx) error {
+	var reqData request.PiiRule
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	piiRuleService := pii.PiiRuleService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := piiRuleService.Modify(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除脱敏规则
+func (this PiiRuleController) DeletePiiRule(ctx *fiber.Ctx) error {
+	var reqData request.PiiRuleId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("规则ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	piiRuleService := pii.PiiRuleService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := piiRuleService.Delete(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//脱敏规则列表
+func (this PiiRuleController) PiiRuleList(ctx *fiber.Ctx) error {
+	var reqData request.PiiRuleId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	piiRuleService := pii.PiiRuleService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := piiRuleService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//预览脱敏效果
+func (this PiiRuleController) PreviewPiiRule(ctx *fiber.Ctx) error {
+	var reqData request.PreviewPiiRule
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	piiRuleService := pii.PiiRuleService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	res, err := piiRuleService.Preview(reqData.Data)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, res)
+}
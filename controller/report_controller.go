@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,7 +12,9 @@ import (
 	"github.com/1340691923/xwl_bi/engine/logs"
 	"github.com/1340691923/xwl_bi/model"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/pii"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/report"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/tracking_plan"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
 	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
@@ -102,9 +105,13 @@ func (this ReportController) ReportAction(ctx *fasthttp.RequestCtx) {
 	if reportService.IsDebugUser(debug, xwlDistinctId, tableId) {
 		kafkaData := duck.GetkafkaData()
 
+		//调试数据会推送到管理后台 先脱敏
+		tableIdInt, _ := strconv.Atoi(tableId)
+		reportData := pii.Apply(tableIdInt, ctx.PostBody())
+
 		pp := parser.FastjsonParser{}
 
-		metric, debugErr := pp.Parse(kafkaData.ReqData)
+		metric, debugErr := pp.Parse(reportData)
 
 		if debugErr != nil {
 			logs.Logger.Error("parser.ParseKafkaData ", zap.Error(err))
@@ -121,7 +128,7 @@ func (this ReportController) ReportAction(ctx *fasthttp.RequestCtx) {
 		obj := metric.GetParseObject()
 		m := map[string]interface{}{
 			"data_name":   kafkaData.EventName,
-			"report_data": util.Bytes2str(ctx.PostBody()),
+			"report_data": util.Bytes2str(reportData),
 			"report_time": kafkaData.ReportTime,
 			"appid":       kafkaData.TableId,
 			"distinct_id": xwlDistinctId,
@@ -144,6 +151,17 @@ func (this ReportController) ReportAction(ctx *fasthttp.RequestCtx) {
 			}
 		}
 
+		//埋点方案校验 丢弃模式下与类型错误一样不入库
+		if validator := tracking_plan.GetValidator(tableIdInt); validator != nil {
+			if violations := validator.Validate(kafkaData.ReportType, kafkaData.EventName, ctx.PostBody()); len(violations) > 0 {
+				m["error_reason"] = "不符合埋点方案:" + strings.Join(violations, ";")
+				m["data_judge"] = eventType
+				if validator.Mode == model.TrackingPlanModeReject {
+					haveFailAttr = true
+				}
+			}
+		}
+
 		xwlUpdateTime := gjson.GetBytes(body, "xwl_update_time").String()
 		clinetT := util.Str2Time(xwlUpdateTime, util.TimeFormat)
 		serverT := util.Str2Time(kafkaData.ReportTime, util.TimeFormat)
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/tracking_plan"
+	"github.com/gofiber/fiber/v2"
+)
+
+//埋点方案
+type TrackingPlanController struct {
+	BaseController
+}
+
+//埋点方案详情
+func (this TrackingPlanController) TrackingPlanInfo(ctx *fiber.Ctx) error {
+	var reqData request.TrackingPlanVersion
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	info, err := trackingPlanService.Info(reqData.Version)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, info)
+}
+
+//导入埋点方案 生成新版本
+func (this TrackingPlanController) ImportTrackingPlan(ctx *fiber.Ctx) error {
+	var reqData request.ImportTrackingPlan
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := trackingPlanService.Import(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//导出埋点方案
+func (this TrackingPlanController) ExportTrackingPlan(ctx *fiber.Ctx) error {
+	var reqData request.ExportTrackingPlan
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	content, err := trackingPlanService.Export(reqData)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, map[string]interface{}{"content": content})
+}
+
+//埋点方案版本列表
+func (this TrackingPlanController) TrackingPlanVersions(ctx *fiber.Ctx) error {
+	var reqData request.TrackingPlanVersion
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := trackingPlanService.Versions()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//回滚到历史版本
+func (this TrackingPlanController) RollbackTrackingPlan(ctx *fiber.Ctx) error {
+	var reqData request.TrackingPlanVersion
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := trackingPlanService.Rollback(reqData.Version); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//设置校验方式
+func (this TrackingPlanController) SetTrackingPlanMode(ctx *fiber.Ctx) error {
+	var reqData request.TrackingPlanMode
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := trackingPlanService.SetMode(reqData.EnforceMode); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//埋点方案与实际上报数据的差异
+func (this TrackingPlanController) TrackingPlanDrift(ctx *fiber.Ctx) error {
+	var reqData request.TrackingPlanVersion
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	trackingPlanService := tracking_plan.TrackingPlanService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := trackingPlanService.Drift()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/virtual_attr"
+	"github.com/gofiber/fiber/v2"
+)
+
+//虚拟属性
+type VirtualAttrController struct {
+	BaseController
+}
+
+//新增虚拟属性
+func (this VirtualAttrController) AddVirtualAttr(ctx *fiber.Ctx) error {
+	var reqData request.VirtualAttr
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualAttrService := virtual_attr.VirtualAttrService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualAttrService.Add(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//修改虚拟属性
+func (this VirtualAttrController) ModifyVirtualAttr(ctx *fiber.Ctx) error {
+	var reqData request.VirtualAttr
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualAttrService := virtual_attr.VirtualAttrService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualAttrService.Modify(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除虚拟属性
+func (this VirtualAttrController) DeleteVirtualAttr(ctx *fiber.Ctx) error {
+	var reqData request.VirtualAttrId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("虚拟属性ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualAttrService := virtual_attr.VirtualAttrService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualAttrService.Delete(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//虚拟属性列表
+func (this VirtualAttrController) VirtualAttrList(ctx *fiber.Ctx) error {
+	var reqData request.VirtualAttrId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualAttrService := virtual_attr.VirtualAttrService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := virtualAttrService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
+
+//校验表达式并返回推断出的数据类型
+func (this VirtualAttrController) CheckVirtualAttr(ctx *fiber.Ctx) error {
+	var reqData request.CheckVirtualAttr
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualAttrService := virtual_attr.VirtualAttrService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	dataType, err := virtualAttrService.Check(reqData.Expression)
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, map[string]interface{}{"data_type": dataType})
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/jwt"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/virtual_event"
+	"github.com/gofiber/fiber/v2"
+)
+
+//虚拟事件
+type VirtualEventController struct {
+	BaseController
+}
+
+//新增虚拟事件
+func (this VirtualEventController) AddVirtualEvent(ctx *fiber.Ctx) error {
+	var reqData request.VirtualEvent
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualEventService := virtual_event.VirtualEventService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualEventService.Add(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//修改虚拟事件
+func (this VirtualEventController) ModifyVirtualEvent(ctx *fiber.Ctx) error {
+	var reqData request.VirtualEvent
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualEventService := virtual_event.VirtualEventService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualEventService.Modify(reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//删除虚拟事件
+func (this VirtualEventController) DeleteVirtualEvent(ctx *fiber.Ctx) error {
+	var reqData request.VirtualEventId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	if reqData.Id == 0 {
+		return this.Error(ctx, errors.New("虚拟事件ID不能为空"))
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualEventService := virtual_event.VirtualEventService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	if err := virtualEventService.Delete(reqData.Id); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.OperateSuccess, nil)
+}
+
+//虚拟事件列表
+func (this VirtualEventController) VirtualEventList(ctx *fiber.Ctx) error {
+	var reqData request.VirtualEventId
+	if err := ctx.BodyParser(&reqData); err != nil {
+		return this.Error(ctx, err)
+	}
+
+	c, _ := jwt.ParseToken(this.GetToken(ctx))
+
+	virtualEventService := virtual_event.VirtualEventService{
+		ManagerID: c.UserID,
+		Appid:     reqData.Appid,
+	}
+
+	list, err := virtualEventService.List()
+	if err != nil {
+		return this.Error(ctx, err)
+	}
+
+	return this.Success(ctx, response.SearchSuccess, list)
+}
@@ -6,27 +6,12 @@ import (
 	"time"
 )
 
-var KafkaSyncProducer sarama.SyncProducer
-var KafkaASyncProducer sarama.AsyncProducer
-
 var KafkaClient sarama.Client
 
-func NewKafkaSyncProduce(host []string, username, pwd string) (conn sarama.SyncProducer, err error) {
-
-	config := sarama.NewConfig()
+//config 由 sinker.GetSaramaProducerConfig 生成
+func NewKafkaSyncProduce(host []string, config *sarama.Config) (conn sarama.SyncProducer, err error) {
 
-	config.Producer.Return.Successes = true                   // 成功交付的消息将在success channel返回
-	config.Producer.RequiredAcks = sarama.WaitForAll          // 发送完数据需要leader和follow都确认
-	config.Producer.Partitioner = sarama.NewRandomPartitioner // 新选出一个partition
-
-	config.Version = sarama.V2_0_0_0
-
-	if username != "" && pwd != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = username
-		config.Net.SASL.Password = pwd
-		config.Net.SASL.Handshake = true
-	}
+	config.Producer.Return.Successes = true // 同步生产者必须开启
 
 	conn, err = sarama.NewSyncProducer(host, config)
 	if err != nil {
@@ -36,22 +21,8 @@ func NewKafkaSyncProduce(host []string, username, pwd string) (conn sarama.SyncP
 	return
 }
 
-func NewKafkaAsyncProduce(host []string, username, pwd string) (conn sarama.AsyncProducer, err error) {
-
-	config := sarama.NewConfig()
-
-	config.Producer.RequiredAcks = sarama.NoResponse                        // Only wait for the leader to ack
-	config.Producer.Compression = sarama.CompressionSnappy                  // Compress messages
-	config.Producer.Flush.Frequency = time.Duration(500) * time.Millisecond // Flush batches every 500ms 不分区
-	config.Producer.Partitioner = sarama.NewRandomPartitioner               // 新选出一个partition
-	config.Version = sarama.V2_0_0_0
-
-	if username != "" && pwd != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = username
-		config.Net.SASL.Password = pwd
-		config.Net.SASL.Handshake = true
-	}
+//config 由 sinker.GetSaramaProducerConfig 生成
+func NewKafkaAsyncProduce(host []string, config *sarama.Config) (conn sarama.AsyncProducer, err error) {
 
 	conn, err = sarama.NewAsyncProducer(host, config)
 	if err != nil {
@@ -60,3 +31,52 @@ func NewKafkaAsyncProduce(host []string, username, pwd string) (conn sarama.Asyn
 	}
 	return
 }
+
+//kafka同步生产者
+type KafkaSyncMqProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewKafkaSyncMqProducer(producer sarama.SyncProducer) *KafkaSyncMqProducer {
+	return &KafkaSyncMqProducer{producer: producer}
+}
+
+func (this *KafkaSyncMqProducer) Send(topic string, value []byte) (err error) {
+	_, _, err = this.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: time.Now(),
+	})
+	return
+}
+
+func (this *KafkaSyncMqProducer) Close() error {
+	return this.producer.Close()
+}
+
+//kafka异步生产者 发送失败的消息交给errFn处理
+type KafkaAsyncMqProducer struct {
+	producer sarama.AsyncProducer
+}
+
+func NewKafkaAsyncMqProducer(producer sarama.AsyncProducer, errFn func(err *sarama.ProducerError)) *KafkaAsyncMqProducer {
+	go func() {
+		for err := range producer.Errors() {
+			errFn(err)
+		}
+	}()
+	return &KafkaAsyncMqProducer{producer: producer}
+}
+
+func (this *KafkaAsyncMqProducer) Send(topic string, value []byte) (err error) {
+	this.producer.Input() <- &sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: time.Now(),
+	}
+	return
+}
+
+func (this *KafkaAsyncMqProducer) Close() error {
+	return this.producer.Close()
+}
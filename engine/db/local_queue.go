@@ -0,0 +1,438 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//单进程部署时替代kafka的本地持久化队列 由 application.InitMsgProducer 初始化
+var LocalMq *LocalQueue
+
+var ErrLocalQueueClosed = errors.New("local queue closed")
+var ErrLocalQueueBroken = errors.New("local queue broken")
+
+const (
+	localSegmentExt   = ".log"
+	localOffsetExt    = ".offset"
+	localRecordHeader = 12 //4字节长度 + 8字节毫秒时间戳
+)
+
+/*
+	本地持久化队列 每个topic一个目录
+	消息追加写入分段文件 {起始位置}.log
+	每个消费者组的消费位置保存在 {消费者组}.offset
+	所有消费者组都已消费完的分段文件会被删除
+*/
+type LocalQueue struct {
+	dir          string
+	segmentBytes int64
+	lock         sync.Mutex
+	topics       map[string]*localTopic
+	closed       bool
+	stopSync     chan struct{}
+	wgSync       sync.WaitGroup
+}
+
+type localTopic struct {
+	dir        string
+	lock       sync.RWMutex
+	segments   []int64
+	active     *os.File
+	activeBase int64
+	end        int64
+	notify     chan struct{}
+	offsets    map[string]int64
+	closed     bool
+	broken     bool //写入失败且无法截掉写了一半的消息 不再写入
+}
+
+//读取到的消息 Offset为消息在topic中的位置 Next为下一条消息的位置
+type LocalMessage struct {
+	Offset    int64
+	Next      int64
+	Value     []byte
+	Timestamp time.Time
+}
+
+//segmentBytes 单个分段文件的大小上限
+func OpenLocalQueue(dir string, segmentBytes int64) (q *LocalQueue, err error) {
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return
+	}
+	q = &LocalQueue{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		topics:       map[string]*localTopic{},
+		stopSync:     make(chan struct{}),
+	}
+	q.wgSync.Add(1)
+	go q.syncLoop(time.Second)
+	return
+}
+
+//定时刷盘
+func (this *LocalQueue) syncLoop(interval time.Duration) {
+	defer this.wgSync.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stopSync:
+			return
+		case <-ticker.C:
+			this.lock.Lock()
+			for _, t := range this.topics {
+				t.lock.Lock()
+				if t.active != nil {
+					t.active.Sync()
+				}
+				t.lock.Unlock()
+			}
+			this.lock.Unlock()
+		}
+	}
+}
+
+func (this *LocalQueue) topic(name string) (t *localTopic, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return nil, ErrLocalQueueClosed
+	}
+	if t, ok := this.topics[name]; ok {
+		return t, nil
+	}
+	if t, err = openLocalTopic(filepath.Join(this.dir, name)); err != nil {
+		return nil, err
+	}
+	this.topics[name] = t
+	return t, nil
+}
+
+func openLocalTopic(dir string) (t *localTopic, err error) {
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return
+	}
+	t = &localTopic{dir: dir, notify: make(chan struct{}), offsets: map[string]int64{}}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		name := f.Name()
+		switch {
+		case strings.HasSuffix(name, localSegmentExt):
+			base, err := strconv.ParseInt(strings.TrimSuffix(name, localSegmentExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			t.segments = append(t.segments, base)
+		case strings.HasSuffix(name, localOffsetExt):
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			offset, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+			t.offsets[strings.TrimSuffix(name, localOffsetExt)] = offset
+		}
+	}
+	sort.Slice(t.segments, func(i, j int) bool { return t.segments[i] < t.segments[j] })
+
+	if len(t.segments) == 0 {
+		t.segments = []int64{0}
+	}
+	t.activeBase = t.segments[len(t.segments)-1]
+	if t.active, err = os.OpenFile(t.segmentPath(t.activeBase), os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return
+	}
+	//进程异常退出时最后一条消息可能只写了一半 截掉
+	size, err := validLocalSegmentSize(t.active)
+	if err != nil {
+		return
+	}
+	if err = t.active.Truncate(size); err != nil {
+		return
+	}
+	if _, err = t.active.Seek(size, io.SeekStart); err != nil {
+		return
+	}
+	t.end = t.activeBase + size
+	return
+}
+
+func validLocalSegmentSize(f *os.File) (size int64, err error) {
+	header := make([]byte, localRecordHeader)
+	for {
+		if _, err = f.ReadAt(header, size); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return size, nil
+			}
+			return
+		}
+		l := int64(binary.BigEndian.Uint32(header[:4]))
+		stat, err := f.Stat()
+		if err != nil {
+			return size, err
+		}
+		if size+localRecordHeader+l > stat.Size() {
+			return size, nil
+		}
+		size += localRecordHeader + l
+	}
+}
+
+func (this *localTopic) segmentPath(base int64) string {
+	return filepath.Join(this.dir, fmt.Sprintf("%020d%s", base, localSegmentExt))
+}
+
+func (this *localTopic) offsetPath(group string) string {
+	return filepath.Join(this.dir, group+localOffsetExt)
+}
+
+func (this *localTopic) append(value []byte, segmentBytes int64) (err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.closed {
+		return ErrLocalQueueClosed
+	}
+	if this.broken {
+		return ErrLocalQueueBroken
+	}
+
+	if segmentBytes > 0 && this.end-this.activeBase >= segmentBytes {
+		if err = this.active.Sync(); err != nil {
+			return
+		}
+		this.active.Close()
+		this.activeBase = this.end
+		if this.active, err = os.OpenFile(this.segmentPath(this.activeBase), os.O_CREATE|os.O_RDWR, 0644); err != nil {
+			return
+		}
+		this.segments = append(this.segments, this.activeBase)
+	}
+
+	record := make([]byte, localRecordHeader+len(value))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(value)))
+	binary.BigEndian.PutUint64(record[4:localRecordHeader], uint64(time.Now().UnixMilli()))
+	copy(record[localRecordHeader:], value)
+
+	if _, err = this.active.Write(record); err != nil {
+		//截掉写了一半的消息 否则之后的消息位置与end不一致
+		size := this.end - this.activeBase
+		if truncErr := this.active.Truncate(size); truncErr != nil {
+			this.broken = true
+		} else if _, seekErr := this.active.Seek(size, io.SeekStart); seekErr != nil {
+			this.broken = true
+		}
+		return
+	}
+	this.end += int64(len(record))
+
+	//唤醒等待中的消费者
+	close(this.notify)
+	this.notify = make(chan struct{})
+	return
+}
+
+//读取offset处的消息 没有新消息时返回等待通道
+func (this *localTopic) read(offset int64) (msg *LocalMessage, wait chan struct{}, err error) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	if this.closed {
+		return nil, nil, ErrLocalQueueClosed
+	}
+	if offset >= this.end {
+		return nil, this.notify, nil
+	}
+
+	i := sort.Search(len(this.segments), func(i int) bool { return this.segments[i] > offset }) - 1
+	if i < 0 {
+		//位置所在的分段已被清理 从最早的分段开始
+		offset = this.segments[0]
+		i = 0
+	}
+	base := this.segments[i]
+
+	f, err := os.Open(this.segmentPath(base))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	header := make([]byte, localRecordHeader)
+	if _, err = f.ReadAt(header, offset-base); err != nil {
+		return
+	}
+	value := make([]byte, binary.BigEndian.Uint32(header[:4]))
+	if _, err = f.ReadAt(value, offset-base+localRecordHeader); err != nil {
+		return
+	}
+	msg = &LocalMessage{
+		Offset:    offset,
+		Next:      offset + localRecordHeader + int64(len(value)),
+		Value:     value,
+		Timestamp: time.UnixMilli(int64(binary.BigEndian.Uint64(header[4:localRecordHeader]))),
+	}
+	return
+}
+
+func (this *localTopic) commit(group string, offset int64) (err error) {
+	tmp := this.offsetPath(group) + ".tmp"
+	if err = ioutil.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0644); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, this.offsetPath(group)); err != nil {
+		return
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.offsets[group] = offset
+
+	//删除所有消费者组都已消费完的分段
+	min := this.end
+	for _, o := range this.offsets {
+		if o < min {
+			min = o
+		}
+	}
+	for len(this.segments) > 1 && this.segments[1] <= min {
+		if err = os.Remove(this.segmentPath(this.segments[0])); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		this.segments = this.segments[1:]
+	}
+	return nil
+}
+
+func (this *localTopic) close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	close(this.notify)
+	this.active.Sync()
+	return this.active.Close()
+}
+
+//实现MqProducer
+func (this *LocalQueue) Send(topic string, value []byte) (err error) {
+	t, err := this.topic(topic)
+	if err != nil {
+		return
+	}
+	return t.append(value, this.segmentBytes)
+}
+
+func (this *LocalQueue) Close() (err error) {
+	this.lock.Lock()
+	if this.closed {
+		this.lock.Unlock()
+		return nil
+	}
+	this.closed = true
+	this.lock.Unlock()
+
+	close(this.stopSync)
+	this.wgSync.Wait()
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, t := range this.topics {
+		if e := t.close(); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+//消费者组读取器 同一消费者组同一时间只应有一个读取器
+type LocalQueueReader struct {
+	topic     *localTopic
+	group     string
+	offset    int64
+	lock      sync.Mutex
+	committed int64
+	flushed   int64
+}
+
+func (this *LocalQueue) NewReader(topic, group string) (r *LocalQueueReader, err error) {
+	t, err := this.topic(topic)
+	if err != nil {
+		return
+	}
+	t.lock.RLock()
+	offset, ok := t.offsets[group]
+	if !ok {
+		//新消费者组从最早的消息开始消费
+		offset = t.segments[0]
+	}
+	t.lock.RUnlock()
+
+	if !ok {
+		if err = t.commit(group, offset); err != nil {
+			return
+		}
+	}
+	return &LocalQueueReader{topic: t, group: group, offset: offset, committed: offset, flushed: offset}, nil
+}
+
+//阻塞读取下一条消息
+func (this *LocalQueueReader) Next(ctx context.Context) (msg *LocalMessage, err error) {
+	for {
+		msg, wait, err := this.topic.read(this.offset)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			this.offset = msg.Next
+			return msg, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+//标记offset之前的消息已消费 由Flush持久化
+func (this *LocalQueueReader) Commit(offset int64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if offset > this.committed {
+		this.committed = offset
+	}
+}
+
+//持久化消费位置
+func (this *LocalQueueReader) Flush() (err error) {
+	this.lock.Lock()
+	committed := this.committed
+	this.lock.Unlock()
+
+	if committed == this.flushed {
+		return nil
+	}
+	if err = this.topic.commit(this.group, committed); err != nil {
+		return
+	}
+	this.flushed = committed
+	return
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//内存版redis 未配置redis地址时使用(例如单进程部署)
+//只实现了项目中用到的缓存命令: get set(nx ex px) setex del unlink hget hset hdel sadd srem sismember
+//以及CompareAndDelScript脚本的eval evalsha
+type memRedisStore struct {
+	lock    sync.Mutex
+	strings map[string]memRedisString
+	hashes  map[string]map[string][]byte
+	sets    map[string]map[string]struct{}
+	setNum  int
+}
+
+//锁的值一致时才删除 用于释放分布式锁 内存版redis只支持该脚本
+const CompareAndDelScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`
+
+var compareAndDelSha = func() string {
+	sum := sha1.Sum([]byte(CompareAndDelScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+type memRedisString struct {
+	val      []byte
+	expireAt time.Time
+}
+
+// NewMemRedisPool 新建一个内存版Redis连接池 所有连接共享同一份数据
+func NewMemRedisPool() *redis.Pool {
+	store := &memRedisStore{
+		strings: map[string]memRedisString{},
+		hashes:  map[string]map[string][]byte{},
+		sets:    map[string]map[string]struct{}{},
+	}
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &memRedisConn{store: store}, nil
+		},
+	}
+}
+
+type memRedisConn struct {
+	store   *memRedisStore
+	pending []memRedisReply
+}
+
+type memRedisReply struct {
+	reply interface{}
+	err   error
+}
+
+func (this *memRedisConn) Close() error {
+	return nil
+}
+
+func (this *memRedisConn) Err() error {
+	return nil
+}
+
+func (this *memRedisConn) Send(commandName string, args ...interface{}) error {
+	reply, err := this.Do(commandName, args...)
+	this.pending = append(this.pending, memRedisReply{reply: reply, err: err})
+	return nil
+}
+
+func (this *memRedisConn) Flush() error {
+	return nil
+}
+
+func (this *memRedisConn) Receive() (reply interface{}, err error) {
+	if len(this.pending) == 0 {
+		return nil, errors.New("mem redis: no pending reply")
+	}
+	r := this.pending[0]
+	this.pending = this.pending[1:]
+	return r.reply, r.err
+}
+
+func (this *memRedisConn) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	if commandName == "" {
+		return nil, nil
+	}
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = memRedisArg(arg)
+	}
+	return this.store.do(strings.ToLower(commandName), argv)
+}
+
+func memRedisArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (this *memRedisStore) do(cmd string, argv []string) (interface{}, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	switch cmd {
+	case "get":
+		if len(argv) != 1 {
+			return nil, memRedisArgErr(cmd)
+		}
+		s, ok := this.getString(argv[0])
+		if !ok {
+			return nil, nil
+		}
+		return s.val, nil
+	case "set", "setex":
+		var key, val string
+		var expireAt time.Time
+		if cmd == "set" {
+			if len(argv) < 2 {
+				return nil, memRedisArgErr(cmd)
+			}
+			key, val = argv[0], argv[1]
+			//支持 NX EX PX 选项 用于分布式锁
+			var nx bool
+			for i := 2; i < len(argv); i++ {
+				switch strings.ToLower(argv[i]) {
+				case "nx":
+					nx = true
+				case "ex", "px":
+					if i+1 >= len(argv) {
+						return nil, memRedisArgErr(cmd)
+					}
+					n, err := strconv.Atoi(argv[i+1])
+					if err != nil {
+						return nil, err
+					}
+					unit := time.Second
+					if strings.ToLower(argv[i]) == "px" {
+						unit = time.Millisecond
+					}
+					expireAt = time.Now().Add(time.Duration(n) * unit)
+					i++
+				default:
+					return nil, memRedisArgErr(cmd)
+				}
+			}
+			if _, ok := this.getString(key); ok && nx {
+				return nil, nil
+			}
+		} else {
+			if len(argv) != 3 {
+				return nil, memRedisArgErr(cmd)
+			}
+			seconds, err := strconv.Atoi(argv[1])
+			if err != nil {
+				return nil, err
+			}
+			key, val = argv[0], argv[2]
+			expireAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		this.strings[key] = memRedisString{val: []byte(val), expireAt: expireAt}
+		this.gcExpired()
+		return "OK", nil
+	case "del", "unlink":
+		var n int64
+		for _, key := range argv {
+			if _, ok := this.getString(key); ok {
+				n++
+			}
+			if _, ok := this.hashes[key]; ok {
+				n++
+			}
+			if _, ok := this.sets[key]; ok {
+				n++
+			}
+			delete(this.strings, key)
+			delete(this.hashes, key)
+			delete(this.sets, key)
+		}
+		return n, nil
+	case "hget":
+		if len(argv) != 2 {
+			return nil, memRedisArgErr(cmd)
+		}
+		val, ok := this.hashes[argv[0]][argv[1]]
+		if !ok {
+			return nil, nil
+		}
+		return val, nil
+	case "hset":
+		if len(argv) < 3 || len(argv)%2 != 1 {
+			return nil, memRedisArgErr(cmd)
+		}
+		h, ok := this.hashes[argv[0]]
+		if !ok {
+			h = map[string][]byte{}
+			this.hashes[argv[0]] = h
+		}
+		var n int64
+		for i := 1; i < len(argv); i += 2 {
+			if _, ok := h[argv[i]]; !ok {
+				n++
+			}
+			h[argv[i]] = []byte(argv[i+1])
+		}
+		return n, nil
+	case "hdel":
+		if len(argv) < 2 {
+			return nil, memRedisArgErr(cmd)
+		}
+		var n int64
+		for _, field := range argv[1:] {
+			if _, ok := this.hashes[argv[0]][field]; ok {
+				delete(this.hashes[argv[0]], field)
+				n++
+			}
+		}
+		return n, nil
+	case "sadd":
+		if len(argv) < 2 {
+			return nil, memRedisArgErr(cmd)
+		}
+		set, ok := this.sets[argv[0]]
+		if !ok {
+			set = map[string]struct{}{}
+			this.sets[argv[0]] = set
+		}
+		var n int64
+		for _, member := range argv[1:] {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				n++
+			}
+		}
+		return n, nil
+	case "srem":
+		if len(argv) < 2 {
+			return nil, memRedisArgErr(cmd)
+		}
+		var n int64
+		for _, member := range argv[1:] {
+			if _, ok := this.sets[argv[0]][member]; ok {
+				delete(this.sets[argv[0]], member)
+				n++
+			}
+		}
+		return n, nil
+	case "sismember":
+		if len(argv) != 2 {
+			return nil, memRedisArgErr(cmd)
+		}
+		if _, ok := this.sets[argv[0]][argv[1]]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "ping":
+		return "PONG", nil
+	case "eval", "evalsha":
+		//eval script numkeys key arg
+		if len(argv) != 4 || argv[1] != "1" {
+			return nil, memRedisArgErr(cmd)
+		}
+		if (cmd == "eval" && argv[0] != CompareAndDelScript) || (cmd == "evalsha" && argv[0] != compareAndDelSha) {
+			return nil, redis.Error("NOSCRIPT mem redis: 不支持的脚本")
+		}
+		s, ok := this.getString(argv[2])
+		if !ok || string(s.val) != argv[3] {
+			return int64(0), nil
+		}
+		delete(this.strings, argv[2])
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf("mem redis: 不支持的命令 %s", cmd)
+}
+
+func (this *memRedisStore) getString(key string) (s memRedisString, ok bool) {
+	s, ok = this.strings[key]
+	if ok && !s.expireAt.IsZero() && time.Now().After(s.expireAt) {
+		delete(this.strings, key)
+		return s, false
+	}
+	return
+}
+
+//每写入1000次清理一次过期key 防止只写不读的key常驻内存
+func (this *memRedisStore) gcExpired() {
+	this.setNum++
+	if this.setNum%1000 != 0 {
+		return
+	}
+	now := time.Now()
+	for key, s := range this.strings {
+		if !s.expireAt.IsZero() && now.After(s.expireAt) {
+			delete(this.strings, key)
+		}
+	}
+}
+
+func memRedisArgErr(cmd string) error {
+	return fmt.Errorf("mem redis: %s 参数个数错误", cmd)
+}
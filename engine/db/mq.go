@@ -0,0 +1,45 @@
+package db
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+//上报数据的消息生产者 由 application.InitMsgProducer 根据配置初始化
+var MsgProducer MqProducer
+
+//消息生产者 屏蔽kafka与redis stream的差异
+type MqProducer interface {
+	Send(topic string, value []byte) error
+	Close() error
+}
+
+//redis stream 生产者 每条消息只有一个value字段
+type RedisStreamProducer struct {
+	pool   *redis.Pool
+	maxLen int64
+}
+
+//maxLen 为stream近似最大长度 0为不限制
+func NewRedisStreamProducer(pool *redis.Pool, maxLen int64) *RedisStreamProducer {
+	return &RedisStreamProducer{pool: pool, maxLen: maxLen}
+}
+
+func (this *RedisStreamProducer) Send(topic string, value []byte) (err error) {
+	conn := this.pool.Get()
+	defer conn.Close()
+
+	args := redis.Args{topic}
+	if this.maxLen > 0 {
+		args = args.Add("MAXLEN", "~", this.maxLen)
+	}
+	args = args.Add("*", RedisStreamValueField, value)
+
+	_, err = conn.Do("XADD", args...)
+	return
+}
+
+func (this *RedisStreamProducer) Close() error {
+	return nil
+}
+
+const RedisStreamValueField = "value"
@@ -26,6 +26,7 @@ require (
 	github.com/tidwall/sjson v1.2.3
 	github.com/valyala/fasthttp v1.31.0
 	github.com/valyala/fastjson v1.6.3
+	github.com/xdg-go/scram v1.1.1
 	go.uber.org/zap v1.19.1
 	golang.org/x/text v0.3.7
 )
@@ -74,6 +75,8 @@ require (
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/stringprep v1.0.3 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
 	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5 // indirect
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	AttrDictSourceCsv = "csv"
+	AttrDictSourceUrl = "url"
+)
+
+//属性值字典 值=>显示名 字典内容存放在clickhouse的xwl_attr_dict表
+type AttrDict struct {
+	Id            int    `db:"id" json:"id"`
+	Appid         int    `db:"appid" json:"appid"`
+	AttributeName string `db:"attribute_name" json:"attribute_name"`
+	SourceType    string `db:"source_type" json:"source_type"`
+	Url           string `db:"url" json:"url"`
+	SyncInterval  int    `db:"sync_interval" json:"sync_interval"`
+	ItemCount     int    `db:"item_count" json:"item_count"`
+	LastSyncTime  string `db:"last_sync_time" json:"last_sync_time"`
+	LastSyncError string `db:"last_sync_error" json:"last_sync_error"`
+	CreateBy      int    `db:"create_by" json:"create_by"`
+	CreateTime    string `db:"create_time" json:"create_time"`
+	UpdateTime    string `db:"update_time" json:"update_time"`
+}
+
+const attrDictCols = "id,appid,attribute_name,source_type,url,sync_interval,item_count,ifnull(last_sync_time,'') as last_sync_time,last_sync_error,create_by,create_time,update_time"
+
+func (this *AttrDict) Insert(managerUid int32, appid int) (err error) {
+	res, err := db.SqlBuilder.
+		Insert("attr_dict").
+		SetMap(map[string]interface{}{
+			"appid":          appid,
+			"attribute_name": this.AttributeName,
+			"source_type":    this.SourceType,
+			"url":            this.Url,
+			"sync_interval":  this.SyncInterval,
+			"create_by":      managerUid,
+		}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("该属性已存在字典，请勿重复添加")
+		}
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	this.Id = int(id)
+	return nil
+}
+
+//属性名创建后不允许修改 需要换属性时删除后重新添加
+func (this *AttrDict) Modify(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("attr_dict").
+		SetMap(map[string]interface{}{
+			"source_type":   this.SourceType,
+			"url":           this.Url,
+			"sync_interval": this.SyncInterval,
+		}).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+//记录同步结果 失败时保留上次成功的条数
+func (this *AttrDict) UpdateSyncResult(itemCount int, syncErr error) (err error) {
+	setMap := map[string]interface{}{
+		"last_sync_time":  squirrel.Expr("now()"),
+		"last_sync_error": "",
+	}
+	if syncErr != nil {
+		errMsg := []rune(syncErr.Error())
+		if len(errMsg) > 1000 {
+			errMsg = errMsg[:1000]
+		}
+		setMap["last_sync_error"] = string(errMsg)
+	} else {
+		setMap["item_count"] = itemCount
+	}
+	_, err = db.SqlBuilder.
+		Update("attr_dict").
+		SetMap(setMap).
+		Where(db.Eq{"id": this.Id}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *AttrDict) Delete(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Delete("attr_dict").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *AttrDict) FindById(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(attrDictCols).
+		From("attr_dict").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(this, SQL, args...)
+	return
+}
+
+func (this *AttrDict) List(appid int) (list []AttrDict, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(attrDictCols).
+		From("attr_dict").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
+
+//到了同步时间的url字典
+func (this *AttrDict) DueList() (list []AttrDict, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(attrDictCols).
+		From("attr_dict").
+		Where(db.Eq{"source_type": AttrDictSourceUrl}).
+		Where("sync_interval > 0").
+		Where("(last_sync_time is null or last_sync_time <= date_sub(now(), interval sync_interval minute))").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	jsoniter "github.com/json-iterator/go"
 	"os"
+	"path/filepath"
 )
 
 var GlobConfig Config
@@ -23,9 +24,37 @@ type Config struct {
 		ClickHouse ClickHouseConfig `json:"clickhouse"`
 		Kafka      KafkaCfg         `json:"kafka"`
 		Redis      RedisConfig      `json:"redis"`
+		Mq         MqConfig         `json:"mq"`
 	} `json:"comm"`
 }
 
+const (
+	MqTypeKafka = "kafka"
+	MqTypeRedis = "redis"
+	MqTypeLocal = "local" //本地持久化队列 仅用于allinone单进程部署
+)
+
+//消息队列配置 topic与消费者组名称沿用kafka配置
+type MqConfig struct {
+	Type        string            `json:"type"` //kafka,redis,local 为空时默认kafka
+	RedisStream RedisStreamConfig `json:"redisStream"`
+	Local       LocalQueueConfig  `json:"local"`
+}
+
+//本地持久化队列配置
+type LocalQueueConfig struct {
+	Dir          string `json:"dir"`          //数据目录 为空时默认data/queue
+	SegmentBytes int64  `json:"segmentBytes"` //单个分段文件大小上限 为空时默认64MB
+}
+
+//redis stream 配置 连接沿用comm.redis
+type RedisStreamConfig struct {
+	MaxLen      int64 `json:"maxLen"`      //stream近似最大长度 0为不限制
+	BatchSize   int   `json:"batchSize"`   //单次XREADGROUP读取条数
+	BlockMs     int   `json:"blockMs"`     //XREADGROUP阻塞时长 单位毫秒
+	ClaimIdleMs int   `json:"claimIdleMs"` //pending消息空闲多久后被其他消费者认领 单位毫秒
+}
+
 type ManagerConfig struct {
 	Port              uint16 `json:"port"`              //铸龙分析系统http启动端口
 	CkQueryLimit      int    `json:"ckQueryLimit"`      //clickhouse 查询限流器阈值
@@ -35,10 +64,19 @@ type ManagerConfig struct {
 }
 
 type SinkerConfig struct {
-	ReportAcceptStatus  BatchConfig `json:"reportAcceptStatus"`
-	ReportData2CK       BatchConfig `json:"reportData2CK"`
-	RealTimeWarehousing BatchConfig `json:"realTimeWarehousing"`
-	PprofHttpPort       uint16      `json:"pprofHttpPort"`
+	ReportAcceptStatus  BatchConfig       `json:"reportAcceptStatus"`
+	ReportData2CK       BatchConfig       `json:"reportData2CK"`
+	RealTimeWarehousing BatchConfig       `json:"realTimeWarehousing"`
+	DestinationLog      BatchConfig       `json:"destinationLog"`
+	Destination         DestinationConfig `json:"destination"`
+	PprofHttpPort       uint16            `json:"pprofHttpPort"`
+}
+
+//事件转发配置
+type DestinationConfig struct {
+	Workers         int `json:"workers"`         //投递协程数
+	QueueSize       int `json:"queueSize"`       //待投递队列长度 队列满时只阻塞转发消费者组 不影响入库
+	RefreshInterval int `json:"refreshInterval"` //转发配置刷新间隔 单位秒
 }
 
 type RedisConfig struct {
@@ -108,18 +146,116 @@ func (this *Config) GetKafkaCfgProducerType() string {
 	return this.Comm.Kafka.ProducerType
 }
 
+func (this *Config) GetMqType() string {
+	if this.Comm.Mq.Type == "" {
+		return MqTypeKafka
+	}
+	return this.Comm.Mq.Type
+}
+
+func (this *RedisStreamConfig) GetBatchSize() int {
+	if this.BatchSize <= 0 {
+		return 100
+	}
+	return this.BatchSize
+}
+
+func (this *RedisStreamConfig) GetBlockMs() int {
+	if this.BlockMs <= 0 {
+		return 2000
+	}
+	return this.BlockMs
+}
+
+func (this *RedisStreamConfig) GetClaimIdleMs() int {
+	if this.ClaimIdleMs <= 0 {
+		return 60000
+	}
+	return this.ClaimIdleMs
+}
+
+func (this *KafkaCfg) GetDestinationGroup() string {
+	if this.DestinationGroup == "" {
+		return "destinationGroup"
+	}
+	return this.DestinationGroup
+}
+
+func (this *DestinationConfig) GetWorkers() int {
+	if this.Workers <= 0 {
+		return 10
+	}
+	return this.Workers
+}
+
+func (this *DestinationConfig) GetQueueSize() int {
+	if this.QueueSize <= 0 {
+		return 1000
+	}
+	return this.QueueSize
+}
+
+func (this *DestinationConfig) GetRefreshInterval() int {
+	if this.RefreshInterval <= 0 {
+		return 30
+	}
+	return this.RefreshInterval
+}
+
+func (this *LocalQueueConfig) GetDir() string {
+	if this.Dir == "" {
+		return filepath.Join("data", "queue")
+	}
+	return this.Dir
+}
+
+func (this *LocalQueueConfig) GetSegmentBytes() int64 {
+	if this.SegmentBytes <= 0 {
+		return 64 << 20
+	}
+	return this.SegmentBytes
+}
+
 type KafkaCfg struct {
-	NumPartitions      int32    `json:"numPartitions"`
-	Addresses          []string `json:"addresses"`
-	Username           string   `json:"username"`
-	Password           string   `json:"password"`
-	ReportTopicName    string   `json:"reportTopicName"`
-	ConsumerGroupName  string   `json:"consumerGroupName"`
-	RealTimeDataGroup  string   `json:"realTimeDataGroup"`
-	ReportData2CKGroup string   `json:"reportData2CKGroup"`
-	DebugDataTopicName string   `json:"debugDataTopicName"`
-	DebugDataGroup     string   `json:"debugDataGroup"`
-	ProducerType       string   `json:"producer_type"`
+	NumPartitions      int32            `json:"numPartitions"`
+	Addresses          []string         `json:"addresses"`
+	Username           string           `json:"username"`
+	Password           string           `json:"password"`
+	ReportTopicName    string           `json:"reportTopicName"`
+	ConsumerGroupName  string           `json:"consumerGroupName"`
+	RealTimeDataGroup  string           `json:"realTimeDataGroup"`
+	ReportData2CKGroup string           `json:"reportData2CKGroup"`
+	DestinationGroup   string           `json:"destinationGroup"` //事件转发消费者组 为空时默认destinationGroup
+	DebugDataTopicName string           `json:"debugDataTopicName"`
+	DebugDataGroup     string           `json:"debugDataGroup"`
+	ProducerType       string           `json:"producer_type"`
+	Version            string           `json:"version"`  //kafka协议版本 例如:2.0.0 为空时默认2.0.0
+	ClientID           string           `json:"clientId"` //客户端标识
+	Tls                KafkaTlsCfg      `json:"tls"`
+	Sasl               KafkaSaslCfg     `json:"sasl"`
+	Producer           KafkaProducerCfg `json:"producer"`
+}
+
+//kafka TLS配置
+type KafkaTlsCfg struct {
+	Enable             bool   `json:"enable"`
+	CaFile             string `json:"caFile"`   //自定义CA证书路径
+	CertFile           string `json:"certFile"` //客户端证书路径
+	KeyFile            string `json:"keyFile"`  //客户端私钥路径
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+//kafka SASL配置 用户名密码沿用KafkaCfg.Username KafkaCfg.Password
+type KafkaSaslCfg struct {
+	Mechanism string `json:"mechanism"` //PLAIN,SCRAM-SHA-256,SCRAM-SHA-512 为空时默认PLAIN
+}
+
+//kafka 生产者调优配置 为空时沿用同步/异步生产者各自的默认值
+type KafkaProducerCfg struct {
+	RequiredAcks   string `json:"requiredAcks"`   //none,leader,all
+	Compression    string `json:"compression"`    //none,gzip,snappy,lz4,zstd
+	Idempotent     bool   `json:"idempotent"`     //幂等生产 开启后requiredAcks强制为all
+	FlushFrequency int    `json:"flushFrequency"` //批量刷新间隔 单位毫秒
 }
 
 type BatchConfig struct {
@@ -127,7 +263,7 @@ type BatchConfig struct {
 	FlushInterval int `json:"flushInterval"`
 }
 
-//下载配置文件
+// 下载配置文件
 func DownloadConfigFile(fname string) (err error) {
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
 	var config Config
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+const (
+	DestinationDisable = 0
+	DestinationEnable  = 1
+)
+
+//事件转发目的地
+type Destination struct {
+	Id              int    `db:"id" json:"id"`
+	Appid           int    `db:"appid" json:"appid"`
+	Name            string `db:"name" json:"name"`
+	EventNames      string `db:"event_names" json:"event_names"`
+	Filter          string `db:"filter" json:"filter"`
+	PayloadTemplate string `db:"payload_template" json:"payload_template"`
+	Url             string `db:"url" json:"url"`
+	Headers         string `db:"headers" json:"headers"`
+	Secret          string `db:"secret" json:"secret"`
+	Timeout         int    `db:"timeout" json:"timeout"`
+	MaxRetries      int    `db:"max_retries" json:"max_retries"`
+	RetryInterval   int    `db:"retry_interval" json:"retry_interval"`
+	Status          int    `db:"status" json:"status"`
+	CreateBy        int    `db:"create_by" json:"create_by"`
+	CreateTime      string `db:"create_time" json:"create_time"`
+	UpdateTime      string `db:"update_time" json:"update_time"`
+}
+
+const destinationCols = "id,appid,name,event_names,filter,payload_template,url,headers,secret,timeout,max_retries,retry_interval,status,create_by,create_time,update_time"
+
+func (this *Destination) setMap() map[string]interface{} {
+	return map[string]interface{}{
+		"name":             this.Name,
+		"event_names":      this.EventNames,
+		"filter":           this.Filter,
+		"payload_template": this.PayloadTemplate,
+		"url":              this.Url,
+		"headers":          this.Headers,
+		"secret":           this.Secret,
+		"timeout":          this.Timeout,
+		"max_retries":      this.MaxRetries,
+		"retry_interval":   this.RetryInterval,
+		"status":           this.Status,
+	}
+}
+
+func (this *Destination) Insert(managerUid int32, appid int) (err error) {
+	setMap := this.setMap()
+	setMap["appid"] = appid
+	setMap["create_by"] = managerUid
+	_, err = db.SqlBuilder.
+		Insert("destination").
+		SetMap(setMap).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("转发名称重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+func (this *Destination) Modify(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("destination").
+		SetMap(this.setMap()).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("转发名称重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+func (this *Destination) ModifyStatus(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("destination").
+		SetMap(map[string]interface{}{"status": this.Status}).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *Destination) Delete(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Delete("destination").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *Destination) FindById(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(destinationCols).
+		From("destination").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	return db.Sqlx.Get(this, SQL, args...)
+}
+
+func (this *Destination) List(appid int) (list []Destination, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(destinationCols).
+		From("destination").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("id desc").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
+
+//所有应用已启用的转发配置 供sinker使用
+func (this *Destination) EnableList() (list []Destination, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(destinationCols).
+		From("destination").
+		Where(db.Eq{"status": DestinationEnable}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"github.com/1340691923/xwl_bi/engine/db"
+)
+
+//任务执行状态
+const (
+	JobRunNone    = -1 //从未执行
+	JobRunRunning = 0
+	JobRunSuccess = 1
+	JobRunFailed  = 2
+	JobRunTimeout = 3
+)
+
+//任务触发方式
+const (
+	JobTriggerCron   = "cron"
+	JobTriggerManual = "manual"
+)
+
+//定时任务 由各服务启动时注册 记录最近一次执行结果
+type Job struct {
+	Id            int    `db:"id" json:"id"`
+	Name          string `db:"name" json:"name"`
+	Remark        string `db:"remark" json:"remark"`
+	Spec          string `db:"spec" json:"spec"`
+	Timeout       int    `db:"timeout" json:"timeout"` //超时时间 秒
+	Retry         int    `db:"retry" json:"retry"`     //失败重试次数
+	IsLocal       int    `db:"is_local" json:"is_local"`
+	CmdName       string `db:"cmd_name" json:"cmd_name"` //注册该任务的服务
+	LastStatus    int    `db:"last_status" json:"last_status"`
+	LastError     string `db:"last_error" json:"last_error"`
+	LastStartTime string `db:"last_start_time" json:"last_start_time"`
+	LastDuration  int64  `db:"last_duration" json:"last_duration"` //毫秒
+	LastHost      string `db:"last_host" json:"last_host"`
+	UpdateTime    string `db:"update_time" json:"update_time"`
+}
+
+const jobCols = "id,name,remark,spec,timeout,retry,is_local,cmd_name,last_status,last_error,ifnull(last_start_time,'') as last_start_time,last_duration,last_host,update_time"
+
+//保存任务定义 不覆盖执行结果
+func (this *Job) Save() (err error) {
+	_, err = db.Sqlx.Exec(`insert into job(name,remark,spec,timeout,retry,is_local,cmd_name) values (?,?,?,?,?,?,?)
+		on duplicate key update remark = values(remark),spec = values(spec),timeout = values(timeout),retry = values(retry),is_local = values(is_local),cmd_name = values(cmd_name)`,
+		this.Name, this.Remark, this.Spec, this.Timeout, this.Retry, this.IsLocal, this.CmdName)
+	return
+}
+
+func (this *Job) List() (list []Job, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(jobCols).
+		From("job").
+		OrderBy("id asc").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
+
+//记录最近一次执行结果
+func (this *Job) UpdateLast(run *JobRun) (err error) {
+	_, err = db.SqlBuilder.
+		Update("job").
+		SetMap(map[string]interface{}{
+			"last_status":     run.Status,
+			"last_error":      run.ErrorMsg,
+			"last_start_time": run.StartTime,
+			"last_duration":   run.Duration,
+			"last_host":       run.Host,
+		}).
+		Where(db.Eq{"name": this.Name}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+//任务执行历史
+type JobRun struct {
+	Id          int    `db:"id" json:"id"`
+	JobName     string `db:"job_name" json:"job_name"`
+	TriggerType string `db:"trigger_type" json:"trigger_type"`
+	TriggerBy   int    `db:"trigger_by" json:"trigger_by"` //手动触发的用户id
+	Status      int    `db:"status" json:"status"`
+	Attempts    int    `db:"attempts" json:"attempts"`
+	ErrorMsg    string `db:"error_msg" json:"error_msg"`
+	Host        string `db:"host" json:"host"`
+	StartTime   string `db:"start_time" json:"start_time"`
+	EndTime     string `db:"end_time" json:"end_time"`
+	Duration    int64  `db:"duration" json:"duration"` //毫秒
+
+	FilterStatus *int `db:"-" json:"-"`
+}
+
+const JobRunCols = "id,job_name,trigger_type,trigger_by,status,attempts,error_msg,host,start_time,ifnull(end_time,'') as end_time,duration"
+
+func (this *JobRun) TableName() string {
+	return "job_run"
+}
+
+func (this *JobRun) ProcessSqlInsert(sqlA db.InsertBuilder) db.InsertBuilder {
+	return sqlA
+}
+
+func (this *JobRun) ProcessSqlUpdate(id int, sqlA db.UpdateBuilder) db.UpdateBuilder {
+	return sqlA
+}
+
+func (this *JobRun) ProcessSqlWhere(sqlA db.SelectBuilder) db.SelectBuilder {
+	if this.JobName != "" {
+		sqlA = sqlA.Where(db.Eq{"job_name": this.JobName})
+	}
+	if this.FilterStatus != nil {
+		sqlA = sqlA.Where(db.Eq{"status": *this.FilterStatus})
+	}
+	return sqlA
+}
+
+func (this *JobRun) columns() map[string]interface{} {
+	m := map[string]interface{}{
+		"job_name":     this.JobName,
+		"trigger_type": this.TriggerType,
+		"trigger_by":   this.TriggerBy,
+		"status":       this.Status,
+		"attempts":     this.Attempts,
+		"error_msg":    this.ErrorMsg,
+		"host":         this.Host,
+		"start_time":   this.StartTime,
+		"duration":     this.Duration,
+	}
+	if this.EndTime != "" {
+		m["end_time"] = this.EndTime
+	}
+	return m
+}
+
+func (this *JobRun) Insert() (err error) {
+	res, err := db.SqlBuilder.
+		Insert(this.TableName()).
+		SetMap(this.columns()).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	this.Id = int(id)
+	return
+}
+
+func (this *JobRun) Finish() (err error) {
+	_, err = db.SqlBuilder.
+		Update(this.TableName()).
+		SetMap(this.columns()).
+		Where(db.Eq{"id": this.Id}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+//清理过期的执行历史
+func (this *JobRun) Clean(before string) (n int64, err error) {
+	res, err := db.SqlBuilder.
+		Delete(this.TableName()).
+		Where(db.Lt{"start_time": before}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
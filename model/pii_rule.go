@@ -0,0 +1,142 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+const (
+	PiiRuleDisable = 0
+	PiiRuleEnable  = 1
+)
+
+//敏感信息脱敏规则
+type PiiRule struct {
+	Id         int    `db:"id" json:"id"`
+	Appid      int    `db:"appid" json:"appid"`
+	Name       string `db:"name" json:"name"`
+	MatchType  string `db:"match_type" json:"match_type"`
+	Pattern    string `db:"pattern" json:"pattern"`
+	Action     string `db:"action" json:"action"`
+	KeepPrefix int    `db:"keep_prefix" json:"keep_prefix"`
+	KeepSuffix int    `db:"keep_suffix" json:"keep_suffix"`
+	Status     int    `db:"status" json:"status"`
+	CreateBy   int    `db:"create_by" json:"create_by"`
+	CreateTime string `db:"create_time" json:"create_time"`
+	UpdateTime string `db:"update_time" json:"update_time"`
+}
+
+const piiRuleCols = "id,appid,name,match_type,pattern,action,keep_prefix,keep_suffix,status,create_by,create_time,update_time"
+
+func (this *PiiRule) setMap() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        this.Name,
+		"match_type":  this.MatchType,
+		"pattern":     this.Pattern,
+		"action":      this.Action,
+		"keep_prefix": this.KeepPrefix,
+		"keep_suffix": this.KeepSuffix,
+		"status":      this.Status,
+	}
+}
+
+func (this *PiiRule) Insert(managerUid int32, appid int) (err error) {
+	setMap := this.setMap()
+	setMap["appid"] = appid
+	setMap["create_by"] = managerUid
+	_, err = db.SqlBuilder.
+		Insert("pii_rule").
+		SetMap(setMap).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("规则名重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+func (this *PiiRule) Modify(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("pii_rule").
+		SetMap(this.setMap()).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("规则名重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+func (this *PiiRule) Delete(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Delete("pii_rule").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *PiiRule) List(appid int) (list []PiiRule, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(piiRuleCols).
+		From("pii_rule").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
+
+//所有应用已启用的规则 按id排序 同一属性命中多条规则时只生效第一条
+func (this *PiiRule) EnableList() (list []PiiRule, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(piiRuleCols).
+		From("pii_rule").
+		Where(db.Eq{"status": PiiRuleEnable}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
+
+type PiiSalt struct {
+	Appid int    `db:"appid" json:"appid"`
+	Salt  string `db:"salt" json:"salt"`
+}
+
+//获取应用的哈希盐 不存在时生成 生成后不再变化 保证同一个值的哈希结果稳定
+func (this *PiiSalt) GetOrCreate(appid int) (salt string, err error) {
+	err = db.Sqlx.Get(&salt, "select salt from pii_salt where appid = ?", appid)
+	if err == nil {
+		return
+	}
+	if err != sql.ErrNoRows {
+		return
+	}
+	_, err = db.Sqlx.Exec("insert ignore into pii_salt(appid,salt) values (?,?)", appid, util.MD5HexHash(util.Str2bytes(util.GetUUid())))
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(&salt, "select salt from pii_salt where appid = ?", appid)
+	return
+}
+
+func (this *PiiSalt) List() (list []PiiSalt, err error) {
+	err = db.Sqlx.Select(&list, "select appid,salt from pii_salt")
+	return
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"database/sql"
+	"github.com/1340691923/xwl_bi/engine/db"
+)
+
+const (
+	TrackingPlanModeOff    = 0
+	TrackingPlanModeReport = 1
+	TrackingPlanModeReject = 2
+)
+
+//应用的埋点方案设置 version为当前生效的版本
+type TrackingPlan struct {
+	Id          int    `db:"id" json:"id"`
+	Appid       int    `db:"appid" json:"appid"`
+	EnforceMode int    `db:"enforce_mode" json:"enforce_mode"`
+	Version     int    `db:"version" json:"version"`
+	UpdateBy    int    `db:"update_by" json:"update_by"`
+	CreateTime  string `db:"create_time" json:"create_time"`
+	UpdateTime  string `db:"update_time" json:"update_time"`
+}
+
+const trackingPlanCols = "id,appid,enforce_mode,version,update_by,create_time,update_time"
+
+//未配置过时返回零值
+func (this *TrackingPlan) Find(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(trackingPlanCols).
+		From("tracking_plan").
+		Where(db.Eq{"appid": appid}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(this, SQL, args...)
+	if err == sql.ErrNoRows {
+		*this = TrackingPlan{Appid: appid}
+		return nil
+	}
+	return
+}
+
+func (this *TrackingPlan) SetMode(managerUid int32, appid int, mode int) (err error) {
+	_, err = db.Sqlx.Exec(`insert into tracking_plan(appid,enforce_mode,update_by) values (?,?,?) 
+		on duplicate key update enforce_mode = values(enforce_mode),update_by = values(update_by)`, appid, mode, managerUid)
+	return
+}
+
+//开启了校验的应用及其生效版本的方案内容
+type TrackingPlanContent struct {
+	Appid       int    `db:"appid"`
+	EnforceMode int    `db:"enforce_mode"`
+	Content     string `db:"content"`
+}
+
+func (this *TrackingPlan) EnforceList() (list []TrackingPlanContent, err error) {
+	err = db.Sqlx.Select(&list, `select p.appid,p.enforce_mode,v.content from tracking_plan p 
+		inner join tracking_plan_version v on v.appid = p.appid and v.version = p.version 
+		where p.enforce_mode > ?`, TrackingPlanModeOff)
+	return
+}
+
+//埋点方案的历史版本 每次导入或修改都生成新版本
+type TrackingPlanVersion struct {
+	Id         int    `db:"id" json:"id"`
+	Appid      int    `db:"appid" json:"appid"`
+	Version    int    `db:"version" json:"version"`
+	Content    string `db:"content" json:"content,omitempty"`
+	Remark     string `db:"remark" json:"remark"`
+	CreateBy   int    `db:"create_by" json:"create_by"`
+	CreateTime string `db:"create_time" json:"create_time"`
+}
+
+//写入新版本并设为生效版本
+func (this *TrackingPlanVersion) Insert(managerUid int32, appid int) (err error) {
+	tx, err := db.Sqlx.Beginx()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	//锁住应用的方案设置 并发保存时版本号不会重复
+	if _, err = tx.Exec(`insert into tracking_plan(appid,update_by) values (?,?) 
+		on duplicate key update update_by = values(update_by)`, appid, managerUid); err != nil {
+		return
+	}
+	var version int
+	if err = tx.Get(&version, "select version from tracking_plan where appid = ? for update", appid); err != nil {
+		return
+	}
+	var maxVersion sql.NullInt64
+	if err = tx.Get(&maxVersion, "select max(version) from tracking_plan_version where appid = ?", appid); err != nil {
+		return
+	}
+	this.Version = int(maxVersion.Int64) + 1
+
+	if _, err = tx.Exec("insert into tracking_plan_version(appid,version,content,remark,create_by) values (?,?,?,?,?)",
+		appid, this.Version, this.Content, this.Remark, managerUid); err != nil {
+		return
+	}
+	if _, err = tx.Exec("update tracking_plan set version = ? where appid = ?", this.Version, appid); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func (this *TrackingPlanVersion) Find(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select("id,appid,version,content,remark,create_by,create_time").
+		From("tracking_plan_version").
+		Where(db.Eq{"appid": appid, "version": this.Version}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(this, SQL, args...)
+	return
+}
+
+//版本列表 不包含方案内容
+func (this *TrackingPlanVersion) List(appid int) (list []TrackingPlanVersion, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select("id,appid,version,remark,create_by,create_time").
+		From("tracking_plan_version").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("version desc").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//虚拟属性 由已有事件属性计算得出 不落库 分析时替换为表达式
+type VirtualAttr struct {
+	Id            int    `db:"id" json:"id"`
+	Appid         int    `db:"appid" json:"appid"`
+	AttributeName string `db:"attribute_name" json:"attribute_name"`
+	ShowName      string `db:"show_name" json:"show_name"`
+	Expression    string `db:"expression" json:"expression"`
+	DataType      int    `db:"data_type" json:"data_type"`
+	CreateBy      int    `db:"create_by" json:"create_by"`
+	CreateTime    string `db:"create_time" json:"create_time"`
+	UpdateTime    string `db:"update_time" json:"update_time"`
+}
+
+const virtualAttrCols = "id,appid,attribute_name,show_name,expression,data_type,create_by,create_time,update_time"
+
+func (this *VirtualAttr) Insert(managerUid int32, appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Insert("virtual_attr").
+		SetMap(map[string]interface{}{
+			"appid":          appid,
+			"attribute_name": this.AttributeName,
+			"show_name":      this.ShowName,
+			"expression":     this.Expression,
+			"data_type":      this.DataType,
+			"create_by":      managerUid,
+		}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("属性名重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+//属性名会被看板中保存的分析条件引用 创建后不允许修改
+func (this *VirtualAttr) Modify(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("virtual_attr").
+		SetMap(map[string]interface{}{
+			"show_name":  this.ShowName,
+			"expression": this.Expression,
+			"data_type":  this.DataType,
+		}).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *VirtualAttr) Delete(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Delete("virtual_attr").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *VirtualAttr) FindById(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(virtualAttrCols).
+		From("virtual_attr").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(this, SQL, args...)
+	return
+}
+
+func (this *VirtualAttr) List(appid int) (list []VirtualAttr, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(virtualAttrCols).
+		From("virtual_attr").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
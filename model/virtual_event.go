@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//虚拟事件 由若干事件及其筛选条件组合而成 分析时展开为对应的条件
+type VirtualEvent struct {
+	Id         int    `db:"id" json:"id"`
+	Appid      int    `db:"appid" json:"appid"`
+	EventName  string `db:"event_name" json:"event_name"`
+	ShowName   string `db:"show_name" json:"show_name"`
+	Definition string `db:"definition" json:"definition"` //[]request.VirtualEventItem的json
+	CreateBy   int    `db:"create_by" json:"create_by"`
+	CreateTime string `db:"create_time" json:"create_time"`
+	UpdateTime string `db:"update_time" json:"update_time"`
+}
+
+const virtualEventCols = "id,appid,event_name,show_name,definition,create_by,create_time,update_time"
+
+func (this *VirtualEvent) Insert(managerUid int32, appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Insert("virtual_event").
+		SetMap(map[string]interface{}{
+			"appid":      appid,
+			"event_name": this.EventName,
+			"show_name":  this.ShowName,
+			"definition": this.Definition,
+			"create_by":  managerUid,
+		}).
+		RunWith(db.Sqlx).
+		Exec()
+	if err != nil {
+		if util.IsMysqlRepeatError(err) {
+			return errors.New("事件名重复，请重新填写")
+		}
+		return err
+	}
+	return nil
+}
+
+//事件名会被看板中保存的分析条件引用 创建后不允许修改
+func (this *VirtualEvent) Modify(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Update("virtual_event").
+		SetMap(map[string]interface{}{
+			"show_name":  this.ShowName,
+			"definition": this.Definition,
+		}).
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *VirtualEvent) Delete(appid int) (err error) {
+	_, err = db.SqlBuilder.
+		Delete("virtual_event").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		RunWith(db.Sqlx).
+		Exec()
+	return
+}
+
+func (this *VirtualEvent) FindById(appid int) (err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(virtualEventCols).
+		From("virtual_event").
+		Where(db.Eq{"id": this.Id, "appid": appid}).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Get(this, SQL, args...)
+	return
+}
+
+func (this *VirtualEvent) List(appid int) (list []VirtualEvent, err error) {
+	SQL, args, err := db.SqlBuilder.
+		Select(virtualEventCols).
+		From("virtual_event").
+		Where(db.Eq{"appid": appid}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.Sqlx.Select(&list, SQL, args...)
+	return
+}
@@ -31,6 +31,7 @@ type AnalysisFilter struct {
 type Zhibiao struct {
 	EventName        string         `json:"eventName"`
 	EventNameDisplay string         `json:"eventNameDisplay"`
+	OrEventNames     []string       `json:"orEventNames"` //漏斗步骤的备选事件 触发其中任意一个即完成该步骤
 	Relation         AnalysisFilter `json:"relation"`
 }
 
@@ -44,6 +45,17 @@ type FunnelReqData struct {
 	Appid             int            `json:"appid"`
 	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
 	GroupBy           []string       `json:"groupBy"`
+	GroupByUser       []string       `json:"groupByUser"`      //按用户属性分组
+	GroupByUserGroup  []int          `json:"groupByUserGroup"` //按所属用户分群分组
+	GroupLimit        int            `json:"groupLimit"`       //最多展示的分组数 其余合并为其他
+	TrendType         string         `json:"trendType"`        //按天 按周 按月 查看转化趋势 为空时不计算
+	Mode              []string       `json:"mode"`             //漏斗模式 strict_order strict_deduplication strict_increase 可组合
+}
+
+type FunnelDropOffReqData struct {
+	FunnelReqData
+	Step      int      `json:"step"`      //在该步骤流失 即到达该步骤但未到达下一步骤
+	UserAttrs []string `json:"userAttrs"` //对比流失用户与转化用户的用户属性分布
 }
 
 type TraceReqData struct {
@@ -73,6 +85,93 @@ type RetentionReqData struct {
 	Appid             int            `json:"appid"`
 	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
 	GroupBy           []string       `json:"groupBy"`
+	GroupByUser       []string       `json:"groupByUser"`
+	GroupByUserGroup  []int          `json:"groupByUserGroup"`
+	GroupLimit        int            `json:"groupLimit"`
+	RetentionType     string         `json:"retentionType"`
+	Metric            []string       `json:"metric"` //回访事件的指标 [字段,计算方式]
+}
+
+type LifecycleReqData struct {
+	UserGroup         []int          `json:"userGroup"`
+	Zhibiao           Zhibiao        `json:"zhibiao"` //活跃事件
+	WhereFilter       AnalysisFilter `json:"whereFilter"`
+	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
+	WindowTimeFormat  string         `json:"windowTimeFormat"`
+	DormantTime       int            `json:"dormantTime"` //连续多少个周期未活跃视为沉默
+	Date              []string       `json:"date"`
+	Appid             int            `json:"appid"`
+}
+
+type IntervalReqData struct {
+	UserGroup         []int          `json:"userGroup"`
+	ZhibiaoArr        []Zhibiao      `json:"zhibiaoArr"` //起始事件与结束事件
+	WhereFilter       AnalysisFilter `json:"whereFilter"`
+	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
+	WindowTime        int            `json:"windowTime"` //最大间隔 超过的配对不计入
+	WindowTimeFormat  string         `json:"windowTimeFormat"`
+	IntervalType      string         `json:"intervalType"` //为空时只取每个用户的第一次起始事件 all为每次起始事件
+	Date              []string       `json:"date"`
+	Appid             int            `json:"appid"`
+	GroupBy           []string       `json:"groupBy"` //按起始事件属性分组
+	GroupByUser       []string       `json:"groupByUser"`
+	GroupByUserGroup  []int          `json:"groupByUserGroup"`
+	GroupLimit        int            `json:"groupLimit"`
+}
+
+type DistributionReqData struct {
+	UserGroup         []int          `json:"userGroup"`
+	Zhibiao           Zhibiao        `json:"zhibiao"`
+	MetricType        string         `json:"metricType"` //为空时为事件次数 sum为属性总和 days为活跃天数
+	MetricAttr        string         `json:"metricAttr"` //求和的属性
+	Bounds            []float64      `json:"bounds"`     //区间边界 为空时自动划分
+	WhereFilter       AnalysisFilter `json:"whereFilter"`
+	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
+	WindowTimeFormat  string         `json:"windowTimeFormat"` //合计 按天 按周 按月
+	Date              []string       `json:"date"`
+	Appid             int            `json:"appid"`
+	GroupBy           []string       `json:"groupBy"`
+	GroupByUser       []string       `json:"groupByUser"`
+	GroupByUserGroup  []int          `json:"groupByUserGroup"`
+	GroupLimit        int            `json:"groupLimit"`
+}
+
+type LtvReqData struct {
+	UserGroup         []int          `json:"userGroup"`
+	Zhibiao           Zhibiao        `json:"zhibiao"`    //付费事件
+	AmountAttr        string         `json:"amountAttr"` //付费金额属性
+	WhereFilter       AnalysisFilter `json:"whereFilter"`
+	WhereFilterByUser AnalysisFilter `json:"whereFilterByUser"`
+	WindowTime        int            `json:"windowTime"` //计算首次活跃之后的第0到第N天(周/月)
+	WindowTimeFormat  string         `json:"windowTimeFormat"`
+	Date              []string       `json:"date"`
+	Appid             int            `json:"appid"`
+	GroupBy           []string       `json:"groupBy"` //按首次活跃事件的属性分组
+	GroupByUser       []string       `json:"groupByUser"`
+	GroupByUserGroup  []int          `json:"groupByUserGroup"`
+	GroupLimit        int            `json:"groupLimit"`
+}
+
+type AttributionTouch struct {
+	EventName        string         `json:"eventName"`
+	EventNameDisplay string         `json:"eventNameDisplay"`
+	AttrName         string         `json:"attrName"` //归因属性 如广告活动 为空时按事件归因
+	Relation         AnalysisFilter `json:"relation"`
+}
+
+type AttributionReqData struct {
+	UserGroup         []int              `json:"userGroup"`
+	Zhibiao           Zhibiao            `json:"zhibiao"`    //目标转化事件
+	ValueAttr         string             `json:"valueAttr"`  //转化价值属性 为空时只计算转化次数
+	TouchArr          []AttributionTouch `json:"touchArr"`   //触点事件
+	Model             string             `json:"model"`      //first last linear decay position
+	WindowTime        int                `json:"windowTime"` //回溯窗口 转化之前该时间内的触点参与归因
+	WindowTimeFormat  string             `json:"windowTimeFormat"`
+	HalfLife          int                `json:"halfLife"` //时间衰减模型的半衰期 单位与回溯窗口相同
+	WhereFilter       AnalysisFilter     `json:"whereFilter"`
+	WhereFilterByUser AnalysisFilter     `json:"whereFilterByUser"`
+	Date              []string           `json:"date"`
+	Appid             int                `json:"appid"`
 }
 
 type FormulaDimension struct {
@@ -92,6 +191,8 @@ type EventZhibiao struct {
 	One               FormulaDimension `json:"one,omitempty"`
 	Two               FormulaDimension `json:"two,omitempty"`
 	DivisorNoGrouping bool             `json:"divisor_no_grouping"`
+	Transform         string           `json:"transform,omitempty"`       //指标变换 cumulative累计 moving移动平均 rolling滚动窗口去重
+	TransformWindow   int              `json:"transformWindow,omitempty"` //移动平均与滚动窗口包含的日期分组个数
 }
 
 type EventReqData struct {
@@ -103,6 +204,8 @@ type EventReqData struct {
 	Date              []string       `json:"date"`
 	WindowTimeFormat  string         `json:"windowTimeFormat"`
 	Appid             int            `json:"appid"`
+	CompareType       string         `json:"compareType"` //对比时段 为空时不对比 prev上一周期 week上周同期 month上月同期 year去年同期 custom自定义
+	CompareDate       []string       `json:"compareDate"` //自定义对比时段
 }
 
 type UserAttrReqData struct {
@@ -272,6 +375,45 @@ type UpdateAttrInvisibleReq struct {
 	Status          int    `json:"status"`
 }
 
+type RetypeAttrReq struct {
+	Appid           int    `json:"appid"`
+	AttributeSource int    `json:"attribute_source"`
+	AttributeName   string `json:"attribute_name"`
+	DataType        int    `json:"data_type"`
+	Confirm         string `json:"confirm"`
+}
+
+type ArchiveAttrReq struct {
+	Appid           int    `json:"appid"`
+	AttributeSource int    `json:"attribute_source"`
+	AttributeName   string `json:"attribute_name"`
+	Archive         bool   `json:"archive"`
+	Confirm         string `json:"confirm"`
+}
+
+type DropAttrReq struct {
+	Appid           int    `json:"appid"`
+	AttributeSource int    `json:"attribute_source"`
+	AttributeName   string `json:"attribute_name"`
+	Confirm         string `json:"confirm"`
+}
+
+type AttrRetypeProgressReq struct {
+	Appid           int    `json:"appid"`
+	AttributeSource int    `json:"attribute_source"`
+	AttributeName   string `json:"attribute_name"`
+}
+
+type EventVolumeReq struct {
+	Appid     int    `json:"appid"`
+	EventName string `json:"event_name"`
+}
+
+type AttrVolumeReq struct {
+	Appid         int    `json:"appid"`
+	AttributeName string `json:"attribute_name"`
+}
+
 type AttrManagerByMetaReq struct {
 	Appid     int    `json:"appid"`
 	Typ       int    `json:"typ"`
@@ -308,3 +450,167 @@ type GmOperaterLogList struct {
 	OperaterAction string   `json:"operater_action"`
 	Date           []string `json:"date"`
 }
+
+type JobRuns struct {
+	Page    int    `json:"page"`
+	Limit   int    `json:"limit"`
+	JobName string `json:"job_name"`
+	Status  *int   `json:"status"`
+}
+
+type JobName struct {
+	Name string `json:"name"`
+}
+
+type Destination struct {
+	Id              int               `json:"id"`
+	Appid           int               `json:"appid"`
+	Name            string            `json:"name"`
+	EventNames      []string          `json:"event_names"`
+	Filter          AnalysisFilter    `json:"filter"`
+	PayloadTemplate string            `json:"payload_template"`
+	Url             string            `json:"url"`
+	Headers         map[string]string `json:"headers"`
+	Secret          string            `json:"secret"`
+	Timeout         int               `json:"timeout"`
+	MaxRetries      int               `json:"max_retries"`
+	RetryInterval   int               `json:"retry_interval"`
+	Status          int               `json:"status"`
+}
+
+type DestinationId struct {
+	Id    int `json:"id"`
+	Appid int `json:"appid"`
+}
+
+type ModifyDestinationStatus struct {
+	Id     int `json:"id"`
+	Appid  int `json:"appid"`
+	Status int `json:"status"`
+}
+
+type TestDestination struct {
+	Id        int    `json:"id"`
+	Appid     int    `json:"appid"`
+	EventName string `json:"event_name"`
+	Data      string `json:"data"`
+}
+
+type DestinationLogList struct {
+	Appid         int      `json:"appid"`
+	DestinationId int      `json:"destination_id"`
+	Status        *int     `json:"status"`
+	Date          []string `json:"date"`
+	Page          int      `json:"page"`
+	PageSize      int      `json:"page_size"`
+}
+
+type PiiRule struct {
+	Id         int    `json:"id"`
+	Appid      int    `json:"appid"`
+	Name       string `json:"name"`
+	MatchType  string `json:"match_type"`
+	Pattern    string `json:"pattern"`
+	Action     string `json:"action"`
+	KeepPrefix int    `json:"keep_prefix"`
+	KeepSuffix int    `json:"keep_suffix"`
+	Status     int    `json:"status"`
+}
+
+type PiiRuleId struct {
+	Id    int `json:"id"`
+	Appid int `json:"appid"`
+}
+
+type PreviewPiiRule struct {
+	Appid int    `json:"appid"`
+	Data  string `json:"data"`
+}
+
+type VirtualAttr struct {
+	Id            int    `json:"id"`
+	Appid         int    `json:"appid"`
+	AttributeName string `json:"attribute_name"`
+	ShowName      string `json:"show_name"`
+	Expression    string `json:"expression"`
+}
+
+type VirtualAttrId struct {
+	Id    int `json:"id"`
+	Appid int `json:"appid"`
+}
+
+type CheckVirtualAttr struct {
+	Appid      int    `json:"appid"`
+	Expression string `json:"expression"`
+}
+
+//虚拟事件的组成部分 筛选条件为空时表示该事件的全部数据
+type VirtualEventItem struct {
+	EventName string         `json:"event_name"`
+	Filter    AnalysisFilter `json:"filter"`
+}
+
+type VirtualEvent struct {
+	Id        int                `json:"id"`
+	Appid     int                `json:"appid"`
+	EventName string             `json:"event_name"`
+	ShowName  string             `json:"show_name"`
+	Items     []VirtualEventItem `json:"items"`
+}
+
+type VirtualEventId struct {
+	Id    int `json:"id"`
+	Appid int `json:"appid"`
+}
+
+type UploadAttrDict struct {
+	Appid         int    `json:"appid"`
+	AttributeName string `json:"attribute_name"`
+	Csv           string `json:"csv"`
+}
+
+type UrlAttrDict struct {
+	Appid         int    `json:"appid"`
+	AttributeName string `json:"attribute_name"`
+	Url           string `json:"url"`
+	SyncInterval  int    `json:"sync_interval"`
+}
+
+type AttrDictId struct {
+	Id    int `json:"id"`
+	Appid int `json:"appid"`
+}
+
+type AttrDictItems struct {
+	Id       int    `json:"id"`
+	Appid    int    `json:"appid"`
+	Keyword  string `json:"keyword"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+//导入埋点方案 excel由前端转换为csv后导入
+type ImportTrackingPlan struct {
+	Appid   int    `json:"appid"`
+	Format  string `json:"format"`
+	Content string `json:"content"`
+	Remark  string `json:"remark"`
+}
+
+//version为0时表示当前生效的版本
+type ExportTrackingPlan struct {
+	Appid   int    `json:"appid"`
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type TrackingPlanVersion struct {
+	Appid   int `json:"appid"`
+	Version int `json:"version"`
+}
+
+type TrackingPlanMode struct {
+	Appid       int `json:"appid"`
+	EnforceMode int `json:"enforce_mode"`
+}
@@ -29,6 +29,36 @@ type MetaEventListRes struct {
 	EventName      string `json:"event_name" db:"event_name"`
 	ShowName       string `json:"show_name" db:"show_name"`
 	YesterdayCount string `json:"yesterday_count" db:"yesterday_count"`
+	IsVirtual      bool   `json:"is_virtual" db:"-"` //是否为虚拟事件
+	FirstSeen      string `json:"first_seen" db:"first_seen"`
+	LastSeen       string `json:"last_seen" db:"last_seen"`
+	IsNew          bool   `json:"is_new" db:"-"`     //最近24小时内首次上报
+	IsStopped      bool   `json:"is_stopped" db:"-"` //超过24小时未上报
+}
+
+//每日上报量
+type DailyVolume struct {
+	Day         string  `json:"day" db:"day"`
+	Count       int64   `json:"count" db:"count"`
+	Total       int64   `json:"total,omitempty" db:"total"`     //属性所属事件的上报量
+	NonNullRate float64 `json:"non_null_rate,omitempty" db:"-"` //属性有值比例
+}
+
+type EventVolumeRes struct {
+	EventName string        `json:"event_name"`
+	FirstSeen string        `json:"first_seen"`
+	LastSeen  string        `json:"last_seen"`
+	IsNew     bool          `json:"is_new"`
+	IsStopped bool          `json:"is_stopped"`
+	Days      []DailyVolume `json:"days"`
+}
+
+type AttrVolumeRes struct {
+	AttributeName string        `json:"attribute_name"`
+	FirstSeen     string        `json:"first_seen"`
+	LastSeen      string        `json:"last_seen"`
+	NonNullRate   float64       `json:"non_null_rate"` //近30天有值比例
+	Days          []DailyVolume `json:"days"`
 }
 
 type AttributeRes struct {
@@ -39,6 +69,18 @@ type AttributeRes struct {
 	DataTypeFormat  string `db:"-" json:"data_type_format"`            //数据类型
 	AttributeSource int    `json:"attribute_source" db:"attribute_source"`
 	Status          int    `json:"status"`
+	IsVirtual       bool   `db:"-" json:"is_virtual"` //是否为虚拟属性
+}
+
+//属性类型转换进度
+type AttrRetypeProgress struct {
+	Status     string `json:"status"`      //running 转换中 done 已完成 failed 失败 none 无转换任务
+	DataType   int    `json:"data_type"`   //目标类型
+	StartTime  int64  `json:"start_time"`  //开始时间
+	PartsToDo  int    `json:"parts_to_do"` //剩余待转换的数据块
+	PartsTotal int    `json:"parts_total"` //数据块总数
+	Progress   int    `json:"progress"`    //进度百分比
+	FailReason string `json:"fail_reason"`
 }
 
 type AttrCalcuSymbolData struct {
@@ -48,3 +90,16 @@ type AttrCalcuSymbolData struct {
 	AttributeType  int8   `db:"attribute_type" json:"attribute_type"` //默认为1 （1为预置属性，2为自定义属性）
 	DataTypeFormat string `db:"-" json:"data_type_format"`            //数据类型
 }
+
+type DestinationLogRes struct {
+	DestinationId int64  `json:"destination_id" db:"destination_id"`
+	CreateTime    string `json:"create_time" db:"create_date"`
+	EventName     string `json:"event_name" db:"event_name"`
+	Status        int32  `json:"status" db:"status"`
+	HttpStatus    int32  `json:"http_status" db:"http_status"`
+	Attempts      int32  `json:"attempts" db:"attempts"`
+	DurationMs    int64  `json:"duration_ms" db:"duration_ms"`
+	ErrorReason   string `json:"error_reason" db:"error_reason"`
+	RequestBody   string `json:"request_body" db:"request_body"`
+	ResponseBody  string `json:"response_body" db:"response_body"`
+}
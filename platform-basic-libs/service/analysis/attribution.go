@@ -0,0 +1,358 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//归因分析 将每次目标转化按归因模型分配给回溯窗口内的触点
+type Attribution struct {
+	sql           string
+	args          []interface{}
+	req           request.AttributionReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	touchCols     []string
+	valueCol      string
+}
+
+//归因模型
+const (
+	AttributionFirst    = "first"    //首次触点
+	AttributionLast     = "last"     //末次触点
+	AttributionLinear   = "linear"   //线性 各触点平均分配
+	AttributionDecay    = "decay"    //时间衰减 越接近转化的触点权重越高
+	AttributionPosition = "position" //位置 首末触点各40% 其余触点平分20%
+)
+
+const attributionTouchMax = 10
+
+//没有触点的转化
+const attributionDirect = "无触点转化"
+
+type AttributionRes struct {
+	EventName        string  `json:"event_name"`
+	EventNameDisplay string  `json:"event_name_display"`
+	AttrName         string  `json:"attr_name"`
+	Value            string  `json:"value"`
+	Conversions      float64 `json:"conversions"`      //归因的转化次数
+	ConversionValue  float64 `json:"conversion_value"` //归因的转化价值
+	Users            int     `json:"users"`            //转化用户数
+	Scale            float64 `json:"scale"`            //占全部转化的比例
+}
+
+type attributionRowRes struct {
+	TouchIndex      uint8   `db:"touch_index"`
+	TouchValue      string  `db:"touch_value"`
+	Conversions     float64 `db:"conversions"`
+	ConversionValue float64 `db:"conversion_value"`
+	Users           uint64  `db:"users"`
+}
+
+func (this *Attribution) GetList() (interface{}, error) {
+	SQL, args, err := this.GetExecSql()
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var resList []attributionRowRes
+	if err = db.ClickHouseSqlx.Select(&resList, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	//触点属性配置了字典时 属性值展示为显示名
+	labels := make([]map[string]string, len(this.req.TouchArr))
+	for index, touch := range this.req.TouchArr {
+		labels[index] = map[string]string{}
+		if touch.AttrName == "" || !this.attrDicts.Has(touch.AttrName) {
+			continue
+		}
+		values := []string{}
+		for _, v := range resList {
+			if int(v.TouchIndex) == index+1 && !util.InstrArr(values, v.TouchValue) {
+				values = append(values, v.TouchValue)
+			}
+		}
+		if labels[index], err = this.attrDicts.Labels(touch.AttrName, values); err != nil {
+			return nil, err
+		}
+	}
+
+	var conversions, conversionValue float64
+	for _, v := range resList {
+		conversions += v.Conversions
+		conversionValue += v.ConversionValue
+	}
+
+	list := []AttributionRes{}
+	direct := AttributionRes{EventNameDisplay: attributionDirect}
+	for _, v := range resList {
+		res := AttributionRes{
+			Value:           v.TouchValue,
+			Conversions:     v.Conversions,
+			ConversionValue: v.ConversionValue,
+			Users:           int(v.Users),
+		}
+		if conversions > 0 {
+			res.Scale = v.Conversions / conversions
+		}
+		if v.TouchIndex == 0 {
+			res.EventNameDisplay = attributionDirect
+			direct = res
+			continue
+		}
+		touch := this.req.TouchArr[v.TouchIndex-1]
+		res.EventName, res.EventNameDisplay, res.AttrName = touch.EventName, touch.EventNameDisplay, touch.AttrName
+		if label, ok := labels[v.TouchIndex-1][v.TouchValue]; ok {
+			res.Value = label
+		}
+		list = append(list, res)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Conversions > list[j].Conversions
+	})
+
+	return map[string]interface{}{
+		"list":             list,
+		"direct":           direct,
+		"conversions":      conversions,
+		"conversion_value": conversionValue,
+	}, nil
+}
+
+func (this *Attribution) eventCond(eventName string, relation request.AnalysisFilter) (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.virtualEvents.EventSql(eventName)
+	if err != nil {
+		return
+	}
+	if len(relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(relation)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " and " + sql
+		allArgs = append(allArgs, args...)
+	}
+	return
+}
+
+//每个用户一行 回溯窗口内按时间排序的触点 以及查询日期内的转化
+//同一事件同时满足多个触点时 归为序号最小的触点
+func (this *Attribution) eventUserSql() (SQL string, allArgs []interface{}, err error) {
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2).AddDate(0, 0, 1)
+	scanStartT := startT.Add(-time.Duration(this.req.WindowTime) * time.Second)
+
+	touchIndexArr := []string{}
+	touchValueArr := []string{}
+	eventNames := []string{this.req.Zhibiao.EventName}
+	for index, touch := range this.req.TouchArr {
+		cond, args, err := this.eventCond(touch.EventName, touch.Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		allArgs = append(allArgs, args...)
+		touchIndexArr = append(touchIndexArr, cond, strconv.Itoa(index+1))
+		valueSql := "''"
+		if this.touchCols[index] != "" {
+			valueSql = "ifNull(toString(" + this.touchCols[index] + "),'')"
+		}
+		touchValueArr = append(touchValueArr, "touch_index = "+strconv.Itoa(index+1), valueSql)
+		eventNames = append(eventNames, touch.EventName)
+	}
+
+	convSql, convArgs, err := this.eventCond(this.req.Zhibiao.EventName, this.req.Zhibiao.Relation)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, convArgs...)
+
+	valueSql := "toFloat64(0)"
+	if this.valueCol != "" {
+		valueSql = "toFloat64(ifNull(" + this.valueCol + ", 0))"
+	}
+
+	var userFilterSql string
+	var userFilterArgs []interface{}
+
+	if len(this.req.WhereFilterByUser.Filts) > 0 {
+		var colArr []string
+		var sql string
+		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
+		if err != nil {
+			return
+		}
+		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
+	}
+
+	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
+
+	partEventSql, partEventArgs, err := this.virtualEvents.EventInSql(eventNames)
+	if err != nil {
+		return
+	}
+
+	allArgs = append(allArgs, partEventArgs...)
+	allArgs = append(allArgs, whereFilterArgs...)
+	allArgs = append(allArgs, this.args...)
+	allArgs = append(allArgs, userFilterArgs...)
+
+	SQL = `SELECT xwl_distinct_id,
+				arraySort(x -> x.1, groupArrayIf(tuple(t, touch_index, touch_value), touch_index > 0)) AS touches,
+				groupArrayIf(tuple(t, conv_value), is_conv = 1 and t >= toUInt32(toDateTime('` + startT.Format(util.TimeFormat) + `'))) AS conversions
+			FROM (
+				SELECT xwl_distinct_id, toUInt32(xwl_part_date) AS t,
+					toUInt8(multiIf(` + strings.Join(touchIndexArr, ", ") + `, 0)) AS touch_index,
+					multiIf(` + strings.Join(touchValueArr, ", ") + `, '') AS touch_value,
+					toUInt8(` + convSql + `) AS is_conv,
+					` + valueSql + ` AS conv_value
+				FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+				prewhere xwl_part_date >= toDateTime('` + scanStartT.Format(util.TimeFormat) + `') and xwl_part_date < toDateTime('` + endT.Format(util.TimeFormat) + `') and ` + partEventSql + ` and ` + whereFilterSql + this.sql + ` ` + userFilterSql + `
+			)
+			GROUP BY xwl_distinct_id
+			HAVING length(conversions) > 0`
+	return
+}
+
+//每次转化中各触点的归因权重 权重之和为1
+func (this *Attribution) weightSql() string {
+	n := "length(conv_touches)"
+	switch this.req.Model {
+	case AttributionFirst:
+		return "arrayMap(i -> toFloat64(i = 1), arrayEnumerate(conv_touches))"
+	case AttributionLast:
+		return "arrayMap(i -> toFloat64(i = " + n + "), arrayEnumerate(conv_touches))"
+	case AttributionLinear:
+		return "arrayMap(i -> 1 / " + n + ", arrayEnumerate(conv_touches))"
+	case AttributionDecay:
+		decaySql := "arrayMap(x -> pow(0.5, (conv.1 - x.1) / " + strconv.Itoa(this.req.HalfLife) + "), conv_touches)"
+		return "arrayMap(w -> w / arraySum(" + decaySql + "), " + decaySql + ")"
+	}
+	return "arrayMap(i -> toFloat64(multiIf(" + n + " = 1, 1, " + n + " = 2, 0.5, i = 1 or i = " + n + ", 0.4, 0.2 / (" + n + " - 2))), arrayEnumerate(conv_touches))"
+}
+
+func (this *Attribution) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	eventUserSql, allArgs, err := this.eventUserSql()
+	if err != nil {
+		return
+	}
+
+	SQL = `SELECT touch.2 AS touch_index, touch.3 AS touch_value,
+				sum(weight) AS conversions, sum(weight * conv_value) AS conversion_value, uniqExact(xwl_distinct_id) AS users
+			FROM (
+				SELECT xwl_distinct_id, conv.2 AS conv_value,
+					if(empty(conv_touches), [tuple(toUInt32(0), toUInt8(0), '')], conv_touches) AS attributed_touches,
+					if(empty(conv_touches), [toFloat64(1)], ` + this.weightSql() + `) AS weights
+				FROM (
+					SELECT xwl_distinct_id, conv, arrayFilter(x -> x.1 <= conv.1 and x.1 + ` + strconv.Itoa(this.req.WindowTime) + ` >= conv.1, touches) AS conv_touches
+					FROM (` + eventUserSql + `)
+					ARRAY JOIN conversions AS conv
+				)
+			)
+			ARRAY JOIN attributed_touches AS touch, weights AS weight
+			GROUP BY touch_index, touch_value
+			ORDER BY conversions DESC`
+	return
+}
+
+func NewAttribution(reqData []byte) (Ianalysis, error) {
+	obj := &Attribution{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &obj.req)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.Date) < 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.Zhibiao.EventName == "" {
+		return nil, my_error.NewBusiness(ERROR_TABLE, EventNameEmptyError)
+	}
+	if len(obj.req.TouchArr) == 0 || len(obj.req.TouchArr) > attributionTouchMax {
+		return nil, my_error.NewBusiness(ERROR_TABLE, AttributionTouchError)
+	}
+	for _, touch := range obj.req.TouchArr {
+		if touch.EventName == "" {
+			return nil, my_error.NewBusiness(ERROR_TABLE, AttributionTouchError)
+		}
+	}
+	if obj.req.Model == "" {
+		obj.req.Model = AttributionLast
+	}
+	switch obj.req.Model {
+	case AttributionFirst, AttributionLast, AttributionLinear, AttributionDecay, AttributionPosition:
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, AttributionModelError)
+	}
+	var T int
+	switch obj.req.WindowTimeFormat {
+	case "天":
+		T = 60 * 60 * 24
+	case "小时":
+		T = 60 * 60
+	case "分钟":
+		T = 60
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.WindowTime <= 0 || obj.req.HalfLife < 0 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	obj.req.WindowTime = obj.req.WindowTime * T
+	obj.req.HalfLife = obj.req.HalfLife * T
+	//未设置半衰期时取回溯窗口的一半
+	if obj.req.HalfLife == 0 {
+		obj.req.HalfLife = obj.req.WindowTime / 2
+	}
+	if obj.req.HalfLife == 0 {
+		obj.req.HalfLife = 1
+	}
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	virtualAttrs.ReplaceFilter(&obj.req.Zhibiao.Relation)
+	for index := range obj.req.TouchArr {
+		virtualAttrs.ReplaceFilter(&obj.req.TouchArr[index].Relation)
+		col := ""
+		if obj.req.TouchArr[index].AttrName != "" {
+			col = virtualAttrs.Col(obj.req.TouchArr[index].AttrName)
+		}
+		obj.touchCols = append(obj.touchCols, col)
+	}
+	if obj.req.ValueAttr != "" {
+		obj.valueCol = virtualAttrs.Col(obj.req.ValueAttr)
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/meta_data"
 	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
 	jsoniter "github.com/json-iterator/go"
+	"strconv"
 	"time"
 )
 
@@ -24,6 +27,15 @@ func (this *BehaviorAnalysisService) GetConfigs(appid int) (eventNameList []resp
 		return eventNameList, attributeMap, err
 	}
 
+	metaDataService := meta_data.MetaDataService{Appid: strconv.Itoa(appid)}
+	virtualEventList, err := metaDataService.VirtualEventList(appid)
+	if err != nil {
+		return eventNameList, attributeMap, err
+	}
+	for _, v := range virtualEventList {
+		eventNameList = append(eventNameList, response.MetaEventListRes{EventName: v.EventName, ShowName: v.ShowName, IsVirtual: true})
+	}
+
 	var attributeRes []response.AttributeRes
 	if err := db.Sqlx.Select(&attributeRes, "select attribute_name,show_name,data_type,attribute_type,attribute_source from attribute where app_id = ? and (status = 1 or attribute_type = 1) and attribute_name not in ('xwl_part_date','xwl_kafka_offset','xwl_part_event')  order by attribute_type asc", appid); err != nil {
 		return eventNameList, attributeMap, err
@@ -43,9 +55,56 @@ func (this *BehaviorAnalysisService) GetConfigs(appid int) (eventNameList []resp
 		}
 	}
 
+	//虚拟属性作为事件属性展示
+	virtualAttr := model.VirtualAttr{}
+	virtualAttrList, err := virtualAttr.List(appid)
+	if err != nil {
+		return eventNameList, attributeMap, err
+	}
+	for _, v := range virtualAttrList {
+		attributeMap[2] = append(attributeMap[2], response.AttributeRes{
+			AttributeName:   v.AttributeName,
+			ShowName:        v.ShowName,
+			DataType:        v.DataType,
+			AttributeType:   2,
+			DataTypeFormat:  parser.TypeRemarkMap[v.DataType],
+			AttributeSource: 2,
+			Status:          1,
+			IsVirtual:       true,
+		})
+	}
+
+	//配置了字典的事件属性可按显示名筛选与分组
+	attrDicts, err := utils.GetAttrDicts(appid)
+	if err != nil {
+		return eventNameList, attributeMap, err
+	}
+	for _, v := range attributeMap[2] {
+		if v.IsVirtual || !attrDicts.Has(v.AttributeName) {
+			continue
+		}
+		attributeMap[2] = append(attributeMap[2], response.AttributeRes{
+			AttributeName:   v.AttributeName + utils.AttrLabelSuffix,
+			ShowName:        labelShowName(v.ShowName, v.AttributeName),
+			DataType:        parser.String,
+			AttributeType:   2,
+			DataTypeFormat:  parser.TypeRemarkMap[parser.String],
+			AttributeSource: 2,
+			Status:          1,
+			IsVirtual:       true,
+		})
+	}
+
 	return
 }
 
+func labelShowName(showName, attributeName string) string {
+	if showName == "" {
+		showName = attributeName
+	}
+	return showName + "(显示名)"
+}
+
 type AttributeName struct {
 	AttributeName string            `json:"attribute_name" db:"attribute_name"`
 	ShowName      string            `json:"show_name" db:"show_name"`
@@ -55,18 +114,72 @@ type AttributeName struct {
 
 func (this *BehaviorAnalysisService) LoadPropQuotas(reqData request.LoadPropQuotasReq) (attributeNameList []AttributeName, err error) {
 
+	//虚拟事件取各组成事件的属性
+	eventNames := []string{reqData.EventName}
+	metaDataService := meta_data.MetaDataService{Appid: strconv.Itoa(reqData.Appid)}
+	virtualEventList, err := metaDataService.VirtualEventList(reqData.Appid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range virtualEventList {
+		if v.EventName != reqData.EventName {
+			continue
+		}
+		eventNames = []string{}
+		for _, item := range v.Items {
+			eventNames = append(eventNames, item.EventName)
+		}
+	}
+
+	relationSql, relationArgs, err := db.SqlBuilder.
+		Select("event_attr").
+		From("meta_attr_relation").
+		Where(db.Eq{"app_id": reqData.Appid, "event_name": eventNames}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{reqData.Appid}
+	args = append(args, relationArgs...)
+
 	if err := db.Sqlx.Select(&attributeNameList,
 		"select attribute_name,show_name,data_type from attribute "+
 			"  where app_id = ?  and (status = 1 or attribute_type = 1) and attribute_source = 2 "+
 			"and attribute_name not in ('xwl_part_event','xwl_part_date') and attribute_name in "+
-			"(select event_attr from meta_attr_relation where  app_id = ? and event_name = ?)",
-		reqData.Appid,
-		reqData.Appid,
-		reqData.EventName,
+			"("+relationSql+")",
+		args...,
 	); err != nil {
 		return nil, err
 	}
 
+	virtualAttr := model.VirtualAttr{}
+	virtualAttrList, err := virtualAttr.List(reqData.Appid)
+	if err != nil {
+		return nil, err
+	}
+	attrDicts, err := utils.GetAttrDicts(reqData.Appid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range attributeNameList {
+		if attrDicts.Has(v.AttributeName) {
+			attributeNameList = append(attributeNameList, AttributeName{
+				AttributeName: v.AttributeName + utils.AttrLabelSuffix,
+				ShowName:      labelShowName(v.ShowName, v.AttributeName),
+				DataType:      parser.String,
+			})
+		}
+	}
+
+	for _, v := range virtualAttrList {
+		attributeNameList = append(attributeNameList, AttributeName{
+			AttributeName: v.AttributeName,
+			ShowName:      v.ShowName,
+			DataType:      v.DataType,
+		})
+	}
+
 	for index, v := range attributeNameList {
 		if v.ShowName == "" {
 			attributeNameList[index].ShowName = v.AttributeName
@@ -89,6 +202,7 @@ func (this *BehaviorAnalysisService) LoadPropQuotas(reqData request.LoadPropQuot
 
 type ValueStruct struct {
 	Value interface{} `json:"value" db:"value"`
+	Label string      `json:"label,omitempty" db:"-"`
 }
 
 func (this *BehaviorAnalysisService) GetValues(appid string, table string, col string, reqData []byte) (values []ValueStruct, err error) {
@@ -112,12 +226,19 @@ func (this *BehaviorAnalysisService) GetValues(appid string, table string, col s
 		return values, err
 	}
 
+	attrName := col
 	tableName := ""
 	switch table {
 	case "1":
 		tableName = "xwl_user" + appid
 	case "2":
 		tableName = "xwl_event" + appid
+		appidInt, _ := strconv.Atoi(appid)
+		virtualAttrs, err := utils.GetVirtualAttrs(appidInt)
+		if err != nil {
+			return values, err
+		}
+		col = virtualAttrs.Col(col)
 	}
 
 	SQL := "select DISTINCT " + col + "  as value from " + tableName + " where  isNotNull(" + col + ") ;"
@@ -136,6 +257,26 @@ func (this *BehaviorAnalysisService) GetValues(appid string, table string, col s
 		}
 	}
 
+	//配置了字典的属性附带显示名 便于下拉框展示
+	appidInt, _ := strconv.Atoi(appid)
+	attrDicts, err := utils.GetAttrDicts(appidInt)
+	if err != nil {
+		return values, err
+	}
+	if attrDicts.Has(attrName) {
+		valueStrs := make([]string, len(values))
+		for index, v := range values {
+			valueStrs[index] = utils.ValueString(v.Value)
+		}
+		labels, err := attrDicts.Labels(attrName, valueStrs)
+		if err != nil {
+			return values, err
+		}
+		for index := range values {
+			values[index].Label = labels[valueStrs[index]]
+		}
+	}
+
 	resB, err := json.Marshal(values)
 	if err != nil {
 		return values, err
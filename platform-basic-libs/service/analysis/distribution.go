@@ -0,0 +1,482 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//分布分析 按每个用户的事件次数 属性总和或活跃天数划分区间 统计各区间的用户数
+type Distribution struct {
+	sql           string
+	args          []interface{}
+	req           request.DistributionReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	groupDims     groupDims
+	userGroupSql  string
+	userGroupArgs []interface{}
+	metricCol     string
+}
+
+//每个用户的指标
+const (
+	DistributionCount = ""     //事件次数
+	DistributionSum   = "sum"  //属性总和
+	DistributionDays  = "days" //活跃天数
+)
+
+const (
+	distributionBoundsMax  = 20 //自定义区间边界最多个数
+	distributionAutoBucket = 10 //自动划分时的区间个数
+)
+
+type DistributionRes struct {
+	Dates  string     `json:"dates"`
+	Group  string     `json:"group"`
+	Total  int        `json:"total"`
+	Values []int      `json:"values"`
+	UI     [][]string `json:"ui"`
+}
+
+type distributionRowRes struct {
+	RowType     uint8    `db:"row_type"`
+	Dates       string   `db:"date_group"`
+	GroupValues []string `db:"group_values"`
+	Bucket      uint8    `db:"bucket"`
+	UserCount   uint64   `db:"user_count"`
+	UI          []string `db:"ui"`
+}
+
+//每个用户指标的聚合函数 先以State形式按事件分组聚合 合并分组后再Merge
+func (this *Distribution) metricFn() (fn string, arg string) {
+	switch this.req.MetricType {
+	case DistributionSum:
+		return "sum", "toFloat64(ifNull(" + this.metricCol + ", 0))"
+	case DistributionDays:
+		return "uniqExact", "toDate(xwl_part_date)"
+	}
+	return "count", ""
+}
+
+//时间分组 合计时只有一行 否则每个周期一行并额外计算整个时间范围的合计
+func (this *Distribution) dateGroupSql() string {
+	var periodSql string
+	switch this.req.WindowTimeFormat {
+	case ByDay:
+		periodSql = "toDate(xwl_part_date)"
+	case ByWeek:
+		periodSql = "toMonday(xwl_part_date)"
+	case Monthly:
+		periodSql = "toStartOfMonth(xwl_part_date)"
+	default:
+		return "['" + ByTotal + "']"
+	}
+	return "[formatDateTime(" + periodSql + ", '%Y-%m-%d'), '" + ByTotal + "']"
+}
+
+//每个用户每个时间分组每个事件属性分组一行 用户属性与用户分群在聚合后再关联
+func (this *Distribution) userSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	var dims groupDims
+	if grouped {
+		dims = this.groupDims
+	}
+	eventGroupSql := dims.eventGroupSql()
+	groupValuesSql, joinSql, outerArr, outerArgs := dims.valuesSql(this.req.Appid, "event_group", this.userGroupSql, this.userGroupArgs)
+	allArgs = append(allArgs, outerArgs...)
+
+	eventSql, eventArgs, err := this.virtualEvents.EventSql(this.req.Zhibiao.EventName)
+	if err != nil {
+		return
+	}
+	if len(this.req.Zhibiao.Relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(this.req.Zhibiao.Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		eventSql = eventSql + " and " + sql
+		eventArgs = append(eventArgs, args...)
+	}
+
+	var userFilterSql string
+	var userFilterArgs []interface{}
+
+	if len(this.req.WhereFilterByUser.Filts) > 0 {
+		var colArr []string
+		var sql string
+		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
+		if err != nil {
+			return
+		}
+		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
+	}
+
+	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
+
+	allArgs = append(allArgs, eventArgs...)
+	allArgs = append(allArgs, whereFilterArgs...)
+	allArgs = append(allArgs, this.args...)
+	allArgs = append(allArgs, userFilterArgs...)
+
+	fn, arg := this.metricFn()
+	outerArr = append(outerArr, "xwl_distinct_id", "date_group", groupValuesSql+" AS group_values", "value_state")
+
+	SQL = `SELECT ` + strings.Join(outerArr, ", ") + ` FROM (
+				SELECT xwl_distinct_id, date_group, ` + eventGroupSql + ` AS event_group, ` + fn + `State(` + arg + `) AS value_state
+				FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+				ARRAY JOIN ` + this.dateGroupSql() + ` AS date_group
+				prewhere xwl_part_date >= toDateTime('` + this.req.Date[0] + ` 00:00:00') and xwl_part_date <= toDateTime('` + this.req.Date[1] + ` 23:59:59') and ` + eventSql + ` and ` + whereFilterSql + this.sql + ` ` + userFilterSql + `
+				GROUP BY xwl_distinct_id, date_group, event_group
+			)` + joinSql
+	return
+}
+
+//整个时间范围内用户数最多的若干个分组 其余分组合并为其他
+func (this *Distribution) topGroupsSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.userSql(true)
+	if err != nil {
+		return
+	}
+	SQL = topGroupsSql(userSql, "date_group = '"+ByTotal+"'", "uniqExact(xwl_distinct_id)", this.req.GroupLimit)
+	return
+}
+
+//每个结果行每个用户的指标值 合并到其他的分组重新聚合
+func (this *Distribution) userValueSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	topGroupsSql := ""
+	if grouped {
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
+	}
+	topGroupsSql, rowTypeSql, groupsSql := groupRowSql(topGroupsSql)
+
+	userSql, userArgs, err := this.userSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, userArgs...)
+
+	fn, _ := this.metricFn()
+
+	SQL = `SELECT row_type, date_group, groups AS group_values, xwl_distinct_id, toFloat64(` + fn + `Merge(value_state)) AS value
+			FROM (
+				SELECT xwl_distinct_id, date_group, value_state, ` + topGroupsSql + `toUInt8(` + rowTypeSql + `) AS row_type, ` + groupsSql + ` AS groups
+				FROM (` + userSql + `)
+			)
+			GROUP BY row_type, date_group, groups, xwl_distinct_id`
+	return
+}
+
+func (this *Distribution) distributionSql(grouped bool, bounds []float64) (SQL string, allArgs []interface{}, err error) {
+	userValueSql, allArgs, err := this.userValueSql(grouped)
+	if err != nil {
+		return
+	}
+
+	SQL = `SELECT row_type, date_group, group_values, toUInt8(` + distributionBucketSql("value", bounds) + `) AS bucket,
+				count(1) AS user_count, groupArray(xwl_distinct_id) AS ui
+			FROM (` + userValueSql + `)
+			GROUP BY row_type, date_group, group_values, bucket`
+	return
+}
+
+//自动划分区间 以整个时间范围内第95百分位的用户指标值为上限 按1 2 5的倍数取整划分
+func (this *Distribution) autoBounds() (bounds []float64, err error) {
+	userValueSql, args, err := this.userValueSql(false)
+	if err != nil {
+		return
+	}
+	SQL := `SELECT toFloat64(quantile(0.95)(value)) FROM (` + userValueSql + `) WHERE date_group = '` + ByTotal + `'`
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var upper float64
+	if err = db.ClickHouseSqlx.Get(&upper, SQL, args...); err != nil {
+		return
+	}
+	upper = math.Ceil(upper)
+	if upper <= distributionAutoBucket {
+		//值较小时每个整数单独一个区间
+		for v := 2.0; v <= math.Max(upper, 1)+1; v++ {
+			bounds = append(bounds, v)
+		}
+		return
+	}
+	step := niceStep(upper / distributionAutoBucket)
+	for v := step; v <= upper; v += step {
+		bounds = append(bounds, v)
+	}
+	return
+}
+
+//不小于v的1 2 5乘以10的整数次幂
+func niceStep(v float64) float64 {
+	base := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*base >= v {
+			return m * base
+		}
+	}
+	return 10 * base
+}
+
+//指标值所在区间的下标 第一个区间不设下限 最后一个区间不设上限
+func distributionBucketSql(col string, bounds []float64) string {
+	if len(bounds) == 0 {
+		return "0"
+	}
+	multiIf := []string{}
+	for index, v := range bounds {
+		multiIf = append(multiIf, col+" < "+strconv.FormatFloat(v, 'f', -1, 64), strconv.Itoa(index))
+	}
+	return "multiIf(" + strings.Join(multiIf, ",") + "," + strconv.Itoa(len(bounds)) + ")"
+}
+
+//区间名 次数与天数为整数时以闭区间展示
+func distributionBucketLabels(bounds []float64, integer bool) []string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, v := range bounds {
+		if v != math.Trunc(v) {
+			integer = false
+		}
+	}
+	if len(bounds) == 0 {
+		return []string{"全部"}
+	}
+	labels := make([]string, 0, len(bounds)+1)
+	if integer {
+		labels = append(labels, "≤"+format(bounds[0]-1))
+	} else {
+		labels = append(labels, "<"+format(bounds[0]))
+	}
+	for index := 1; index < len(bounds); index++ {
+		min, max := bounds[index-1], bounds[index]
+		switch {
+		case integer && max-min == 1:
+			labels = append(labels, format(min))
+		case integer:
+			labels = append(labels, format(min)+"~"+format(max-1))
+		default:
+			labels = append(labels, "["+format(min)+","+format(max)+")")
+		}
+	}
+	labels = append(labels, "≥"+format(bounds[len(bounds)-1]))
+	return labels
+}
+
+func (this *Distribution) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	return this.execSql(this.req.Bounds)
+}
+
+func (this *Distribution) execSql(bounds []float64) (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.distributionSql(false, bounds)
+	if err != nil {
+		return
+	}
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.distributionSql(true, bounds)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = fmt.Sprintf("%s UNION ALL %s", SQL, groupSql)
+		allArgs = append(allArgs, groupArgs...)
+	}
+	return
+}
+
+func (this *Distribution) GetList() (interface{}, error) {
+	bounds := this.req.Bounds
+	if len(bounds) == 0 {
+		var err error
+		if bounds, err = this.autoBounds(); err != nil {
+			return nil, err
+		}
+	}
+
+	SQL, args, err := this.execSql(bounds)
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var resList []distributionRowRes
+	if err = db.ClickHouseSqlx.Select(&resList, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	groupValuesArr := [][]string{}
+	for _, v := range resList {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	labels, err := this.groupDims.labels(this.attrDicts, groupValuesArr)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketNum := len(bounds) + 1
+	resMap := map[string]*DistributionRes{}
+	dates := []string{}
+	groupTotal := map[string]int{}
+	for _, v := range resList {
+		group := "总体"
+		switch v.RowType {
+		case groupRowGroup:
+			group = groupKeyOf(v.GroupValues, labels)
+		case groupRowOther:
+			group = otherGroup
+		}
+		key := v.Dates + "|" + group
+		res, ok := resMap[key]
+		if !ok {
+			res = &DistributionRes{Dates: v.Dates, Group: group, Values: make([]int, bucketNum), UI: make([][]string, bucketNum)}
+			for index := range res.UI {
+				res.UI[index] = []string{}
+			}
+			resMap[key] = res
+			if group == "总体" {
+				dates = append(dates, v.Dates)
+			}
+		}
+		if int(v.Bucket) < bucketNum {
+			res.Values[v.Bucket] = int(v.UserCount)
+			res.UI[v.Bucket] = v.UI
+		}
+		res.Total += int(v.UserCount)
+		if v.Dates == ByTotal {
+			groupTotal[group] += int(v.UserCount)
+		}
+	}
+
+	//合计排在最前 其余按时间顺序
+	sort.Slice(dates, func(i, j int) bool {
+		if dates[i] == ByTotal || dates[j] == ByTotal {
+			return dates[i] == ByTotal
+		}
+		return dates[i] < dates[j]
+	})
+	//总体排在最前 其他排在最后 其余按整个时间范围的用户数从多到少
+	groupOrder := func(group string) int {
+		switch group {
+		case "总体":
+			return math.MaxInt32
+		case otherGroup:
+			return -1
+		}
+		return groupTotal[group]
+	}
+	groups := []string{}
+	for _, res := range resMap {
+		if res.Dates == ByTotal {
+			groups = append(groups, res.Group)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groupOrder(groups[i]) == groupOrder(groups[j]) {
+			return groups[i] < groups[j]
+		}
+		return groupOrder(groups[i]) > groupOrder(groups[j])
+	})
+
+	list := []DistributionRes{}
+	for _, date := range dates {
+		for _, group := range groups {
+			if res, ok := resMap[date+"|"+group]; ok {
+				list = append(list, *res)
+			}
+		}
+	}
+
+	integer := this.req.MetricType != DistributionSum
+	return map[string]interface{}{"buckets": distributionBucketLabels(bounds, integer), "bounds": bounds, "dates": dates, "groups": groups, "list": list}, nil
+}
+
+func NewDistribution(reqData []byte) (Ianalysis, error) {
+	obj := &Distribution{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &obj.req)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.Date) < 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.Zhibiao.EventName == "" {
+		return nil, my_error.NewBusiness(ERROR_TABLE, EventNameEmptyError)
+	}
+	switch obj.req.WindowTimeFormat {
+	case "":
+		obj.req.WindowTimeFormat = ByTotal
+	case ByTotal, ByDay, ByWeek, Monthly:
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	switch obj.req.MetricType {
+	case DistributionCount, DistributionDays:
+	case DistributionSum:
+		if obj.req.MetricAttr == "" {
+			return nil, my_error.NewBusiness(ERROR_TABLE, DistributionMetricError)
+		}
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, DistributionMetricError)
+	}
+	if len(obj.req.Bounds) > distributionBoundsMax {
+		return nil, my_error.NewBusiness(ERROR_TABLE, DistributionBoundsError)
+	}
+	sort.Float64s(obj.req.Bounds)
+	for index := 1; index < len(obj.req.Bounds); index++ {
+		if obj.req.Bounds[index] == obj.req.Bounds[index-1] {
+			return nil, my_error.NewBusiness(ERROR_TABLE, DistributionBoundsError)
+		}
+	}
+	obj.req.GroupLimit = groupLimitOf(obj.req.GroupLimit)
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	virtualAttrs.ReplaceFilter(&obj.req.Zhibiao.Relation)
+	obj.metricCol = virtualAttrs.Col(obj.req.MetricAttr)
+	obj.groupDims, err = newGroupDims(obj.req.GroupBy, obj.req.GroupByUser, obj.req.GroupByUserGroup, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.GroupByUserGroup) > 0 {
+		obj.userGroupSql, obj.userGroupArgs, err = utils.GetUserGroupNamesSql(obj.req.GroupByUserGroup, obj.req.Appid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+)
+
+//耗时分布的区间边界 单位秒 超出窗口期的边界不展示 漏斗转化耗时与间隔分析共用
+var durationBuckets = []int{60, 5 * 60, 30 * 60, 60 * 60, 6 * 60 * 60, 24 * 60 * 60, 3 * 24 * 60 * 60, 7 * 24 * 60 * 60}
+
+type DurationBucket struct {
+	Min   int      `json:"min"`
+	Max   int      `json:"max"` //为0时表示不设上限
+	Count int      `json:"count"`
+	UI    []string `json:"ui"`
+}
+
+//小于上限的区间边界
+func durationBucketsWithin(max int) (buckets []int) {
+	for _, v := range durationBuckets {
+		if v >= max {
+			break
+		}
+		buckets = append(buckets, v)
+	}
+	return
+}
+
+//耗时所在区间的下标 最后一个区间不设上限
+func durationBucketSql(col string, buckets []int) string {
+	if len(buckets) == 0 {
+		return "0"
+	}
+	multiIf := []string{}
+	for index, v := range buckets {
+		multiIf = append(multiIf, col+" < "+strconv.Itoa(v), strconv.Itoa(index))
+	}
+	return "multiIf(" + strings.Join(multiIf, ",") + "," + strconv.Itoa(len(buckets)) + ")"
+}
+
+//按区间边界展开查询结果 没有数据的区间计数为0
+func newDurationBuckets(buckets []int, indexes []uint8, counts []uint64, uis [][]string) []DurationBucket {
+	res := make([]DurationBucket, len(buckets)+1)
+	for index := range res {
+		if index > 0 {
+			res[index].Min = buckets[index-1]
+		}
+		if index < len(buckets) {
+			res[index].Max = buckets[index]
+		}
+		res[index].UI = []string{}
+	}
+	for index, bucket := range indexes {
+		if int(bucket) >= len(res) {
+			continue
+		}
+		res[bucket].Count = int(counts[index])
+		res[bucket].UI = uis[index]
+	}
+	return res
+}
@@ -21,6 +21,11 @@ type Event struct {
 	eventNameDisplayArr []string
 	req                 request.EventReqData
 	divisorIndex        int32
+	virtualAttrs        utils.VirtualAttrs
+	virtualEvents       utils.VirtualEvents
+	attrDicts           utils.AttrDicts
+	compare             *eventCompare
+	lookback            int //当前指标需要向前多查询的日期分组个数
 }
 
 func (this *Event) getDivisorName() string {
@@ -69,7 +74,21 @@ func (this *Event) GetList() (interface{}, error) {
 		}
 		list = append(list, item)
 	}
-	return map[string]interface{}{"alldata": list, "use_group": len(this.req.GroupBy) > 0, "len": len(this.req.ZhibiaoArr), "groupby": this.req.GroupBy, "eventNameDisplayArr": this.eventNameDisplayArr}, nil
+
+	//配置了字典的分组属性展示显示名
+	for _, groupby := range this.req.GroupBy {
+		if err = this.attrDicts.ReplaceRows(groupby, list, groupby); err != nil {
+			return nil, err
+		}
+	}
+	res := map[string]interface{}{"alldata": list, "use_group": len(this.req.GroupBy) > 0, "len": len(this.req.ZhibiaoArr), "groupby": this.req.GroupBy, "eventNameDisplayArr": this.eventNameDisplayArr}
+
+	//对比时段的结果行不放入alldata 与查询时段配对后放入compare
+	if this.compare != nil {
+		res["alldata"], res["compare"] = this.compareRes(list)
+		res["compareDate"] = this.compare.compareDates()
+	}
+	return res, nil
 }
 
 const (
@@ -95,7 +114,10 @@ func (this *Event) getSqlByZhibiao(index int, sql string, args []interface{}) (S
 	zhibiao := this.req.ZhibiaoArr[index]
 
 	//获取指标sql段
-	eventSql, eventArgs := this.whereInZhibiaoEvent(zhibiao)
+	eventSql, eventArgs, err := this.whereInZhibiaoEvent(zhibiao)
+	if err != nil {
+		return "", nil, err
+	}
 
 	fmt.Println("eventSql = ", eventSql)
 	fmt.Println("eventArgs = ", eventArgs)
@@ -117,6 +139,12 @@ func (this *Event) getSqlByZhibiao(index int, sql string, args []interface{}) (S
 	fmt.Println("groupCol = ", groupCol)
 	fmt.Println()
 
+	//对比时段作为一个分组 放在日期分组之前
+	if this.compare != nil {
+		groupArr = append(groupArr, "compare_period")
+		groupCol = append(groupCol, this.scanCompare().periodCol())
+	}
+
 	copyGroupArr := groupArr
 
 	if dateGroupCol != "" {
@@ -195,6 +223,8 @@ func (this *Event) getSqlByZhibiao(index int, sql string, args []interface{}) (S
 		return "", nil, errors.New("未知指标类型")
 	}
 
+	groupCol = append(groupCol, this.transformCols(zhibiao)...)
+
 	args = append(argsWith, args...)
 
 	args = append(args, whereArgs...)
@@ -209,7 +239,14 @@ func (this *Event) getSqlByZhibiao(index int, sql string, args []interface{}) (S
 		SQL = SQL + " group by " + strings.Join(copyGroupArr, ",")
 	}
 
-	copyGroupArr = append(copyGroupArr, `arrayMap((x, y) -> (x, y),groupArray(date_group),groupArray(amount)) as data_group`)
+	amountSql := "groupArray(amount)"
+	if zhibiao.Transform != TransformNone {
+		amountSql = this.transformAmountSql(zhibiao)
+	}
+	copyGroupArr = append(copyGroupArr, this.visibleSql(zhibiao, `arrayMap((x, y) -> (x, y),groupArray(date_group),`+amountSql+`)`)+` as data_group`)
+	if this.compare != nil {
+		copyGroupArr = append(copyGroupArr, this.visibleSql(zhibiao, `groupArray(date_group)`)+` as date_arr`, this.visibleSql(zhibiao, this.transformAmountSql(zhibiao))+` as amount_arr`)
+	}
 	eventNameDisplay := "" + zhibiao.EventNameDisplay + "(" + strconv.Itoa(index+1) + ")"
 	this.eventNameDisplayArr = append(this.eventNameDisplayArr, eventNameDisplay)
 	copyGroupArr = append(copyGroupArr, "'"+eventNameDisplay+"'"+" as eventNameDisplay ", "count(1)  group_num", ``+strconv.Itoa(index+1)+` as serial_number`)
@@ -233,10 +270,6 @@ func (this *Event) GetExecSql() (SQL string, allArgs []interface{}, err error) {
 		return "", nil, err
 	}
 
-	//获取 req.date 日期sql条件段
-	filterDateSql, filterDateArgs := this.GetFilterDateSql()
-	fmt.Println("filterDateSql = ", filterDateSql)
-
 	//获取 req.whereFilterByUser 用户sql条件段
 	usersql, userArgs, err := getUserfilterSqlArgs(this.req.WhereFilterByUser, this.req.Appid)
 	fmt.Println("usersql = ", usersql)
@@ -248,11 +281,10 @@ func (this *Event) GetExecSql() (SQL string, allArgs []interface{}, err error) {
 	}
 
 	//sql 拼接
-	sql := whereSql + usersql + filterDateSql
+	sql := whereSql + usersql
 	args := []interface{}{}
 	args = append(args, whereArgs...)
 	args = append(args, userArgs...)
-	args = append(args, filterDateArgs...)
 
 	fmt.Println("sql = ", sql)
 	fmt.Println("args = ", args)
@@ -263,10 +295,19 @@ func (this *Event) GetExecSql() (SQL string, allArgs []interface{}, err error) {
 	//循环指标， 单个指标代表一个字段
 	for index := range this.req.ZhibiaoArr {
 
+		//获取 req.date 日期sql条件段 移动平均与滚动窗口需要向前多查询
+		this.lookback = this.lookbackOf(this.req.ZhibiaoArr[index])
+		filterDateSql, filterDateArgs := this.GetFilterDateSql()
+		fmt.Println("filterDateSql = ", filterDateSql)
+
+		zhibiaoArgs := []interface{}{}
+		zhibiaoArgs = append(zhibiaoArgs, args...)
+		zhibiaoArgs = append(zhibiaoArgs, filterDateArgs...)
+
 		fmt.Println("index = ", index)
-		fmt.Println("sql = ", sql)
-		fmt.Println("args = ", args)
-		sql, args, err := this.getSqlByZhibiao(index, sql, args)
+		fmt.Println("sql = ", sql+filterDateSql)
+		fmt.Println("args = ", zhibiaoArgs)
+		sql, args, err := this.getSqlByZhibiao(index, sql+filterDateSql, zhibiaoArgs)
 		if err != nil {
 			return "", nil, err
 		}
@@ -288,7 +329,14 @@ func (this *Event) GetExecSql() (SQL string, allArgs []interface{}, err error) {
 
 func (this *Event) GetFilterDateSql() (SQL string, args []interface{}) {
 
+	if this.compare != nil {
+		return this.scanCompare().filterDateSql()
+	}
+
 	startTime := this.req.Date[0] + " 00:00:00"
+	if this.lookback > 0 {
+		startTime = this.scanStartTime()
+	}
 	endTime := this.req.Date[1] + " 23:59:59"
 	args = append(args, startTime)
 	args = append(args, endTime)
@@ -301,35 +349,39 @@ func (this *Event) GetFilterDateSql() (SQL string, args []interface{}) {
 /*
 	zhibiao 指标对象
 */
-func (this *Event) whereInZhibiaoEvent(zhibiao request.EventZhibiao) (SQL string, args []interface{}) {
+func (this *Event) whereInZhibiaoEvent(zhibiao request.EventZhibiao) (SQL string, args []interface{}, err error) {
 
-	colsArr := []interface{}{}
+	eventNames := []string{}
 
 	switch zhibiao.Typ {
 	case Zhibiao:
-		colsArr = append(colsArr, zhibiao.EventName)
+		eventNames = append(eventNames, zhibiao.EventName)
 	case Formula:
-		arr := []interface{}{}
-		arr = append(arr, zhibiao.One.EventName)
+		eventNames = append(eventNames, zhibiao.One.EventName)
 		if !zhibiao.DivisorNoGrouping {
-			arr = append(arr, zhibiao.Two.EventName)
+			eventNames = append(eventNames, zhibiao.Two.EventName)
 		}
+	}
 
-		colsArr = append(colsArr, arr)
+	if len(eventNames) == 0 {
+		return "", nil, nil
 	}
 
-	if len(colsArr) == 0 {
-		return "", nil
+	//虚拟事件展开为组成事件及其筛选条件
+	SQL, args, err = this.virtualEvents.EventInSql(eventNames)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return " and xwl_part_event in (?) ", colsArr
+	return " and " + SQL, args, nil
 }
 
 func (this *Event) getFormulaSql(dimension request.FormulaDimension, isDivisor, divisorNoGrouping bool) (withSql, sql string, withArgs, args []interface{}, err error) {
 
-	eventFilter := " xwl_part_event = ? "
-
-	args = append(args, dimension.EventName)
+	eventFilter, args, err := this.virtualEvents.EventSql(dimension.EventName)
+	if err != nil {
+		return
+	}
 
 	whereSql, whereArgs, _, err := utils.GetWhereSql(dimension.Relation)
 
@@ -349,11 +401,18 @@ func (this *Event) getFormulaSql(dimension request.FormulaDimension, isDivisor,
 
 		args = append(args, filterDateArgs...)
 		groupSql, groupCol := this.GetGroupDateSql()
-		fmtStr := ` with ( select cast((groupArray(date_group),groupArray(tmp)) AS Map(String, String)) as withDataMap from (select %v from xwl_event` + strconv.Itoa(this.req.Appid) + ` prewhere %v  group by %v)  ) as %v `
+		keySql := groupSql
+		//有对比时段时 以时段和日期分组共同作为除数的键
+		if this.compare != nil {
+			groupCol = this.compare.periodCol() + "," + groupCol
+			groupSql = " compare_period," + groupSql
+			keySql = " concat(toString(compare_period), date_group) "
+		}
+		fmtStr := ` with ( select cast((groupArray(%v),groupArray(tmp)) AS Map(String, String)) as withDataMap from (select %v from xwl_event` + strconv.Itoa(this.req.Appid) + ` prewhere %v  group by %v)  ) as %v `
 		divisorName := this.getDivisorName()
-		withSql = fmt.Sprintf(fmtStr, utils.CountTypMap[dimension.SelectAttr[1]](dimension.SelectAttr[0])+" as tmp ,"+groupCol, eventFilter+filterDateSql, groupSql, divisorName)
+		withSql = fmt.Sprintf(fmtStr, keySql, utils.CountTypMap[dimension.SelectAttr[1]](dimension.SelectAttr[0])+" as tmp ,"+groupCol, eventFilter+filterDateSql, groupSql, divisorName)
 
-		sql = ` toFloat64OrZero(mapValues(` + divisorName + `)[indexOf(mapKeys(` + divisorName + `), ` + groupSql + `)])  `
+		sql = ` toFloat64OrZero(mapValues(` + divisorName + `)[indexOf(mapKeys(` + divisorName + `), ` + keySql + `)])  `
 		withArgs = args
 		args = nil
 
@@ -368,7 +427,7 @@ func (this *Event) getFormulaSql(dimension request.FormulaDimension, isDivisor,
 				sql = utils.CountTypMap[dimension.SelectAttr[1]](`if(` + eventFilter + `, 1, null)` + utils.SPLIT + `if(` + eventFilter + `, xwl_distinct_id, null)`)
 			}
 		} else {
-			sql = utils.CountTypMap[dimension.SelectAttr[1]](`if(` + eventFilter + `, ` + dimension.SelectAttr[1] + `, null)`)
+			sql = utils.CountTypMap[dimension.SelectAttr[1]](`if(` + eventFilter + `, ` + dimension.SelectAttr[0] + `, null)`)
 		}
 		sql = utils.ToFloat32OrZero(sql)
 	}
@@ -378,17 +437,22 @@ func (this *Event) getFormulaSql(dimension request.FormulaDimension, isDivisor,
 
 func (this *Event) GetGroupDateSql() (groupSQL string, groupCol string) {
 
+	dateCol := "xwl_part_date"
+	if this.compare != nil {
+		dateCol = this.compare.dateCol()
+	}
+
 	switch this.req.WindowTimeFormat {
 	case ByDay:
-		return "  date_group ", "formatDateTime(xwl_part_date,'%Y年%m月%d日') as date_group "
+		return "  date_group ", "formatDateTime(" + dateCol + ",'%Y年%m月%d日') as date_group "
 	case ByHour:
-		return "  date_group ", " formatDateTime(xwl_part_date,'%Y年%m月%d日 %H点') as date_group "
+		return "  date_group ", " formatDateTime(" + dateCol + ",'%Y年%m月%d日 %H点') as date_group "
 	case ByMinute:
-		return "  date_group ", " formatDateTime(xwl_part_date,'%Y年%m月%d日 %H点%M分') as date_group "
+		return "  date_group ", " formatDateTime(" + dateCol + ",'%Y年%m月%d日 %H点%M分') as date_group "
 	case ByWeek:
-		return "  date_group ", " formatDateTime(xwl_part_date,'%Y年%m月 星期%u')  as date_group "
+		return "  date_group ", " formatDateTime(" + dateCol + ",'%Y年%m月 星期%u')  as date_group "
 	case Monthly:
-		return "  date_group ", " formatDateTime(xwl_part_date,'%Y年%m月') as date_group"
+		return "  date_group ", " formatDateTime(" + dateCol + ",'%Y年%m月') as date_group"
 	case ByTotal:
 		return " date_group ", " '合计' as date_group "
 	}
@@ -403,7 +467,7 @@ func (this *Event) GetGroupSql() (groupSql []string, groupCol []string) {
 
 	for _, groupby := range this.req.GroupBy {
 		groupSql = append(groupSql, groupby)
-		groupCol = append(groupCol, fmt.Sprintf(" %s as %s ", groupby, groupby))
+		groupCol = append(groupCol, fmt.Sprintf(" %s as %s ", this.virtualAttrs.Col(groupby), groupby))
 	}
 
 	return
@@ -433,11 +497,46 @@ func NewEvent(reqData []byte) (Ianalysis, error) {
 			return nil, my_error.NewBusiness(ERROR_TABLE, GroupEmptyError)
 		}
 	}
+	//检测指标变换
+	for _, zhibiao := range obj.req.ZhibiaoArr {
+		if err = checkTransform(zhibiao); err != nil {
+			return nil, err
+		}
+	}
+	obj.compare, err = newEventCompare(obj.req)
+	if err != nil {
+		return nil, err
+	}
+
 	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
 	if err != nil {
 		return nil, err
 	}
 
+	//虚拟属性替换为表达式 分组字段在拼接sql时替换 以保留原属性名作为别名
+	obj.virtualAttrs, err = utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	obj.virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	for index := range obj.req.ZhibiaoArr {
+		zhibiao := &obj.req.ZhibiaoArr[index]
+		obj.virtualAttrs.ReplaceFilter(&zhibiao.Relation)
+		obj.virtualAttrs.ReplaceFilter(&zhibiao.One.Relation)
+		obj.virtualAttrs.ReplaceFilter(&zhibiao.Two.Relation)
+		obj.virtualAttrs.ReplaceSelectAttr(zhibiao.SelectAttr)
+		obj.virtualAttrs.ReplaceSelectAttr(zhibiao.One.SelectAttr)
+		obj.virtualAttrs.ReplaceSelectAttr(zhibiao.Two.SelectAttr)
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, obj.virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
 	fmt.Println("NewEvent() obj.sql = ", obj.sql)
 	fmt.Println()
 	fmt.Println("NewEvent() obj.args = ", obj.args)
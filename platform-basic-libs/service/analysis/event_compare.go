@@ -0,0 +1,224 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//对比时段
+const (
+	CompareNone   = ""       //不对比
+	ComparePrev   = "prev"   //上一周期 与查询时段等长且紧邻其前
+	CompareWeek   = "week"   //上周同期
+	CompareMonth  = "month"  //上月同期
+	CompareYear   = "year"   //去年同期
+	CompareCustom = "custom" //自定义时段
+)
+
+//结果行所属时段
+const (
+	comparePeriodCurrent = 0
+	comparePeriodCompare = 1
+)
+
+//事件分析的对比时段 与查询时段在同一次查询中计算
+//对比时段的时间平移到查询时段后再按日期分组 使两个时段的日期分组一一对应
+type eventCompare struct {
+	startT        time.Time
+	endT          time.Time
+	compareStartT time.Time
+	compareEndT   time.Time
+	shiftFn       string //将对比时段的时间平移到查询时段
+	shiftNum      int
+}
+
+type EventCompareItem struct {
+	Date         string   `json:"date"`
+	Value        string   `json:"value"`
+	CompareValue string   `json:"compare_value"`
+	Delta        float64  `json:"delta"`      //查询时段减对比时段
+	DeltaRate    *float64 `json:"delta_rate"` //变化率 对比时段为0时为null
+}
+
+type EventCompareRes struct {
+	SerialNumber     int                `json:"serial_number"`
+	EventNameDisplay string             `json:"eventNameDisplay"`
+	Groups           []string           `json:"groups"` //各分组属性的值 与groupby一一对应
+	Data             []EventCompareItem `json:"data"`
+}
+
+func newEventCompare(req request.EventReqData) (compare *eventCompare, err error) {
+	if req.CompareType == CompareNone {
+		return nil, nil
+	}
+	compare = &eventCompare{
+		startT: util.Str2Time(req.Date[0], util.TimeFormatDay2),
+		endT:   util.Str2Time(req.Date[1], util.TimeFormatDay2),
+	}
+	if compare.startT.IsZero() || compare.endT.Before(compare.startT) {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	switch req.CompareType {
+	case ComparePrev:
+		days := int(math.Round(compare.endT.Sub(compare.startT).Hours()/24)) + 1
+		compare.compareStartT = compare.startT.AddDate(0, 0, -days)
+		compare.compareEndT = compare.endT.AddDate(0, 0, -days)
+		compare.shiftFn, compare.shiftNum = "addDays", days
+	case CompareWeek:
+		compare.compareStartT = compare.startT.AddDate(0, 0, -7)
+		compare.compareEndT = compare.endT.AddDate(0, 0, -7)
+		compare.shiftFn, compare.shiftNum = "addWeeks", 1
+	case CompareMonth:
+		compare.compareStartT = addMonthsClamp(compare.startT, -1)
+		compare.compareEndT = addMonthsClamp(compare.endT, -1)
+		compare.shiftFn, compare.shiftNum = "addMonths", 1
+	case CompareYear:
+		compare.compareStartT = addMonthsClamp(compare.startT, -12)
+		compare.compareEndT = addMonthsClamp(compare.endT, -12)
+		compare.shiftFn, compare.shiftNum = "addYears", 1
+	case CompareCustom:
+		if len(req.CompareDate) < 2 {
+			return nil, my_error.NewBusiness(ERROR_TABLE, EventCompareError)
+		}
+		compare.compareStartT = util.Str2Time(req.CompareDate[0], util.TimeFormatDay2)
+		compare.compareEndT = util.Str2Time(req.CompareDate[1], util.TimeFormatDay2)
+		if compare.compareStartT.IsZero() || compare.compareEndT.Before(compare.compareStartT) {
+			return nil, my_error.NewBusiness(ERROR_TABLE, EventCompareError)
+		}
+		compare.shiftFn = "addDays"
+		compare.shiftNum = int(math.Round(compare.startT.Sub(compare.compareStartT).Hours() / 24))
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, EventCompareError)
+	}
+	return compare, nil
+}
+
+//按月平移 日期超出目标月的天数时取月末 与clickhouse的addMonths addYears一致
+func addMonthsClamp(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if lastDay := first.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func (this *eventCompare) compareDates() []string {
+	return []string{this.compareStartT.Format(util.TimeFormatDay2), this.compareEndT.Format(util.TimeFormatDay2)}
+}
+
+func periodBetweenSql(startT, endT time.Time) string {
+	return "xwl_part_date >= toDateTime('" + startT.Format(util.TimeFormat) + "') and xwl_part_date <= toDateTime('" + endT.Format(util.TimeFormatDay2) + " 23:59:59')"
+}
+
+//两个时段可能重叠 重叠部分的事件在两个时段各计一次
+func (this *eventCompare) periodCol() string {
+	return " arrayJoin(arrayFilter(p -> if(p = " + strconv.Itoa(comparePeriodCurrent) + ", " +
+		periodBetweenSql(this.startT, this.endT) + ", " + periodBetweenSql(this.compareStartT, this.compareEndT) + "), [" +
+		strconv.Itoa(comparePeriodCurrent) + ", " + strconv.Itoa(comparePeriodCompare) + "])) as compare_period "
+}
+
+//按日期分组时使用的时间 对比时段平移到查询时段
+func (this *eventCompare) dateCol() string {
+	return "if(compare_period = " + strconv.Itoa(comparePeriodCompare) + ", " + this.shiftFn + "(xwl_part_date, " + strconv.Itoa(this.shiftNum) + "), xwl_part_date)"
+}
+
+func (this *eventCompare) filterDateSql() (SQL string, args []interface{}) {
+	args = append(args, this.startT.Format(util.TimeFormatDay2)+" 00:00:00", this.endT.Format(util.TimeFormatDay2)+" 23:59:59")
+	args = append(args, this.compareStartT.Format(util.TimeFormatDay2)+" 00:00:00", this.compareEndT.Format(util.TimeFormatDay2)+" 23:59:59")
+
+	SQL = ` and ((xwl_part_date >= toDateTime(?) and xwl_part_date <= toDateTime(?)) or (xwl_part_date >= toDateTime(?) and xwl_part_date <= toDateTime(?))) `
+	return
+}
+
+//指标值为字符串 百分比去掉百分号后计算差值
+func compareAmount(amount string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(amount), "%"), 64)
+	return f
+}
+
+func compareInt(v interface{}) int {
+	i, _ := strconv.Atoi(utils.ValueString(v))
+	return i
+}
+
+//按指标与分组将两个时段的结果行配对 日期按查询时段的日期分组对齐
+func (this *Event) compareRes(list []map[string]interface{}) (alldata []map[string]interface{}, compareList []EventCompareRes) {
+	type series struct {
+		res      EventCompareRes
+		current  map[string]string
+		compared map[string]string
+		dates    []string
+	}
+	keys := []string{}
+	seriesMap := map[string]*series{}
+	for _, item := range list {
+		period := compareInt(item["compare_period"])
+		if period == comparePeriodCurrent {
+			alldata = append(alldata, item)
+		}
+		groups := []string{}
+		for _, groupby := range this.req.GroupBy {
+			groups = append(groups, utils.ValueString(item[groupby]))
+		}
+		key := utils.ValueString(item["serial_number"]) + "\x00" + strings.Join(groups, "\x00")
+		s, ok := seriesMap[key]
+		if !ok {
+			s = &series{
+				res: EventCompareRes{
+					SerialNumber:     compareInt(item["serial_number"]),
+					EventNameDisplay: utils.ValueString(item["eventNameDisplay"]),
+					Groups:           groups,
+				},
+				current:  map[string]string{},
+				compared: map[string]string{},
+			}
+			seriesMap[key] = s
+			keys = append(keys, key)
+		}
+		dates, _ := item["date_arr"].([]string)
+		amounts, _ := item["amount_arr"].([]string)
+		for index, date := range dates {
+			if index >= len(amounts) {
+				break
+			}
+			if _, ok := s.current[date]; !ok {
+				if _, ok := s.compared[date]; !ok {
+					s.dates = append(s.dates, date)
+				}
+			}
+			if period == comparePeriodCurrent {
+				s.current[date] = amounts[index]
+			} else {
+				s.compared[date] = amounts[index]
+			}
+		}
+	}
+
+	compareList = []EventCompareRes{}
+	for _, key := range keys {
+		s := seriesMap[key]
+		sort.Strings(s.dates)
+		s.res.Data = []EventCompareItem{}
+		for _, date := range s.dates {
+			item := EventCompareItem{Date: date, Value: s.current[date], CompareValue: s.compared[date]}
+			value, compareValue := compareAmount(item.Value), compareAmount(item.CompareValue)
+			item.Delta = value - compareValue
+			if compareValue != 0 {
+				rate := item.Delta / compareValue
+				item.DeltaRate = &rate
+			}
+			s.res.Data = append(s.res.Data, item)
+		}
+		compareList = append(compareList, s.res)
+	}
+	return
+}
@@ -0,0 +1,198 @@
+package analysis
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//指标变换 在按日期分组的结果上计算
+const (
+	TransformNone       = ""           //不变换
+	TransformCumulative = "cumulative" //从开始日期起的累计值 去重类的指标为累计去重数
+	TransformMoving     = "moving"     //最近N个日期分组的移动平均 没有数据的日期分组按0计
+	TransformRolling    = "rolling"    //最近N个日期分组的去重数 如按天的近7天活跃用户数
+)
+
+const transformWindowMax = 366
+
+//去重类的指标 不能由各日期分组的值相加得到
+func isDistinctZhibiao(zhibiao request.EventZhibiao) bool {
+	if zhibiao.Typ != Zhibiao || len(zhibiao.SelectAttr) < 2 {
+		return false
+	}
+	return zhibiao.SelectAttr[1] == utils.ClickUserNum || zhibiao.SelectAttr[1] == utils.DistincCount
+}
+
+//可以由各日期分组的值相加得到累计值的指标
+func isAdditiveZhibiao(zhibiao request.EventZhibiao) bool {
+	if zhibiao.Typ != Zhibiao || len(zhibiao.SelectAttr) < 2 {
+		return false
+	}
+	switch zhibiao.SelectAttr[1] {
+	case utils.UserNum, utils.AllCount, utils.AllSum:
+		return true
+	}
+	return false
+}
+
+//是否需要每个日期分组的去重状态
+func needUniqState(zhibiao request.EventZhibiao) bool {
+	switch zhibiao.Transform {
+	case TransformRolling:
+		return true
+	case TransformCumulative:
+		return isDistinctZhibiao(zhibiao)
+	}
+	return false
+}
+
+func checkTransform(zhibiao request.EventZhibiao) error {
+	switch zhibiao.Transform {
+	case TransformNone:
+		return nil
+	case TransformCumulative:
+		//只有次数与总和可以累加 去重类的指标合并去重状态 均值 最值 分位数与公式累加没有意义
+		if !isAdditiveZhibiao(zhibiao) && !isDistinctZhibiao(zhibiao) {
+			return my_error.NewBusiness(ERROR_TABLE, EventTransformError)
+		}
+		return nil
+	case TransformMoving:
+	case TransformRolling:
+		//滚动窗口去重数由每个日期分组的去重状态合并得到 只支持去重类的指标
+		if !isDistinctZhibiao(zhibiao) {
+			return my_error.NewBusiness(ERROR_TABLE, EventTransformError)
+		}
+	default:
+		return my_error.NewBusiness(ERROR_TABLE, EventTransformError)
+	}
+	if zhibiao.TransformWindow <= 0 || zhibiao.TransformWindow > transformWindowMax {
+		return my_error.NewBusiness(ERROR_TABLE, EventTransformError)
+	}
+	return nil
+}
+
+//移动平均与滚动窗口需要查询开始日期之前的N-1个日期分组
+func (this *Event) lookbackOf(zhibiao request.EventZhibiao) int {
+	if this.req.WindowTimeFormat == ByTotal {
+		return 0
+	}
+	switch zhibiao.Transform {
+	case TransformMoving, TransformRolling:
+		return zhibiao.TransformWindow - 1
+	}
+	return 0
+}
+
+//t所在日期分组之前第n个日期分组的开始时间
+func (this *Event) periodsBefore(t time.Time, n int) time.Time {
+	switch this.req.WindowTimeFormat {
+	case ByMinute:
+		return t.Add(-time.Duration(n) * time.Minute)
+	case ByHour:
+		return t.Add(-time.Duration(n) * time.Hour)
+	case ByWeek:
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7-7*n)
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, -n, 0)
+	}
+	return t.AddDate(0, 0, -n)
+}
+
+//查询开始时间 包含移动平均与滚动窗口需要的之前的日期分组
+func (this *Event) scanStartT(startT time.Time) time.Time {
+	if this.lookback <= 0 {
+		return startT
+	}
+	return this.periodsBefore(startT, this.lookback)
+}
+
+func (this *Event) scanStartTime() string {
+	return this.scanStartT(util.Str2Time(this.req.Date[0], util.TimeFormatDay2)).Format(util.TimeFormat)
+}
+
+//有对比时段时两个时段都向前扩展
+func (this *Event) scanCompare() *eventCompare {
+	compare := *this.compare
+	compare.startT = this.scanStartT(compare.startT)
+	compare.compareStartT = this.scanStartT(compare.compareStartT)
+	return &compare
+}
+
+//日期分组的序号 相邻的日期分组序号相差1
+func (this *Event) periodNoSql(dateCol string) string {
+	switch this.req.WindowTimeFormat {
+	case ByMinute:
+		return "toRelativeMinuteNum(" + dateCol + ")"
+	case ByHour:
+		return "toRelativeHourNum(" + dateCol + ")"
+	case ByWeek:
+		return "toRelativeWeekNum(" + dateCol + ")"
+	case Monthly:
+		return "toRelativeMonthNum(" + dateCol + ")"
+	case ByTotal:
+		return "0"
+	}
+	return "toRelativeDayNum(" + dateCol + ")"
+}
+
+//内层按日期分组的查询中变换需要的列
+func (this *Event) transformCols(zhibiao request.EventZhibiao) (cols []string) {
+	if zhibiao.Transform == TransformNone {
+		return
+	}
+	dateCol := "xwl_part_date"
+	if this.compare != nil {
+		dateCol = this.compare.dateCol()
+	}
+	cols = append(cols, " min("+this.periodNoSql(dateCol)+") as period_no ")
+	if needUniqState(zhibiao) {
+		col := zhibiao.SelectAttr[0]
+		if col == utils.Default {
+			col = "xwl_distinct_id"
+		}
+		cols = append(cols, " uniqExactState("+col+") as uniq_state ")
+	}
+	return
+}
+
+//外层各日期分组变换后的指标值
+func (this *Event) transformAmountSql(zhibiao request.EventZhibiao) string {
+	if zhibiao.Transform == TransformNone {
+		return "groupArray(toString(amount))"
+	}
+	window := strconv.Itoa(zhibiao.TransformWindow)
+	valuesSql := "arrayMap(x -> toFloat64OrZero(replaceAll(toString(x), '%', '')), groupArray(amount))"
+	periodsSql := "groupArray(period_no)"
+
+	var amountSql string
+	switch zhibiao.Transform {
+	case TransformCumulative:
+		amountSql = "arrayMap(p -> arraySum(arrayFilter((v, q) -> q <= p, " + valuesSql + ", " + periodsSql + ")), " + periodsSql + ")"
+		if isDistinctZhibiao(zhibiao) {
+			amountSql = "arrayMap(p -> toFloat64(arrayReduce('uniqExactMerge', arrayFilter((s, q) -> q <= p, groupArray(uniq_state), " + periodsSql + "))), " + periodsSql + ")"
+		}
+	case TransformMoving:
+		amountSql = "arrayMap(p -> arraySum(arrayFilter((v, q) -> q > p - " + window + " and q <= p, " + valuesSql + ", " + periodsSql + ")) / " + window + ", " + periodsSql + ")"
+	case TransformRolling:
+		amountSql = "arrayMap(p -> toFloat64(arrayReduce('uniqExactMerge', arrayFilter((s, q) -> q > p - " + window + " and q <= p, groupArray(uniq_state), " + periodsSql + "))), " + periodsSql + ")"
+	}
+
+	if zhibiao.Typ == Formula && zhibiao.ScaleType == utils.Percentage {
+		return "arrayMap(x -> concat(toString(round(x, 2)), '%'), " + amountSql + ")"
+	}
+	return "arrayMap(x -> toString(round(x, 2)), " + amountSql + ")"
+}
+
+//去掉查询开始日期之前的日期分组
+func (this *Event) visibleSql(zhibiao request.EventZhibiao, arrSql string) string {
+	if this.lookbackOf(zhibiao) <= 0 {
+		return arrSql
+	}
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	return "arrayFilter((x, p) -> p >= " + this.periodNoSql("toDateTime('"+startT.Format(util.TimeFormat)+"')") + ", " + arrSql + ", groupArray(period_no))"
+}
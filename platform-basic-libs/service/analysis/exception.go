@@ -2,20 +2,42 @@ package analysis
 
 // 内置异常
 const (
-	TimeError           int = 60001
-	ZhiBiaoNumError     int = 60002
-	GroupNumError       int = 60003
-	GroupEmptyError     int = 60004
-	UIEmptyError        int = 60005
-	EventNameEmptyError int = 60006
+	TimeError               int = 60001
+	ZhiBiaoNumError         int = 60002
+	GroupNumError           int = 60003
+	GroupEmptyError         int = 60004
+	UIEmptyError            int = 60005
+	EventNameEmptyError     int = 60006
+	FunnelModeError         int = 60007
+	RetentionTypeError      int = 60008
+	RetentionMetricError    int = 60009
+	IntervalTypeError       int = 60010
+	DistributionMetricError int = 60011
+	DistributionBoundsError int = 60012
+	LtvAmountError          int = 60013
+	AttributionModelError   int = 60014
+	AttributionTouchError   int = 60015
+	EventCompareError       int = 60016
+	EventTransformError     int = 60017
 )
 
 // 内置异常表
 var ERROR_TABLE = map[int]string{
-	TimeError:           "筛选时间异常",
-	ZhiBiaoNumError:     "筛选指标个数异常",
-	GroupNumError:       "筛选分组个数异常",
-	GroupEmptyError:     "筛选分组不能为空字段",
-	UIEmptyError:        "用户id列表不能为空",
-	EventNameEmptyError: "事件名不能为空",
+	TimeError:               "筛选时间异常",
+	ZhiBiaoNumError:         "筛选指标个数异常",
+	GroupNumError:           "筛选分组个数异常",
+	GroupEmptyError:         "筛选分组不能为空字段",
+	UIEmptyError:            "用户id列表不能为空",
+	EventNameEmptyError:     "事件名不能为空",
+	FunnelModeError:         "漏斗模式异常",
+	RetentionTypeError:      "留存类型异常",
+	RetentionMetricError:    "留存回访指标异常",
+	IntervalTypeError:       "间隔类型异常",
+	DistributionMetricError: "分布指标异常",
+	DistributionBoundsError: "分布区间异常",
+	LtvAmountError:          "付费金额属性不能为空",
+	AttributionModelError:   "归因模型异常",
+	AttributionTouchError:   "触点事件不能为空",
+	EventCompareError:       "对比时段异常",
+	EventTransformError:     "指标变换异常",
 }
@@ -1,49 +1,88 @@
 package analysis
 
 import (
-	"database/sql"
 	"github.com/1340691923/xwl_bi/engine/logs"
 
-	"fmt"
 	"github.com/1340691923/xwl_bi/engine/db"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
 	jsoniter "github.com/json-iterator/go"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type Funnel struct {
-	sql  string
-	args []interface{}
-	req  request.FunnelReqData
+	sql           string
+	args          []interface{}
+	req           request.FunnelReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	groupDims     groupDims
+	userGroupSql  string
+	userGroupArgs []interface{}
 }
 
-func (this *Funnel) GetExecSql() (SQL string, allArgs []interface{}, err error) {
-
-	startTime := this.req.Date[0] + " 00:00:00"
-	endTime := this.req.Date[1] + " 23:59:59"
-
-	windowSql := ""
+//趋势的结果行类型 总体与分组见groupRowTotal等
+const funnelRowTrend = 3
 
+//各步骤的事件条件 计算趋势时步骤1限定在用户进入漏斗的周期内
+func (this *Funnel) stepConds(trend bool) (conds []string, allArgs []interface{}, err error) {
 	for _, zhibiao := range this.req.ZhibiaoArr {
-		windowSql = windowSql + ","
-
-		windowSql = windowSql + fmt.Sprintf(" xwl_part_event = '%v' ", zhibiao.EventName)
+		eventSqlArr := []string{}
+		for _, eventName := range append([]string{zhibiao.EventName}, zhibiao.OrEventNames...) {
+			sql, args, err := this.virtualEvents.EventSql(eventName)
+			if err != nil {
+				return nil, nil, err
+			}
+			eventSqlArr = append(eventSqlArr, sql)
+			allArgs = append(allArgs, args...)
+		}
+		eventSql := eventSqlArr[0]
+		if len(eventSqlArr) > 1 {
+			eventSql = " ( " + strings.Join(eventSqlArr, " or ") + " ) "
+		}
 
 		if len(zhibiao.Relation.Filts) > 0 {
-			windowSql = windowSql + " and "
 			sql, args, _, err := utils.GetWhereSql(zhibiao.Relation)
-
 			if err != nil {
-				return SQL, allArgs, err
+				return nil, nil, err
 			}
-
 			allArgs = append(allArgs, args...)
-
-			windowSql = windowSql + sql
+			eventSql = eventSql + " and " + sql
 		}
+		conds = append(conds, eventSql)
+	}
+	if trend && len(conds) > 0 {
+		conds[0] = "(" + conds[0] + ") and " + this.trendPeriodSql("xwl_part_date") + " = start_period"
 	}
+	return
+}
+
+//趋势周期 用户进入步骤1的时间所在的天 周或月
+func (this *Funnel) trendPeriodSql(col string) string {
+	switch this.req.TrendType {
+	case ByWeek:
+		return "toMonday(" + col + ")"
+	case Monthly:
+		return "toStartOfMonth(" + col + ")"
+	}
+	return "toDate(" + col + ")"
+}
+
+//事件可能所属的漏斗开始周期 即窗口期内往前每一天所在的周期
+func (this *Funnel) trendPeriodsSql() string {
+	days := (this.req.WindowTime + 86399) / 86400
+	return "arrayDistinct(arrayPushBack(arrayMap(i -> " + this.trendPeriodSql("xwl_part_date - i * 86400") + ", range(" + strconv.Itoa(days) + ")), " +
+		this.trendPeriodSql("xwl_part_date - "+strconv.Itoa(this.req.WindowTime)) + "))"
+}
+
+//时间范围 全局筛选 用户分群以及用户属性筛选
+func (this *Funnel) whereSql() (SQL string, allArgs []interface{}, err error) {
+	startTime := this.req.Date[0] + " 00:00:00"
+	endTime := this.req.Date[1] + " 23:59:59"
 
 	var userFilterSql string
 	var userFilterArgs []interface{}
@@ -59,68 +98,156 @@ func (this *Funnel) GetExecSql() (SQL string, allArgs []interface{}, err error)
 	}
 
 	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
-
-	whereFilterSql = whereFilterSql + this.sql
+	if err != nil {
+		logs.Logger.Sugar().Errorf("req.WhereFilter", this.req.WhereFilter)
+		return
+	}
 
 	allArgs = append(allArgs, whereFilterArgs...)
-
 	allArgs = append(allArgs, this.args...)
-
 	allArgs = append(allArgs, userFilterArgs...)
 
+	SQL = `xwl_part_date >= toDateTime('` + startTime + `') and xwl_part_date <= toDateTime('` + endTime + `') and ` + whereFilterSql + this.sql + ` ` + userFilterSql
+	return
+}
+
+//windowFunnel函数及其模式参数
+func (this *Funnel) windowFunnelSql() string {
+	params := []string{strconv.Itoa(this.req.WindowTime)}
+	for _, mode := range this.req.Mode {
+		params = append(params, "'"+mode+"'")
+	}
+	return "windowFunnel(" + strings.Join(params, ",") + ")"
+}
+
+//每个用户的漏斗计算结果 cols为按用户聚合的列 aliases为其别名
+//事件属性分组在扫描事件时拆分 用户属性与用户分群在聚合后再关联 trend为true时按用户进入步骤1的周期拆分
+func (this *Funnel) userSql(cols, aliases []string, colArgs []interface{}, having string, grouped, trend bool) (SQL string, allArgs []interface{}, err error) {
+	whereSql, whereArgs, err := this.whereSql()
 	if err != nil {
-		logs.Logger.Sugar().Errorf("req.WhereFilter", this.req.WhereFilter)
 		return
 	}
 
-	SQL = `SELECT '总体' as groupkey,level_index,count(1) as count,groupUniqArray(xwl_distinct_id) as ui  FROM
-			(
-				SELECT  xwl_distinct_id,
-					arrayWithConstant(windowFunnel_level, 1) levels, 
-					arrayJoin(arrayEnumerate( levels )) level_index
-				  FROM (
-					SELECT
-					  xwl_distinct_id,
-					  windowFunnel(` + strconv.Itoa(this.req.WindowTime) + `)(
-						xwl_part_date
-						` + windowSql + `
-					  ) AS windowFunnel_level
-					FROM  xwl_event` + strconv.Itoa(this.req.Appid) + `   
-					WHERE xwl_part_date >= toDateTime('` + startTime + `') and xwl_part_date <= toDateTime('` + endTime + `') and ` + whereFilterSql + ` ` + userFilterSql + `
-					GROUP BY xwl_distinct_id
-				)
-			)
-			group by level_index
-			ORDER BY level_index limit 1000
-	`
+	dateGroupSql := "'" + ByTotal + "'"
+	arrayJoinSql := ""
+	if trend {
+		dateGroupSql = "toString(start_period)"
+		arrayJoinSql = " ARRAY JOIN " + this.trendPeriodsSql() + " AS start_period"
+		whereSql = whereSql + " and start_period >= " + this.trendPeriodSql("toDate('"+this.req.Date[0]+"')")
+	}
 
-	if len(this.req.GroupBy) > 0 {
-		groupSql := `SELECT toString(groupkey) as groupkey,level_index,count(1) as count ,groupUniqArray(xwl_distinct_id) as ui FROM
+	var dims groupDims
+	if grouped {
+		dims = this.groupDims
+	}
+	eventGroupSql := dims.eventGroupSql()
+	groupValuesSql, joinSql, outerArr, outerArgs := dims.valuesSql(this.req.Appid, "event_group", this.userGroupSql, this.userGroupArgs)
+
+	innerSql := `SELECT xwl_distinct_id, ` + dateGroupSql + ` AS date_group, ` + eventGroupSql + ` AS event_group,
+						` + strings.Join(cols, ",\n\t\t\t\t\t\t") + `
+					FROM xwl_event` + strconv.Itoa(this.req.Appid) + arrayJoinSql + `
+					WHERE ` + whereSql + `
+					GROUP BY xwl_distinct_id, date_group, event_group`
+	if having != "" {
+		innerSql = innerSql + `
+					HAVING ` + having
+	}
+
+	outerArr = append(outerArr, "xwl_distinct_id", "date_group", groupValuesSql+" AS group_values")
+	outerArr = append(outerArr, aliases...)
+
+	SQL = `SELECT ` + strings.Join(outerArr, ", ") + ` FROM (
+					` + innerSql + `
+				)` + joinSql
+
+	allArgs = append(allArgs, outerArgs...)
+	allArgs = append(allArgs, colArgs...)
+	allArgs = append(allArgs, whereArgs...)
+	return
+}
+
+//每个用户到达的步骤数
+func (this *Funnel) levelUserSql(grouped, trend bool) (SQL string, allArgs []interface{}, err error) {
+	conds, condArgs, err := this.stepConds(trend)
+	if err != nil {
+		return
+	}
+	col := this.windowFunnelSql() + "(xwl_part_date," + strings.Join(conds, ",") + ") AS funnel_level"
+	return this.userSql([]string{col}, []string{"funnel_level"}, condArgs, "", grouped, trend)
+}
+
+//步骤1人数最多的若干个分组 其余分组合并为其他
+func (this *Funnel) topGroupsSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.levelUserSql(true, false)
+	if err != nil {
+		return
+	}
+	SQL = topGroupsSql(userSql, "funnel_level > 0", "uniqExact(xwl_distinct_id)", this.req.GroupLimit)
+	return
+}
+
+//总体 分组以及趋势各步骤的人数
+func (this *Funnel) levelSql(grouped, trend bool) (SQL string, allArgs []interface{}, err error) {
+	topGroupsSql := ""
+	if grouped {
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
+	}
+	topGroupsSql, rowTypeSql, groupsSql := groupRowSql(topGroupsSql)
+	if trend && !grouped {
+		rowTypeSql = strconv.Itoa(funnelRowTrend)
+	}
+
+	userSql, userArgs, err := this.levelUserSql(grouped, trend)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, userArgs...)
+
+	SQL = `SELECT row_type, date_group, groups AS group_values, level_index, uniqExact(xwl_distinct_id) AS count, groupUniqArray(xwl_distinct_id) AS ui FROM
 			(
-				SELECT  xwl_distinct_id, groupkey,
-					arrayWithConstant(windowFunnel_level, 1) levels, 
-					arrayJoin(arrayEnumerate( levels )) level_index
-				  FROM (
-					SELECT
-					  xwl_distinct_id, ` + this.req.GroupBy[0] + ` groupkey,
-					  windowFunnel(` + strconv.Itoa(this.req.WindowTime) + `)(
-						xwl_part_date
-						` + windowSql + ` 
-					  ) AS windowFunnel_level
-					  FROM xwl_event` + strconv.Itoa(this.req.Appid) + ` 
-					  WHERE xwl_part_date >= toDateTime('` + startTime + `') and xwl_part_date <= toDateTime('` + endTime + `') and ` + whereFilterSql + `  ` + userFilterSql + `
-					
-					GROUP BY xwl_distinct_id,groupkey
-				)
+				SELECT xwl_distinct_id, date_group, ` + topGroupsSql + `
+					toUInt8(` + rowTypeSql + `) AS row_type,
+					` + groupsSql + ` AS groups,
+					arrayJoin(range(1, toUInt64(funnel_level) + 1)) AS level_index
+				FROM (` + userSql + `)
 			)
-			group by groupkey,level_index
-			ORDER BY groupkey,level_index limit 1000
+			GROUP BY row_type, date_group, groups, level_index
+			ORDER BY row_type, date_group, groups, level_index
 	`
-		SQL = fmt.Sprintf("%s UNION ALL %s", SQL, groupSql)
-		allArgs = append(allArgs, allArgs...)
+	return
+}
+
+func (this *Funnel) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	sqlArr := []string{}
+
+	SQL, allArgs, err = this.levelSql(false, false)
+	if err != nil {
+		return
 	}
+	sqlArr = append(sqlArr, SQL)
 
-	return SQL, allArgs, err
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.levelSql(true, false)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlArr = append(sqlArr, groupSql)
+		allArgs = append(allArgs, groupArgs...)
+	}
+
+	if this.req.TrendType != "" {
+		trendSql, trendArgs, err := this.levelSql(false, true)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlArr = append(sqlArr, trendSql)
+		allArgs = append(allArgs, trendArgs...)
+	}
+
+	return strings.Join(sqlArr, " UNION ALL "), allArgs, nil
 }
 
 type FunnelRes struct {
@@ -129,11 +256,13 @@ type FunnelRes struct {
 	UI         []string `json:"ui" db:"ui"`
 }
 
-type FunnelGroupRes struct {
-	Groupkey   sql.NullString `json:"groupkey" db:"groupkey"`
-	LevelIndex int            `json:"level_index" db:"level_index"`
-	UI         []string       `json:"ui" db:"ui"`
-	Count      int            `json:"count" db:"count"`
+type funnelLevelRes struct {
+	RowType     uint8    `db:"row_type"`
+	DateGroup   string   `db:"date_group"`
+	GroupValues []string `db:"group_values"`
+	LevelIndex  int      `db:"level_index"`
+	Count       uint64   `db:"count"`
+	UI          []string `db:"ui"`
 }
 
 func (this *Funnel) GetList() (interface{}, error) {
@@ -146,35 +275,108 @@ func (this *Funnel) GetList() (interface{}, error) {
 
 	logs.Logger.Sugar().Infof("SQL", sql, args)
 
-	var funnelGroupResList []FunnelGroupRes
+	var resList []funnelLevelRes
 
-	if err := db.ClickHouseSqlx.Select(&funnelGroupResList, sql, args...); err != nil {
+	if err := db.ClickHouseSqlx.Select(&resList, sql, args...); err != nil {
+		return nil, err
+	}
+
+	timeRes, err := this.conversionTime()
+	if err != nil {
+		return nil, err
+	}
+
+	groupValuesArr := [][]string{}
+	for _, v := range resList {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	for _, v := range timeRes {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	labels, err := this.groupDims.labels(this.attrDicts, groupValuesArr)
+	if err != nil {
 		return nil, err
 	}
 
 	groupData := map[string][]FunnelRes{}
+	trendData := map[string][]FunnelRes{}
 
-	for _, v := range funnelGroupResList {
-		if _, ok := groupData[v.Groupkey.String]; !ok {
-			groupData[v.Groupkey.String] = []FunnelRes{}
-		}
-		groupData[v.Groupkey.String] = append(groupData[v.Groupkey.String], FunnelRes{
+	for _, v := range resList {
+		res := FunnelRes{
 			LevelIndex: v.LevelIndex,
-			Count:      v.Count,
+			Count:      int(v.Count),
 			UI:         v.UI,
+		}
+		if v.RowType == funnelRowTrend {
+			trendData[v.DateGroup] = append(trendData[v.DateGroup], res)
+			continue
+		}
+		groupkey := this.groupKey(v.RowType, v.GroupValues, labels)
+		groupData[groupkey] = append(groupData[groupkey], res)
+	}
+
+	timeData := map[string][]FunnelStepTime{}
+	for _, v := range timeRes {
+		groupkey := this.groupKey(v.RowType, v.GroupValues, labels)
+		timeData[groupkey] = append(timeData[groupkey], v.stepTime(this.timeBuckets()))
+	}
+	for _, list := range timeData {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].LevelIndex < list[j].LevelIndex
 		})
 	}
 
-	return map[string]interface{}{"groupData": groupData}, nil
+	return map[string]interface{}{
+		"groupData":      groupData,
+		"trendData":      trendData,
+		"conversionTime": timeData,
+		"mode":           this.req.Mode,
+		"modeDesc":       this.modeDesc(),
+	}, nil
+}
+
+//分组名 总体与其他之外为各维度的值
+func (this *Funnel) groupKey(rowType uint8, groupValues []string, labels []map[string]string) string {
+	switch rowType {
+	case groupRowTotal:
+		return "总体"
+	case groupRowOther:
+		return otherGroup
+	}
+	return groupKeyOf(groupValues, labels)
+}
+
+//漏斗模式 对应windowFunnel的模式参数
+var funnelModes = map[string]string{
+	"strict_order":         "严格顺序:步骤之间出现其他步骤的事件时停止",
+	"strict_deduplication": "严格去重:步骤之间重复出现同一步骤的事件时停止",
+	"strict_increase":      "严格递增:步骤之间的时间必须严格递增",
+}
+
+//计算结果所用的漏斗模式说明
+func (this *Funnel) modeDesc() string {
+	if len(this.req.Mode) == 0 {
+		return "默认:窗口期内按顺序完成各步骤即可 不限制中间事件"
+	}
+	descArr := make([]string, len(this.req.Mode))
+	for index, mode := range this.req.Mode {
+		descArr[index] = funnelModes[mode]
+	}
+	return strings.Join(descArr, ";")
 }
 
 func NewFunnel(reqData []byte) (Ianalysis, error) {
-	obj := &Funnel{}
+	var req request.FunnelReqData
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	err := json.Unmarshal(reqData, &obj.req)
+	err := json.Unmarshal(reqData, &req)
 	if err != nil {
 		return nil, err
 	}
+	return newFunnel(req)
+}
+
+func newFunnel(req request.FunnelReqData) (obj *Funnel, err error) {
+	obj = &Funnel{req: req}
 
 	if len(obj.req.Date) < 2 {
 		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
@@ -182,6 +384,25 @@ func NewFunnel(reqData []byte) (Ianalysis, error) {
 	if len(obj.req.ZhibiaoArr) > 30 {
 		return nil, my_error.NewBusiness(ERROR_TABLE, ZhiBiaoNumError)
 	}
+	obj.req.GroupLimit = groupLimitOf(obj.req.GroupLimit)
+	switch obj.req.TrendType {
+	case ByTotal:
+		obj.req.TrendType = ""
+	case "", ByDay, ByWeek, Monthly:
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	modes := []string{}
+	for _, mode := range obj.req.Mode {
+		if _, ok := funnelModes[mode]; !ok {
+			return nil, my_error.NewBusiness(ERROR_TABLE, FunnelModeError)
+		}
+		if !util.InstrArr(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+	sort.Strings(modes)
+	obj.req.Mode = modes
 	var T int
 	switch obj.req.WindowTimeFormat {
 	case "天":
@@ -201,5 +422,32 @@ func NewFunnel(reqData []byte) (Ianalysis, error) {
 		return nil, err
 	}
 
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	for index := range obj.req.ZhibiaoArr {
+		virtualAttrs.ReplaceFilter(&obj.req.ZhibiaoArr[index].Relation)
+	}
+	obj.groupDims, err = newGroupDims(obj.req.GroupBy, obj.req.GroupByUser, obj.req.GroupByUserGroup, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.GroupByUserGroup) > 0 {
+		obj.userGroupSql, obj.userGroupArgs, err = utils.GetUserGroupNamesSql(obj.req.GroupByUserGroup, obj.req.Appid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
 	return obj, nil
 }
@@ -0,0 +1,263 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	dropOffNextEventLimit = 20
+	dropOffAttrValueLimit = 20
+	dropOffUserAttrMax    = 5
+)
+
+// 漏斗流失分析 到达某一步骤但在窗口期内未到达下一步骤的用户之后做了什么
+type FunnelDropOff struct {
+	funnel    *Funnel
+	step      int
+	userAttrs []string
+}
+
+type FunnelNextEvent struct {
+	EventName   string   `json:"event_name" db:"event_name"`
+	ShowName    string   `json:"show_name" db:"-"`
+	UserCount   uint64   `json:"user_count" db:"user_count"`
+	EventCount  uint64   `json:"event_count" db:"event_count"`
+	MedianDelay float64  `json:"median_delay" db:"median_delay"` //流失步骤之后首次触发该事件的耗时中位数 单位秒
+	UI          []string `json:"ui" db:"ui"`
+}
+
+type FunnelAttrValue struct {
+	Value        string  `json:"value"`
+	DropCount    int     `json:"drop_count"`
+	DropRate     float64 `json:"drop_rate"`
+	ConvertCount int     `json:"convert_count"`
+	ConvertRate  float64 `json:"convert_rate"`
+}
+
+type dropOffTotal struct {
+	DropCount    uint64   `db:"drop_count"`
+	ConvertCount uint64   `db:"convert_count"`
+	DropUI       []string `db:"drop_ui"`
+}
+
+type dropOffAttrRes struct {
+	IsDrop uint8  `db:"is_drop"`
+	Attr   string `db:"attr"`
+	Value  string `db:"value"`
+	Count  uint64 `db:"count"`
+}
+
+// 流失用户与转化用户
+func (this *FunnelDropOff) userSql() (SQL string, allArgs []interface{}, err error) {
+	return this.funnel.userPathSql(false, this.step)
+}
+
+// 流失用户在流失步骤之后 窗口期结束之前触发的事件
+func (this *FunnelDropOff) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.userSql()
+	if err != nil {
+		return
+	}
+	whereSql, whereArgs, err := this.funnel.whereSql()
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, whereArgs...)
+
+	step := strconv.Itoa(this.step)
+	SQL = `SELECT event_name, uniqExact(xwl_distinct_id) AS user_count, sum(cnt) AS event_count,
+				quantile(0.5)(delay) AS median_delay, groupUniqArray(xwl_distinct_id) AS ui
+			FROM (
+				SELECT xwl_distinct_id, xwl_part_event AS event_name, count(1) AS cnt,
+					min(toUInt32(xwl_part_date)) - any(drop_time) AS delay
+				FROM xwl_event` + strconv.Itoa(this.funnel.req.Appid) + `
+				ANY INNER JOIN (
+					SELECT xwl_distinct_id, path[` + step + `] AS drop_time, path[1] + ` + strconv.Itoa(this.funnel.req.WindowTime) + ` AS end_time
+					FROM (` + userSql + `) WHERE level = ` + step + `
+				) USING xwl_distinct_id
+				WHERE ` + whereSql + ` and toUInt32(xwl_part_date) > drop_time and toUInt32(xwl_part_date) <= end_time
+				GROUP BY xwl_distinct_id, event_name
+			)
+			GROUP BY event_name
+			ORDER BY user_count DESC
+			LIMIT ` + strconv.Itoa(dropOffNextEventLimit)
+	return
+}
+
+func (this *FunnelDropOff) totalSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.userSql()
+	if err != nil {
+		return
+	}
+	step := strconv.Itoa(this.step)
+	SQL = `SELECT countIf(level = ` + step + `) AS drop_count, countIf(level > ` + step + `) AS convert_count,
+				groupUniqArrayIf(xwl_distinct_id, level = ` + step + `) AS drop_ui
+			FROM (` + userSql + `)`
+	return
+}
+
+// 流失用户与转化用户各用户属性取值最多的若干个值
+func (this *FunnelDropOff) attrSql() (SQL string, allArgs []interface{}, err error) {
+	kvArr := make([]string, len(this.userAttrs))
+	for index, attr := range this.userAttrs {
+		kvArr[index] = "tuple(?, ifNull(toString(" + attr + "),''))"
+		allArgs = append(allArgs, attr)
+	}
+	userSql, userArgs, err := this.userSql()
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, userArgs...)
+
+	SQL = `SELECT toUInt8(level = ` + strconv.Itoa(this.step) + `) AS is_drop, kv.1 AS attr, kv.2 AS value, uniqExact(xwl_distinct_id) AS count
+			FROM (
+				SELECT xwl_distinct_id, level, arrayJoin([` + strings.Join(kvArr, ",") + `]) AS kv
+				FROM (SELECT xwl_distinct_id, level FROM (` + userSql + `))
+				ANY LEFT JOIN ` + utils.GetUserTableView(this.funnel.req.Appid, this.userAttrs) + ` USING xwl_distinct_id
+			)
+			GROUP BY is_drop, attr, value
+			ORDER BY count DESC
+			LIMIT ` + strconv.Itoa(dropOffAttrValueLimit) + ` BY is_drop, attr`
+	return
+}
+
+func (this *FunnelDropOff) GetList() (interface{}, error) {
+	SQL, args, err := this.totalSql()
+	if err != nil {
+		return nil, err
+	}
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+	var total dropOffTotal
+	if err = db.ClickHouseSqlx.Get(&total, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	SQL, args, err = this.GetExecSql()
+	if err != nil {
+		return nil, err
+	}
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+	nextEvents := []FunnelNextEvent{}
+	if err = db.ClickHouseSqlx.Select(&nextEvents, SQL, args...); err != nil {
+		return nil, err
+	}
+	if err = this.fillShowName(nextEvents); err != nil {
+		return nil, err
+	}
+
+	attrDistribution := map[string][]FunnelAttrValue{}
+	if len(this.userAttrs) > 0 {
+		SQL, args, err = this.attrSql()
+		if err != nil {
+			return nil, err
+		}
+		logs.Logger.Sugar().Infof("SQL", SQL, args)
+		var attrResList []dropOffAttrRes
+		if err = db.ClickHouseSqlx.Select(&attrResList, SQL, args...); err != nil {
+			return nil, err
+		}
+		attrDistribution = this.attrDistribution(attrResList, total)
+	}
+
+	return map[string]interface{}{
+		"step":             this.step,
+		"dropCount":        total.DropCount,
+		"convertCount":     total.ConvertCount,
+		"dropUI":           total.DropUI,
+		"nextEvents":       nextEvents,
+		"attrDistribution": attrDistribution,
+		"modeDesc":         this.funnel.modeDesc(),
+	}, nil
+}
+
+func (this *FunnelDropOff) fillShowName(nextEvents []FunnelNextEvent) (err error) {
+	type metaEvent struct {
+		EventName string `db:"event_name"`
+		ShowName  string `db:"show_name"`
+	}
+	var list []metaEvent
+	if err = db.Sqlx.Select(&list, "select event_name,show_name from meta_event where appid = ?", this.funnel.req.Appid); err != nil {
+		return
+	}
+	showNames := map[string]string{}
+	for _, v := range list {
+		showNames[v.EventName] = v.ShowName
+	}
+	for index, v := range nextEvents {
+		nextEvents[index].ShowName = showNames[v.EventName]
+		if nextEvents[index].ShowName == "" {
+			nextEvents[index].ShowName = v.EventName
+		}
+	}
+	return
+}
+
+// 合并流失与转化用户的属性值 占比为占各自总人数的百分比
+func (this *FunnelDropOff) attrDistribution(attrResList []dropOffAttrRes, total dropOffTotal) map[string][]FunnelAttrValue {
+	attrDistribution := map[string][]FunnelAttrValue{}
+	indexMap := map[string]map[string]int{}
+	for _, attr := range this.userAttrs {
+		attrDistribution[attr] = []FunnelAttrValue{}
+		indexMap[attr] = map[string]int{}
+	}
+	for _, v := range attrResList {
+		index, ok := indexMap[v.Attr][v.Value]
+		if !ok {
+			index = len(attrDistribution[v.Attr])
+			indexMap[v.Attr][v.Value] = index
+			attrDistribution[v.Attr] = append(attrDistribution[v.Attr], FunnelAttrValue{Value: v.Value})
+		}
+		item := &attrDistribution[v.Attr][index]
+		if v.IsDrop == 1 {
+			item.DropCount = int(v.Count)
+			item.DropRate = dropOffRate(v.Count, total.DropCount)
+		} else {
+			item.ConvertCount = int(v.Count)
+			item.ConvertRate = dropOffRate(v.Count, total.ConvertCount)
+		}
+	}
+	return attrDistribution
+}
+
+func dropOffRate(count, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(int64(float64(count)/float64(total)*10000)) / 100
+}
+
+func NewFunnelDropOff(reqData []byte) (Ianalysis, error) {
+	var req request.FunnelDropOffReqData
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Step < 1 || req.Step >= len(req.ZhibiaoArr) {
+		return nil, my_error.NewBusiness(ERROR_TABLE, ZhiBiaoNumError)
+	}
+	if len(req.UserAttrs) > dropOffUserAttrMax {
+		return nil, my_error.NewBusiness(ERROR_TABLE, GroupNumError)
+	}
+	for _, attr := range req.UserAttrs {
+		if attr == "" {
+			return nil, my_error.NewBusiness(ERROR_TABLE, GroupEmptyError)
+		}
+	}
+	//流失分析只看总体
+	req.GroupBy, req.GroupByUser, req.GroupByUserGroup, req.TrendType = nil, nil, nil, ""
+
+	funnel, err := newFunnel(req.FunnelReqData)
+	if err != nil {
+		return nil, err
+	}
+	return &FunnelDropOff{funnel: funnel, step: req.Step, userAttrs: req.UserAttrs}, nil
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+)
+
+//步骤未到达时的占位时间 大于任何事件时间
+const funnelTimeNone = "4294967295"
+
+//相邻步骤的转化耗时
+type FunnelStepTime struct {
+	LevelIndex int              `json:"level_index"` //从该步骤转化到下一步骤
+	Count      int              `json:"count"`
+	Median     float64          `json:"median"` //单位秒
+	P75        float64          `json:"p75"`
+	P90        float64          `json:"p90"`
+	Buckets    []DurationBucket `json:"buckets"`
+}
+
+type funnelTimeRes struct {
+	RowType      uint8      `db:"row_type"`
+	GroupValues  []string   `db:"group_values"`
+	LevelIndex   int        `db:"level_index"`
+	Count        uint64     `db:"count"`
+	Quantiles    []float64  `db:"quantiles"`
+	Buckets      []uint8    `db:"buckets"`
+	BucketCounts []uint64   `db:"bucket_counts"`
+	BucketUI     [][]string `db:"bucket_ui"`
+}
+
+func (this funnelTimeRes) stepTime(buckets []int) (stepTime FunnelStepTime) {
+	stepTime = FunnelStepTime{
+		LevelIndex: this.LevelIndex,
+		Count:      int(this.Count),
+	}
+	if len(this.Quantiles) == 3 {
+		stepTime.Median, stepTime.P75, stepTime.P90 = this.Quantiles[0], this.Quantiles[1], this.Quantiles[2]
+	}
+	stepTime.Buckets = newDurationBuckets(buckets, this.Buckets, this.BucketCounts, this.BucketUI)
+	return
+}
+
+func (this *Funnel) timeBuckets() []int {
+	return durationBucketsWithin(this.req.WindowTime)
+}
+
+//每个用户在窗口期内到达的最深路径以及各步骤的时间
+//从每个步骤1出发 依次取下一步骤在上一步骤之后最早的一次 到达步骤最多的路径即为该用户的转化路径
+//严格模式下到达的步骤数以windowFunnel为准 保证与漏斗人数一致 只返回至少到达minLevel步的用户
+func (this *Funnel) userPathSql(grouped bool, minLevel int) (SQL string, allArgs []interface{}, err error) {
+	conds, condArgs, err := this.stepConds(false)
+	if err != nil {
+		return
+	}
+	//条件在路径与windowFunnel中各用一次
+	colArgs := append(append([]interface{}{}, condArgs...), condArgs...)
+
+	cols := make([]string, 0, len(conds)+1)
+	aliases := make([]string, 0, len(conds)+1)
+	for index, cond := range conds {
+		cols = append(cols, fmt.Sprintf("arrayPushBack(arraySort(groupArrayIf(toUInt32(xwl_part_date),%s)),%s) AS t%d", cond, funnelTimeNone, index+1))
+		aliases = append(aliases, fmt.Sprintf("t%d", index+1))
+	}
+	cols = append(cols, this.windowFunnelSql()+"(xwl_part_date,"+strings.Join(conds, ",")+") AS funnel_level")
+	aliases = append(aliases, "funnel_level")
+
+	userSql, allArgs, err := this.userSql(cols, aliases, colArgs, "length(t1) > 1", grouped, false)
+	if err != nil {
+		return
+	}
+
+	pathArr := []string{"s"}
+	prev := "s"
+	for index := 2; index <= len(conds); index++ {
+		prev = fmt.Sprintf("arrayFirst(x%d -> x%d > %s or x%d = %s, t%d)", index, index, prev, index, funnelTimeNone, index)
+		pathArr = append(pathArr, prev)
+	}
+
+	SQL = `SELECT xwl_distinct_id, group_values, paths[indexOf(levels, max_level)] AS path, level FROM (
+				SELECT xwl_distinct_id, group_values,
+					arrayMap(s -> [` + strings.Join(pathArr, ",") + `], arrayPopBack(t1)) AS paths,
+					arrayMap(p -> arrayCount(x -> x <= p[1] + ` + strconv.Itoa(this.req.WindowTime) + `, p), paths) AS levels,
+					arrayMax(levels) AS max_level,
+					least(max_level, funnel_level) AS level
+				FROM (` + userSql + `)
+			) WHERE level >= ` + strconv.Itoa(minLevel)
+	return
+}
+
+//其他分组中的用户来自多个分组 不计算转化耗时
+func (this *Funnel) conversionTimeSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	rowTypeSql := strconv.Itoa(groupRowTotal)
+	topGroupsSql := ""
+	whereSql := ""
+	if grouped {
+		rowTypeSql = strconv.Itoa(groupRowGroup)
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
+		topGroupsSql = topGroupsSql + " AS top_groups, "
+		whereSql = " WHERE has(top_groups, group_values)"
+	}
+
+	pathSql, pathArgs, err := this.userPathSql(grouped, 2)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, pathArgs...)
+
+	bucketSql := durationBucketSql("duration", this.timeBuckets())
+
+	SQL = `SELECT toUInt8(` + rowTypeSql + `) AS row_type, group_values, level_index, sum(cnt) AS count,
+				quantilesMerge(0.5,0.75,0.9)(q) AS quantiles,
+				groupArray(bucket) AS buckets, groupArray(cnt) AS bucket_counts, groupArray(ui) AS bucket_ui
+			FROM (
+				SELECT group_values, level_index, toUInt8(` + bucketSql + `) AS bucket, count(1) AS cnt,
+					groupUniqArray(xwl_distinct_id) AS ui, quantilesState(0.5,0.75,0.9)(duration) AS q
+				FROM (
+					SELECT xwl_distinct_id, ` + topGroupsSql + `group_values, level_index, path[level_index + 1] - path[level_index] AS duration
+					FROM (` + pathSql + `)
+					ARRAY JOIN range(1, toUInt64(level)) AS level_index
+				)` + whereSql + `
+				GROUP BY group_values, level_index, bucket
+			)
+			GROUP BY group_values, level_index`
+	return
+}
+
+//各分组相邻步骤的转化耗时中位数 分位数以及耗时分布
+func (this *Funnel) conversionTime() (resList []funnelTimeRes, err error) {
+	if len(this.req.ZhibiaoArr) < 2 {
+		return
+	}
+
+	SQL, allArgs, err := this.conversionTimeSql(false)
+	if err != nil {
+		return
+	}
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.conversionTimeSql(true)
+		if err != nil {
+			return nil, err
+		}
+		SQL = fmt.Sprintf("%s UNION ALL %s", SQL, groupSql)
+		allArgs = append(allArgs, groupArgs...)
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, allArgs)
+
+	err = db.ClickHouseSqlx.Select(&resList, SQL, allArgs...)
+	return
+}
@@ -0,0 +1,174 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//分组维度 漏斗 留存 间隔 分布与LTV分析共用
+type groupDim struct {
+	name   string //属性名 用于查找字典显示名
+	col    string
+	source int //1为用户属性 2为事件属性 0为用户分群
+}
+
+type groupDims []groupDim
+
+const (
+	groupMax      = 3
+	groupLimit    = 20
+	groupLimitMax = 100
+	otherGroup    = "其他"
+	noUserGroup   = "未分群"
+)
+
+//结果行类型
+const (
+	groupRowTotal = 0 //总体
+	groupRowGroup = 1 //展示的分组
+	groupRowOther = 2 //合并为其他的分组
+)
+
+//按事件属性 用户属性 用户分群的顺序生成分组维度 最多groupMax个
+func newGroupDims(groupBy, groupByUser []string, groupByUserGroup []int, virtualAttrs utils.VirtualAttrs) (dims groupDims, err error) {
+	groupNum := len(groupBy) + len(groupByUser)
+	if len(groupByUserGroup) > 0 {
+		groupNum++
+	}
+	if groupNum > groupMax {
+		return nil, my_error.NewBusiness(ERROR_TABLE, GroupNumError)
+	}
+	for _, name := range append(append([]string{}, groupBy...), groupByUser...) {
+		if name == "" {
+			return nil, my_error.NewBusiness(ERROR_TABLE, GroupEmptyError)
+		}
+	}
+	for _, name := range groupBy {
+		dims = append(dims, groupDim{name: name, col: virtualAttrs.Col(name), source: 2})
+	}
+	for _, name := range groupByUser {
+		dims = append(dims, groupDim{name: name, col: name, source: 1})
+	}
+	if len(groupByUserGroup) > 0 {
+		dims = append(dims, groupDim{})
+	}
+	return
+}
+
+//事件属性分组在按用户聚合前取值 各维度的值组成数组
+func (this groupDims) eventGroupSql() string {
+	eventGroupArr := []string{}
+	for _, dim := range this {
+		if dim.source == 2 {
+			eventGroupArr = append(eventGroupArr, "ifNull(toString("+dim.col+"),'')")
+		}
+	}
+	if len(eventGroupArr) == 0 {
+		return "emptyArrayString()"
+	}
+	return "[" + strings.Join(eventGroupArr, ",") + "]"
+}
+
+//分组维度在外层查询中的取值 事件属性取自eventGroupCol 用户属性关联用户表 用户分群展开为多行
+//outerCols须放在外层查询的最前面 outerArgs为其参数
+func (this groupDims) valuesSql(appid int, eventGroupCol, userGroupSql string, userGroupArgs []interface{}) (groupValuesSql, joinSql string, outerCols []string, outerArgs []interface{}) {
+	groupArr := []string{}
+	userCols := []string{}
+	eventGroupIndex := 0
+	for _, dim := range this {
+		switch dim.source {
+		case 2:
+			eventGroupIndex++
+			groupArr = append(groupArr, eventGroupCol+"["+strconv.Itoa(eventGroupIndex)+"]")
+		case 1:
+			userCols = append(userCols, dim.col)
+			groupArr = append(groupArr, "ifNull(toString("+dim.col+"),'')")
+		default:
+			outerCols = append(outerCols,
+				userGroupSql+" AS user_groups",
+				"arrayJoin(if(empty(user_groups), ['"+noUserGroup+"'], user_groups)) AS user_group_name")
+			outerArgs = append(outerArgs, userGroupArgs...)
+			groupArr = append(groupArr, "user_group_name")
+		}
+	}
+	groupValuesSql = "emptyArrayString()"
+	if len(groupArr) > 0 {
+		groupValuesSql = "[" + strings.Join(groupArr, ",") + "]"
+	}
+	if len(userCols) > 0 {
+		joinSql = " ANY LEFT JOIN " + utils.GetUserTableView(appid, userCols) + " USING xwl_distinct_id"
+	}
+	return
+}
+
+//按orderSql排序最靠前的若干个分组
+func topGroupsSql(userSql, whereSql, orderSql string, limit int) string {
+	if whereSql != "" {
+		whereSql = " WHERE " + whereSql
+	}
+	return `(SELECT groupArray(group_values) FROM (
+					SELECT group_values FROM (` + userSql + `)` + whereSql + `
+					GROUP BY group_values ORDER BY ` + orderSql + ` DESC LIMIT ` + strconv.Itoa(limit) + `
+				))`
+}
+
+//结果行类型与分组值 有展示分组时不在其中的分组合并为其他
+func groupRowSql(topGroupsSql string) (topGroupsCol, rowTypeSql, groupsSql string) {
+	if topGroupsSql == "" {
+		return "", strconv.Itoa(groupRowTotal), "group_values"
+	}
+	topGroupsCol = topGroupsSql + " AS top_groups, "
+	rowTypeSql = "if(has(top_groups, group_values), " + strconv.Itoa(groupRowGroup) + ", " + strconv.Itoa(groupRowOther) + ")"
+	groupsSql = "if(has(top_groups, group_values), group_values, emptyArrayString())"
+	return
+}
+
+//展示的分组个数 其余分组合并为其他
+func groupLimitOf(limit int) int {
+	if limit <= 0 {
+		return groupLimit
+	}
+	if limit > groupLimitMax {
+		return groupLimitMax
+	}
+	return limit
+}
+
+//分组名 多个维度的值以逗号连接
+func groupKeyOf(groupValues []string, labels []map[string]string) string {
+	keys := make([]string, len(groupValues))
+	for index, value := range groupValues {
+		keys[index] = value
+		if index < len(labels) {
+			if label, ok := labels[index][value]; ok {
+				keys[index] = label
+			}
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+//各分组维度配置了字典时 分组值展示为显示名
+func (this groupDims) labels(attrDicts utils.AttrDicts, groupValuesArr [][]string) (labels []map[string]string, err error) {
+	labels = make([]map[string]string, len(this))
+	for index, dim := range this {
+		labels[index] = map[string]string{}
+		if dim.source != 2 || !attrDicts.Has(dim.name) {
+			continue
+		}
+		values := []string{}
+		for _, groupValues := range groupValuesArr {
+			if index < len(groupValues) && !util.InstrArr(values, groupValues[index]) {
+				values = append(values, groupValues[index])
+			}
+		}
+		if labels[index], err = attrDicts.Labels(dim.name, values); err != nil {
+			return
+		}
+	}
+	return
+}
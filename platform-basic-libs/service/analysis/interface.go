@@ -21,6 +21,12 @@ const (
 	UserListCommand            Command = 6
 	UserEventDetailListCommand Command = 7
 	UserEventCountCommand      Command = 8
+	FunnelDropOffCommand       Command = 9
+	LifecycleCommand           Command = 10
+	IntervalCommand            Command = 11
+	DistributionCommand        Command = 12
+	LtvCommand                 Command = 13
+	AttributionCommand         Command = 14
 )
 
 var commandMap = map[Command]func(reqData []byte) (Ianalysis, error){
@@ -32,6 +38,12 @@ var commandMap = map[Command]func(reqData []byte) (Ianalysis, error){
 	UserListCommand:            NewUserList,
 	UserEventDetailListCommand: NewUserEventDetailList,
 	UserEventCountCommand:      NewUserEventCountList,
+	FunnelDropOffCommand:       NewFunnelDropOff,
+	LifecycleCommand:           NewLifecycle,
+	IntervalCommand:            NewInterval,
+	DistributionCommand:        NewDistribution,
+	LtvCommand:                 NewLtv,
+	AttributionCommand:         NewAttribution,
 }
 
 func NewAnalysisByCommand(command Command, reqData []byte) (i Ianalysis, err error) {
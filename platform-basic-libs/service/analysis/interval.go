@@ -0,0 +1,380 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//间隔分析 起始事件与其后最早的一次结束事件之间的间隔
+type Interval struct {
+	sql           string
+	args          []interface{}
+	req           request.IntervalReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	groupDims     groupDims
+	userGroupSql  string
+	userGroupArgs []interface{}
+}
+
+const (
+	IntervalFirst = ""    //每个用户只取第一次起始事件
+	IntervalAll   = "all" //每次起始事件都与其后的结束事件配对
+)
+
+type IntervalRes struct {
+	PairCount int              `json:"pair_count"`
+	UserCount int              `json:"user_count"`
+	Min       float64          `json:"min"` //单位秒
+	Max       float64          `json:"max"`
+	Avg       float64          `json:"avg"`
+	P25       float64          `json:"p25"`
+	Median    float64          `json:"median"`
+	P75       float64          `json:"p75"`
+	P90       float64          `json:"p90"`
+	Buckets   []DurationBucket `json:"buckets"`
+}
+
+type intervalRowRes struct {
+	RowType      uint8      `db:"row_type"`
+	GroupValues  []string   `db:"group_values"`
+	PairCount    uint64     `db:"pair_count"`
+	UserCount    uint64     `db:"user_count"`
+	Min          float64    `db:"min_interval"`
+	Max          float64    `db:"max_interval"`
+	Avg          float64    `db:"avg_interval"`
+	Quantiles    []float64  `db:"quantiles"`
+	Buckets      []uint8    `db:"buckets"`
+	BucketCounts []uint64   `db:"bucket_counts"`
+	BucketUI     [][]string `db:"bucket_ui"`
+}
+
+func (this intervalRowRes) intervalRes(buckets []int) (res IntervalRes) {
+	res = IntervalRes{
+		PairCount: int(this.PairCount),
+		UserCount: int(this.UserCount),
+		Min:       this.Min,
+		Max:       this.Max,
+		Avg:       this.Avg,
+		Buckets:   newDurationBuckets(buckets, this.Buckets, this.BucketCounts, this.BucketUI),
+	}
+	if len(this.Quantiles) == 4 {
+		res.P25, res.Median, res.P75, res.P90 = this.Quantiles[0], this.Quantiles[1], this.Quantiles[2], this.Quantiles[3]
+	}
+	return
+}
+
+func (this *Interval) eventCond(index int) (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.virtualEvents.EventSql(this.req.ZhibiaoArr[index].EventName)
+	if err != nil {
+		return
+	}
+	if len(this.req.ZhibiaoArr[index].Relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(this.req.ZhibiaoArr[index].Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " and " + sql
+		allArgs = append(allArgs, args...)
+	}
+	return
+}
+
+//每个用户一行 起始事件的时间及其事件属性分组 结束事件的时间
+//结束事件最晚可以在结束日期之后的最大间隔内
+func (this *Interval) eventUserSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2).AddDate(0, 0, 1)
+	scanEndT := endT.Add(time.Duration(this.req.WindowTime) * time.Second)
+
+	startSql, startArgs, err := this.eventCond(0)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, startArgs...)
+
+	endSql, endArgs, err := this.eventCond(1)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, endArgs...)
+
+	eventGroupSql := "emptyArrayString()"
+	if grouped {
+		eventGroupSql = this.groupDims.eventGroupSql()
+	}
+
+	var userFilterSql string
+	var userFilterArgs []interface{}
+
+	if len(this.req.WhereFilterByUser.Filts) > 0 {
+		var colArr []string
+		var sql string
+		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
+		if err != nil {
+			return
+		}
+		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
+	}
+
+	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
+
+	partEventSql, partEventArgs, err := this.virtualEvents.EventInSql([]string{this.req.ZhibiaoArr[0].EventName, this.req.ZhibiaoArr[1].EventName})
+	if err != nil {
+		return
+	}
+
+	allArgs = append(allArgs, partEventArgs...)
+	allArgs = append(allArgs, whereFilterArgs...)
+	allArgs = append(allArgs, this.args...)
+	allArgs = append(allArgs, userFilterArgs...)
+
+	SQL = `SELECT xwl_distinct_id,
+				arraySort(x -> x.1, groupArrayIf(tuple(toUInt32(xwl_part_date), ` + eventGroupSql + `), ` + startSql + ` and xwl_part_date < toDateTime('` + endT.Format(util.TimeFormat) + `'))) AS starts,
+				arraySort(groupArrayIf(toUInt32(xwl_part_date), ` + endSql + `)) AS ends
+			FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+			prewhere xwl_part_date >= toDateTime('` + startT.Format(util.TimeFormat) + `') and xwl_part_date < toDateTime('` + scanEndT.Format(util.TimeFormat) + `') and ` + partEventSql + ` and ` + whereFilterSql + this.sql + ` ` + userFilterSql + `
+			GROUP BY xwl_distinct_id
+			HAVING length(starts) > 0 and length(ends) > 0`
+	return
+}
+
+//每个配对一行 起止事件相同时结束事件须晚于起始事件 否则可以同时发生
+//用户属性与用户分群在配对后再关联
+func (this *Interval) pairSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	var dims groupDims
+	if grouped {
+		dims = this.groupDims
+	}
+	groupValuesSql, joinSql, outerArr, outerArgs := dims.valuesSql(this.req.Appid, "event_group", this.userGroupSql, this.userGroupArgs)
+	allArgs = append(allArgs, outerArgs...)
+
+	eventUserSql, eventUserArgs, err := this.eventUserSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, eventUserArgs...)
+
+	startsSql := "starts"
+	if this.req.IntervalType == IntervalFirst {
+		startsSql = "arraySlice(starts, 1, 1)"
+	}
+	afterSql := ">="
+	if this.req.ZhibiaoArr[0].EventName == this.req.ZhibiaoArr[1].EventName {
+		afterSql = ">"
+	}
+
+	outerArr = append(outerArr, "xwl_distinct_id", groupValuesSql+" AS group_values", "duration")
+
+	SQL = `SELECT ` + strings.Join(outerArr, ", ") + ` FROM (
+				SELECT xwl_distinct_id, start_event.2 AS event_group, toInt64(arrayFirst(x -> x ` + afterSql + ` start_event.1, ends)) - start_event.1 AS duration
+				FROM (` + eventUserSql + `)
+				ARRAY JOIN ` + startsSql + ` AS start_event
+				WHERE duration >= 0 and duration <= ` + strconv.Itoa(this.req.WindowTime) + `
+			)` + joinSql
+	return
+}
+
+//配对数最多的若干个分组 其余分组合并为其他
+func (this *Interval) topGroupsSql() (SQL string, allArgs []interface{}, err error) {
+	pairSql, allArgs, err := this.pairSql(true)
+	if err != nil {
+		return
+	}
+	SQL = topGroupsSql(pairSql, "", "count(1)", this.req.GroupLimit)
+	return
+}
+
+func (this *Interval) intervalSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	topGroupsSql := ""
+	if grouped {
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
+	}
+	topGroupsSql, rowTypeSql, groupsSql := groupRowSql(topGroupsSql)
+
+	pairSql, pairArgs, err := this.pairSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, pairArgs...)
+
+	bucketSql := durationBucketSql("duration", durationBucketsWithin(this.req.WindowTime))
+
+	SQL = `SELECT row_type, groups AS group_values, sum(cnt) AS pair_count, uniqExactMerge(users) AS user_count,
+				toFloat64(min(min_value)) AS min_interval, toFloat64(max(max_value)) AS max_interval, sum(total) / sum(cnt) AS avg_interval,
+				quantilesMerge(0.25,0.5,0.75,0.9)(q) AS quantiles,
+				groupArray(bucket) AS buckets, groupArray(cnt) AS bucket_counts, groupArray(ui) AS bucket_ui
+			FROM (
+				SELECT row_type, groups, toUInt8(` + bucketSql + `) AS bucket, count(1) AS cnt,
+					min(duration) AS min_value, max(duration) AS max_value, sum(duration) AS total,
+					uniqExactState(xwl_distinct_id) AS users, groupUniqArray(xwl_distinct_id) AS ui,
+					quantilesState(0.25,0.5,0.75,0.9)(duration) AS q
+				FROM (
+					SELECT xwl_distinct_id, duration, ` + topGroupsSql + `toUInt8(` + rowTypeSql + `) AS row_type, ` + groupsSql + ` AS groups
+					FROM (` + pairSql + `)
+				)
+				GROUP BY row_type, groups, bucket
+			)
+			GROUP BY row_type, groups`
+	return
+}
+
+func (this *Interval) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.intervalSql(false)
+	if err != nil {
+		return
+	}
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.intervalSql(true)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = fmt.Sprintf("%s UNION ALL %s", SQL, groupSql)
+		allArgs = append(allArgs, groupArgs...)
+	}
+	return
+}
+
+func (this *Interval) GetList() (interface{}, error) {
+	SQL, args, err := this.GetExecSql()
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var resList []intervalRowRes
+	if err = db.ClickHouseSqlx.Select(&resList, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	groupValuesArr := [][]string{}
+	for _, v := range resList {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	labels, err := this.groupDims.labels(this.attrDicts, groupValuesArr)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := durationBucketsWithin(this.req.WindowTime)
+	alldata := intervalRowRes{}.intervalRes(buckets)
+	groupNames := []string{}
+	groupData := map[string]IntervalRes{}
+	var other *IntervalRes
+	for _, v := range resList {
+		res := v.intervalRes(buckets)
+		switch v.RowType {
+		case groupRowTotal:
+			alldata = res
+		case groupRowOther:
+			other = &res
+		default:
+			groupkey := groupKeyOf(v.GroupValues, labels)
+			groupNames = append(groupNames, groupkey)
+			groupData[groupkey] = res
+		}
+	}
+	//按配对数从多到少展示分组 其他排在最后
+	sort.SliceStable(groupNames, func(i, j int) bool {
+		return groupData[groupNames[i]].PairCount > groupData[groupNames[j]].PairCount
+	})
+	if other != nil {
+		groupNames = append(groupNames, otherGroup)
+		groupData[otherGroup] = *other
+	}
+
+	return map[string]interface{}{"alldata": alldata, "groupNames": groupNames, "groupData": groupData}, nil
+}
+
+func NewInterval(reqData []byte) (Ianalysis, error) {
+	obj := &Interval{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &obj.req)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.Date) < 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if len(obj.req.ZhibiaoArr) != 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, ZhiBiaoNumError)
+	}
+	for _, zhibiao := range obj.req.ZhibiaoArr {
+		if zhibiao.EventName == "" {
+			return nil, my_error.NewBusiness(ERROR_TABLE, EventNameEmptyError)
+		}
+	}
+	if obj.req.IntervalType != IntervalFirst && obj.req.IntervalType != IntervalAll {
+		return nil, my_error.NewBusiness(ERROR_TABLE, IntervalTypeError)
+	}
+	var T int
+	switch obj.req.WindowTimeFormat {
+	case "天":
+		T = 60 * 60 * 24
+	case "小时":
+		T = 60 * 60
+	case "分钟":
+		T = 60
+	case "秒":
+		T = 1
+	default:
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.WindowTime <= 0 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	obj.req.WindowTime = obj.req.WindowTime * T
+	obj.req.GroupLimit = groupLimitOf(obj.req.GroupLimit)
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	for index := range obj.req.ZhibiaoArr {
+		virtualAttrs.ReplaceFilter(&obj.req.ZhibiaoArr[index].Relation)
+	}
+	obj.groupDims, err = newGroupDims(obj.req.GroupBy, obj.req.GroupByUser, obj.req.GroupByUserGroup, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.GroupByUserGroup) > 0 {
+		obj.userGroupSql, obj.userGroupArgs, err = utils.GetUserGroupNamesSql(obj.req.GroupByUserGroup, obj.req.Appid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
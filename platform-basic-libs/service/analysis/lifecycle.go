@@ -0,0 +1,248 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//生命周期分析 每个周期的活跃用户分为新增 持续活跃 回流 以及本周期转为沉默的用户
+type Lifecycle struct {
+	sql           string
+	args          []interface{}
+	req           request.LifecycleReqData
+	virtualEvents utils.VirtualEvents
+}
+
+//用户在某个周期的状态
+const (
+	lifecycleNone        = 0
+	lifecycleNew         = 1 //首次活跃
+	lifecycleContinuing  = 2 //之前的沉默期内活跃过
+	lifecycleResurrected = 3 //沉默之后再次活跃
+	lifecycleDormant     = 4 //已连续沉默期个周期未活跃
+)
+
+type LifecycleBucket struct {
+	Count int      `json:"count"`
+	UI    []string `json:"ui"`
+}
+
+type LifecycleRes struct {
+	Dates       string          `json:"dates"`
+	New         LifecycleBucket `json:"new"`
+	Continuing  LifecycleBucket `json:"continuing"`
+	Resurrected LifecycleBucket `json:"resurrected"`
+	Dormant     LifecycleBucket `json:"dormant"`
+}
+
+type lifecycleRowRes struct {
+	Dates  string   `db:"dates"`
+	Status uint8    `db:"status"`
+	Count  uint64   `db:"count"`
+	UI     []string `db:"ui"`
+}
+
+//活跃事件 全局筛选 用户分群以及用户属性筛选
+func (this *Lifecycle) activeSql() (SQL string, allArgs []interface{}, err error) {
+	eventSqlArr := []string{}
+	for _, eventName := range append([]string{this.req.Zhibiao.EventName}, this.req.Zhibiao.OrEventNames...) {
+		sql, args, err := this.virtualEvents.EventSql(eventName)
+		if err != nil {
+			return "", nil, err
+		}
+		eventSqlArr = append(eventSqlArr, sql)
+		allArgs = append(allArgs, args...)
+	}
+	SQL = " ( " + strings.Join(eventSqlArr, " or ") + " ) "
+
+	if len(this.req.Zhibiao.Relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(this.req.Zhibiao.Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " and " + sql
+		allArgs = append(allArgs, args...)
+	}
+
+	var userFilterSql string
+	var userFilterArgs []interface{}
+
+	if len(this.req.WhereFilterByUser.Filts) > 0 {
+		var colArr []string
+		var sql string
+		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
+		if err != nil {
+			return
+		}
+		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
+	}
+
+	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
+
+	allArgs = append(allArgs, whereFilterArgs...)
+	allArgs = append(allArgs, this.args...)
+	allArgs = append(allArgs, userFilterArgs...)
+
+	SQL = SQL + ` and ` + whereFilterSql + this.sql + ` ` + userFilterSql
+	return
+}
+
+func (this *Lifecycle) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2)
+
+	periods := periodList(this.req.WindowTimeFormat, startT, endT)
+	if len(periods) == 0 {
+		return "", nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	periodArr := make([]string, len(periods))
+	for index, t := range periods {
+		periodArr[index] = "toDate('" + t.Format(util.TimeFormatDay2) + "')"
+	}
+	//往前多取沉默期个周期 用于判断第一个周期的用户状态
+	scanStartT := periodAdd(this.req.WindowTimeFormat, periods[0], -this.req.DormantTime)
+	scanEndT := endT.AddDate(0, 0, 1)
+
+	activeSql, activeArgs, err := this.activeSql()
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, activeArgs...)
+	allArgs = append(allArgs, activeArgs...)
+
+	dormantTime := strconv.Itoa(this.req.DormantTime)
+	dormantStartSql := unit.addFn + "(p, -" + dormantTime + ")"
+	activeInPeriod := "has(active_periods, p)"
+	activeBefore := "arrayExists(x -> x >= " + dormantStartSql + " and x < p, active_periods)"
+	dormantSql := "has(active_periods, " + dormantStartSql + ") and not arrayExists(x -> x > " + dormantStartSql + " and x <= p, active_periods)"
+
+	SQL = `SELECT formatDateTime(p, '%Y-%m-%d') AS dates, status, uniqExact(xwl_distinct_id) AS count, groupUniqArray(xwl_distinct_id) AS ui
+			FROM (
+				SELECT xwl_distinct_id, p, toUInt8(multiIf(
+					` + activeInPeriod + ` and first_period = p, ` + strconv.Itoa(lifecycleNew) + `,
+					` + activeInPeriod + ` and ` + activeBefore + `, ` + strconv.Itoa(lifecycleContinuing) + `,
+					` + activeInPeriod + `, ` + strconv.Itoa(lifecycleResurrected) + `,
+					` + dormantSql + `, ` + strconv.Itoa(lifecycleDormant) + `,
+					` + strconv.Itoa(lifecycleNone) + `)) AS status
+				FROM (
+					SELECT xwl_distinct_id, groupUniqArray(` + unit.periodFn + `(xwl_part_date)) AS active_periods
+					FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+					prewhere xwl_part_date >= toDateTime('` + scanStartT.Format(util.TimeFormat) + `') and xwl_part_date < toDateTime('` + scanEndT.Format(util.TimeFormat) + `') and ` + activeSql + `
+					GROUP BY xwl_distinct_id
+				) ANY INNER JOIN (
+					SELECT xwl_distinct_id, ` + unit.periodFn + `(min(xwl_part_date)) AS first_period
+					FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+					prewhere xwl_part_date < toDateTime('` + scanEndT.Format(util.TimeFormat) + `') and ` + activeSql + `
+					GROUP BY xwl_distinct_id
+				) USING xwl_distinct_id
+				ARRAY JOIN [` + strings.Join(periodArr, ",") + `] AS p
+			)
+			WHERE status > ` + strconv.Itoa(lifecycleNone) + `
+			GROUP BY p, status
+			ORDER BY p, status`
+	return
+}
+
+func (this *Lifecycle) GetList() (interface{}, error) {
+	SQL, args, err := this.GetExecSql()
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var resList []lifecycleRowRes
+	if err = db.ClickHouseSqlx.Select(&resList, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2)
+	list := []LifecycleRes{}
+	indexMap := map[string]int{}
+	for _, t := range periodList(this.req.WindowTimeFormat, startT, endT) {
+		dates := t.Format(util.TimeFormatDay2)
+		indexMap[dates] = len(list)
+		empty := LifecycleBucket{UI: []string{}}
+		list = append(list, LifecycleRes{Dates: dates, New: empty, Continuing: empty, Resurrected: empty, Dormant: empty})
+	}
+
+	for _, v := range resList {
+		index, ok := indexMap[v.Dates]
+		if !ok {
+			continue
+		}
+		bucket := LifecycleBucket{Count: int(v.Count), UI: v.UI}
+		switch v.Status {
+		case lifecycleNew:
+			list[index].New = bucket
+		case lifecycleContinuing:
+			list[index].Continuing = bucket
+		case lifecycleResurrected:
+			list[index].Resurrected = bucket
+		case lifecycleDormant:
+			list[index].Dormant = bucket
+		}
+	}
+
+	return map[string]interface{}{"list": list}, nil
+}
+
+func NewLifecycle(reqData []byte) (Ianalysis, error) {
+	obj := &Lifecycle{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &obj.req)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.Date) < 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	startT := util.Str2Time(obj.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(obj.req.Date[1], util.TimeFormatDay2)
+	if startT.IsZero() || endT.Before(startT) {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.WindowTimeFormat == "" {
+		obj.req.WindowTimeFormat = PeriodByDay
+	}
+	if _, ok := periodUnits[obj.req.WindowTimeFormat]; !ok {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.Zhibiao.EventName == "" {
+		return nil, my_error.NewBusiness(ERROR_TABLE, EventNameEmptyError)
+	}
+	if obj.req.DormantTime <= 0 {
+		obj.req.DormantTime = 1
+	}
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	virtualAttrs.ReplaceFilter(&obj.req.Zhibiao.Relation)
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,411 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//LTV分析 按首次活跃的周期划分用户 计算之后各周期的累计付费
+type Ltv struct {
+	sql           string
+	args          []interface{}
+	req           request.LtvReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	groupDims     groupDims
+	userGroupSql  string
+	userGroupArgs []interface{}
+	amountCol     string
+}
+
+const ltvWindowTimeMax = 180
+
+//各数组的第i个元素为截止第i天(周/月)的值 未到达的周期不返回
+type LtvRes struct {
+	Dates          string    `json:"dates"`
+	Users          int       `json:"users"`
+	Revenue        []float64 `json:"revenue"`         //累计付费金额
+	Ltv            []float64 `json:"ltv"`             //人均累计付费 即ARPU
+	Payers         []int     `json:"payers"`          //累计付费人数
+	PayRate        []float64 `json:"pay_rate"`        //累计付费率
+	Arppu          []float64 `json:"arppu"`           //付费用户人均累计付费
+	PayerRetention []float64 `json:"payer_retention"` //当天(周/月)付费用户在第i天(周/月)再次付费的比例
+}
+
+type ltvRowRes struct {
+	RowType       uint8     `db:"row_type"`
+	Dates         string    `db:"dates"`
+	GroupValues   []string  `db:"group_values"`
+	Users         uint64    `db:"users"`
+	Revenue       []float64 `db:"revenue"`
+	Payers        []uint64  `db:"payers"`
+	PayerRetained []uint64  `db:"payer_retained"`
+}
+
+//多个初始周期合计时 每个周期只累加已到达该周期的初始周期
+type ltvSums struct {
+	users         int
+	periodUsers   []float64
+	revenue       []float64
+	payers        []float64
+	payerRetained []float64
+}
+
+func (this *ltvSums) add(row ltvRowRes, available int) {
+	this.users += int(row.Users)
+	for index := 0; index < available && index < len(row.Revenue); index++ {
+		if index >= len(this.periodUsers) {
+			this.periodUsers = append(this.periodUsers, 0)
+			this.revenue = append(this.revenue, 0)
+			this.payers = append(this.payers, 0)
+			this.payerRetained = append(this.payerRetained, 0)
+		}
+		this.periodUsers[index] += float64(row.Users)
+		this.revenue[index] += row.Revenue[index]
+		this.payers[index] += float64(row.Payers[index])
+		this.payerRetained[index] += float64(row.PayerRetained[index])
+	}
+}
+
+func (this *ltvSums) res(dates string) (res LtvRes) {
+	div := func(a, b float64) float64 {
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	}
+	res = LtvRes{
+		Dates:          dates,
+		Users:          this.users,
+		Revenue:        []float64{},
+		Ltv:            []float64{},
+		Payers:         []int{},
+		PayRate:        []float64{},
+		Arppu:          []float64{},
+		PayerRetention: []float64{},
+	}
+	for index := range this.periodUsers {
+		res.Revenue = append(res.Revenue, this.revenue[index])
+		res.Ltv = append(res.Ltv, div(this.revenue[index], this.periodUsers[index]))
+		res.Payers = append(res.Payers, int(this.payers[index]))
+		res.PayRate = append(res.PayRate, div(this.payers[index], this.periodUsers[index]))
+		res.Arppu = append(res.Arppu, div(this.revenue[index], this.payers[index]))
+		res.PayerRetention = append(res.PayerRetention, div(this.payerRetained[index], this.payerRetained[0]))
+	}
+	return
+}
+
+//初始周期之后已经到达的周期数
+func (this *Ltv) available(cohort time.Time, now time.Time) (available int) {
+	for n := 0; n <= this.req.WindowTime; n++ {
+		if periodAdd(this.req.WindowTimeFormat, cohort, n).After(now) {
+			break
+		}
+		available++
+	}
+	return
+}
+
+func (this *Ltv) GetList() (interface{}, error) {
+	SQL, args, err := this.GetExecSql()
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Sugar().Infof("SQL", SQL, args)
+
+	var resList []ltvRowRes
+	if err = db.ClickHouseSqlx.Select(&resList, SQL, args...); err != nil {
+		return nil, err
+	}
+
+	groupValuesArr := [][]string{}
+	for _, v := range resList {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	labels, err := this.groupDims.labels(this.attrDicts, groupValuesArr)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	groupNames := []string{}
+	groupSums := map[string]*ltvSums{}
+	groupData := map[string][]LtvRes{}
+	for _, v := range resList {
+		groupkey := this.groupKey(v.RowType, v.GroupValues, labels)
+		if _, ok := groupSums[groupkey]; !ok {
+			groupSums[groupkey] = &ltvSums{}
+			groupNames = append(groupNames, groupkey)
+		}
+		available := this.available(util.Str2Time(v.Dates, util.TimeFormatDay2), now)
+		sums := &ltvSums{}
+		sums.add(v, available)
+		groupSums[groupkey].add(v, available)
+		groupData[groupkey] = append(groupData[groupkey], sums.res(v.Dates))
+	}
+	//每个分组的第一行为所有初始周期的合计
+	for _, groupkey := range groupNames {
+		groupData[groupkey] = append([]LtvRes{groupSums[groupkey].res(ByTotal)}, groupData[groupkey]...)
+	}
+
+	alldata := groupData["总体"]
+	if alldata == nil {
+		alldata = []LtvRes{}
+	}
+
+	return map[string]interface{}{"alldata": alldata, "groupData": groupData}, nil
+}
+
+func (this *Ltv) groupKey(rowType uint8, groupValues []string, labels []map[string]string) string {
+	switch rowType {
+	case groupRowTotal:
+		return "总体"
+	case groupRowOther:
+		return otherGroup
+	}
+	return groupKeyOf(groupValues, labels)
+}
+
+//全局筛选 用户分群以及用户属性筛选
+func (this *Ltv) whereSql() (SQL string, allArgs []interface{}, err error) {
+	var userFilterSql string
+	var userFilterArgs []interface{}
+
+	if len(this.req.WhereFilterByUser.Filts) > 0 {
+		var colArr []string
+		var sql string
+		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
+		if err != nil {
+			return
+		}
+		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
+	}
+
+	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
+
+	allArgs = append(allArgs, whereFilterArgs...)
+	allArgs = append(allArgs, this.args...)
+	allArgs = append(allArgs, userFilterArgs...)
+
+	SQL = whereFilterSql + this.sql + ` ` + userFilterSql
+	return
+}
+
+//每个用户一行 首次活跃时间及首次活跃事件的属性分组 之后付费事件所在的周期与金额
+func (this *Ltv) eventUserSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2).AddDate(0, 0, 1)
+	scanEndT := periodAdd(this.req.WindowTimeFormat, periodStart(this.req.WindowTimeFormat, endT), this.req.WindowTime+1)
+
+	eventGroupSql := "emptyArrayString()"
+	if grouped {
+		eventGroupSql = this.groupDims.eventGroupSql()
+	}
+
+	whereSql, whereArgs, err := this.whereSql()
+	if err != nil {
+		return
+	}
+
+	revenueSql, revenueArgs, err := this.virtualEvents.EventSql(this.req.Zhibiao.EventName)
+	if err != nil {
+		return
+	}
+	if len(this.req.Zhibiao.Relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(this.req.Zhibiao.Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		revenueSql = revenueSql + " and " + sql
+		revenueArgs = append(revenueArgs, args...)
+	}
+
+	allArgs = append(allArgs, whereArgs...)
+	allArgs = append(allArgs, revenueArgs...)
+	allArgs = append(allArgs, whereArgs...)
+
+	SQL = `SELECT xwl_distinct_id, first_time, event_group, pays FROM (
+				SELECT xwl_distinct_id, min(xwl_part_date) AS first_time, argMin(` + eventGroupSql + `, xwl_part_date) AS event_group
+				FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+				prewhere xwl_part_date < toDateTime('` + endT.Format(util.TimeFormat) + `') and ` + whereSql + `
+				GROUP BY xwl_distinct_id
+				HAVING first_time >= toDateTime('` + startT.Format(util.TimeFormat) + `')
+			) ANY LEFT JOIN (
+				SELECT xwl_distinct_id, groupArray(tuple(` + unit.periodFn + `(xwl_part_date), toFloat64(ifNull(` + this.amountCol + `, 0)))) AS pays
+				FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+				prewhere xwl_part_date >= toDateTime('` + startT.Format(util.TimeFormat) + `') and xwl_part_date < toDateTime('` + scanEndT.Format(util.TimeFormat) + `') and ` + revenueSql + ` and ` + whereSql + `
+				GROUP BY xwl_distinct_id
+			) USING xwl_distinct_id`
+	return
+}
+
+//每个用户每个分组一行 用户属性与用户分群在聚合后再关联
+func (this *Ltv) userSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	var dims groupDims
+	if grouped {
+		dims = this.groupDims
+	}
+	groupValuesSql, joinSql, outerArr, outerArgs := dims.valuesSql(this.req.Appid, "event_group", this.userGroupSql, this.userGroupArgs)
+	allArgs = append(allArgs, outerArgs...)
+
+	eventUserSql, eventUserArgs, err := this.eventUserSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, eventUserArgs...)
+
+	outerArr = append(outerArr, "xwl_distinct_id", unit.periodFn+"(first_time) AS cohort", groupValuesSql+" AS group_values", "pays")
+
+	SQL = `SELECT ` + strings.Join(outerArr, ", ") + ` FROM (
+					` + eventUserSql + `
+				)` + joinSql
+	return
+}
+
+//首次活跃人数最多的若干个分组 其余分组合并为其他
+func (this *Ltv) topGroupsSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.userSql(true)
+	if err != nil {
+		return
+	}
+	SQL = topGroupsSql(userSql, "", "uniqExact(xwl_distinct_id)", this.req.GroupLimit)
+	return
+}
+
+//每个结果行的每个用户一行 同一用户在合并后的分组中只计一次
+func (this *Ltv) cohortUserSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	topGroupsSql := ""
+	if grouped {
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
+	}
+	topGroupsSql, rowTypeSql, groupsSql := groupRowSql(topGroupsSql)
+
+	userSql, userArgs, err := this.userSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, userArgs...)
+
+	SQL = `SELECT row_type, cohort, groups AS group_values, xwl_distinct_id, any(user_pays) AS pays
+			FROM (
+				SELECT xwl_distinct_id, cohort, pays AS user_pays, ` + topGroupsSql + `toUInt8(` + rowTypeSql + `) AS row_type, ` + groupsSql + ` AS groups
+				FROM (` + userSql + `)
+			)
+			GROUP BY row_type, cohort, groups, xwl_distinct_id`
+	return
+}
+
+//每个初始周期的人数 之后各周期的累计付费金额 累计付费人数 以及当天(周/月)付费用户在各周期的再次付费人数
+func (this *Ltv) ltvSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	cohortUserSql, allArgs, err := this.cohortUserSql(grouped)
+	if err != nil {
+		return
+	}
+
+	SQL = `SELECT row_type, formatDateTime(cohort, '%Y-%m-%d') AS dates, group_values, count(1) AS users,
+				sumForEach(rev) AS revenue, sumForEach(paid_cum) AS payers, sumForEach(arrayMap(x -> paid[1] * x, paid)) AS payer_retained
+			FROM (
+				SELECT row_type, cohort, group_values,
+					arrayMap(n -> ` + unit.addFn + `(cohort, n), range(` + strconv.Itoa(this.req.WindowTime+1) + `)) AS periods,
+					arrayCumSum(arrayMap(p -> arraySum(arrayMap(x -> x.2, arrayFilter(x -> x.1 = p, pays))), periods)) AS rev,
+					arrayMap(p -> toUInt64(arrayExists(x -> x.1 = p, pays)), periods) AS paid,
+					arrayMap(p -> toUInt64(arrayExists(x -> x.1 >= cohort and x.1 <= p, pays)), periods) AS paid_cum
+				FROM (` + cohortUserSql + `)
+			)
+			GROUP BY row_type, cohort, group_values
+			ORDER BY row_type, cohort, group_values`
+	return
+}
+
+func (this *Ltv) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.ltvSql(false)
+	if err != nil {
+		return
+	}
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.ltvSql(true)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " UNION ALL " + groupSql
+		allArgs = append(allArgs, groupArgs...)
+	}
+	return
+}
+
+func NewLtv(reqData []byte) (Ianalysis, error) {
+	obj := &Ltv{}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err := json.Unmarshal(reqData, &obj.req)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.Date) < 2 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.WindowTimeFormat == "" {
+		obj.req.WindowTimeFormat = PeriodByDay
+	}
+	if _, ok := periodUnits[obj.req.WindowTimeFormat]; !ok || obj.req.WindowTime < 0 || obj.req.WindowTime > ltvWindowTimeMax {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.Zhibiao.EventName == "" {
+		return nil, my_error.NewBusiness(ERROR_TABLE, EventNameEmptyError)
+	}
+	if obj.req.AmountAttr == "" {
+		return nil, my_error.NewBusiness(ERROR_TABLE, LtvAmountError)
+	}
+	obj.req.GroupLimit = groupLimitOf(obj.req.GroupLimit)
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	virtualAttrs.ReplaceFilter(&obj.req.Zhibiao.Relation)
+	obj.amountCol = virtualAttrs.Col(obj.req.AmountAttr)
+	obj.groupDims, err = newGroupDims(obj.req.GroupBy, obj.req.GroupByUser, obj.req.GroupByUserGroup, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.req.GroupByUserGroup) > 0 {
+		obj.userGroupSql, obj.userGroupArgs, err = utils.GetUserGroupNamesSql(obj.req.GroupByUserGroup, obj.req.Appid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"time"
+)
+
+//按天 周 月划分的周期单位 留存与生命周期分析共用
+type periodUnit struct {
+	periodFn string //将时间截断到周期开始
+	addFn    string //周期偏移
+}
+
+const (
+	PeriodByDay   = "天"
+	PeriodByWeek  = "周"
+	PeriodByMonth = "月"
+)
+
+var periodUnits = map[string]periodUnit{
+	PeriodByDay:   {periodFn: "toDate", addFn: "addDays"},
+	PeriodByWeek:  {periodFn: "toMonday", addFn: "addWeeks"},
+	PeriodByMonth: {periodFn: "toStartOfMonth", addFn: "addMonths"},
+}
+
+//时间所在周期的开始
+func periodStart(unit string, t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch unit {
+	case PeriodByWeek:
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case PeriodByMonth:
+		return t.AddDate(0, 0, 1-t.Day())
+	}
+	return t
+}
+
+//周期偏移n个单位
+func periodAdd(unit string, t time.Time, n int) time.Time {
+	switch unit {
+	case PeriodByWeek:
+		return t.AddDate(0, 0, n*7)
+	case PeriodByMonth:
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+//起止时间覆盖的所有周期的开始
+func periodList(unit string, startT, endT time.Time) (periods []time.Time) {
+	for t := periodStart(unit, startT); !t.After(endT); t = periodAdd(unit, t, 1) {
+		periods = append(periods, t)
+	}
+	return
+}
@@ -1,14 +1,12 @@
 package analysis
 
 import (
-	"fmt"
 	"github.com/1340691923/xwl_bi/engine/db"
 	"github.com/1340691923/xwl_bi/engine/logs"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
-	"go.uber.org/zap"
 	"strconv"
 	"strings"
 	"time"
@@ -17,9 +15,37 @@ import (
 )
 
 type Retention struct {
-	sql  string
-	args []interface{}
-	req  request.RetentionReqData
+	sql           string
+	args          []interface{}
+	req           request.RetentionReqData
+	virtualEvents utils.VirtualEvents
+	attrDicts     utils.AttrDicts
+	groupDims     groupDims
+	userGroupSql  string
+	userGroupArgs []interface{}
+}
+
+type RetentionRes struct {
+	Dates  string     `json:"dates" db:"dates"`
+	Value  []uint64   `json:"value" db:"value"`
+	UI     [][]string `json:"ui" db:"ui"`
+	Metric []float64  `json:"metric,omitempty" db:"-"` //依次为当天(周/月)与第N天(周/月)留存用户回访事件的指标
+}
+
+type retentionRowRes struct {
+	RowType     uint8      `db:"row_type"`
+	Dates       string     `db:"dates"`
+	GroupValues []string   `db:"group_values"`
+	Value       []uint64   `db:"value"`
+	UI          [][]string `db:"ui"`
+}
+
+type retentionMetricRes struct {
+	RowType     uint8    `db:"row_type"`
+	Dates       string   `db:"dates"`
+	GroupValues []string `db:"group_values"`
+	PeriodIndex uint64   `db:"period_index"`
+	Metric      float64  `db:"metric"`
 }
 
 func (this *Retention) GetList() (interface{}, error) {
@@ -32,87 +58,140 @@ func (this *Retention) GetList() (interface{}, error) {
 
 	logs.Logger.Sugar().Infof("sql", sqls, args, err)
 
-	type Res struct {
-		Dates string     `json:"dates" db:"dates"`
-		Value []uint64   `json:"value" db:"value"`
-		UI    [][]string `json:"ui" db:"ui"`
-	}
-
-	var res []Res
+	var resList []retentionRowRes
 
-	err = db.ClickHouseSqlx.Select(&res, sqls, args...)
+	err = db.ClickHouseSqlx.Select(&resList, sqls, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]interface{}{"alldata": res}, nil
-}
-
-func (this *Retention) getSqlByDate(t time.Time) (SQL string, allArgs []interface{}, err error) {
-
-	var tmp = func(index int) (firstDayEventNameSql string, args []interface{}, err error) {
+	var metricList []retentionMetricRes
+	if len(this.req.Metric) > 0 {
+		sqls, args, err = this.metricSql()
+		if err != nil {
+			return nil, err
+		}
+		logs.Logger.Sugar().Infof("sql", sqls, args, err)
+		if err = db.ClickHouseSqlx.Select(&metricList, sqls, args...); err != nil {
+			return nil, err
+		}
+	}
 
-		firstDayEventNameSql = `xwl_part_event ='` + this.req.ZhibiaoArr[index].EventName + `' and  toYYYYMMDD(xwl_part_date) = '` + t.Format(util.TimeFormatDay) + `' `
-		var sql = ""
-		if len(this.req.ZhibiaoArr[index].Relation.Filts) > 0 {
-			firstDayEventNameSql = firstDayEventNameSql + " and "
+	groupValuesArr := [][]string{}
+	for _, v := range resList {
+		groupValuesArr = append(groupValuesArr, v.GroupValues)
+	}
+	labels, err := this.groupDims.labels(this.attrDicts, groupValuesArr)
+	if err != nil {
+		return nil, err
+	}
 
-			sql, args, _, err = utils.GetWhereSql(this.req.ZhibiaoArr[index].Relation)
+	metricMap := map[string][]float64{}
+	for _, v := range metricList {
+		key := this.groupKey(v.RowType, v.GroupValues, labels) + "|" + v.Dates
+		if _, ok := metricMap[key]; !ok {
+			metricMap[key] = make([]float64, this.req.WindowTime+1)
+		}
+		if int(v.PeriodIndex) < len(metricMap[key]) {
+			metricMap[key][v.PeriodIndex] = v.Metric
+		}
+	}
 
-			if err == nil {
-				firstDayEventNameSql = firstDayEventNameSql + sql
+	alldata := []RetentionRes{}
+	groupData := map[string][]RetentionRes{}
+	for _, v := range resList {
+		groupkey := this.groupKey(v.RowType, v.GroupValues, labels)
+		res := RetentionRes{Dates: v.Dates, Value: v.Value, UI: v.UI}
+		if len(this.req.Metric) > 0 {
+			res.Metric = metricMap[groupkey+"|"+v.Dates]
+			if res.Metric == nil {
+				res.Metric = make([]float64, this.req.WindowTime+1)
 			}
 		}
-		return
+		if v.RowType == groupRowTotal {
+			alldata = append(alldata, res)
+		}
+		groupData[groupkey] = append(groupData[groupkey], res)
 	}
 
-	firstDayEventNameSql, args, err := tmp(0)
+	return map[string]interface{}{"alldata": alldata, "groupData": groupData}, nil
+}
 
-	if err != nil {
-		return
+func (this *Retention) groupKey(rowType uint8, groupValues []string, labels []map[string]string) string {
+	switch rowType {
+	case groupRowTotal:
+		return "总体"
+	case groupRowOther:
+		return otherGroup
 	}
+	return groupKeyOf(groupValues, labels)
+}
 
-	allArgs = append(allArgs, args...)
+const (
+	RetentionNDay      = ""          //第N天当天回访
+	RetentionUnbounded = "unbounded" //第N天及以后回访
+)
 
-	firstDayEventName2Sql, args, err := tmp(1)
+//扫描的结束时间 需要覆盖最后一个周期之后的窗口期
+func (this *Retention) scanEndTime(endT time.Time) time.Time {
+	switch this.req.WindowTimeFormat {
+	case PeriodByWeek:
+		return endT.AddDate(0, 0, (this.req.WindowTime+1)*7)
+	case PeriodByMonth:
+		return endT.AddDate(0, this.req.WindowTime+1, 0)
+	}
+	return endT.AddDate(0, 0, this.req.WindowTime)
+}
 
+func (this *Retention) eventCond(index int) (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.virtualEvents.EventSql(this.req.ZhibiaoArr[index].EventName)
 	if err != nil {
 		return
 	}
+	if len(this.req.ZhibiaoArr[index].Relation.Filts) > 0 {
+		sql, args, _, err := utils.GetWhereSql(this.req.ZhibiaoArr[index].Relation)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " and " + sql
+		allArgs = append(allArgs, args...)
+	}
+	return
+}
 
-	allArgs = append(allArgs, args...)
-
-	retentionSql := firstDayEventNameSql + `,` + firstDayEventName2Sql
-
-	sumArr := make([]string, this.req.WindowTime)
-	uiArr := make([]string, this.req.WindowTime)
-	var sql string
-
-	retentionPartDate := t
-
-	for i := 0; i < this.req.WindowTime; i++ {
-
-		retentionPartDate = retentionPartDate.AddDate(0, 0, 1)
-
-		retentionSql = retentionSql + ","
-
-		sumArr[i] = fmt.Sprintf("sum(r[%s])", strconv.Itoa(i+3))
-		uiArr[i] = fmt.Sprintf("groupUniqArray(if(r[%s]=1,xwl_distinct_id,null))", strconv.Itoa(i+3))
+//每个用户一行 初始事件所在的周期及其事件属性分组 回访事件所在的周期
+//计算回访指标时同时收集回访事件所在的周期与指标字段
+func (this *Retention) eventUserSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	startT := util.Str2Time(this.req.Date[0], util.TimeFormatDay2)
+	endT := util.Str2Time(this.req.Date[1], util.TimeFormatDay2).AddDate(0, 0, 1)
 
-		retentionSql = retentionSql + ` xwl_part_event ='` + this.req.ZhibiaoArr[1].EventName + `' and  toYYYYMMDD(xwl_part_date) = '` + retentionPartDate.Format(util.TimeFormatDay) + `' `
+	initSql, initArgs, err := this.eventCond(0)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, initArgs...)
 
-		if len(this.req.ZhibiaoArr[1].Relation.Filts) > 0 {
-			retentionSql = retentionSql + " and "
-			sql, args, _, err = utils.GetWhereSql(this.req.ZhibiaoArr[1].Relation)
+	returnSql, returnArgs, err := this.eventCond(1)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, returnArgs...)
 
-			if err != nil {
-				logs.Logger.Error("err", zap.Error(err))
-				return
-			}
+	eventGroupSql := "emptyArrayString()"
+	if grouped {
+		eventGroupSql = this.groupDims.eventGroupSql()
+	}
 
-			allArgs = append(allArgs, args...)
-			retentionSql = retentionSql + sql
+	returnEventsSql := ""
+	if len(this.req.Metric) > 0 {
+		metricCol := "0"
+		if this.req.Metric[0] != utils.Default {
+			metricCol = this.req.Metric[0]
 		}
+		returnEventsSql = `,
+				groupArrayIf(tuple(` + unit.periodFn + `(xwl_part_date), ` + metricCol + `), ` + returnSql + `) AS return_events`
+		allArgs = append(allArgs, returnArgs...)
 	}
 
 	var userFilterSql string
@@ -123,81 +202,211 @@ func (this *Retention) getSqlByDate(t time.Time) (SQL string, allArgs []interfac
 		var sql string
 		sql, userFilterArgs, colArr, err = utils.GetWhereSql(this.req.WhereFilterByUser)
 		if err != nil {
-			return SQL, allArgs, err
+			return
 		}
 		userFilterSql = `and xwl_distinct_id in ( select xwl_distinct_id from ` + utils.GetUserTableView(this.req.Appid, colArr) + ` where ` + sql + ")"
 	}
 
 	whereFilterSql, whereFilterArgs, _, err := utils.GetWhereSql(this.req.WhereFilter)
+	if err != nil {
+		return
+	}
 
 	whereFilterSql = whereFilterSql + this.sql
 
 	whereFilterArgs = append(whereFilterArgs, this.args...)
 
-	parteventWhereSql := " xwl_part_event in (?,?) "
+	parteventWhereSql, parteventArgs, err := this.virtualEvents.EventInSql([]string{this.req.ZhibiaoArr[0].EventName, this.req.ZhibiaoArr[1].EventName})
+	if err != nil {
+		return
+	}
 
-	allArgs = append(allArgs, this.req.ZhibiaoArr[0].EventName, this.req.ZhibiaoArr[1].EventName)
+	allArgs = append(allArgs, parteventArgs...)
 
 	allArgs = append(allArgs, whereFilterArgs...)
 
 	allArgs = append(allArgs, userFilterArgs...)
 
-	SQL = `
-			SELECT
-				'` + t.Format(util.TimeFormatDay2) + `' AS dates,
-				array(sum(r[1]),sum(r[2]),` + strings.Join(sumArr, ",") + `) as value,
-				array(groupUniqArray(if(r[1]=1,xwl_distinct_id,null)),groupUniqArray(if(r[2]=1,xwl_distinct_id,null)), ` + strings.Join(uiArr, ",") + `) as ui
-				FROM
-				(
-					SELECT
-   					 xwl_distinct_id,
-   				 retention(` + retentionSql + `) AS r
-				FROM xwl_event` + strconv.Itoa(this.req.Appid) + `  
-				prewhere xwl_part_date >= toDateTime('` + t.Format(util.TimeFormat) + `') and xwl_part_date <= toDateTime('` + t.AddDate(0, 0, this.req.WindowTime+1).Format(util.TimeFormat) + `') and ` + parteventWhereSql + `  and ` + whereFilterSql + ` ` + userFilterSql + `
-				
-				GROUP BY xwl_distinct_id
-			) limit 1000
-       `
+	SQL = `SELECT xwl_distinct_id,
+				groupUniqArrayIf(tuple(` + unit.periodFn + `(xwl_part_date), ` + eventGroupSql + `), ` + initSql + ` and xwl_part_date < toDateTime('` + endT.Format(util.TimeFormat) + `')) AS inits,
+				groupUniqArrayIf(` + unit.periodFn + `(xwl_part_date), ` + returnSql + `) AS return_periods` + returnEventsSql + `
+			FROM xwl_event` + strconv.Itoa(this.req.Appid) + `
+			prewhere xwl_part_date >= toDateTime('` + startT.Format(util.TimeFormat) + `') and xwl_part_date < toDateTime('` + this.scanEndTime(endT).Format(util.TimeFormat) + `') and ` + parteventWhereSql + ` and ` + whereFilterSql + ` ` + userFilterSql + `
+			GROUP BY xwl_distinct_id
+			HAVING length(inits) > 0`
+	return
+}
+
+//每个用户每个初始周期一行 用户属性与用户分群在聚合后再关联
+func (this *Retention) userSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	var dims groupDims
+	if grouped {
+		dims = this.groupDims
+	}
+	groupValuesSql, joinSql, outerArr, outerArgs := dims.valuesSql(this.req.Appid, "init.2", this.userGroupSql, this.userGroupArgs)
+	allArgs = append(allArgs, outerArgs...)
+
+	eventUserSql, eventUserArgs, err := this.eventUserSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, eventUserArgs...)
+
+	outerArr = append(outerArr, "xwl_distinct_id", "arrayJoin(inits) AS init", "init.1 AS cohort", groupValuesSql+" AS group_values", "return_periods")
+	if len(this.req.Metric) > 0 {
+		outerArr = append(outerArr, "return_events")
+	}
+
+	SQL = `SELECT ` + strings.Join(outerArr, ", ") + ` FROM (
+					` + eventUserSql + `
+				)` + joinSql
 	return
 }
 
-func (this *Retention) parseReqDate() []time.Time {
+//初始事件人数最多的若干个分组 其余分组合并为其他
+func (this *Retention) topGroupsSql() (SQL string, allArgs []interface{}, err error) {
+	userSql, allArgs, err := this.userSql(true)
+	if err != nil {
+		return
+	}
+	SQL = topGroupsSql(userSql, "", "uniqExact(xwl_distinct_id)", this.req.GroupLimit)
+	return
+}
 
-	if len(this.req.Date) < 2 {
-		return nil
+//每个结果行的每个用户一行 同一用户在合并后的分组中只计一次
+func (this *Retention) cohortUserSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	topGroupsSql := ""
+	if grouped {
+		topGroupsSql, allArgs, err = this.topGroupsSql()
+		if err != nil {
+			return
+		}
 	}
+	topGroupsSql, rowTypeSql, groupsSql := groupRowSql(topGroupsSql)
 
-	startTimeFormat := this.req.Date[0]
-	endTimeFormat := this.req.Date[1]
+	userSql, userArgs, err := this.userSql(grouped)
+	if err != nil {
+		return
+	}
+	allArgs = append(allArgs, userArgs...)
 
-	if startTimeFormat == endTimeFormat {
-		t := make([]time.Time, 1)
-		t[0] = util.Str2Time(startTimeFormat, util.TimeFormatDay2)
-		return t
+	returnEventsSql := ""
+	returnEventsCol := ""
+	if len(this.req.Metric) > 0 {
+		returnEventsSql = ", any(user_return_events) AS return_events"
+		returnEventsCol = ", return_events AS user_return_events"
 	}
-	startT := util.Str2Time(startTimeFormat, util.TimeFormatDay2)
-	endT := util.Str2Time(endTimeFormat, util.TimeFormatDay2)
 
-	t := []time.Time{}
-	for ; startT.Before(endT.AddDate(0, 0, 1)); startT = startT.AddDate(0, 0, 1) {
-		t = append(t, startT)
+	SQL = `SELECT row_type, cohort, groups AS group_values, xwl_distinct_id, any(user_return_periods) AS return_periods` + returnEventsSql + `
+			FROM (
+				SELECT xwl_distinct_id, cohort, return_periods AS user_return_periods` + returnEventsCol + `, ` + topGroupsSql + `toUInt8(` + rowTypeSql + `) AS row_type, ` + groupsSql + ` AS groups
+				FROM (` + userSql + `)
+			)
+			GROUP BY row_type, cohort, groups, xwl_distinct_id`
+	return
+}
+
+//每个用户在每个初始周期之后的各周期是否回访
+func (this *Retention) retainedSql() string {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	retainedSql := "has(return_periods, p)"
+	if this.req.RetentionType == RetentionUnbounded {
+		retainedSql = "arrayExists(x -> x >= p, return_periods)"
+	}
+	return `arrayMap(p -> toUInt64(` + retainedSql + `), arrayMap(n -> ` + unit.addFn + `(cohort, n), range(` + strconv.Itoa(this.req.WindowTime+1) + `)))`
+}
+
+//所有初始周期一次计算 value与ui的第一个元素为初始事件人数 之后依次为当天(周/月)与第N天(周/月)的留存
+func (this *Retention) retentionSql(grouped bool) (SQL string, allArgs []interface{}, err error) {
+	cohortUserSql, allArgs, err := this.cohortUserSql(grouped)
+	if err != nil {
+		return
 	}
 
-	return t
+	SQL = `SELECT row_type, formatDateTime(cohort, '%Y-%m-%d') AS dates, group_values,
+				arrayPushFront(sumForEach(r), count(1)) AS value,
+				arrayPushFront(
+					arrayMap(x -> arrayFilter(id -> id != '', x), groupUniqArrayForEach(arrayMap(x -> if(x = 1, xwl_distinct_id, ''), r))),
+					groupUniqArray(xwl_distinct_id)
+				) AS ui
+			FROM (
+				SELECT row_type, cohort, group_values, xwl_distinct_id, ` + this.retainedSql() + ` AS r
+				FROM (` + cohortUserSql + `)
+			)
+			GROUP BY row_type, cohort, group_values
+			ORDER BY row_type, cohort, group_values`
+	return
 }
 
 func (this *Retention) GetExecSql() (SQL string, allArgs []interface{}, err error) {
+	SQL, allArgs, err = this.retentionSql(false)
+	if err != nil {
+		return
+	}
+	if len(this.groupDims) > 0 {
+		groupSql, groupArgs, err := this.retentionSql(true)
+		if err != nil {
+			return "", nil, err
+		}
+		SQL = SQL + " UNION ALL " + groupSql
+		allArgs = append(allArgs, groupArgs...)
+	}
+	return
+}
+
+//留存用户在当天(周/月)与第N天(周/月)回访事件的指标 及以后留存时包含之后所有周期的回访事件
+func (this *Retention) metricSql() (SQL string, allArgs []interface{}, err error) {
+	unit := periodUnits[this.req.WindowTimeFormat]
+	eventCond := "x.1 = " + unit.addFn + "(cohort, period_index)"
+	if this.req.RetentionType == RetentionUnbounded {
+		eventCond = "x.1 >= " + unit.addFn + "(cohort, period_index)"
+	}
+	metricExpr := utils.CountTypMap[this.req.Metric[1]]("metric_value")
+	if this.req.Metric[0] == utils.Default {
+		metricExpr = utils.CountTypMap[this.req.Metric[1]](utils.Default)
+	}
+
 	sqlArr := []string{}
-	for _, date := range this.parseReqDate() {
-		sql, args, err := this.getSqlByDate(date)
+	for _, grouped := range []bool{false, true} {
+		if grouped && len(this.groupDims) == 0 {
+			continue
+		}
+		cohortUserSql, args, err := this.cohortUserSql(grouped)
 		if err != nil {
 			return "", nil, err
 		}
-		sqlArr = append(sqlArr, sql)
 		allArgs = append(allArgs, args...)
+		sqlArr = append(sqlArr, `SELECT row_type, formatDateTime(cohort, '%Y-%m-%d') AS dates, group_values, period_index,
+				`+utils.ToFloat32OrZero(metricExpr)+` AS metric
+			FROM (
+				SELECT row_type, cohort, group_values, xwl_distinct_id, period_index, ev.2 AS metric_value
+				FROM (
+					SELECT row_type, cohort, group_values, xwl_distinct_id, arrayJoin(range(`+strconv.Itoa(this.req.WindowTime+1)+`)) AS period_index,
+						arrayFilter(x -> `+eventCond+`, return_events) AS events
+					FROM (`+cohortUserSql+`)
+				)
+				ARRAY JOIN events AS ev
+			)
+			GROUP BY row_type, cohort, group_values, period_index`)
 	}
+	return strings.Join(sqlArr, " UNION ALL "), allArgs, nil
+}
 
-	return strings.Join(sqlArr, "union all"), allArgs, err
+//回访指标为空或者[字段,计算方式] 字段为默认时只支持次数与人数类的计算方式
+func retentionMetricValid(metric []string) bool {
+	if len(metric) == 0 {
+		return true
+	}
+	if len(metric) != 2 || metric[0] == "" {
+		return false
+	}
+	if _, ok := utils.CountTypMap[metric[1]]; !ok {
+		return false
+	}
+	if metric[0] == utils.Default {
+		return metric[1] == utils.AllCount || metric[1] == utils.ClickUserNum || metric[1] == utils.AvgCountByUser
+	}
+	return true
 }
 
 func NewRetention(reqData []byte) (Ianalysis, error) {
@@ -213,11 +422,53 @@ func NewRetention(reqData []byte) (Ianalysis, error) {
 	if len(obj.req.ZhibiaoArr) != 2 {
 		return nil, my_error.NewBusiness(ERROR_TABLE, ZhiBiaoNumError)
 	}
+	//兼容未保存周期单位的报表
+	if obj.req.WindowTimeFormat == "" {
+		obj.req.WindowTimeFormat = PeriodByDay
+	}
+	if _, ok := periodUnits[obj.req.WindowTimeFormat]; !ok || obj.req.WindowTime < 0 {
+		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
+	}
+	if obj.req.RetentionType != RetentionNDay && obj.req.RetentionType != RetentionUnbounded {
+		return nil, my_error.NewBusiness(ERROR_TABLE, RetentionTypeError)
+	}
+	if !retentionMetricValid(obj.req.Metric) {
+		return nil, my_error.NewBusiness(ERROR_TABLE, RetentionMetricError)
+	}
 
 	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
 	if err != nil {
 		return nil, err
 	}
 
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	for index := range obj.req.ZhibiaoArr {
+		virtualAttrs.ReplaceFilter(&obj.req.ZhibiaoArr[index].Relation)
+	}
+	virtualAttrs.ReplaceSelectAttr(obj.req.Metric)
+	obj.groupDims, err = newGroupDims(obj.req.GroupBy, obj.req.GroupByUser, obj.req.GroupByUserGroup, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.req.GroupLimit = groupLimitOf(obj.req.GroupLimit)
+	if len(obj.req.GroupByUserGroup) > 0 {
+		obj.userGroupSql, obj.userGroupArgs, err = utils.GetUserGroupNamesSql(obj.req.GroupByUserGroup, obj.req.Appid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
+	if err != nil {
+		return nil, err
+	}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
 	return obj, nil
 }
@@ -18,6 +18,7 @@ type Trace struct {
 	eventNameMapStr string
 	req             request.TraceReqData
 	sqlTyp          int
+	virtualEvents   utils.VirtualEvents
 }
 
 const ChartSql int = 1
@@ -91,7 +92,7 @@ func (this *Trace) GetTableSql() (SQL string, allArgs []interface{}, err error)
 	startTime := this.req.Date[0] + " 00:00:00"
 	endTime := this.req.Date[1] + " 23:59:59"
 
-	windowSql, allArgs, err := getZhibiaoFilterSqlArgs(this.req.ZhibiaoArr)
+	windowSql, allArgs, err := getZhibiaoFilterSqlArgs(this.req.ZhibiaoArr, this.virtualEvents)
 	if err != nil {
 		return
 	}
@@ -105,8 +106,12 @@ func (this *Trace) GetTableSql() (SQL string, allArgs []interface{}, err error)
 	}
 
 	if len(this.req.EventNames) > 1 {
-		whereFilterSql = whereFilterSql + " and xwl_part_event in (?) "
-		whereFilterArgs = append(whereFilterArgs, this.req.EventNames)
+		eventSql, eventArgs, err := this.virtualEvents.EventInSql(this.req.EventNames)
+		if err != nil {
+			return SQL, allArgs, err
+		}
+		whereFilterSql = whereFilterSql + " and " + eventSql
+		whereFilterArgs = append(whereFilterArgs, eventArgs...)
 	}
 
 	whereFilterSql = whereFilterSql + this.sql
@@ -169,7 +174,7 @@ func (this *Trace) GetChartSql() (SQL string, allArgs []interface{}, err error)
 	startTime := this.req.Date[0] + " 00:00:00"
 	endTime := this.req.Date[1] + " 23:59:59"
 
-	windowSql, allArgs, err := getZhibiaoFilterSqlArgs(this.req.ZhibiaoArr)
+	windowSql, allArgs, err := getZhibiaoFilterSqlArgs(this.req.ZhibiaoArr, this.virtualEvents)
 	if err != nil {
 		return
 	}
@@ -183,8 +188,12 @@ func (this *Trace) GetChartSql() (SQL string, allArgs []interface{}, err error)
 	}
 
 	if len(this.req.EventNames) > 1 {
-		whereFilterSql = whereFilterSql + " and xwl_part_event in (?) "
-		whereFilterArgs = append(whereFilterArgs, this.req.EventNames)
+		eventSql, eventArgs, err := this.virtualEvents.EventInSql(this.req.EventNames)
+		if err != nil {
+			return SQL, allArgs, err
+		}
+		whereFilterSql = whereFilterSql + " and " + eventSql
+		whereFilterArgs = append(whereFilterArgs, eventArgs...)
 	}
 
 	whereFilterSql = whereFilterSql + this.sql
@@ -354,20 +363,50 @@ func NewTrace(reqData []byte) (Ianalysis, error) {
 		return nil, my_error.NewBusiness(ERROR_TABLE, TimeError)
 	}
 	obj.req.WindowTime = obj.req.WindowTime * T
-	metaDataService := meta_data.MetaDataService{Appid: strconv.Itoa(obj.req.Appid)}
-	mapStr, err := metaDataService.GetEventNameShowMap()
+
+	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
+
 	if err != nil {
 		return nil, err
 	}
-	obj.eventNameMapStr = mapStr
-
-	obj.sql, obj.args, err = utils.GetUserGroupSqlAndArgs(obj.req.UserGroup, obj.req.Appid)
 
+	virtualAttrs, err := utils.GetVirtualAttrs(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs.ReplaceFilter(&obj.req.WhereFilter)
+	for index := range obj.req.ZhibiaoArr {
+		virtualAttrs.ReplaceFilter(&obj.req.ZhibiaoArr[index].Relation)
+	}
+	obj.virtualEvents, err = utils.GetVirtualEvents(obj.req.Appid, virtualAttrs)
 	if err != nil {
 		return nil, err
 	}
 
 	obj.req.EventNames = append(obj.req.EventNames, obj.req.ZhibiaoArr[0].EventName)
 
+	//路径中选中的虚拟事件的组成事件显示为虚拟事件名
+	showNameOverride := map[string]string{}
+	for _, eventName := range obj.req.EventNames {
+		virtualEvent, ok := obj.virtualEvents[eventName]
+		if !ok {
+			continue
+		}
+		showName := virtualEvent.ShowName
+		if strings.TrimSpace(showName) == "" {
+			showName = eventName
+		}
+		showNameOverride[eventName] = showName
+		for _, item := range virtualEvent.Items {
+			showNameOverride[item.EventName] = showName
+		}
+	}
+	metaDataService := meta_data.MetaDataService{Appid: strconv.Itoa(obj.req.Appid)}
+	mapStr, err := metaDataService.GetEventNameShowMapWith(showNameOverride)
+	if err != nil {
+		return nil, err
+	}
+	obj.eventNameMapStr = mapStr
+
 	return obj, nil
 }
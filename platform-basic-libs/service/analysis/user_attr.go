@@ -12,9 +12,10 @@ import (
 )
 
 type UserAttr struct {
-	req  request.UserAttrReqData
-	sql  string
-	args []interface{}
+	req       request.UserAttrReqData
+	sql       string
+	args      []interface{}
+	attrDicts utils.AttrDicts
 }
 
 func (this *UserAttr) GetList() (interface{}, error) {
@@ -41,6 +42,23 @@ func (this *UserAttr) GetList() (interface{}, error) {
 		return nil, err
 	}
 
+	//分组属性配置了字典时展示显示名
+	if len(this.req.GroupBy) > 0 && this.attrDicts.Has(this.req.GroupBy[0]) {
+		values := []string{}
+		for _, v := range tableRes {
+			values = append(values, v.GroupKey)
+		}
+		labels, err := this.attrDicts.Labels(this.req.GroupBy[0], values)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range tableRes {
+			if label, ok := labels[v.GroupKey]; ok {
+				tableRes[i].GroupKey = label
+			}
+		}
+	}
+
 	//响应结果
 	return map[string]interface{}{"tableRes": tableRes}, nil
 }
@@ -107,5 +125,10 @@ func NewUserAttr(reqData []byte) (Ianalysis, error) {
 		return nil, err
 	}
 
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
+
 	return obj, nil
 }
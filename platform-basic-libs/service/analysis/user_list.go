@@ -13,8 +13,9 @@ import (
 )
 
 type UserList struct {
-	req     request.UserListReqData
-	propMap map[string]string
+	req       request.UserListReqData
+	propMap   map[string]string
+	attrDicts utils.AttrDicts
 }
 
 func (this *UserList) GetList() (interface{}, error) {
@@ -65,6 +66,16 @@ func (this *UserList) GetList() (interface{}, error) {
 		}
 		list[index] = obj
 	}
+
+	//配置了字典的属性展示显示名
+	for _, name := range this.attrDicts.Names() {
+		if _, ok := this.propMap[name]; !ok {
+			continue
+		}
+		if err = this.attrDicts.ReplaceRows(name, list, name); err != nil {
+			return nil, err
+		}
+	}
 	delete(this.propMap, "xwl_update_time")
 	return map[string]interface{}{"alldata": list, "propMap": this.propMap}, nil
 
@@ -114,5 +125,9 @@ func NewUserList(reqData []byte) (Ianalysis, error) {
 		return nil, my_error.NewBusiness(ERROR_TABLE, UIEmptyError)
 	}
 	obj.propMap = map[string]string{}
+	obj.attrDicts, err = utils.GetAttrDicts(obj.req.Appid)
+	if err != nil {
+		return nil, err
+	}
 	return obj, nil
 }
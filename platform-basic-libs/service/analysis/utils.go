@@ -1,7 +1,6 @@
 package analysis
 
 import (
-	"fmt"
 	"github.com/1340691923/xwl_bi/engine/logs"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
@@ -20,12 +19,19 @@ func getUserfilterSqlArgs(analysisFilter request.AnalysisFilter, appid int) (use
 	return
 }
 
-func getZhibiaoFilterSqlArgs(zhibiaoArr []request.Zhibiao) (windowSql string, allArgs []interface{}, err error) {
+func getZhibiaoFilterSqlArgs(zhibiaoArr []request.Zhibiao, virtualEvents utils.VirtualEvents) (windowSql string, allArgs []interface{}, err error) {
 
 	for _, zhibiao := range zhibiaoArr {
 		windowSql = windowSql + ","
 
-		windowSql = windowSql + fmt.Sprintf(" xwl_part_event = '%v' ", zhibiao.EventName)
+		eventSql, eventArgs, err := virtualEvents.EventSql(zhibiao.EventName)
+		if err != nil {
+			return windowSql, allArgs, err
+		}
+
+		windowSql = windowSql + eventSql
+
+		allArgs = append(allArgs, eventArgs...)
 
 		if len(zhibiao.Relation.Filts) > 0 {
 			windowSql = windowSql + " and "
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
+)
+
+//字典显示名对应的伪属性后缀 例如 channel__label
+const AttrLabelSuffix = "__label"
+
+//应用中配置了字典的属性
+type AttrDicts struct {
+	appid int
+	names map[string]bool
+}
+
+func GetAttrDicts(appid int) (attrDicts AttrDicts, err error) {
+	attrDict := model.AttrDict{}
+	list, err := attrDict.List(appid)
+	if err != nil {
+		return
+	}
+	attrDicts = AttrDicts{appid: appid, names: map[string]bool{}}
+	for _, v := range list {
+		attrDicts.names[v.AttributeName] = true
+	}
+	return
+}
+
+func (this AttrDicts) Has(attributeName string) bool {
+	return this.names[attributeName]
+}
+
+func (this AttrDicts) Names() (names []string) {
+	for name := range this.names {
+		names = append(names, name)
+	}
+	return
+}
+
+//属性值替换为字典中的显示名 字典中没有的值原样返回
+//属性名只来自配置表 不会拼接前端传入的内容
+func (this AttrDicts) LabelExpr(attributeName string) string {
+	return fmt.Sprintf("dictGetOrDefault('xwl_attr_dict_dict','label',tuple(toUInt64(%d),'%s',toString(%s)),toString(%s))",
+		this.appid, strings.ReplaceAll(attributeName, "'", "\\'"), attributeName, attributeName)
+}
+
+//查询一批值的显示名 只返回字典中存在的值
+func (this AttrDicts) Labels(attributeName string, values []string) (labels map[string]string, err error) {
+	labels = map[string]string{}
+	if !this.Has(attributeName) || len(values) == 0 {
+		return
+	}
+	type item struct {
+		Value string `db:"value"`
+		Label string `db:"label"`
+	}
+	var items []item
+	err = db.ClickHouseSqlx.Select(&items, `select value,label from xwl_attr_dict 
+		where table_id = ? and attribute_name = ? and value in (?) 
+		and version = (select max(version) from xwl_attr_dict where table_id = ? and attribute_name = ?)`,
+		this.appid, attributeName, values, this.appid, attributeName)
+	if err != nil {
+		return
+	}
+	for _, v := range items {
+		labels[v.Value] = v.Label
+	}
+	return
+}
+
+//把查询结果中某一列的值替换为显示名
+func (this AttrDicts) ReplaceRows(attributeName string, rows []map[string]interface{}, key string) (err error) {
+	if !this.Has(attributeName) || len(rows) == 0 {
+		return
+	}
+	values := []string{}
+	for _, row := range rows {
+		if v, ok := row[key]; ok && v != nil {
+			values = append(values, ValueString(v))
+		}
+	}
+	labels, err := this.Labels(attributeName, values)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		if v, ok := row[key]; ok && v != nil {
+			if label, ok := labels[ValueString(v)]; ok {
+				row[key] = label
+			}
+		}
+	}
+	return
+}
+
+//字典中的值统一按toString后的字符串匹配
+func ValueString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	default:
+		return strings.TrimSpace(fmt.Sprint(val))
+	}
+}
@@ -51,3 +51,36 @@ func GetUserGroupSqlAndArgs(ids []int, appid int) (SQL string, Args []interface{
 	SQL = " and " + SQL
 	return SQL, Args, err
 }
+
+//用户所属分群名组成的数组 用于按分群分组
+func GetUserGroupNamesSql(ids []int, appid int) (SQL string, Args []interface{}, err error) {
+	sql, args, err := db.
+		SqlBuilder.
+		Select("group_name", "user_list").
+		From("user_group").
+		Where(db.Eq{"appid": appid, "id": ids}).
+		OrderBy("id asc").
+		ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var userGroupList []model.UserGroup
+	if err = db.Sqlx.Select(&userGroupList, sql, args...); err != nil {
+		return "", nil, err
+	}
+
+	ifArr := []string{}
+	for index := range userGroupList {
+		idStr, err := util.GzipUnCompress(userGroupList[index].UserList)
+		if err != nil {
+			return "", nil, err
+		}
+		ifArr = append(ifArr, "if(xwl_distinct_id in (?), ?, '')")
+		Args = append(Args, strings.Split(idStr, ","), userGroupList[index].GroupName)
+	}
+	if len(ifArr) == 0 {
+		return " emptyArrayString() ", nil, nil
+	}
+	return " arrayFilter(x -> x != '', [" + strings.Join(ifArr, ",") + "]) ", Args, nil
+}
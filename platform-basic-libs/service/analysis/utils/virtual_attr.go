@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+)
+
+//应用的虚拟属性 属性名=>表达式
+type VirtualAttrs map[string]string
+
+func GetVirtualAttrs(appid int) (virtualAttrs VirtualAttrs, err error) {
+	virtualAttr := model.VirtualAttr{}
+	list, err := virtualAttr.List(appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualAttrs = VirtualAttrs{}
+	for _, v := range list {
+		virtualAttrs[v.AttributeName] = v.Expression
+	}
+
+	//配置了字典的属性可以按显示名筛选与分组
+	attrDicts, err := GetAttrDicts(appid)
+	if err != nil {
+		return nil, err
+	}
+	for name := range attrDicts.names {
+		virtualAttrs[name+AttrLabelSuffix] = attrDicts.LabelExpr(name)
+	}
+	return
+}
+
+//虚拟属性替换为加括号的表达式 其他字段原样返回
+//表达式在保存时已校验过 这里只按属性名精确匹配 不会拼接前端传入的内容
+func (this VirtualAttrs) Col(col string) string {
+	if expr, ok := this[col]; ok {
+		return "(" + expr + ")"
+	}
+	return col
+}
+
+//替换筛选条件中的虚拟属性 只用于事件表的条件 用户属性条件不支持虚拟属性
+func (this VirtualAttrs) ReplaceFilter(filter *request.AnalysisFilter) {
+	if len(this) == 0 {
+		return
+	}
+	for i := range filter.Filts {
+		filter.Filts[i].ColumnName = this.Col(filter.Filts[i].ColumnName)
+		for j := range filter.Filts[i].Filts {
+			filter.Filts[i].Filts[j].ColumnName = this.Col(filter.Filts[i].Filts[j].ColumnName)
+		}
+	}
+}
+
+//替换指标中的虚拟属性 selectAttr[0]为字段 selectAttr[1]为计算方式
+func (this VirtualAttrs) ReplaceSelectAttr(selectAttr []string) {
+	if len(selectAttr) > 0 {
+		selectAttr[0] = this.Col(selectAttr[0])
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	jsoniter "github.com/json-iterator/go"
+)
+
+type VirtualEvent struct {
+	ShowName string
+	Items    []request.VirtualEventItem
+}
+
+//应用的虚拟事件 事件名=>组成部分
+type VirtualEvents map[string]VirtualEvent
+
+//筛选条件中的虚拟属性会被替换为表达式
+func GetVirtualEvents(appid int, virtualAttrs VirtualAttrs) (virtualEvents VirtualEvents, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	virtualEvent := model.VirtualEvent{}
+	list, err := virtualEvent.List(appid)
+	if err != nil {
+		return nil, err
+	}
+	virtualEvents = VirtualEvents{}
+	for _, v := range list {
+		var items []request.VirtualEventItem
+		if err = json.Unmarshal([]byte(v.Definition), &items); err != nil {
+			return nil, err
+		}
+		for i := range items {
+			virtualAttrs.ReplaceFilter(&items[i].Filter)
+		}
+		virtualEvents[v.EventName] = VirtualEvent{ShowName: v.ShowName, Items: items}
+	}
+	return
+}
+
+//单个事件的条件 虚拟事件展开为各组成部分的或条件
+func (this VirtualEvents) EventSql(eventName string) (SQL string, args []interface{}, err error) {
+	virtualEvent, ok := this[eventName]
+	if !ok {
+		return " xwl_part_event = ? ", []interface{}{eventName}, nil
+	}
+
+	sqlArr := []string{}
+	for _, item := range virtualEvent.Items {
+		itemSql := " xwl_part_event = ? "
+		args = append(args, item.EventName)
+		if len(item.Filter.Filts) > 0 {
+			whereSql, whereArgs, _, err := GetWhereSql(item.Filter)
+			if err != nil {
+				return "", nil, err
+			}
+			itemSql = itemSql + " and " + whereSql
+			args = append(args, whereArgs...)
+		}
+		sqlArr = append(sqlArr, "("+itemSql+")")
+	}
+	return " ( " + strings.Join(sqlArr, " or ") + " ) ", args, nil
+}
+
+//多个事件的条件 真实事件合并为一个in条件
+func (this VirtualEvents) EventInSql(eventNames []string) (SQL string, args []interface{}, err error) {
+	realEventNames := []interface{}{}
+	sqlArr := []string{}
+	for _, eventName := range eventNames {
+		if _, ok := this[eventName]; !ok {
+			realEventNames = append(realEventNames, eventName)
+			continue
+		}
+		eventSql, eventArgs, err := this.EventSql(eventName)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlArr = append(sqlArr, eventSql)
+		args = append(args, eventArgs...)
+	}
+	if len(realEventNames) > 0 {
+		sqlArr = append([]string{" xwl_part_event in (?) "}, sqlArr...)
+		args = append([]interface{}{realEventNames}, args...)
+	}
+	if len(sqlArr) == 0 {
+		return " 1 = 1 ", nil, nil
+	}
+	return " ( " + strings.Join(sqlArr, " or ") + " ) ", args, nil
+}
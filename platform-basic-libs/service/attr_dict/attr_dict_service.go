@@ -0,0 +1,237 @@
+package attr_dict
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
+	"go.uber.org/zap"
+)
+
+const maxDownloadSize = 50 << 20
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+type AttrDictService struct {
+	ManagerID int32
+	Appid     int
+}
+
+//字典只能挂在已上报过的属性上
+func (this *AttrDictService) checkAttr(attributeName string) (err error) {
+	var count int
+	err = db.Sqlx.Get(&count, "select count(*) from attribute where app_id = ? and attribute_name = ?", this.Appid, attributeName)
+	if err != nil {
+		return
+	}
+	if count == 0 {
+		return errors.New("属性" + attributeName + "不存在")
+	}
+	return nil
+}
+
+func checkUrl(rawUrl string) (err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("同步地址只支持http或https")
+	}
+	return nil
+}
+
+//已存在时覆盖原有配置
+func (this *AttrDictService) save(attrDict *model.AttrDict) (err error) {
+	if err = this.checkAttr(attrDict.AttributeName); err != nil {
+		return
+	}
+	list, err := attrDict.List(this.Appid)
+	if err != nil {
+		return
+	}
+	for _, v := range list {
+		if v.AttributeName == attrDict.AttributeName {
+			attrDict.Id = v.Id
+			return attrDict.Modify(this.Appid)
+		}
+	}
+	return attrDict.Insert(this.ManagerID, this.Appid)
+}
+
+//上传csv 替换该属性的全部字典内容
+func (this *AttrDictService) Upload(reqData request.UploadAttrDict) (err error) {
+	items, err := ParseCsv(strings.NewReader(reqData.Csv))
+	if err != nil {
+		return
+	}
+	attrDict := model.AttrDict{
+		AttributeName: strings.TrimSpace(reqData.AttributeName),
+		SourceType:    model.AttrDictSourceCsv,
+	}
+	if err = this.save(&attrDict); err != nil {
+		return
+	}
+	err = replaceItems(this.Appid, attrDict.AttributeName, items)
+	if updateErr := attrDict.UpdateSyncResult(len(items), err); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return
+}
+
+//保存url同步配置并立即同步一次
+func (this *AttrDictService) SaveUrl(reqData request.UrlAttrDict) (err error) {
+	if err = checkUrl(reqData.Url); err != nil {
+		return
+	}
+	if reqData.SyncInterval <= 0 {
+		return errors.New("同步间隔必须大于0")
+	}
+	attrDict := model.AttrDict{
+		AttributeName: strings.TrimSpace(reqData.AttributeName),
+		SourceType:    model.AttrDictSourceUrl,
+		Url:           reqData.Url,
+		SyncInterval:  reqData.SyncInterval,
+	}
+	if err = this.save(&attrDict); err != nil {
+		return
+	}
+	attrDict.Appid = this.Appid
+	return Sync(attrDict)
+}
+
+func (this *AttrDictService) Sync(id int) (err error) {
+	attrDict := model.AttrDict{Id: id}
+	if err = attrDict.FindById(this.Appid); err != nil {
+		return
+	}
+	if attrDict.SourceType != model.AttrDictSourceUrl {
+		return errors.New("上传的字典不支持同步")
+	}
+	return Sync(attrDict)
+}
+
+func (this *AttrDictService) Delete(id int) (err error) {
+	attrDict := model.AttrDict{Id: id}
+	if err = attrDict.FindById(this.Appid); err != nil {
+		return
+	}
+	if err = attrDict.Delete(this.Appid); err != nil {
+		return
+	}
+	_, err = db.ClickHouseSqlx.Exec("ALTER TABLE xwl_attr_dict "+sinker.GetClusterSql()+" DELETE WHERE table_id = ? and attribute_name = ?", this.Appid, attrDict.AttributeName)
+	return
+}
+
+func (this *AttrDictService) List() (list []model.AttrDict, err error) {
+	attrDict := model.AttrDict{}
+	return attrDict.List(this.Appid)
+}
+
+//分页查看字典内容
+func (this *AttrDictService) Items(reqData request.AttrDictItems) (items []Item, count int, err error) {
+	attrDict := model.AttrDict{Id: reqData.Id}
+	if err = attrDict.FindById(this.Appid); err != nil {
+		return
+	}
+	if reqData.Page <= 0 {
+		reqData.Page = 1
+	}
+	if reqData.PageSize <= 0 || reqData.PageSize > 1000 {
+		reqData.PageSize = 20
+	}
+
+	where := " table_id = ? and attribute_name = ? and version = (select max(version) from xwl_attr_dict where table_id = ? and attribute_name = ?) "
+	args := []interface{}{this.Appid, attrDict.AttributeName, this.Appid, attrDict.AttributeName}
+	if reqData.Keyword != "" {
+		where = where + " and (positionCaseInsensitiveUTF8(value, ?) > 0 or positionCaseInsensitiveUTF8(label, ?) > 0) "
+		args = append(args, reqData.Keyword, reqData.Keyword)
+	}
+	if err = db.ClickHouseSqlx.Get(&count, "select count() from xwl_attr_dict where "+where, args...); err != nil {
+		return
+	}
+	limit := " limit " + strconv.Itoa((reqData.Page-1)*reqData.PageSize) + "," + strconv.Itoa(reqData.PageSize)
+	err = db.ClickHouseSqlx.Select(&items, "select value,label from xwl_attr_dict where "+where+" order by value"+limit, args...)
+	return
+}
+
+//拉取url字典并替换 结果记录到配置上
+func Sync(attrDict model.AttrDict) (err error) {
+	items, err := fetch(attrDict.Url)
+	if err == nil {
+		err = replaceItems(attrDict.Appid, attrDict.AttributeName, items)
+	}
+	if updateErr := attrDict.UpdateSyncResult(len(items), err); updateErr != nil {
+		logs.Logger.Error("记录字典同步结果失败", zap.Int("id", attrDict.Id), zap.Error(updateErr))
+	}
+	return
+}
+
+func fetch(rawUrl string) (items []Item, err error) {
+	if err = checkUrl(rawUrl); err != nil {
+		return
+	}
+	resp, err := httpClient.Get(rawUrl)
+	if err != nil {
+		return nil, errors.New("拉取字典失败:" + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("拉取字典失败:" + resp.Status)
+	}
+	if resp.ContentLength > maxDownloadSize {
+		return nil, errors.New("字典文件过大")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, errors.New("拉取字典失败:" + err.Error())
+	}
+	if len(body) > maxDownloadSize {
+		return nil, errors.New("字典文件过大")
+	}
+	return ParseCsv(bytes.NewReader(body))
+}
+
+//写入新版本后删除旧版本 删除是异步的 字典加载时只取最新版本 所以不会读到新旧混合的内容
+func replaceItems(appid int, attributeName string, items []Item) (err error) {
+	version := uint64(time.Now().UnixNano())
+
+	tx, err := db.ClickHouseSqlx.Begin()
+	if err != nil {
+		return
+	}
+	stmt, err := tx.Prepare("INSERT INTO xwl_attr_dict (table_id,attribute_name,value,label,version) VALUES (?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	defer stmt.Close()
+	for _, item := range items {
+		if _, err = stmt.Exec(uint64(appid), attributeName, item.Value, item.Label, version); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	_, err = db.ClickHouseSqlx.Exec("ALTER TABLE xwl_attr_dict "+sinker.GetClusterSql()+" DELETE WHERE table_id = ? and attribute_name = ? and version < ?", appid, attributeName, version)
+	if err != nil {
+		return
+	}
+
+	//字典按LIFETIME定期刷新 这里尽量立即生效 失败不影响结果
+	if _, reloadErr := db.ClickHouseSqlx.Exec("SYSTEM RELOAD DICTIONARY xwl_attr_dict_dict"); reloadErr != nil {
+		logs.Logger.Warn("刷新属性字典失败", zap.Error(reloadErr))
+	}
+	return nil
+}
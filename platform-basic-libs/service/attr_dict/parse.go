@@ -0,0 +1,70 @@
+package attr_dict
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxItems    = 200000
+	maxValueLen = 1024
+)
+
+type Item struct {
+	Value string `json:"value" db:"value"`
+	Label string `json:"label" db:"label"`
+}
+
+//解析两列的csv 第一列为属性值 第二列为显示名
+//首行为value,label时视为表头跳过 同一个值出现多次时以最后一次为准
+func ParseCsv(r io.Reader) (items []Item, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	index := map[string]int{}
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("csv格式有误:" + err.Error())
+		}
+		line++
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, errors.New("csv第" + strconv.Itoa(line) + "行缺少显示名")
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff"))
+		label := strings.TrimSpace(record[1])
+		if line == 1 && strings.EqualFold(value, "value") && strings.EqualFold(label, "label") {
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if len(value) > maxValueLen || len(label) > maxValueLen {
+			return nil, errors.New("csv第" + strconv.Itoa(line) + "行内容过长")
+		}
+		if i, ok := index[value]; ok {
+			items[i].Label = label
+			continue
+		}
+		if len(items) >= maxItems {
+			return nil, errors.New("字典条数不能超过" + strconv.Itoa(maxItems))
+		}
+		index[value] = len(items)
+		items = append(items, Item{Value: value, Label: label})
+	}
+	if len(items) == 0 {
+		return nil, errors.New("字典内容为空")
+	}
+	return items, nil
+}
@@ -0,0 +1,27 @@
+package attr_dict
+
+import (
+	"context"
+
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"go.uber.org/zap"
+)
+
+//同步到期的url字典 ctx取消后不再同步剩余的字典
+func SyncDue(ctx context.Context) (err error) {
+	attrDict := model.AttrDict{}
+	list, err := attrDict.DueList()
+	if err != nil {
+		return
+	}
+	for _, v := range list {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if err := Sync(v); err != nil {
+			logs.Logger.Error("同步属性字典失败", zap.Int("id", v.Id), zap.String("url", v.Url), zap.Error(err))
+		}
+	}
+	return nil
+}
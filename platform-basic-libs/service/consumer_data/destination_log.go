@@ -0,0 +1,139 @@
+package consumer_data
+
+import (
+	"sync"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"go.uber.org/zap"
+)
+
+//事件转发投递日志
+type DestinationLogData struct {
+	TableId       int
+	DestinationId int
+	CreateTime    string
+	EventName     string
+	Status        int
+	HttpStatus    int
+	Attempts      int
+	DurationMs    int64
+	ErrorReason   string
+	RequestBody   string
+	ResponseBody  string
+}
+
+type DestinationLog struct {
+	buffer        []*DestinationLogData
+	bufferMutex   *sync.RWMutex
+	batchSize     int
+	flushInterval int
+}
+
+func NewDestinationLog(config model.BatchConfig) *DestinationLog {
+	logs.Logger.Info("NewDestinationLog", zap.Int("batchSize", config.BufferSize), zap.Int("flushInterval", config.FlushInterval))
+	destinationLog := &DestinationLog{
+		buffer:        make([]*DestinationLogData, 0, config.BufferSize),
+		bufferMutex:   new(sync.RWMutex),
+		batchSize:     config.BufferSize,
+		flushInterval: config.FlushInterval,
+	}
+
+	if config.FlushInterval > 0 {
+		destinationLog.RegularFlushing()
+	}
+
+	return destinationLog
+}
+
+func (this *DestinationLog) Flush() (err error) {
+	this.bufferMutex.Lock()
+	defer this.bufferMutex.Unlock()
+
+	if len(this.buffer) == 0 {
+		return nil
+	}
+
+	startNow := time.Now()
+
+	tx, err := db.ClickHouseSqlx.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO xwl_destination_log (table_id,destination_id,create_time,event_name,status,http_status,attempts,duration_ms,error_reason,request_body,response_body) VALUES (?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, buffer := range this.buffer {
+		if _, err := stmt.Exec(
+			buffer.TableId,
+			buffer.DestinationId,
+			buffer.CreateTime,
+			buffer.EventName,
+			buffer.Status,
+			buffer.HttpStatus,
+			buffer.Attempts,
+			buffer.DurationMs,
+			buffer.ErrorReason,
+			buffer.RequestBody,
+			buffer.ResponseBody,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logs.Logger.Error("入库转发日志出现错误", zap.Error(err))
+	} else {
+		logs.Logger.Info("入库转发日志成功", zap.String("所花时间", time.Now().Sub(startNow).String()), zap.Int("数据长度为", len(this.buffer)))
+	}
+	this.buffer = make([]*DestinationLogData, 0, this.batchSize)
+	return nil
+}
+
+func (this *DestinationLog) Add(data *DestinationLogData) (err error) {
+	this.bufferMutex.Lock()
+	this.buffer = append(this.buffer, data)
+	this.bufferMutex.Unlock()
+
+	if this.getBufferLength() >= this.batchSize {
+		return this.Flush()
+	}
+
+	return nil
+}
+
+func (this *DestinationLog) getBufferLength() int {
+	this.bufferMutex.RLock()
+	defer this.bufferMutex.RUnlock()
+	return len(this.buffer)
+}
+
+func (this *DestinationLog) FlushAll() error {
+	for this.getBufferLength() > 0 {
+		if err := this.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *DestinationLog) RegularFlushing() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(this.flushInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			<-ticker.C
+			if err := this.Flush(); err != nil {
+				logs.Logger.Error("DestinationLog RegularFlushing", zap.Error(err))
+			}
+		}
+	}()
+}
@@ -31,6 +31,8 @@ type ReportAcceptStatus struct {
 const (
 	FailStatus    = 0
 	SuccessStatus = 1
+	//已入库 但不符合埋点方案
+	WarnStatus = 2
 )
 
 func NewReportAcceptStatus(config model.BatchConfig) *ReportAcceptStatus {
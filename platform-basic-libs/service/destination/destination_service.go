@@ -0,0 +1,192 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/Masterminds/squirrel"
+	jsoniter "github.com/json-iterator/go"
+)
+
+//列表中签名密钥的掩码 修改时密钥为空或为掩码则保留原密钥
+const secretMask = "******"
+
+type DestinationService struct {
+	ManagerID int32
+	Appid     int
+}
+
+func (this *DestinationService) toModel(reqData request.Destination) (destination model.Destination, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	if strings.TrimSpace(reqData.Name) == "" {
+		return destination, errors.New("转发名称不能为空")
+	}
+	if reqData.MaxRetries < 0 || reqData.MaxRetries > 10 {
+		return destination, errors.New("重试次数需在0到10之间")
+	}
+
+	destination = model.Destination{
+		Id:              reqData.Id,
+		Name:            reqData.Name,
+		EventNames:      strings.Join(reqData.EventNames, ","),
+		PayloadTemplate: reqData.PayloadTemplate,
+		Url:             strings.TrimSpace(reqData.Url),
+		Secret:          reqData.Secret,
+		Timeout:         reqData.Timeout,
+		MaxRetries:      reqData.MaxRetries,
+		RetryInterval:   reqData.RetryInterval,
+		Status:          reqData.Status,
+	}
+	if destination.Timeout <= 0 {
+		destination.Timeout = 5000
+	}
+	if destination.RetryInterval <= 0 {
+		destination.RetryInterval = 1000
+	}
+	if len(reqData.Filter.Filts) > 0 {
+		b, err := json.Marshal(reqData.Filter)
+		if err != nil {
+			return destination, err
+		}
+		destination.Filter = string(b)
+	}
+	if len(reqData.Headers) > 0 {
+		b, err := json.Marshal(reqData.Headers)
+		if err != nil {
+			return destination, err
+		}
+		destination.Headers = string(b)
+	}
+
+	//校验地址、筛选条件与模板
+	_, err = NewTarget(destination)
+	return
+}
+
+func (this *DestinationService) Add(reqData request.Destination) (err error) {
+	destination, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	return destination.Insert(this.ManagerID, this.Appid)
+}
+
+func (this *DestinationService) Modify(reqData request.Destination) (err error) {
+	if reqData.Id == 0 {
+		return errors.New("转发ID不能为空")
+	}
+	if reqData.Secret == "" || reqData.Secret == secretMask {
+		old := model.Destination{Id: reqData.Id}
+		if err = old.FindById(this.Appid); err != nil {
+			return
+		}
+		reqData.Secret = old.Secret
+	}
+	destination, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	return destination.Modify(this.Appid)
+}
+
+func (this *DestinationService) ModifyStatus(id, status int) (err error) {
+	if status != model.DestinationEnable && status != model.DestinationDisable {
+		return errors.New("错误的状态")
+	}
+	destination := model.Destination{Id: id, Status: status}
+	return destination.ModifyStatus(this.Appid)
+}
+
+func (this *DestinationService) Delete(id int) (err error) {
+	destination := model.Destination{Id: id}
+	return destination.Delete(this.Appid)
+}
+
+func (this *DestinationService) List() (list []model.Destination, err error) {
+	destination := model.Destination{}
+	if list, err = destination.List(this.Appid); err != nil {
+		return
+	}
+	for index := range list {
+		if list[index].Secret != "" {
+			list[index].Secret = secretMask
+		}
+	}
+	return
+}
+
+//用示例数据发送一次 不写入投递日志
+func (this *DestinationService) Test(id int, eventName string, data string) (result DeliveryResult, err error) {
+	destination := model.Destination{Id: id}
+	if err = destination.FindById(this.Appid); err != nil {
+		return
+	}
+	target, err := NewTarget(destination)
+	if err != nil {
+		return
+	}
+	if !jsoniter.Valid([]byte(data)) {
+		return result, errors.New("示例数据不是合法的json")
+	}
+	body, err := target.Payload(Event{Appid: this.Appid, EventName: eventName, Raw: data})
+	if err != nil {
+		return result, errors.New("生成请求体失败:" + err.Error())
+	}
+	return target.Deliver(context.Background(), body), nil
+}
+
+//投递日志
+func (this *DestinationService) LogList(reqData request.DestinationLogList) (list []response.DestinationLogRes, count int, err error) {
+	if len(reqData.Date) != 2 {
+		return nil, 0, errors.New("请选择时间范围")
+	}
+	if reqData.Page <= 0 {
+		reqData.Page = 1
+	}
+	if reqData.PageSize <= 0 {
+		reqData.PageSize = 20
+	}
+
+	where := db.And{
+		db.Eq{"table_id": this.Appid},
+		squirrel.Expr("create_time >= toDateTime(?) and create_time <= toDateTime(?)", reqData.Date[0], reqData.Date[1]),
+	}
+	if reqData.DestinationId > 0 {
+		where = append(where, db.Eq{"destination_id": reqData.DestinationId})
+	}
+	if reqData.Status != nil {
+		where = append(where, db.Eq{"status": *reqData.Status})
+	}
+
+	SQL, args, err := db.SqlBuilder.
+		Select("count()").
+		From("xwl_destination_log").
+		Where(where).
+		ToSql()
+	if err != nil {
+		return
+	}
+	if err = db.ClickHouseSqlx.Get(&count, SQL, args...); err != nil {
+		return
+	}
+
+	SQL, args, err = db.SqlBuilder.
+		Select("destination_id,formatDateTime(create_time,'%Y-%m-%d %H:%M:%S') as create_date,event_name,status,http_status,attempts,duration_ms,error_reason,request_body,response_body").
+		From("xwl_destination_log").
+		Where(where).
+		OrderBy("create_time desc").
+		Limit(uint64(reqData.PageSize)).
+		Offset(uint64((reqData.Page - 1) * reqData.PageSize)).
+		ToSql()
+	if err != nil {
+		return
+	}
+	err = db.ClickHouseSqlx.Select(&list, SQL, args...)
+	return
+}
@@ -0,0 +1,233 @@
+package destination
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/consumer_data"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"go.uber.org/zap"
+)
+
+const (
+	FailStatus    = 0
+	SuccessStatus = 1
+)
+
+type job struct {
+	target *Target
+	event  Event
+	//该消息的所有转发都处理完后才标记消费
+	done func()
+}
+
+//同一分区的消息按消费顺序标记 前面的消息还在投递时后面的消息不标记
+//否则提交了后面消息的位置 进程退出后前面未投递完的消息不会再被消费
+type partitionMarker struct {
+	lock    sync.Mutex
+	pending map[int][]*markEntry
+}
+
+type markEntry struct {
+	done   bool
+	markFn func()
+}
+
+func newPartitionMarker() *partitionMarker {
+	return &partitionMarker{pending: map[int][]*markEntry{}}
+}
+
+//按消费顺序登记一条消息 返回该消息处理完后的回调
+func (this *partitionMarker) add(partition int, markFn func()) (done func()) {
+	entry := &markEntry{markFn: markFn}
+	this.lock.Lock()
+	this.pending[partition] = append(this.pending[partition], entry)
+	this.lock.Unlock()
+	return func() {
+		this.lock.Lock()
+		defer this.lock.Unlock()
+		entry.done = true
+		queue := this.pending[partition]
+		for len(queue) > 0 && queue[0].done {
+			queue[0].markFn()
+			queue[0] = nil
+			queue = queue[1:]
+		}
+		if len(queue) == 0 {
+			delete(this.pending, partition)
+		} else {
+			this.pending[partition] = queue
+		}
+	}
+}
+
+//事件转发调度器 运行在sinker独立的消费者组中
+//投递由固定数量的协程完成 队列满时只会阻塞转发消费者组
+type Dispatcher struct {
+	cfg     model.DestinationConfig
+	log     *consumer_data.DestinationLog
+	targets atomic.Value //map[int][]*Target 按appid分组
+	jobs    chan job
+	marker  *partitionMarker
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewDispatcher(cfg model.DestinationConfig, log *consumer_data.DestinationLog) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcher := &Dispatcher{
+		cfg:    cfg,
+		log:    log,
+		jobs:   make(chan job, cfg.GetQueueSize()),
+		marker: newPartitionMarker(),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	dispatcher.targets.Store(map[int][]*Target{})
+	return dispatcher
+}
+
+func (this *Dispatcher) Start() (err error) {
+	if err = this.refresh(); err != nil {
+		return
+	}
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		ticker := time.NewTicker(time.Duration(this.cfg.GetRefreshInterval()) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-this.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := this.refresh(); err != nil {
+					logs.Logger.Error("刷新转发配置失败", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < this.cfg.GetWorkers(); i++ {
+		this.wg.Add(1)
+		go this.work()
+	}
+	return
+}
+
+//重新加载已启用的转发配置 配置有误的转发会被跳过
+func (this *Dispatcher) refresh() (err error) {
+	destination := model.Destination{}
+	list, err := destination.EnableList()
+	if err != nil {
+		return
+	}
+	targets := map[int][]*Target{}
+	for _, v := range list {
+		target, err := NewTarget(v)
+		if err != nil {
+			logs.Logger.Error("转发配置有误", zap.Int("id", v.Id), zap.String("name", v.Name), zap.Error(err))
+			continue
+		}
+		targets[v.Appid] = append(targets[v.Appid], target)
+	}
+	this.targets.Store(targets)
+	return nil
+}
+
+//分发一条上报事件 同一分区的事件须按消费顺序调用 没有满足条件的转发时按顺序直接标记消费
+func (this *Dispatcher) Dispatch(partition, appid int, eventName, reportTime string, data []byte, markFn func()) {
+	markFn = this.marker.add(partition, markFn)
+	var matched []*Target
+	for _, target := range this.targets.Load().(map[int][]*Target)[appid] {
+		if target.Match(eventName, data) {
+			matched = append(matched, target)
+		}
+	}
+	if len(matched) == 0 {
+		markFn()
+		return
+	}
+
+	pending := int32(len(matched))
+	done := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			markFn()
+		}
+	}
+	event := Event{Appid: appid, EventName: eventName, ReportTime: reportTime, Raw: string(data)}
+	for _, target := range matched {
+		select {
+		case this.jobs <- job{target: target, event: event, done: done}:
+		case <-this.ctx.Done():
+			//已停止 不标记消费 重启后重新投递
+			return
+		}
+	}
+}
+
+//不需要转发的消息 同样按消费顺序标记
+func (this *Dispatcher) Skip(partition int, markFn func()) {
+	this.marker.add(partition, markFn)()
+}
+
+func (this *Dispatcher) work() {
+	defer this.wg.Done()
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case j := <-this.jobs:
+			this.deliver(j)
+		}
+	}
+}
+
+func (this *Dispatcher) deliver(j job) {
+	logData := &consumer_data.DestinationLogData{
+		TableId:       j.event.Appid,
+		DestinationId: j.target.Id,
+		CreateTime:    time.Now().Format(util.TimeFormat),
+		EventName:     j.event.EventName,
+		Status:        FailStatus,
+	}
+
+	body, err := j.target.Payload(j.event)
+	if err != nil {
+		//模板渲染失败重试也不会成功 记录后跳过
+		logData.ErrorReason = "生成请求体失败:" + err.Error()
+		logData.RequestBody = j.event.Raw
+	} else {
+		result := j.target.Deliver(this.ctx, body)
+		if !result.Success && this.ctx.Err() != nil {
+			//服务停止导致的中断 不标记消费 重启后重新投递
+			return
+		}
+		if result.Success {
+			logData.Status = SuccessStatus
+		}
+		logData.HttpStatus = result.HttpStatus
+		logData.Attempts = result.Attempts
+		logData.DurationMs = result.Duration
+		logData.ErrorReason = result.Error
+		logData.RequestBody = result.RequestBody
+		logData.ResponseBody = result.ResponseBody
+	}
+
+	if err := this.log.Add(logData); err != nil {
+		logs.Logger.Error("转发日志写入失败", zap.Error(err))
+	}
+	j.done()
+}
+
+//停止投递 未完成的事件不会被标记消费
+func (this *Dispatcher) Stop() {
+	this.cancel()
+	this.wg.Wait()
+}
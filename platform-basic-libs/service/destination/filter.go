@@ -0,0 +1,200 @@
+package destination
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/tidwall/gjson"
+)
+
+//正则缓存 避免每条数据都编译一次
+var regexpCache sync.Map
+
+//校验筛选条件格式 与 utils.GetWhereSql 的规则保持一致
+func CheckFilter(filter request.AnalysisFilter) (err error) {
+	if len(filter.Filts) == 0 {
+		return nil
+	}
+	if filter.Relation != utils.AND && filter.Relation != utils.OR {
+		return errors.New("错误的连接类型:" + filter.Relation)
+	}
+	for _, v := range filter.Filts {
+		if v.FilterType == utils.SIMPLE {
+			if err = checkExpr(v.Comparator, v.Ftv); err != nil {
+				return
+			}
+			continue
+		}
+		if v.Relation != utils.AND && v.Relation != utils.OR {
+			return errors.New("错误的连接类型:" + v.Relation)
+		}
+		for _, v2 := range v.Filts {
+			if err = checkExpr(v2.Comparator, v2.Ftv); err != nil {
+				return
+			}
+		}
+	}
+	return nil
+}
+
+func checkExpr(comparator string, ftv interface{}) (err error) {
+	switch comparator {
+	case "isNull", "isNotNull":
+		return nil
+	case "range", "rangeTime":
+		arr, ok := ftv.([]interface{})
+		if !ok || len(arr) != 2 {
+			return fmt.Errorf("%s 需要两个值", comparator)
+		}
+	case "match", "notmatch":
+		if _, err = getRegexp(fmt.Sprint(ftv)); err != nil {
+			return fmt.Errorf("正则表达式错误:%s", err.Error())
+		}
+	case "=", "!=", ">", ">=", "<", "<=":
+	default:
+		return errors.New("不支持的操作符:" + comparator)
+	}
+	return nil
+}
+
+//判断上报数据是否满足筛选条件 在内存中实现 getExpr 对应的语义
+func MatchFilter(filter request.AnalysisFilter, data []byte) bool {
+	if len(filter.Filts) == 0 {
+		return true
+	}
+	isAnd := filter.Relation == utils.AND
+	for _, v := range filter.Filts {
+		var ok bool
+		if v.FilterType == utils.SIMPLE {
+			ok = matchExpr(gjson.GetBytes(data, v.ColumnName), v.Comparator, v.Ftv)
+		} else {
+			childAnd := v.Relation == utils.AND
+			ok = childAnd
+			for _, v2 := range v.Filts {
+				if matchExpr(gjson.GetBytes(data, v2.ColumnName), v2.Comparator, v2.Ftv) != childAnd {
+					ok = !childAnd
+					break
+				}
+			}
+		}
+		if ok != isAnd {
+			return !isAnd
+		}
+	}
+	return isAnd
+}
+
+func matchExpr(val gjson.Result, comparator string, ftv interface{}) bool {
+	isNull := !val.Exists() || val.Type == gjson.Null
+	switch comparator {
+	case "isNull":
+		return isNull
+	case "isNotNull":
+		return !isNull
+	}
+	if isNull {
+		return false
+	}
+
+	switch comparator {
+	case "range":
+		arr, ok := ftv.([]interface{})
+		if !ok || len(arr) != 2 {
+			return false
+		}
+		return compare(val, arr[0]) >= 0 && compare(val, arr[1]) <= 0
+	case "rangeTime":
+		arr, ok := ftv.([]interface{})
+		//参数不足时与sql一致视为不筛选
+		if !ok || len(arr) != 2 {
+			return true
+		}
+		t := util.Str2Time(val.String(), util.TimeFormat)
+		start := util.Str2Time(fmt.Sprint(arr[0]), util.TimeFormat)
+		end := util.Str2Time(fmt.Sprint(arr[1]), util.TimeFormat)
+		return !t.Before(start) && !t.After(end)
+	case "match", "notmatch":
+		re, err := getRegexp(fmt.Sprint(ftv))
+		if err != nil {
+			return false
+		}
+		return re.MatchString(val.String()) == (comparator == "match")
+	case "=", "!=":
+		//多选时为数组 对应sql中的 in
+		arr, ok := ftv.([]interface{})
+		if !ok {
+			arr = []interface{}{ftv}
+		}
+		in := false
+		for _, v := range arr {
+			if compare(val, v) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (comparator == "=")
+	case ">":
+		return compare(val, ftv) > 0
+	case ">=":
+		return compare(val, ftv) >= 0
+	case "<":
+		return compare(val, ftv) < 0
+	case "<=":
+		return compare(val, ftv) <= 0
+	}
+	return false
+}
+
+//数值类型按数值比较 其余按字符串比较
+func compare(val gjson.Result, ftv interface{}) int {
+	if val.Type == gjson.Number || val.Type == gjson.True || val.Type == gjson.False {
+		var f float64
+		var err error
+		switch v := ftv.(type) {
+		case float64:
+			f = v
+		case bool:
+			if v {
+				f = 1
+			}
+		default:
+			f, err = strconv.ParseFloat(fmt.Sprint(v), 64)
+		}
+		if err == nil {
+			n := val.Float()
+			switch {
+			case n > f:
+				return 1
+			case n < f:
+				return -1
+			}
+			return 0
+		}
+	}
+	s, t := val.String(), fmt.Sprint(ftv)
+	switch {
+	case s > t:
+		return 1
+	case s < t:
+		return -1
+	}
+	return 0
+}
+
+func getRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(expr, re)
+	return re, nil
+}
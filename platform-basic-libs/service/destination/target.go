@@ -0,0 +1,228 @@
+package destination
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	SignatureHeader = "X-Xwl-Signature"
+	TimestampHeader = "X-Xwl-Timestamp"
+
+	//单次重试最长等待时间
+	maxRetryInterval = time.Minute
+	//投递日志中保留的响应体长度
+	maxResponseBody = 1024
+)
+
+var httpClient = &http.Client{}
+
+//转发给模板的事件数据
+type Event struct {
+	Appid      int                    `json:"appid"`
+	EventName  string                 `json:"event_name"`
+	ReportTime string                 `json:"report_time"`
+	Data       map[string]interface{} `json:"data"`
+	Raw        string                 `json:"-"`
+}
+
+//投递结果
+type DeliveryResult struct {
+	Success      bool   `json:"success"`
+	HttpStatus   int    `json:"http_status"`
+	Attempts     int    `json:"attempts"`
+	Duration     int64  `json:"duration_ms"`
+	Error        string `json:"error"`
+	RequestBody  string `json:"request_body"`
+	ResponseBody string `json:"response_body"`
+}
+
+//解析后的转发配置
+type Target struct {
+	model.Destination
+	eventNames map[string]struct{}
+	filter     request.AnalysisFilter
+	tpl        *template.Template
+	headers    map[string]string
+}
+
+func NewTarget(destination model.Destination) (target *Target, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	target = &Target{Destination: destination, eventNames: map[string]struct{}{}}
+
+	if !strings.HasPrefix(destination.Url, "http://") && !strings.HasPrefix(destination.Url, "https://") {
+		return nil, errors.New("转发地址必须以http://或https://开头")
+	}
+
+	for _, eventName := range strings.Split(destination.EventNames, ",") {
+		if eventName = strings.TrimSpace(eventName); eventName != "" {
+			target.eventNames[eventName] = struct{}{}
+		}
+	}
+
+	if strings.TrimSpace(destination.Filter) != "" {
+		if err = json.Unmarshal([]byte(destination.Filter), &target.filter); err != nil {
+			return nil, fmt.Errorf("属性筛选条件格式错误:%s", err.Error())
+		}
+		if err = CheckFilter(target.filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(destination.Headers) != "" {
+		if err = json.Unmarshal([]byte(destination.Headers), &target.headers); err != nil {
+			return nil, fmt.Errorf("请求头格式错误:%s", err.Error())
+		}
+	}
+
+	if strings.TrimSpace(destination.PayloadTemplate) != "" {
+		target.tpl, err = template.New(destination.Name).Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Option("missingkey=zero").Parse(destination.PayloadTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("请求体模板错误:%s", err.Error())
+		}
+	}
+
+	return target, nil
+}
+
+//事件名与属性是否满足转发条件
+func (this *Target) Match(eventName string, data []byte) bool {
+	if len(this.eventNames) > 0 {
+		if _, ok := this.eventNames[eventName]; !ok {
+			return false
+		}
+	}
+	return MatchFilter(this.filter, data)
+}
+
+//生成请求体 未配置模板时转发appid、事件名、上报时间与原始数据
+func (this *Target) Payload(event Event) (body []byte, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	if event.Data == nil {
+		if err = json.Unmarshal([]byte(event.Raw), &event.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if this.tpl == nil {
+		return json.Marshal(event)
+	}
+
+	buf := bytes.Buffer{}
+	if err = this.tpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//签名 hex(hmac_sha256(secret, 时间戳 + "." + 请求体))
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//投递 失败时按指数退避重试
+func (this *Target) Deliver(ctx context.Context, body []byte) (result DeliveryResult) {
+	startT := time.Now()
+	result.RequestBody = string(body)
+
+	interval := time.Duration(this.RetryInterval) * time.Millisecond
+	for attempt := 0; attempt <= this.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				result.Error = ctx.Err().Error()
+				result.Duration = time.Since(startT).Milliseconds()
+				return
+			case <-time.After(interval):
+			}
+			interval *= 2
+			if interval > maxRetryInterval {
+				interval = maxRetryInterval
+			}
+		}
+
+		result.Attempts = attempt + 1
+		retry, err := this.send(ctx, body, &result)
+		if err == nil {
+			result.Success = true
+			result.Error = ""
+			break
+		}
+		result.Error = err.Error()
+		if !retry {
+			break
+		}
+	}
+
+	result.Duration = time.Since(startT).Milliseconds()
+	return
+}
+
+func (this *Target) send(ctx context.Context, body []byte, result *DeliveryResult) (retry bool, err error) {
+	if this.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(this.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, this.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range this.headers {
+		req.Header.Set(k, v)
+	}
+	if this.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(this.Secret, timestamp, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		result.HttpStatus = 0
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	//读完剩余响应体 以便复用连接
+	io.Copy(ioutil.Discard, resp.Body)
+	result.HttpStatus = resp.StatusCode
+	result.ResponseBody = string(respBody)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("http status %d", resp.StatusCode)
+	//只有服务端错误与限流需要重试
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,175 @@
+package job
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//任务调度时间
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+//固定间隔执行 对应 @every 表达式
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (this everySchedule) Next(t time.Time) time.Time {
+	return t.Add(this.interval - time.Duration(t.UnixNano())%this.interval)
+}
+
+//标准5段cron表达式 分 时 日 月 周
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronBound struct {
+	min, max int
+}
+
+var (
+	minuteBound = cronBound{0, 59}
+	hourBound   = cronBound{0, 23}
+	domBound    = cronBound{1, 31}
+	monthBound  = cronBound{1, 12}
+	dowBound    = cronBound{0, 7}
+)
+
+//解析cron表达式 支持 分 时 日 月 周 五段格式、@hourly等描述符以及 @every 1m30s
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, errors.New("cron表达式错误:" + err.Error())
+		}
+		if interval < time.Second {
+			return nil, errors.New("cron表达式错误:执行间隔不能小于1秒")
+		}
+		return everySchedule{interval: interval}, nil
+	}
+	if v, ok := cronDescriptors[spec]; ok {
+		spec = v
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("cron表达式错误:需要5段 分 时 日 月 周")
+	}
+	var (
+		schedule cronSchedule
+		err      error
+	)
+	if schedule.minute, err = parseCronField(fields[0], minuteBound); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], hourBound); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], domBound); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], monthBound); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], dowBound); err != nil {
+		return nil, err
+	}
+	//周日可以写成0或7
+	if schedule.dow&(1<<7) > 0 {
+		schedule.dow |= 1
+	}
+	schedule.domStar = fields[2] == "*" || fields[2] == "?"
+	schedule.dowStar = fields[4] == "*" || fields[4] == "?"
+	return schedule, nil
+}
+
+//解析单段 支持 * ? 数字 a-b */n a-b/n 以及逗号分隔的列表
+func parseCronField(field string, bound cronBound) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		start, end, step := bound.min, bound.max, 1
+		rangeStr := part
+		if i := strings.Index(part, "/"); i >= 0 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.New("cron表达式错误:" + part)
+			}
+			rangeStr = part[:i]
+		}
+		switch {
+		case rangeStr == "*" || rangeStr == "?":
+		case strings.Contains(rangeStr, "-"):
+			se := strings.SplitN(rangeStr, "-", 2)
+			if start, err = strconv.Atoi(se[0]); err != nil {
+				return 0, errors.New("cron表达式错误:" + part)
+			}
+			if end, err = strconv.Atoi(se[1]); err != nil {
+				return 0, errors.New("cron表达式错误:" + part)
+			}
+		default:
+			if start, err = strconv.Atoi(rangeStr); err != nil {
+				return 0, errors.New("cron表达式错误:" + part)
+			}
+			end = start
+			//5/10 表示从5开始每10执行一次
+			if step > 1 {
+				end = bound.max
+			}
+		}
+		if start < bound.min || end > bound.max || start > end {
+			return 0, errors.New("cron表达式错误:" + part + "超出范围")
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (this cronSchedule) match(t time.Time) bool {
+	return this.month&(1<<uint(t.Month())) > 0 && this.hour&(1<<uint(t.Hour())) > 0 && this.minute&(1<<uint(t.Minute())) > 0 && this.dayMatch(t)
+}
+
+func (this cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	//最多向后查找5年 避免 2月30日 这类永远不会触发的表达式死循环
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if this.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !this.match(t) {
+			if this.hour&(1<<uint(t.Hour())) == 0 || !this.dayMatch(t) {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(time.Hour)
+				continue
+			}
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (this cronSchedule) dayMatch(t time.Time) bool {
+	domMatch := this.dom&(1<<uint(t.Day())) > 0
+	dowMatch := this.dow&(1<<uint(t.Weekday())) > 0
+	//日与周都有限定时满足其一即可 与crontab一致
+	if this.domStar || this.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,384 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/garyburd/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTimeout = 10 * time.Minute
+	slotLockTTL    = 10 * time.Minute //同一触发时间点的锁 只需覆盖各进程间的时钟误差
+	maxErrorLen    = 1000
+)
+
+var (
+	ErrJobRunning  = errors.New("任务正在执行中")
+	ErrJobNotFound = errors.New("任务不存在或不在当前服务中运行")
+	errJobTimeout  = errors.New("任务执行超时")
+)
+
+//定时任务
+type Job struct {
+	Name         string
+	Remark       string
+	Spec         string        //cron表达式
+	Timeout      time.Duration //单次执行超时时间 默认10分钟
+	Retry        int           //失败重试次数 超时不重试
+	RetryDelay   time.Duration
+	Local        bool //每个进程都执行 不抢占分布式锁 用于刷新进程内缓存
+	QuietSuccess bool //执行成功时不写执行历史 用于高频任务
+	Fn           func(ctx context.Context) error
+
+	schedule Schedule
+	running  int32
+}
+
+func (this *Job) timeout() time.Duration {
+	if this.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return this.Timeout
+}
+
+//执行锁的过期时间 覆盖所有重试
+func (this *Job) lockTTL() time.Duration {
+	return time.Duration(this.Retry+1)*this.timeout() + time.Duration(this.Retry)*this.RetryDelay + time.Minute
+}
+
+type scheduler struct {
+	lock    sync.Mutex
+	jobs    map[string]*Job
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+}
+
+var defaultScheduler = newScheduler()
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{jobs: map[string]*Job{}, ctx: ctx, cancel: cancel}
+}
+
+//当前进程标识 记录在执行历史中
+var host = func() string {
+	hostname, _ := os.Hostname()
+	return hostname + ":" + strconv.Itoa(os.Getpid())
+}()
+
+func hostName() string {
+	return model.CmdName + "@" + host
+}
+
+//注册任务 调度器已启动时立即开始调度
+func Register(jobs ...*Job) (err error) {
+	return defaultScheduler.register(jobs...)
+}
+
+//启动调度器 多次调用只会启动一次
+func Start() (stop func()) {
+	defaultScheduler.start()
+	return defaultScheduler.stop
+}
+
+//手动触发任务 在后台执行
+func Trigger(name string, managerUid int) (err error) {
+	return defaultScheduler.trigger(name, managerUid)
+}
+
+//当前进程注册的任务名
+func Names() []string {
+	defaultScheduler.lock.Lock()
+	defer defaultScheduler.lock.Unlock()
+	names := make([]string, 0, len(defaultScheduler.jobs))
+	for name := range defaultScheduler.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (this *scheduler) register(jobs ...*Job) (err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, job := range jobs {
+		if job.Name == "" || job.Fn == nil {
+			return errors.New("任务名和执行函数不能为空")
+		}
+		if _, ok := this.jobs[job.Name]; ok {
+			return errors.New("任务" + job.Name + "重复注册")
+		}
+		if job.schedule, err = ParseCron(job.Spec); err != nil {
+			return errors.New("任务" + job.Name + err.Error())
+		}
+		this.jobs[job.Name] = job
+		if this.started {
+			this.run(job)
+		}
+	}
+	return nil
+}
+
+func (this *scheduler) start() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.started {
+		return
+	}
+	this.started = true
+	for _, job := range this.jobs {
+		this.run(job)
+	}
+}
+
+func (this *scheduler) stop() {
+	this.cancel()
+}
+
+//保存任务定义并开始调度
+func (this *scheduler) run(job *Job) {
+	isLocal := 0
+	if job.Local {
+		isLocal = 1
+	}
+	jobModel := model.Job{
+		Name:    job.Name,
+		Remark:  job.Remark,
+		Spec:    job.Spec,
+		Timeout: int(job.timeout().Seconds()),
+		Retry:   job.Retry,
+		IsLocal: isLocal,
+		CmdName: model.CmdName,
+	}
+	if err := jobModel.Save(); err != nil {
+		logs.Logger.Error("保存任务定义失败", zap.String("job", job.Name), zap.Error(err))
+	}
+	go this.loop(job)
+}
+
+func (this *scheduler) loop(job *Job) {
+	for {
+		now := time.Now()
+		next := job.schedule.Next(now)
+		if next.IsZero() {
+			logs.Logger.Error("任务不会再被触发", zap.String("job", job.Name), zap.String("spec", job.Spec))
+			return
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-this.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			go this.fire(job, next)
+		}
+	}
+}
+
+//定时触发 同一触发时间点只有一个进程抢到锁执行
+func (this *scheduler) fire(job *Job, slot time.Time) {
+	if !job.Local {
+		ok, err := setNX(fmt.Sprintf("jobSlot_%s_%d", job.Name, slot.Unix()), hostName(), slotLockTTL)
+		if err != nil {
+			logs.Logger.Error("任务抢锁失败", zap.String("job", job.Name), zap.Error(err))
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+	release, err := this.acquire(job)
+	if err != nil {
+		if err != ErrJobRunning {
+			logs.Logger.Error("任务抢锁失败", zap.String("job", job.Name), zap.Error(err))
+		} else {
+			logs.Logger.Info("上一次执行尚未结束 跳过本次执行", zap.String("job", job.Name))
+		}
+		return
+	}
+	defer release()
+	this.execute(job, model.JobTriggerCron, 0)
+}
+
+func (this *scheduler) trigger(name string, managerUid int) (err error) {
+	this.lock.Lock()
+	job, ok := this.jobs[name]
+	this.lock.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	release, err := this.acquire(job)
+	if err != nil {
+		return
+	}
+	go func() {
+		defer release()
+		this.execute(job, model.JobTriggerManual, managerUid)
+	}()
+	return nil
+}
+
+//获取执行锁 进程内防止重复执行 非本地任务还需获取redis锁防止多个进程同时执行
+func (this *scheduler) acquire(job *Job) (release func(), err error) {
+	if !atomic.CompareAndSwapInt32(&job.running, 0, 1) {
+		return nil, ErrJobRunning
+	}
+	if job.Local {
+		return func() { atomic.StoreInt32(&job.running, 0) }, nil
+	}
+	key := "jobRunning_" + job.Name
+	val := hostName() + "_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	ok, err := setNX(key, val, job.lockTTL())
+	if err != nil || !ok {
+		atomic.StoreInt32(&job.running, 0)
+		if err == nil {
+			err = ErrJobRunning
+		}
+		return nil, err
+	}
+	return func() {
+		if err := unlock(key, val); err != nil {
+			logs.Logger.Error("任务释放锁失败", zap.String("job", job.Name), zap.Error(err))
+		}
+		atomic.StoreInt32(&job.running, 0)
+	}, nil
+}
+
+//执行任务并记录执行历史
+func (this *scheduler) execute(job *Job, triggerType string, managerUid int) {
+	start := time.Now()
+	run := &model.JobRun{
+		JobName:     job.Name,
+		TriggerType: triggerType,
+		TriggerBy:   managerUid,
+		Status:      model.JobRunRunning,
+		Host:        hostName(),
+		StartTime:   start.Format(util.TimeFormat),
+	}
+	if !job.QuietSuccess {
+		if err := run.Insert(); err != nil {
+			logs.Logger.Error("写入任务执行历史失败", zap.String("job", job.Name), zap.Error(err))
+		}
+	}
+
+	var err error
+	var unfinished <-chan error
+	for attempt := 0; attempt <= job.Retry; attempt++ {
+		if attempt > 0 && job.RetryDelay > 0 {
+			select {
+			case <-this.ctx.Done():
+			case <-time.After(job.RetryDelay):
+			}
+		}
+		if this.ctx.Err() != nil {
+			break
+		}
+		run.Attempts = attempt + 1
+		if unfinished, err = this.exec(job); err == nil || err == errJobTimeout {
+			break
+		}
+		logs.Logger.Error("任务执行失败", zap.String("job", job.Name), zap.Int("attempt", run.Attempts), zap.Error(err))
+	}
+
+	end := time.Now()
+	run.EndTime = end.Format(util.TimeFormat)
+	run.Duration = end.Sub(start).Milliseconds()
+	switch {
+	case err == nil:
+		run.Status = model.JobRunSuccess
+	case err == errJobTimeout:
+		run.Status = model.JobRunTimeout
+		run.ErrorMsg = err.Error()
+	default:
+		run.Status = model.JobRunFailed
+		run.ErrorMsg = err.Error()
+	}
+	if r := []rune(run.ErrorMsg); len(r) > maxErrorLen {
+		run.ErrorMsg = string(r[:maxErrorLen])
+	}
+
+	var saveErr error
+	switch {
+	case run.Id > 0:
+		saveErr = run.Finish()
+	case err != nil:
+		saveErr = run.Insert()
+	}
+	if saveErr != nil {
+		logs.Logger.Error("写入任务执行历史失败", zap.String("job", job.Name), zap.Error(saveErr))
+	}
+	jobModel := model.Job{Name: job.Name}
+	if saveErr = jobModel.UpdateLast(run); saveErr != nil {
+		logs.Logger.Error("更新任务执行结果失败", zap.String("job", job.Name), zap.Error(saveErr))
+	}
+
+	//超时的任务仍在执行 等其返回后调用方才释放执行锁 避免同一任务同时执行多份
+	if unfinished != nil {
+		logs.Logger.Warn("等待超时的任务返回", zap.String("job", job.Name))
+		if err := <-unfinished; err != nil {
+			logs.Logger.Error("超时的任务执行失败", zap.String("job", job.Name), zap.Error(err))
+		}
+	}
+}
+
+//单次执行 超时后不再等待任务返回 unfinished在任务返回时收到其结果
+func (this *scheduler) exec(job *Job) (unfinished <-chan error, err error) {
+	ctx, cancel := context.WithTimeout(this.ctx, job.timeout())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- job.Fn(ctx)
+	}()
+	select {
+	case err = <-done:
+		return nil, err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return done, errJobTimeout
+		}
+		return done, ctx.Err()
+	}
+}
+
+func setNX(key, val string, ttl time.Duration) (ok bool, err error) {
+	conn := db.RedisPool.Get()
+	defer conn.Close()
+	_, err = redis.String(conn.Do("set", key, val, "nx", "px", ttl.Milliseconds()))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//比较与删除在一个脚本中原子执行
+var unlockScript = redis.NewScript(1, db.CompareAndDelScript)
+
+//锁的值一致时才删除 避免锁过期后误删其他进程的锁
+func unlock(key, val string) (err error) {
+	conn := db.RedisPool.Get()
+	defer conn.Close()
+	_, err = unlockScript.Do(conn, key, val)
+	return
+}
@@ -0,0 +1,72 @@
+package job
+
+import (
+	"time"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+//执行历史保留天数
+const runKeepDays = 30
+
+type JobService struct {
+	ManagerID int32
+}
+
+type JobInfo struct {
+	model.Job
+	NextRunTime string `json:"next_run_time"`
+	CanTrigger  bool   `json:"can_trigger"` //是否可在当前服务手动触发
+}
+
+//任务列表以及最近一次执行结果
+func (this *JobService) List() (list []JobInfo, err error) {
+	jobModel := model.Job{}
+	jobs, err := jobModel.List()
+	if err != nil {
+		return
+	}
+	names := Names()
+	now := time.Now()
+	list = make([]JobInfo, 0, len(jobs))
+	for _, v := range jobs {
+		info := JobInfo{Job: v, CanTrigger: util.InstrArr(names, v.Name)}
+		if schedule, err := ParseCron(v.Spec); err == nil {
+			if next := schedule.Next(now); !next.IsZero() {
+				info.NextRunTime = next.Format(util.TimeFormat)
+			}
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+//执行历史
+func (this *JobService) Runs(reqData request.JobRuns) (list []model.JobRun, count int, err error) {
+	if reqData.Page <= 0 {
+		reqData.Page = 1
+	}
+	if reqData.Limit <= 0 {
+		reqData.Limit = 10
+	}
+	jobRun := &model.JobRun{JobName: reqData.JobName, FilterStatus: reqData.Status}
+	if err = model.SearchList(jobRun, reqData.Page, reqData.Limit, model.JobRunCols, &list); err != nil {
+		return
+	}
+	count, err = model.Count(jobRun)
+	return
+}
+
+//手动触发
+func (this *JobService) Trigger(name string) (err error) {
+	return Trigger(name, int(this.ManagerID))
+}
+
+//清理过期的执行历史
+func CleanRuns() (err error) {
+	jobRun := model.JobRun{}
+	_, err = jobRun.Clean(time.Now().AddDate(0, 0, -runKeepDays).Format(util.TimeFormat))
+	return
+}
@@ -0,0 +1,284 @@
+package meta_data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/sinker"
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/garyburd/redigo/redis"
+	jsoniter "github.com/json-iterator/go"
+	"go.uber.org/zap"
+)
+
+const (
+	AttrStatusHide     = 0
+	AttrStatusShow     = 1
+	AttrStatusArchived = 2
+)
+
+const (
+	RetypeRunning = "running"
+	RetypeDone    = "done"
+	RetypeFailed  = "failed"
+	RetypeNone    = "none"
+)
+
+//类型转换任务状态保留时间
+const retypeTaskExpire = 60 * 60 * 24
+
+type retypeTask struct {
+	Status     string `json:"status"`
+	DataType   int    `json:"data_type"`
+	StartTime  int64  `json:"start_time"`
+	FailReason string `json:"fail_reason"`
+}
+
+func retypeTaskKey(appid string, attributeSource int, attributeName string) string {
+	return fmt.Sprintf("AttrRetype_%s_%d_%s", appid, attributeSource, attributeName)
+}
+
+func (this *MetaDataService) tableName(attributeSource int) (string, error) {
+	switch attributeSource {
+	case 1:
+		return "xwl_user" + this.Appid, nil
+	case 2:
+		return "xwl_event" + this.Appid, nil
+	}
+	return "", errors.New("属性来源错误")
+}
+
+//校验二次确认并返回属性当前信息
+func (this *MetaDataService) checkAttrAction(attributeSource int, attributeName, confirm string) (attr response.AttributeRes, err error) {
+	if attributeName == "" {
+		return attr, errors.New("属性名不能为空")
+	}
+	if confirm != attributeName {
+		return attr, errors.New("请输入属性名" + attributeName + "确认该操作")
+	}
+	if _, ok := parser.SysColumn[attributeName]; ok || strings.HasPrefix(attributeName, "xwl_") {
+		return attr, errors.New("预置属性不允许该操作")
+	}
+	if err = db.Sqlx.Get(&attr, "select attribute_name,show_name,data_type,attribute_type,attribute_source,status from attribute where app_id = ? and attribute_source = ? and attribute_name = ?", this.Appid, attributeSource, attributeName); err != nil {
+		return attr, errors.New("属性" + attributeName + "不存在")
+	}
+	if attr.AttributeType == 1 {
+		return attr, errors.New("预置属性不允许该操作")
+	}
+	return attr, nil
+}
+
+func (this *MetaDataService) getRetypeTask(attributeSource int, attributeName string) (task *retypeTask, err error) {
+	redisConn := db.RedisPool.Get()
+	defer redisConn.Close()
+	b, err := redis.Bytes(redisConn.Do("get", retypeTaskKey(this.Appid, attributeSource, attributeName)))
+	if err != nil {
+		if util.FilterRedisNilErr(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	task = new(retypeTask)
+	err = json.Unmarshal(b, task)
+	return task, err
+}
+
+func (this *MetaDataService) setRetypeTask(attributeSource int, attributeName string, task *retypeTask) (err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	b, err := json.Marshal(task)
+	if err != nil {
+		return
+	}
+	redisConn := db.RedisPool.Get()
+	defer redisConn.Close()
+	_, err = redisConn.Do("setex", retypeTaskKey(this.Appid, attributeSource, attributeName), retypeTaskExpire, b)
+	return
+}
+
+//修改属性类型 ck列转换在后台执行 通过RetypeProgress查看进度
+func (this *MetaDataService) RetypeAttr(reqData request.RetypeAttrReq) (err error) {
+	attr, err := this.checkAttrAction(reqData.AttributeSource, reqData.AttributeName, reqData.Confirm)
+	if err != nil {
+		return
+	}
+	if reqData.DataType == parser.ElasticDateTime {
+		reqData.DataType = parser.DateTime
+	}
+	if _, ok := parser.TypeRemarkMap[reqData.DataType]; !ok {
+		return errors.New("数据类型错误")
+	}
+	if attr.DataType == reqData.DataType {
+		return errors.New("属性类型未发生变化")
+	}
+	colType, err := sinker.GetColumnTypeSql(reqData.DataType)
+	if err != nil {
+		return
+	}
+	tableName, err := this.tableName(reqData.AttributeSource)
+	if err != nil {
+		return
+	}
+	task, err := this.getRetypeTask(reqData.AttributeSource, reqData.AttributeName)
+	if err != nil {
+		return
+	}
+	if task != nil && task.Status == RetypeRunning {
+		return errors.New("该属性正在转换类型，请稍后再试")
+	}
+
+	task = &retypeTask{Status: RetypeRunning, DataType: reqData.DataType, StartTime: time.Now().Unix()}
+	if err = this.setRetypeTask(reqData.AttributeSource, reqData.AttributeName, task); err != nil {
+		return
+	}
+
+	go func() {
+		dbName := model.GlobConfig.Comm.ClickHouse.DbName
+		sql := fmt.Sprintf("ALTER TABLE %s.%s %s MODIFY COLUMN `%s` %s", dbName, tableName, sinker.GetClusterSql(), reqData.AttributeName, colType)
+		logs.Logger.Info(fmt.Sprintf("executing sql=> %s", sql), zap.String("table", tableName))
+		if _, err := db.ClickHouseSqlx.Exec(sql); err != nil {
+			logs.Logger.Error("RetypeAttr", zap.String("sql", sql), zap.Error(err))
+			task.Status = RetypeFailed
+			task.FailReason = err.Error()
+		} else if _, err := db.Sqlx.Exec("update attribute set data_type = ? where app_id = ? and attribute_source = ? and attribute_name = ?", reqData.DataType, this.Appid, reqData.AttributeSource, reqData.AttributeName); err != nil {
+			task.Status = RetypeFailed
+			task.FailReason = err.Error()
+		} else {
+			task.Status = RetypeDone
+		}
+		//无论成功与否都通知sinker重新读取表结构
+		if err := sinker.InvalidateCache(dbName, tableName); err != nil {
+			logs.Logger.Error("InvalidateCache", zap.Error(err))
+		}
+		if err := this.setRetypeTask(reqData.AttributeSource, reqData.AttributeName, task); err != nil {
+			logs.Logger.Error("setRetypeTask", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+//查看属性类型转换进度
+func (this *MetaDataService) RetypeProgress(reqData request.AttrRetypeProgressReq) (res response.AttrRetypeProgress, err error) {
+	task, err := this.getRetypeTask(reqData.AttributeSource, reqData.AttributeName)
+	if err != nil {
+		return
+	}
+	if task == nil {
+		res.Status = RetypeNone
+		return
+	}
+	res.Status = task.Status
+	res.DataType = task.DataType
+	res.StartTime = task.StartTime
+	res.FailReason = task.FailReason
+
+	tableName, err := this.tableName(reqData.AttributeSource)
+	if err != nil {
+		return
+	}
+	dbName := model.GlobConfig.Comm.ClickHouse.DbName
+
+	if err = db.ClickHouseSqlx.Get(&res.PartsTotal, "select count() from system.parts where database = ? and table = ? and active", dbName, tableName); err != nil {
+		return
+	}
+
+	var mutations []struct {
+		PartsToDo        int    `db:"parts_to_do"`
+		IsDone           int    `db:"is_done"`
+		LatestFailReason string `db:"latest_fail_reason"`
+	}
+	if err = db.ClickHouseSqlx.Select(&mutations,
+		"select toInt64(parts_to_do) as parts_to_do,toInt64(is_done) as is_done,latest_fail_reason from system.mutations where database = ? and table = ? and create_time >= toDateTime(?) and position(command, ?) > 0 order by create_time desc limit 1",
+		dbName, tableName, task.StartTime, reqData.AttributeName); err != nil {
+		return
+	}
+
+	switch {
+	case len(mutations) > 0:
+		res.PartsToDo = mutations[0].PartsToDo
+		if mutations[0].IsDone == 0 && mutations[0].LatestFailReason != "" && res.FailReason == "" {
+			res.FailReason = mutations[0].LatestFailReason
+		}
+	case task.Status == RetypeRunning:
+		res.PartsToDo = res.PartsTotal
+	}
+
+	if res.PartsTotal > 0 {
+		res.Progress = (res.PartsTotal - res.PartsToDo) * 100 / res.PartsTotal
+	}
+	if res.Progress < 0 {
+		res.Progress = 0
+	}
+	if res.Status == RetypeDone {
+		res.Progress = 100
+	}
+	return
+}
+
+//归档属性 归档后不在分析中展示 取消归档恢复为不显示
+func (this *MetaDataService) ArchiveAttr(reqData request.ArchiveAttrReq) (err error) {
+	attr, err := this.checkAttrAction(reqData.AttributeSource, reqData.AttributeName, reqData.Confirm)
+	if err != nil {
+		return
+	}
+	status := AttrStatusArchived
+	if !reqData.Archive {
+		if attr.Status != AttrStatusArchived {
+			return errors.New("该属性未归档")
+		}
+		status = AttrStatusHide
+	}
+	_, err = db.Sqlx.Exec("update attribute set status = ? where app_id = ? and attribute_source = ? and attribute_name = ?;", status, this.Appid, reqData.AttributeSource, reqData.AttributeName)
+	return
+}
+
+//删除属性 删除ck列以及元数据
+func (this *MetaDataService) DropAttr(reqData request.DropAttrReq) (err error) {
+	if _, err = this.checkAttrAction(reqData.AttributeSource, reqData.AttributeName, reqData.Confirm); err != nil {
+		return
+	}
+	tableName, err := this.tableName(reqData.AttributeSource)
+	if err != nil {
+		return
+	}
+	task, err := this.getRetypeTask(reqData.AttributeSource, reqData.AttributeName)
+	if err != nil {
+		return
+	}
+	if task != nil && task.Status == RetypeRunning {
+		return errors.New("该属性正在转换类型，请稍后再试")
+	}
+
+	dbName := model.GlobConfig.Comm.ClickHouse.DbName
+	sql := fmt.Sprintf("ALTER TABLE %s.%s %s DROP COLUMN IF EXISTS `%s`", dbName, tableName, sinker.GetClusterSql(), reqData.AttributeName)
+	logs.Logger.Info(fmt.Sprintf("executing sql=> %s", sql), zap.String("table", tableName))
+	if _, err = db.ClickHouseSqlx.Exec(sql); err != nil {
+		return
+	}
+
+	if _, err = db.Sqlx.Exec("delete from attribute where app_id = ? and attribute_source = ? and attribute_name = ?;", this.Appid, reqData.AttributeSource, reqData.AttributeName); err != nil {
+		return
+	}
+	if reqData.AttributeSource == 2 {
+		if _, err = db.Sqlx.Exec("delete from meta_attr_relation where app_id = ? and event_attr = ?;", this.Appid, reqData.AttributeName); err != nil {
+			return
+		}
+		if _, err = db.Sqlx.Exec("delete from meta_attr_daily where appid = ? and attribute_name = ?;", this.Appid, reqData.AttributeName); err != nil {
+			return
+		}
+		if _, err = db.Sqlx.Exec("delete from meta_attr_stat where appid = ? and attribute_name = ?;", this.Appid, reqData.AttributeName); err != nil {
+			return
+		}
+	}
+
+	return sinker.InvalidateCache(dbName, tableName)
+}
@@ -2,13 +2,16 @@ package meta_data
 
 import (
 	"bytes"
-	"fmt"
 	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
 	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
-	"github.com/garyburd/redigo/redis"
+	jsoniter "github.com/json-iterator/go"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,74 +20,36 @@ type MetaDataService struct {
 	Appid string `json:"appid"`
 }
 
-type YesterdayCountRes struct {
-	XwlPartEvent string `db:"xwl_part_event"`
-	Count        int    `db:"count"`
+func (this *MetaDataService) GetEventNameShowMap() (mapStr string, err error) {
+	return this.GetEventNameShowMapWith(nil)
 }
 
-func (this *MetaDataService) UpdateYesterdayCount() (err error) {
-	Hash := "EventYesterdayCountCache"
-	redisConn := db.RedisPool.Get()
-	defer redisConn.Close()
-
-	lastUpdateDay, redisErr := redis.Int64(redisConn.Do("hget", Hash, this.Appid))
-
-	if util.FilterRedisNilErr(redisErr) {
-		return redisErr
-	}
-	timeNow := time.Now().Unix()
-
-	if util.IsSameDay(lastUpdateDay, timeNow) {
-		return nil
-	}
-
-	var datas []YesterdayCountRes
-
-	err = db.ClickHouseSqlx.Select(&datas, "SELECT xwl_part_event,count() as count from xwl_event"+this.Appid+" xe where toDateTime(formatDateTime(xwl_part_date,'%Y-%m-%d')) = yesterday() group by xwl_part_event ")
-
-	if err != nil {
-		return err
-	}
+//override中的事件显示名优先 不在元事件中的事件名追加到末尾
+func (this *MetaDataService) GetEventNameShowMapWith(override map[string]string) (mapStr string, err error) {
+	var eventNameList []response.MetaEventListRes
 
-	_, err = db.Sqlx.Exec("update meta_event set yesterday_count = 0  where  appid= ?;", this.Appid)
-	if err != nil {
-		return err
+	if err := db.Sqlx.Select(&eventNameList, "select event_name,show_name from meta_event where appid = ?", this.Appid); err != nil {
+		return "", err
 	}
 
-	if len(datas) > 0 {
-		sqlStr := this.createSql(datas)
-
-		_, err = db.Sqlx.Exec(sqlStr, this.Appid)
-		if err != nil {
-			return err
+	exists := map[string]bool{}
+	for index := range eventNameList {
+		exists[eventNameList[index].EventName] = true
+		if showName, ok := override[eventNameList[index].EventName]; ok {
+			eventNameList[index].ShowName = showName
 		}
 	}
-
-	_, err = redisConn.Do("hset", Hash, this.Appid, timeNow)
-	if err != nil {
-		return err
+	extraEventNames := []string{}
+	for eventName := range override {
+		if !exists[eventName] {
+			extraEventNames = append(extraEventNames, eventName)
+		}
 	}
-	return nil
-}
-
-func (this *MetaDataService) createSql(datas []YesterdayCountRes) string {
-	sqlStart := `UPDATE meta_event SET yesterday_count = CASE event_name `
-	sqlCaseWhen := ""
-	eventNameArr := []string{}
-	for _, data := range datas {
-		eventNameArr = append(eventNameArr, fmt.Sprintf("'%v'", data.XwlPartEvent))
-		sqlCaseWhen = sqlCaseWhen + fmt.Sprintf("  WHEN '%v' THEN %v  ", data.XwlPartEvent, data.Count)
+	sort.Strings(extraEventNames)
+	for _, eventName := range extraEventNames {
+		eventNameList = append(eventNameList, response.MetaEventListRes{EventName: eventName, ShowName: override[eventName]})
 	}
-	sqlEnd := " END WHERE event_name IN (" + strings.Join(eventNameArr, ",") + ") and appid= ? "
-	return sqlStart + sqlCaseWhen + sqlEnd
-}
-
-func (this *MetaDataService) GetEventNameShowMap() (mapStr string, err error) {
-	var eventNameList []response.MetaEventListRes
 
-	if err := db.Sqlx.Select(&eventNameList, "select event_name,show_name from meta_event where appid = ?", this.Appid); err != nil {
-		return "", err
-	}
 	buff := bytes.Buffer{}
 	buff.WriteString("map(")
 	for index, eventNameObj := range eventNameList {
@@ -109,9 +74,14 @@ func (this *MetaDataService) GetEventNameShowMap() (mapStr string, err error) {
 }
 
 func (this *MetaDataService) MetaEventList() (res []response.MetaEventListRes, err error) {
-	if err := db.Sqlx.Select(&res, "select event_name,show_name,yesterday_count from meta_event where appid = ?", this.Appid); err != nil {
+	if err := db.Sqlx.Select(&res, `select m.event_name,m.show_name,m.yesterday_count,ifnull(s.first_seen,'') as first_seen,ifnull(s.last_seen,'') as last_seen
+		from meta_event m left join meta_event_stat s on s.appid = m.appid and s.event_name = m.event_name where m.appid = ?`, this.Appid); err != nil {
 		return res, err
 	}
+	now := time.Now()
+	for k := range res {
+		res[k].IsNew, res[k].IsStopped = activeFlags(res[k].FirstSeen, res[k].LastSeen, now)
+	}
 	return res, err
 }
 
@@ -251,12 +221,14 @@ func (this *MetaDataService) GetCalcuSymbolData(reqData request.GetCalcuSymbolDa
 }
 
 type EventNameAndTheAttr struct {
-	EventNameDesc string `json:"event_name_desc" db:"event_name_desc"`
-	EventName     string `json:"event_name" db:"event_name"`
-	AttributeName string `json:"attribute_name" db:"attribute_name"`
-	AttributeDesc string `json:"attribute_desc" db:"attribute_desc"`
-	DataType      string `json:"data_type" db:"data_type"`
-	AttributeType string `json:"attribute_type" db:"attribute_type"`
+	EventNameDesc  string `json:"event_name_desc" db:"event_name_desc"`
+	EventName      string `json:"event_name" db:"event_name"`
+	AttributeName  string `json:"attribute_name" db:"attribute_name"`
+	AttributeDesc  string `json:"attribute_desc" db:"attribute_desc"`
+	DataType       string `json:"data_type" db:"data_type"`
+	AttributeType  string `json:"attribute_type" db:"attribute_type"`
+	IsVirtual      bool   `json:"is_virtual" db:"-"`       //是否为虚拟属性
+	IsVirtualEvent bool   `json:"is_virtual_event" db:"-"` //是否为虚拟事件
 }
 
 func (this *MetaDataService) GetAnalyseSelectOptions(appid int) (eventNameAndTheAttrList []EventNameAndTheAttr, err error) {
@@ -280,5 +252,96 @@ FROM
 	if err != nil {
 		return
 	}
+
+	//虚拟事件的属性为各组成事件属性的并集
+	virtualEventList, err := this.VirtualEventList(appid)
+	if err != nil {
+		return
+	}
+	var eventList []response.MetaEventListRes
+	if err = db.Sqlx.Select(&eventList, "select event_name,show_name from meta_event where appid = ?", appid); err != nil {
+		return
+	}
+	for _, v := range virtualEventList {
+		eventList = append(eventList, response.MetaEventListRes{EventName: v.EventName, ShowName: v.ShowName, IsVirtual: true})
+		attrs := map[string]bool{}
+		for _, item := range v.Items {
+			for _, row := range eventNameAndTheAttrList {
+				if row.EventName != item.EventName || row.IsVirtualEvent || attrs[row.AttributeName] {
+					continue
+				}
+				attrs[row.AttributeName] = true
+				row.EventName = v.EventName
+				row.EventNameDesc = v.ShowName
+				row.IsVirtualEvent = true
+				eventNameAndTheAttrList = append(eventNameAndTheAttrList, row)
+			}
+		}
+	}
+
+	//配置了字典的属性可按显示名筛选与分组
+	attrDicts, err := utils.GetAttrDicts(appid)
+	if err != nil {
+		return
+	}
+	for _, row := range eventNameAndTheAttrList {
+		if !attrDicts.Has(row.AttributeName) {
+			continue
+		}
+		if row.AttributeDesc == "" {
+			row.AttributeDesc = row.AttributeName
+		}
+		row.AttributeName = row.AttributeName + utils.AttrLabelSuffix
+		row.AttributeDesc = row.AttributeDesc + "(显示名)"
+		row.DataType = strconv.Itoa(parser.String)
+		row.IsVirtual = true
+		eventNameAndTheAttrList = append(eventNameAndTheAttrList, row)
+	}
+
+	//虚拟属性基于事件表计算 对所有事件可用
+	virtualAttr := model.VirtualAttr{}
+	virtualAttrList, err := virtualAttr.List(appid)
+	if err != nil {
+		return
+	}
+	for _, event := range eventList {
+		for _, v := range virtualAttrList {
+			eventNameAndTheAttrList = append(eventNameAndTheAttrList, EventNameAndTheAttr{
+				EventNameDesc:  event.ShowName,
+				EventName:      event.EventName,
+				AttributeName:  v.AttributeName,
+				AttributeDesc:  v.ShowName,
+				DataType:       strconv.Itoa(v.DataType),
+				AttributeType:  "2",
+				IsVirtual:      true,
+				IsVirtualEvent: event.IsVirtual,
+			})
+		}
+	}
+	return
+}
+
+type VirtualEventRes struct {
+	EventName string
+	ShowName  string
+	Items     []request.VirtualEventItem
+}
+
+//应用的虚拟事件及其组成部分
+func (this *MetaDataService) VirtualEventList(appid int) (res []VirtualEventRes, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	virtualEvent := model.VirtualEvent{}
+	list, err := virtualEvent.List(appid)
+	if err != nil {
+		return
+	}
+	for _, v := range list {
+		var items []request.VirtualEventItem
+		if err = json.Unmarshal([]byte(v.Definition), &items); err != nil {
+			return nil, err
+		}
+		res = append(res, VirtualEventRes{EventName: v.EventName, ShowName: v.ShowName, Items: items})
+	}
 	return
 }
@@ -0,0 +1,380 @@
+package meta_data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/response"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"go.uber.org/zap"
+)
+
+const (
+	volumeDays      = 30             //保留的每日上报量天数
+	activeWindow    = 24 * time.Hour //判断新事件与停止上报的时间窗口
+	attrChunkSize   = 50             //每次查询统计的属性列数
+	upsertChunkSize = 500
+)
+
+//不参与属性统计的列
+var volumeExcludedColumns = map[string]struct{}{
+	"xwl_part_date":       {},
+	"xwl_part_event":      {},
+	"xwl_kafka_offset":    {},
+	"xwl_kafka_partition": {},
+}
+
+//统计所有应用的上报量 单个应用失败不影响其他应用 ctx取消后不再统计剩余的应用
+func UpdateAllVolumeStat(ctx context.Context) (err error) {
+	var appids []int
+	if err = db.Sqlx.Select(&appids, "select id from app where is_close = 0"); err != nil {
+		return
+	}
+	var failNum int
+	for _, appid := range appids {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		metaData := MetaDataService{Appid: strconv.Itoa(appid)}
+		if err := metaData.UpdateVolumeStat(); err != nil {
+			failNum++
+			logs.Logger.Error("统计上报量失败", zap.Int("appid", appid), zap.Error(err))
+		}
+	}
+	if failNum > 0 {
+		return fmt.Errorf("%d个应用统计上报量失败", failNum)
+	}
+	return nil
+}
+
+func volumeWindow(now time.Time) (today, windowStart time.Time) {
+	today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	windowStart = today.AddDate(0, 0, -(volumeDays - 1))
+	return
+}
+
+//统计近30天每日上报量以及首次、最近上报时间
+func (this *MetaDataService) UpdateVolumeStat() (err error) {
+	today, windowStart := volumeWindow(time.Now())
+	if err = this.updateEventVolume(today, windowStart); err != nil {
+		return
+	}
+	return this.updateAttrVolume(today, windowStart)
+}
+
+//已有统计时只需扫描最近两天的数据更新首次、最近上报时间 否则扫描全表
+func seenSince(table, appid string, today time.Time) (since int64, err error) {
+	var count int
+	if err = db.Sqlx.Get(&count, "select count(*) from "+table+" where appid = ?", appid); err != nil {
+		return
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return today.AddDate(0, 0, -1).Unix(), nil
+}
+
+func upsert(table string, columns []string, rows [][]interface{}, suffix string) (err error) {
+	for start := 0; start < len(rows); start += upsertChunkSize {
+		end := start + upsertChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		builder := db.SqlBuilder.Insert(table).Columns(columns...)
+		for _, row := range rows[start:end] {
+			builder = builder.Values(row...)
+		}
+		sqlStr, args, err := builder.Suffix(suffix).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = db.Sqlx.Exec(sqlStr, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *MetaDataService) updateEventVolume(today, windowStart time.Time) (err error) {
+	tableName := "xwl_event" + this.Appid
+
+	var daily []struct {
+		EventName string    `db:"event_name"`
+		Day       time.Time `db:"day"`
+		Count     uint64    `db:"count"`
+	}
+	if err = db.ClickHouseSqlx.Select(&daily, "select xwl_part_event as event_name,toDate(xwl_part_date) as day,count() as count from "+tableName+" where xwl_part_date >= toDateTime(?) group by xwl_part_event,day", windowStart.Unix()); err != nil {
+		return
+	}
+	rows := make([][]interface{}, 0, len(daily))
+	for _, v := range daily {
+		rows = append(rows, []interface{}{this.Appid, v.EventName, v.Day.Format(util.TimeFormatDay2), v.Count})
+	}
+	if err = upsert("meta_event_daily", []string{"appid", "event_name", "day", "count"}, rows, "on duplicate key update count = values(count)"); err != nil {
+		return
+	}
+
+	since, err := seenSince("meta_event_stat", this.Appid, today)
+	if err != nil {
+		return
+	}
+	var seen []struct {
+		EventName string    `db:"event_name"`
+		FirstSeen time.Time `db:"first_seen"`
+		LastSeen  time.Time `db:"last_seen"`
+	}
+	if err = db.ClickHouseSqlx.Select(&seen, "select xwl_part_event as event_name,min(xwl_part_date) as first_seen,max(xwl_part_date) as last_seen from "+tableName+" where xwl_part_date >= toDateTime(?) group by xwl_part_event", since); err != nil {
+		return
+	}
+	rows = rows[:0]
+	for _, v := range seen {
+		rows = append(rows, []interface{}{this.Appid, v.EventName, v.FirstSeen.Local().Format(util.TimeFormat), v.LastSeen.Local().Format(util.TimeFormat)})
+	}
+	if err = upsert("meta_event_stat", []string{"appid", "event_name", "first_seen", "last_seen"}, rows,
+		"on duplicate key update first_seen = least(first_seen,values(first_seen)),last_seen = greatest(last_seen,values(last_seen))"); err != nil {
+		return
+	}
+
+	if _, err = db.Sqlx.Exec("delete from meta_event_daily where appid = ? and day < ?", this.Appid, windowStart.Format(util.TimeFormatDay2)); err != nil {
+		return
+	}
+
+	//昨日上报量直接取自每日统计
+	_, err = db.Sqlx.Exec(`update meta_event m left join meta_event_daily d on d.appid = m.appid and d.event_name = m.event_name and d.day = ?
+		set m.yesterday_count = ifnull(d.count,0) where m.appid = ?`, today.AddDate(0, 0, -1).Format(util.TimeFormatDay2), this.Appid)
+	return
+}
+
+//属性有值的判断条件 数值类型缺省值为0 以非0计
+func notEmptyExpr(name, typ string) string {
+	col := "`" + name + "`"
+	if strings.HasPrefix(typ, "LowCardinality(") {
+		typ = strings.TrimSuffix(strings.TrimPrefix(typ, "LowCardinality("), ")")
+	}
+	switch {
+	case strings.HasPrefix(typ, "Nullable("):
+		return "isNotNull(" + col + ")"
+	case strings.HasPrefix(typ, "Array("):
+		return "notEmpty(" + col + ")"
+	case typ == "String":
+		return col + " != ''"
+	case strings.HasPrefix(typ, "DateTime"):
+		return "toUnixTimestamp(" + col + ") != 0"
+	}
+	return col + " != 0"
+}
+
+type volumeColumn struct {
+	Name   string `db:"name"`
+	Type   string `db:"type"`
+	events []string
+}
+
+func (this *MetaDataService) updateAttrVolume(today, windowStart time.Time) (err error) {
+	tableName := "xwl_event" + this.Appid
+
+	var allColumns []volumeColumn
+	if err = db.ClickHouseSqlx.Select(&allColumns, "select name,type from system.columns where database = ? and table = ? and default_kind not in ('MATERIALIZED','ALIAS')", model.GlobConfig.Comm.ClickHouse.DbName, tableName); err != nil {
+		return
+	}
+
+	var relations []struct {
+		EventName string `db:"event_name"`
+		EventAttr string `db:"event_attr"`
+	}
+	if err = db.Sqlx.Select(&relations, "select event_name,event_attr from meta_attr_relation where app_id = ?", this.Appid); err != nil {
+		return
+	}
+	attrEvents := map[string][]string{}
+	for _, v := range relations {
+		attrEvents[v.EventAttr] = append(attrEvents[v.EventAttr], v.EventName)
+	}
+
+	columns := make([]volumeColumn, 0, len(allColumns))
+	for _, v := range allColumns {
+		if _, ok := volumeExcludedColumns[v.Name]; ok {
+			continue
+		}
+		v.events = attrEvents[v.Name]
+		columns = append(columns, v)
+	}
+
+	since, err := seenSince("meta_attr_stat", this.Appid, today)
+	if err != nil {
+		return
+	}
+
+	for start := 0; start < len(columns); start += attrChunkSize {
+		end := start + attrChunkSize
+		if end > len(columns) {
+			end = len(columns)
+		}
+		if err = this.updateAttrVolumeChunk(tableName, columns[start:end], windowStart, since); err != nil {
+			return
+		}
+	}
+
+	_, err = db.Sqlx.Exec("delete from meta_attr_daily where appid = ? and day < ?", this.Appid, windowStart.Format(util.TimeFormatDay2))
+	return
+}
+
+func (this *MetaDataService) updateAttrVolumeChunk(tableName string, columns []volumeColumn, windowStart time.Time, since int64) (err error) {
+	//属性只统计携带该属性的事件 未记录关联事件时统计全部事件
+	selects := make([]string, 0, len(columns)*2)
+	args := []interface{}{}
+	for i, v := range columns {
+		selects = append(selects, fmt.Sprintf("countIf(%s) as c%d", notEmptyExpr(v.Name, v.Type), i))
+		if len(v.events) > 0 {
+			selects = append(selects, fmt.Sprintf("countIf(xwl_part_event in (?)) as t%d", i))
+			args = append(args, v.events)
+		} else {
+			selects = append(selects, fmt.Sprintf("count() as t%d", i))
+		}
+	}
+	args = append(args, windowStart.Unix())
+
+	rs, err := db.ClickHouseSqlx.Query("select toDate(xwl_part_date) as day,"+strings.Join(selects, ",")+" from "+tableName+" where xwl_part_date >= toDateTime(?) group by day", args...)
+	if err != nil {
+		return
+	}
+	defer rs.Close()
+
+	rows := [][]interface{}{}
+	for rs.Next() {
+		var day time.Time
+		counts := make([]uint64, len(columns)*2)
+		dest := make([]interface{}, 0, len(counts)+1)
+		dest = append(dest, &day)
+		for i := range counts {
+			dest = append(dest, &counts[i])
+		}
+		if err = rs.Scan(dest...); err != nil {
+			return
+		}
+		for i, v := range columns {
+			if counts[i*2] == 0 && counts[i*2+1] == 0 {
+				continue
+			}
+			rows = append(rows, []interface{}{this.Appid, v.Name, day.Format(util.TimeFormatDay2), counts[i*2], counts[i*2+1]})
+		}
+	}
+	if err = rs.Err(); err != nil {
+		return
+	}
+	if err = upsert("meta_attr_daily", []string{"appid", "attribute_name", "day", "count", "total"}, rows,
+		"on duplicate key update count = values(count),total = values(total)"); err != nil {
+		return
+	}
+
+	selects = selects[:0]
+	for i, v := range columns {
+		expr := notEmptyExpr(v.Name, v.Type)
+		selects = append(selects, fmt.Sprintf("minIf(xwl_part_date,%s) as f%d,maxIf(xwl_part_date,%s) as l%d", expr, i, expr, i))
+	}
+	seen := make([]time.Time, len(columns)*2)
+	dest := make([]interface{}, 0, len(seen))
+	for i := range seen {
+		dest = append(dest, &seen[i])
+	}
+	if err = db.ClickHouseSqlx.QueryRow("select "+strings.Join(selects, ",")+" from "+tableName+" where xwl_part_date >= toDateTime(?)", since).Scan(dest...); err != nil {
+		return
+	}
+	rows = rows[:0]
+	for i, v := range columns {
+		//没有匹配的数据时返回的是零值时间
+		if seen[i*2].Unix() <= 0 {
+			continue
+		}
+		rows = append(rows, []interface{}{this.Appid, v.Name, seen[i*2].Local().Format(util.TimeFormat), seen[i*2+1].Local().Format(util.TimeFormat)})
+	}
+	return upsert("meta_attr_stat", []string{"appid", "attribute_name", "first_seen", "last_seen"}, rows,
+		"on duplicate key update first_seen = least(first_seen,values(first_seen)),last_seen = greatest(last_seen,values(last_seen))")
+}
+
+//根据首次、最近上报时间判断是否为新事件以及是否已停止上报
+func activeFlags(firstSeen, lastSeen string, now time.Time) (isNew, isStopped bool) {
+	if first, err := time.ParseInLocation(util.TimeFormat, firstSeen, time.Local); err == nil {
+		isNew = now.Sub(first) <= activeWindow
+	}
+	if last, err := time.ParseInLocation(util.TimeFormat, lastSeen, time.Local); err == nil {
+		isStopped = now.Sub(last) > activeWindow
+	}
+	return
+}
+
+//补齐没有上报的日期
+func fillDays(list []response.DailyVolume, now time.Time) []response.DailyVolume {
+	today, windowStart := volumeWindow(now)
+	dayMap := make(map[string]response.DailyVolume, len(list))
+	for _, v := range list {
+		dayMap[v.Day] = v
+	}
+	res := make([]response.DailyVolume, 0, volumeDays)
+	for day := windowStart; !day.After(today); day = day.AddDate(0, 0, 1) {
+		dayStr := day.Format(util.TimeFormatDay2)
+		v, ok := dayMap[dayStr]
+		if !ok {
+			v = response.DailyVolume{Day: dayStr}
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+func rate(count, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(count)/float64(total)*10000) / 10000
+}
+
+//事件近30天每日上报量
+func (this *MetaDataService) EventVolume(eventName string) (res response.EventVolumeRes, err error) {
+	now := time.Now()
+	res.EventName = eventName
+
+	err = db.Sqlx.QueryRow("select first_seen,last_seen from meta_event_stat where appid = ? and event_name = ?", this.Appid, eventName).Scan(&res.FirstSeen, &res.LastSeen)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	res.IsNew, res.IsStopped = activeFlags(res.FirstSeen, res.LastSeen, now)
+
+	var list []response.DailyVolume
+	if err = db.Sqlx.Select(&list, "select date_format(day,'%Y-%m-%d') as day,count from meta_event_daily where appid = ? and event_name = ?", this.Appid, eventName); err != nil {
+		return
+	}
+	res.Days = fillDays(list, now)
+	return res, nil
+}
+
+//事件属性近30天每日上报量以及有值比例
+func (this *MetaDataService) AttrVolume(attributeName string) (res response.AttrVolumeRes, err error) {
+	res.AttributeName = attributeName
+
+	err = db.Sqlx.QueryRow("select first_seen,last_seen from meta_attr_stat where appid = ? and attribute_name = ?", this.Appid, attributeName).Scan(&res.FirstSeen, &res.LastSeen)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+
+	var list []response.DailyVolume
+	if err = db.Sqlx.Select(&list, "select date_format(day,'%Y-%m-%d') as day,count,total from meta_attr_daily where appid = ? and attribute_name = ?", this.Appid, attributeName); err != nil {
+		return
+	}
+	var count, total int64
+	for k, v := range list {
+		list[k].NonNullRate = rate(v.Count, v.Total)
+		count += v.Count
+		total += v.Total
+	}
+	res.NonNullRate = rate(count, total)
+	res.Days = fillDays(list, time.Now())
+	return res, nil
+}
@@ -0,0 +1,83 @@
+package pii
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"go.uber.org/zap"
+)
+
+//规则刷新间隔 管理后台修改规则后最迟在该间隔后生效
+const refreshInterval = 30 * time.Second
+
+var (
+	maskers    atomic.Value //map[int]*Masker 按appid分组
+	loadTime   int64
+	loading    int32
+	initLocker sync.Mutex
+)
+
+//按应用规则对上报数据脱敏 sinker与上报服务的调试链路共用
+//首次调用时同步加载规则 之后过期时在后台刷新 刷新期间使用旧规则
+func Apply(appid int, data []byte) []byte {
+	m, ok := maskers.Load().(map[int]*Masker)
+	if !ok {
+		initLocker.Lock()
+		if m, ok = maskers.Load().(map[int]*Masker); !ok {
+			if err := Refresh(); err != nil {
+				logs.Logger.Error("加载脱敏规则失败", zap.Error(err))
+			}
+			m, _ = maskers.Load().(map[int]*Masker)
+		}
+		initLocker.Unlock()
+	} else if time.Now().Unix()-atomic.LoadInt64(&loadTime) >= int64(refreshInterval/time.Second) &&
+		atomic.CompareAndSwapInt32(&loading, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&loading, 0)
+			if err := Refresh(); err != nil {
+				logs.Logger.Error("刷新脱敏规则失败", zap.Error(err))
+			}
+		}()
+	}
+	return m[appid].Apply(data)
+}
+
+//重新加载所有应用的脱敏规则 有误的规则会被跳过
+func Refresh() (err error) {
+	//失败时也更新时间 避免数据库异常时每条数据都触发刷新
+	defer atomic.StoreInt64(&loadTime, time.Now().Unix())
+
+	piiRule := model.PiiRule{}
+	list, err := piiRule.EnableList()
+	if err != nil {
+		return
+	}
+	piiSalt := model.PiiSalt{}
+	saltList, err := piiSalt.List()
+	if err != nil {
+		return
+	}
+
+	salts := map[int]string{}
+	for _, v := range saltList {
+		salts[v.Appid] = v.Salt
+	}
+	rules := map[int][]model.PiiRule{}
+	for _, v := range list {
+		if err := CheckRule(v); err != nil {
+			logs.Logger.Error("脱敏规则有误", zap.Int("id", v.Id), zap.String("name", v.Name), zap.Error(err))
+			continue
+		}
+		rules[v.Appid] = append(rules[v.Appid], v)
+	}
+
+	m := map[int]*Masker{}
+	for appid, appRules := range rules {
+		m[appid], _ = NewMasker(salts[appid], appRules)
+	}
+	maskers.Store(m)
+	return nil
+}
@@ -0,0 +1,194 @@
+package pii
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	MatchByName  = "name"
+	MatchByRegex = "regex"
+
+	ActionDrop       = "drop"
+	ActionHash       = "hash"
+	ActionTruncateIp = "truncate_ip"
+	ActionMask       = "mask"
+)
+
+//入库链路依赖的系统属性 不允许被脱敏
+var protectedAttrs = []string{
+	"xwl_distinct_id",
+	"xwl_client_time",
+	"xwl_update_time",
+	"xwl_part_event",
+	"xwl_part_date",
+	"xwl_server_time",
+	"xwl_kafka_offset",
+	"xwl_kafka_partition",
+}
+
+type rule struct {
+	model.PiiRule
+	re *regexp.Regexp
+}
+
+//单个应用的脱敏规则
+type Masker struct {
+	salt  string
+	rules []rule
+}
+
+func NewMasker(salt string, piiRules []model.PiiRule) (masker *Masker, err error) {
+	masker = &Masker{salt: salt}
+	for _, piiRule := range piiRules {
+		r := rule{PiiRule: piiRule}
+		if err = CheckRule(piiRule); err != nil {
+			return nil, err
+		}
+		if piiRule.MatchType == MatchByRegex {
+			r.re = regexp.MustCompile(piiRule.Pattern)
+		}
+		masker.rules = append(masker.rules, r)
+	}
+	return
+}
+
+func CheckRule(piiRule model.PiiRule) (err error) {
+	if strings.TrimSpace(piiRule.Pattern) == "" {
+		return errors.New("匹配的属性名不能为空")
+	}
+	switch piiRule.MatchType {
+	case MatchByName:
+		if util.InstrArr(protectedAttrs, piiRule.Pattern) {
+			return errors.New("系统属性" + piiRule.Pattern + "不允许脱敏")
+		}
+	case MatchByRegex:
+		if _, err = regexp.Compile(piiRule.Pattern); err != nil {
+			return errors.New("正则表达式错误:" + err.Error())
+		}
+	default:
+		return errors.New("错误的匹配方式:" + piiRule.MatchType)
+	}
+	switch piiRule.Action {
+	case ActionDrop, ActionHash, ActionTruncateIp:
+	case ActionMask:
+		if piiRule.KeepPrefix < 0 || piiRule.KeepSuffix < 0 {
+			return errors.New("保留长度不能小于0")
+		}
+	default:
+		return errors.New("错误的脱敏方式:" + piiRule.Action)
+	}
+	return nil
+}
+
+func (this *Masker) match(key string) (r *rule, ok bool) {
+	if util.InstrArr(protectedAttrs, key) {
+		return nil, false
+	}
+	for i := range this.rules {
+		switch this.rules[i].MatchType {
+		case MatchByName:
+			ok = this.rules[i].Pattern == key
+		case MatchByRegex:
+			ok = this.rules[i].re.MatchString(key)
+		}
+		if ok {
+			return &this.rules[i], true
+		}
+	}
+	return nil, false
+}
+
+//对上报数据的顶层属性脱敏 未命中规则时原样返回
+func (this *Masker) Apply(data []byte) []byte {
+	if this == nil || len(this.rules) == 0 {
+		return data
+	}
+
+	type change struct {
+		key string
+		r   *rule
+		val gjson.Result
+	}
+	var changes []change
+	gjson.ParseBytes(data).ForEach(func(key, value gjson.Result) bool {
+		if r, ok := this.match(key.String()); ok {
+			changes = append(changes, change{key: key.String(), r: r, val: value})
+		}
+		return true
+	})
+
+	var err error
+	for _, c := range changes {
+		//属性名可能包含sjson的特殊字符
+		path := escapePath(c.key)
+		switch {
+		case c.r.Action == ActionDrop:
+			data, err = sjson.DeleteBytes(data, path)
+		case c.val.Type == gjson.Null:
+			continue
+		default:
+			data, err = sjson.SetBytes(data, path, this.maskValue(c.r, c.val.String()))
+		}
+		if err != nil {
+			//脱敏失败时宁可删除也不能保留原始值
+			data, _ = sjson.DeleteBytes(data, path)
+		}
+	}
+	return data
+}
+
+func (this *Masker) maskValue(r *rule, val string) string {
+	switch r.Action {
+	case ActionHash:
+		sum := sha256.Sum256([]byte(this.salt + val))
+		return hex.EncodeToString(sum[:])
+	case ActionTruncateIp:
+		return truncateIp(val)
+	case ActionMask:
+		return maskMiddle(val, r.KeepPrefix, r.KeepSuffix)
+	}
+	return ""
+}
+
+//ipv4保留/24 ipv6保留/48 无法解析的值置空
+func truncateIp(val string) string {
+	ip := net.ParseIP(strings.TrimSpace(val))
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+//保留前后若干字符 中间用*代替 长度不足时全部遮盖
+func maskMiddle(val string, keepPrefix, keepSuffix int) string {
+	runes := []rune(val)
+	if keepPrefix+keepSuffix >= len(runes) {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:keepPrefix]) + strings.Repeat("*", len(runes)-keepPrefix-keepSuffix) + string(runes[len(runes)-keepSuffix:])
+}
+
+func escapePath(key string) string {
+	var b strings.Builder
+	for _, c := range key {
+		switch c {
+		case '.', '*', '?', '|', '#', '@', '\\', ':', '!', '=', '<', '>', '%':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
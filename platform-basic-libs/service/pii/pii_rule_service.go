@@ -0,0 +1,95 @@
+package pii
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	jsoniter "github.com/json-iterator/go"
+)
+
+type PiiRuleService struct {
+	ManagerID int32
+	Appid     int
+}
+
+func (this *PiiRuleService) toModel(reqData request.PiiRule) (piiRule model.PiiRule, err error) {
+	if strings.TrimSpace(reqData.Name) == "" {
+		return piiRule, errors.New("规则名不能为空")
+	}
+	piiRule = model.PiiRule{
+		Id:         reqData.Id,
+		Name:       reqData.Name,
+		MatchType:  reqData.MatchType,
+		Pattern:    strings.TrimSpace(reqData.Pattern),
+		Action:     reqData.Action,
+		KeepPrefix: reqData.KeepPrefix,
+		KeepSuffix: reqData.KeepSuffix,
+		Status:     reqData.Status,
+	}
+	err = CheckRule(piiRule)
+	return
+}
+
+func (this *PiiRuleService) Add(reqData request.PiiRule) (err error) {
+	piiRule, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	//保证哈希盐在规则生效前已生成
+	piiSalt := model.PiiSalt{}
+	if _, err = piiSalt.GetOrCreate(this.Appid); err != nil {
+		return
+	}
+	return piiRule.Insert(this.ManagerID, this.Appid)
+}
+
+func (this *PiiRuleService) Modify(reqData request.PiiRule) (err error) {
+	if reqData.Id == 0 {
+		return errors.New("规则ID不能为空")
+	}
+	piiRule, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	return piiRule.Modify(this.Appid)
+}
+
+func (this *PiiRuleService) Delete(id int) (err error) {
+	piiRule := model.PiiRule{Id: id}
+	return piiRule.Delete(this.Appid)
+}
+
+func (this *PiiRuleService) List() (list []model.PiiRule, err error) {
+	piiRule := model.PiiRule{}
+	return piiRule.List(this.Appid)
+}
+
+//用已启用的规则对示例数据脱敏 立即生效 不受规则缓存影响
+func (this *PiiRuleService) Preview(data string) (res string, err error) {
+	if !jsoniter.Valid([]byte(data)) {
+		return "", errors.New("示例数据不是合法的json")
+	}
+	piiRule := model.PiiRule{}
+	list, err := piiRule.List(this.Appid)
+	if err != nil {
+		return
+	}
+	enableList := []model.PiiRule{}
+	for _, v := range list {
+		if v.Status == model.PiiRuleEnable {
+			enableList = append(enableList, v)
+		}
+	}
+	piiSalt := model.PiiSalt{}
+	salt, err := piiSalt.GetOrCreate(this.Appid)
+	if err != nil {
+		return
+	}
+	masker, err := NewMasker(salt, enableList)
+	if err != nil {
+		return
+	}
+	return string(masker.Apply([]byte(data))), nil
+}
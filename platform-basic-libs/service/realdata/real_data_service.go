@@ -11,7 +11,7 @@ import (
 type RealDataService struct {
 }
 
-//错误数据列表
+//错误数据列表 包含已入库但不符合埋点方案的数据
 func (this RealDataService) FailDataList(minutes int, appid int) (failDataResList []response.FailDataRes, err error) {
 
 	err = db.ClickHouseSqlx.Select(&failDataResList, `
@@ -19,10 +19,10 @@ func (this RealDataService) FailDataList(minutes int, appid int) (failDataResLis
 			toStartOfInterval(a.part_date, INTERVAL `+strconv.Itoa(minutes)+`  minute) as interval_date,
 			formatDateTime(interval_date,'%Y-%m-%d') as year ,formatDateTime(interval_date,'%H:%M') as start_minute, formatDateTime(addMinutes(interval_date, ?),'%H:%M') as end_minute,
 			count(report_data) as count,a.error_reason,a.error_handling,report_type 
-			from (select * from xwl_acceptance_status prewhere table_id = ? and status = ? order by part_date desc limit 1000 ) a
+			from (select * from xwl_acceptance_status prewhere table_id = ? and status != ? order by part_date desc limit 1000 ) a
 			group by interval_date,a.error_reason,a.error_handling,report_type
 			order by interval_date desc;
-	`, minutes, appid, consumer_data.FailStatus)
+	`, minutes, appid, consumer_data.SuccessStatus)
 
 	return
 }
@@ -35,7 +35,7 @@ func (this RealDataService) FailDataDesc(appid, startTime, endTime, errorReason,
 			and part_date <= '`+endTime+`'
 			and error_reason = '`+errorReason+`'
 			and error_handling = '`+errorHandling+`'
-			and status = `+strconv.Itoa(consumer_data.FailStatus)+`
+			and status != `+strconv.Itoa(consumer_data.SuccessStatus)+`
 			and report_type = '`+reportType+`' LIMIT  1
 	`)
 	return
@@ -70,7 +70,8 @@ func (this RealDataService) ReportCount(appid string, startTime string, endTime
 	if err != nil {
 		return nil, err
 	}
-	err = db.ClickHouseSqlx.Select(&succCountArr, `select data_name,count() as count from xwl_acceptance_status xas prewhere  status = 1 and table_id = `+appid+` and  part_date >= '`+startTime+`'  and part_date <= '`+endTime+`' group by data_name`)
+	//不符合埋点方案但已入库的数据计为成功
+	err = db.ClickHouseSqlx.Select(&succCountArr, `select data_name,count() as count from xwl_acceptance_status xas prewhere  status != 0 and table_id = `+appid+` and  part_date >= '`+startTime+`'  and part_date <= '`+endTime+`' group by data_name`)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +121,7 @@ func (this RealDataService) EventFailDesc(appid, startTime, endTime, dataName st
 			and part_date >= '`+startTime+`'
 			and part_date <= '`+endTime+`'
 			and data_name = '`+dataName+`'
-			and status = `+strconv.Itoa(consumer_data.FailStatus)+`
+			and status != `+strconv.Itoa(consumer_data.SuccessStatus)+`
 			group by  error_reason`)
 	if err != nil {
 		return nil, err
@@ -6,9 +6,7 @@ import (
 	model2 "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/model"
 	"sync"
 
-	"github.com/Shopify/sarama"
 	jsoniter "github.com/json-iterator/go"
-	"time"
 )
 
 type ReportInterface interface {
@@ -52,13 +50,9 @@ func (this *UserReport) GetkafkaData() model.KafkaData {
 func (this *UserReport) InflowOfKakfa() (err error) {
 
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	msg := &sarama.ProducerMessage{}
-	msg.Topic = model.GlobConfig.Comm.Kafka.ReportTopicName
 	sendData, _ := json.Marshal(this.kafkaData)
-	msg.Value = sarama.ByteEncoder(sendData)
-	msg.Timestamp = time.Now()
 
-	return sendMsg(msg)
+	return sendMsg(model.GlobConfig.Comm.Kafka.ReportTopicName, sendData)
 }
 
 func (this *UserReport) Put() {
@@ -82,13 +76,9 @@ func (this *EventReport) NewReportType(appid, tableId, debug, timeNow, eventName
 
 func (this *EventReport) InflowOfKakfa() (err error) {
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
-	msg := &sarama.ProducerMessage{}
-	msg.Topic = model.GlobConfig.Comm.Kafka.ReportTopicName
 	sendData, _ := json.Marshal(this.kafkaData)
-	msg.Value = sarama.ByteEncoder(sendData)
-	msg.Timestamp = time.Now()
 
-	return sendMsg(msg)
+	return sendMsg(model.GlobConfig.Comm.Kafka.ReportTopicName, sendData)
 }
 
 func (this *EventReport) GetkafkaData() model.KafkaData {
@@ -9,11 +9,9 @@ import (
 	"github.com/1340691923/xwl_bi/platform-basic-libs/my_error"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/service/myapp"
 	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
-	"github.com/Shopify/sarama"
 	"github.com/garyburd/redigo/redis"
 	"go.uber.org/zap"
 	"sync"
-	"time"
 )
 
 type ReportService struct {
@@ -21,14 +19,12 @@ type ReportService struct {
 
 var tableIdMap sync.Map
 
-func RefreshTableIdMap(t time.Duration) {
-	for {
-		time.Sleep(t)
-		tableIdMap.Range(func(key, value interface{}) bool {
-			tableIdMap.Delete(key)
-			return true
-		})
-	}
+//清空appid与表id的本地缓存
+func ClearTableIdMap() {
+	tableIdMap.Range(func(key, value interface{}) bool {
+		tableIdMap.Delete(key)
+		return true
+	})
 }
 
 func (this *ReportService) GetTableid(appid, appkey string) (table string, err error) {
@@ -112,23 +108,14 @@ func (this *ReportService) CantInflowOfKakfa(debug, xwlDistinctId, tableId strin
 	return true
 }
 
-func sendMsg(msg *sarama.ProducerMessage) (err error) {
-	switch model.GlobConfig.GetKafkaCfgProducerType() {
-	case "async":
-		db.KafkaASyncProducer.Input() <- msg
-	case "sync":
-		_, _, err = db.KafkaSyncProducer.SendMessage(msg)
-	}
-	return
+//发送消息到kafka或redis stream 由comm.mq.type决定
+func sendMsg(topic string, value []byte) (err error) {
+	return db.MsgProducer.Send(topic, value)
 }
 
 func (this *ReportService) InflowOfDebugData(data map[string]interface{}, eventName string) (err error) {
-	msg := &sarama.ProducerMessage{}
-	msg.Topic = model.GlobConfig.Comm.Kafka.DebugDataTopicName
 	sendData, _ := json.Marshal(data)
-	msg.Value = sarama.ByteEncoder(sendData)
-	msg.Timestamp = time.Now()
 
-	return sendMsg(msg)
+	return sendMsg(model.GlobConfig.Comm.Kafka.DebugDataTopicName, sendData)
 
 }
@@ -0,0 +1,73 @@
+package tracking_plan
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	jsoniter "github.com/json-iterator/go"
+	"go.uber.org/zap"
+)
+
+//方案刷新间隔 管理后台修改方案后最迟在该间隔后生效
+const refreshInterval = 30 * time.Second
+
+var (
+	validators atomic.Value //map[int]*Validator 按appid分组
+	loadTime   int64
+	loading    int32
+	initLocker sync.Mutex
+)
+
+//获取应用的校验器 未开启校验时返回nil sinker与上报服务的调试链路共用
+//首次调用时同步加载 之后过期时在后台刷新 刷新期间使用旧方案
+func GetValidator(appid int) *Validator {
+	m, ok := validators.Load().(map[int]*Validator)
+	if !ok {
+		initLocker.Lock()
+		if m, ok = validators.Load().(map[int]*Validator); !ok {
+			if err := Refresh(); err != nil {
+				logs.Logger.Error("加载埋点方案失败", zap.Error(err))
+			}
+			m, _ = validators.Load().(map[int]*Validator)
+		}
+		initLocker.Unlock()
+	} else if time.Now().Unix()-atomic.LoadInt64(&loadTime) >= int64(refreshInterval/time.Second) &&
+		atomic.CompareAndSwapInt32(&loading, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&loading, 0)
+			if err := Refresh(); err != nil {
+				logs.Logger.Error("刷新埋点方案失败", zap.Error(err))
+			}
+		}()
+	}
+	return m[appid]
+}
+
+//重新加载开启了校验的应用的方案 有误的方案会被跳过
+func Refresh() (err error) {
+	//失败时也更新时间 避免数据库异常时每条数据都触发刷新
+	defer atomic.StoreInt64(&loadTime, time.Now().Unix())
+
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	trackingPlan := model.TrackingPlan{}
+	list, err := trackingPlan.EnforceList()
+	if err != nil {
+		return
+	}
+
+	m := map[int]*Validator{}
+	for _, v := range list {
+		var plan Plan
+		if err := json.Unmarshal([]byte(v.Content), &plan); err != nil {
+			logs.Logger.Error("埋点方案有误", zap.Int("appid", v.Appid), zap.Error(err))
+			continue
+		}
+		m[v.Appid] = NewValidator(v.EnforceMode, plan)
+	}
+	validators.Store(m)
+	return nil
+}
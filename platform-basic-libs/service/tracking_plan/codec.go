@@ -0,0 +1,224 @@
+package tracking_plan
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	FormatJson = "json"
+	FormatCsv  = "csv"
+)
+
+//csv每行一个属性 事件名为空的行是用户属性 属性名为空的行表示没有属性的事件
+//excel由前端与csv互相转换 列与csv一致
+var csvHeader = []string{"event_name", "event_show_name", "prop_name", "prop_show_name", "data_type", "required", "enum", "min", "max"}
+
+const enumSep = "|"
+
+var dataTypeNames = map[string]int{
+	"int":            parser.Int,
+	"float":          parser.Float,
+	"string":         parser.String,
+	"datetime":       parser.DateTime,
+	"int_array":      parser.IntArray,
+	"float_array":    parser.FloatArray,
+	"string_array":   parser.StringArray,
+	"datetime_array": parser.DateTimeArray,
+}
+
+func parseDataType(s string) (dataType int, ok bool) {
+	s = strings.TrimSpace(s)
+	if dataType, err := strconv.Atoi(s); err == nil {
+		_, ok = parser.TypeRemarkMap[dataType]
+		return dataType, ok && dataType != parser.TypeUnknown
+	}
+	if dataType, ok = dataTypeNames[strings.ToLower(s)]; ok {
+		return
+	}
+	for typ, remark := range parser.TypeRemarkMap {
+		if remark == s && typ != parser.TypeUnknown {
+			if typ == parser.ElasticDateTime {
+				typ = parser.DateTime
+			}
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "y", "是":
+		return true
+	}
+	return false
+}
+
+func parseNumber(s string) (f float64, ok bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f, err == nil
+}
+
+func parseLimit(s string, line int, name string) (f *float64, err error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	v, ok := parseNumber(s)
+	if !ok {
+		return nil, errors.New("第" + strconv.Itoa(line) + "行的" + name + "不是数字")
+	}
+	return &v, nil
+}
+
+func ParseCsv(r io.Reader) (plan Plan, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	eventIndex := map[string]int{}
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return plan, errors.New("csv格式有误:" + err.Error())
+		}
+		line++
+		for len(record) < len(csvHeader) {
+			record = append(record, "")
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if line == 1 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			if record[0] == csvHeader[0] {
+				continue
+			}
+		}
+		eventName, eventShowName, propName := record[0], record[1], record[2]
+		if eventName == "" && propName == "" {
+			continue
+		}
+
+		var props *[]Prop
+		if eventName == "" {
+			props = &plan.UserProps
+		} else {
+			index, ok := eventIndex[eventName]
+			if !ok {
+				index = len(plan.Events)
+				eventIndex[eventName] = index
+				plan.Events = append(plan.Events, Event{EventName: eventName, Props: []Prop{}})
+			}
+			if eventShowName != "" {
+				plan.Events[index].ShowName = eventShowName
+			}
+			props = &plan.Events[index].Props
+		}
+		if propName == "" {
+			continue
+		}
+
+		dataType, ok := parseDataType(record[4])
+		if !ok {
+			return plan, errors.New("第" + strconv.Itoa(line) + "行的数据类型" + record[4] + "有误")
+		}
+		prop := Prop{
+			Name:     propName,
+			ShowName: record[3],
+			DataType: dataType,
+			Required: parseBool(record[5]),
+		}
+		if record[6] != "" {
+			prop.Enum = strings.Split(record[6], enumSep)
+		}
+		if prop.Min, err = parseLimit(record[7], line, "最小值"); err != nil {
+			return plan, err
+		}
+		if prop.Max, err = parseLimit(record[8], line, "最大值"); err != nil {
+			return plan, err
+		}
+		*props = append(*props, prop)
+	}
+	return plan, nil
+}
+
+func formatLimit(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func propRecord(eventName, eventShowName string, prop Prop) []string {
+	required := "否"
+	if prop.Required {
+		required = "是"
+	}
+	return []string{
+		eventName, eventShowName, prop.Name, prop.ShowName, parser.TypeRemarkMap[prop.DataType],
+		required, strings.Join(prop.Enum, enumSep), formatLimit(prop.Min), formatLimit(prop.Max),
+	}
+}
+
+func (this *Plan) ToCsv() (content string, err error) {
+	buf := bytes.Buffer{}
+	writer := csv.NewWriter(&buf)
+	records := [][]string{csvHeader}
+	for _, event := range this.Events {
+		if len(event.Props) == 0 {
+			records = append(records, []string{event.EventName, event.ShowName, "", "", "", "", "", "", ""})
+		}
+		for _, prop := range event.Props {
+			records = append(records, propRecord(event.EventName, event.ShowName, prop))
+		}
+	}
+	for _, prop := range this.UserProps {
+		records = append(records, propRecord("", "", prop))
+	}
+	if err = writer.WriteAll(records); err != nil {
+		return
+	}
+	return buf.String(), nil
+}
+
+//按格式解析导入内容并检查
+func Decode(format, content string) (plan Plan, err error) {
+	switch format {
+	case FormatJson:
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		if err = json.Unmarshal([]byte(content), &plan); err != nil {
+			return plan, errors.New("json格式有误:" + err.Error())
+		}
+	case FormatCsv:
+		if plan, err = ParseCsv(strings.NewReader(content)); err != nil {
+			return
+		}
+	default:
+		return plan, errors.New("不支持的格式:" + format)
+	}
+	err = plan.Check()
+	return
+}
+
+func Encode(format string, plan Plan) (content string, err error) {
+	switch format {
+	case FormatJson:
+		var json = jsoniter.ConfigCompatibleWithStandardLibrary
+		b, err := json.MarshalIndent(plan, "", "  ")
+		return string(b), err
+	case FormatCsv:
+		return plan.ToCsv()
+	}
+	return "", errors.New("不支持的格式:" + format)
+}
@@ -0,0 +1,124 @@
+package tracking_plan
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+)
+
+const (
+	DriftUndeclared   = "undeclared"    //已上报但方案中未声明
+	DriftUnobserved   = "unobserved"    //方案中已声明但从未上报
+	DriftTypeMismatch = "type_mismatch" //上报类型与方案类型不一致
+)
+
+//方案与实际上报数据的差异 事件名为空时为用户属性 属性名为空时为事件本身
+type Drift struct {
+	Kind             string `json:"kind"`
+	EventName        string `json:"event_name"`
+	AttributeName    string `json:"attribute_name"`
+	PlanDataType     int    `json:"plan_data_type"`
+	ObservedDataType int    `json:"observed_data_type"`
+}
+
+//对比方案与元数据 元数据由sinker根据实际上报数据生成
+func (this *TrackingPlanService) Drift() (list []Drift, err error) {
+	plan, err := this.load(0)
+	if err != nil {
+		return
+	}
+
+	var eventNames []string
+	if err = db.Sqlx.Select(&eventNames, "select event_name from meta_event where appid = ?", this.Appid); err != nil {
+		return
+	}
+	type relation struct {
+		EventName string `db:"event_name"`
+		EventAttr string `db:"event_attr"`
+	}
+	var relations []relation
+	if err = db.Sqlx.Select(&relations, "select event_name,event_attr from meta_attr_relation where app_id = ?", this.Appid); err != nil {
+		return
+	}
+	type attribute struct {
+		AttributeName   string `db:"attribute_name"`
+		DataType        string `db:"data_type"`
+		AttributeSource int    `db:"attribute_source"`
+	}
+	var attributes []attribute
+	if err = db.Sqlx.Select(&attributes, "select attribute_name,data_type,attribute_source from attribute where app_id = ?", this.Appid); err != nil {
+		return
+	}
+
+	//属性来源 1为用户属性 2为事件属性
+	attrTypes := map[int]map[string]int{1: {}, 2: {}}
+	for _, v := range attributes {
+		if attrTypes[v.AttributeSource] == nil || isSysProp(v.AttributeName) {
+			continue
+		}
+		attrTypes[v.AttributeSource][v.AttributeName], _ = strconv.Atoi(v.DataType)
+	}
+	observedEvents := map[string]map[string]bool{}
+	for _, eventName := range eventNames {
+		observedEvents[eventName] = map[string]bool{}
+	}
+	for _, v := range relations {
+		if observedEvents[v.EventName] != nil && !isSysProp(v.EventAttr) {
+			observedEvents[v.EventName][v.EventAttr] = true
+		}
+	}
+
+	compareProps := func(eventName string, props []Prop, observed map[string]bool, types map[string]int) {
+		declared := map[string]bool{}
+		for _, prop := range props {
+			declared[prop.Name] = true
+			if !observed[prop.Name] {
+				list = append(list, Drift{Kind: DriftUnobserved, EventName: eventName, AttributeName: prop.Name, PlanDataType: prop.DataType})
+				continue
+			}
+			observedType := types[prop.Name]
+			if observedType != prop.DataType && !(isNumberType(observedType) && isNumberType(prop.DataType)) {
+				list = append(list, Drift{Kind: DriftTypeMismatch, EventName: eventName, AttributeName: prop.Name, PlanDataType: prop.DataType, ObservedDataType: observedType})
+			}
+		}
+		for name := range observed {
+			if !declared[name] {
+				list = append(list, Drift{Kind: DriftUndeclared, EventName: eventName, AttributeName: name, ObservedDataType: types[name]})
+			}
+		}
+	}
+
+	declaredEvents := map[string]bool{}
+	for _, event := range plan.Events {
+		declaredEvents[event.EventName] = true
+		observed, ok := observedEvents[event.EventName]
+		if !ok {
+			list = append(list, Drift{Kind: DriftUnobserved, EventName: event.EventName})
+			continue
+		}
+		compareProps(event.EventName, event.Props, observed, attrTypes[2])
+	}
+	for _, eventName := range eventNames {
+		if !declaredEvents[eventName] {
+			list = append(list, Drift{Kind: DriftUndeclared, EventName: eventName})
+		}
+	}
+
+	observedUserProps := map[string]bool{}
+	for name := range attrTypes[1] {
+		observedUserProps[name] = true
+	}
+	compareProps("", plan.UserProps, observedUserProps, attrTypes[1])
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].EventName != list[j].EventName {
+			return list[i].EventName < list[j].EventName
+		}
+		return list[i].AttributeName < list[j].AttributeName
+	})
+	if list == nil {
+		list = []Drift{}
+	}
+	return list, nil
+}
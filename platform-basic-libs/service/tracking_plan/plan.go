@@ -0,0 +1,119 @@
+package tracking_plan
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+)
+
+const (
+	maxEvents = 2000
+	maxProps  = 500
+)
+
+//埋点方案中声明的属性 Min与Max只对数字类型生效 Enum只对数字与字符串类型生效
+type Prop struct {
+	Name     string   `json:"name"`
+	ShowName string   `json:"show_name"`
+	DataType int      `json:"data_type"`
+	Required bool     `json:"required"`
+	Enum     []string `json:"enum,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+type Event struct {
+	EventName string `json:"event_name"`
+	ShowName  string `json:"show_name"`
+	Props     []Prop `json:"props"`
+}
+
+type Plan struct {
+	Events    []Event `json:"events"`
+	UserProps []Prop  `json:"user_props"`
+}
+
+func isNumberType(dataType int) bool {
+	return dataType == parser.Int || dataType == parser.Float
+}
+
+func checkProps(props []Prop, owner string) (err error) {
+	if len(props) > maxProps {
+		return errors.New(owner + "的属性不能超过" + strconv.Itoa(maxProps) + "个")
+	}
+	names := map[string]bool{}
+	for i := range props {
+		prop := &props[i]
+		prop.Name = strings.TrimSpace(prop.Name)
+		prop.ShowName = strings.TrimSpace(prop.ShowName)
+		if prop.Name == "" {
+			return errors.New(owner + "中存在属性名为空的属性")
+		}
+		if names[prop.Name] {
+			return errors.New(owner + "中的属性" + prop.Name + "重复")
+		}
+		names[prop.Name] = true
+		if _, ok := parser.TypeRemarkMap[prop.DataType]; !ok || prop.DataType == parser.TypeUnknown {
+			return errors.New(owner + "中的属性" + prop.Name + "数据类型有误")
+		}
+		//时间类型在入库时统一为DateTime
+		if prop.DataType == parser.ElasticDateTime {
+			prop.DataType = parser.DateTime
+		}
+		if (prop.Min != nil || prop.Max != nil) && !isNumberType(prop.DataType) {
+			return errors.New(owner + "中的属性" + prop.Name + "不是数字类型，不能设置取值范围")
+		}
+		if prop.Min != nil && prop.Max != nil && *prop.Min > *prop.Max {
+			return errors.New(owner + "中的属性" + prop.Name + "的最小值大于最大值")
+		}
+		if len(prop.Enum) > 0 {
+			if !isNumberType(prop.DataType) && prop.DataType != parser.String {
+				return errors.New(owner + "中的属性" + prop.Name + "不是数字或字符串类型，不能设置枚举值")
+			}
+			for j := range prop.Enum {
+				prop.Enum[j] = strings.TrimSpace(prop.Enum[j])
+				if isNumberType(prop.DataType) {
+					if _, ok := parseNumber(prop.Enum[j]); !ok {
+						return errors.New(owner + "中的属性" + prop.Name + "的枚举值" + prop.Enum[j] + "不是数字")
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//检查并整理方案 去掉首尾空格并统一时间类型
+func (this *Plan) Check() (err error) {
+	if len(this.Events) > maxEvents {
+		return errors.New("事件不能超过" + strconv.Itoa(maxEvents) + "个")
+	}
+	if this.Events == nil {
+		this.Events = []Event{}
+	}
+	if this.UserProps == nil {
+		this.UserProps = []Prop{}
+	}
+	eventNames := map[string]bool{}
+	for i := range this.Events {
+		event := &this.Events[i]
+		event.EventName = strings.TrimSpace(event.EventName)
+		event.ShowName = strings.TrimSpace(event.ShowName)
+		if event.EventName == "" {
+			return errors.New("存在事件名为空的事件")
+		}
+		if eventNames[event.EventName] {
+			return errors.New("事件" + event.EventName + "重复")
+		}
+		eventNames[event.EventName] = true
+		if event.Props == nil {
+			event.Props = []Prop{}
+		}
+		if err = checkProps(event.Props, "事件"+event.EventName); err != nil {
+			return
+		}
+	}
+	return checkProps(this.UserProps, "用户属性")
+}
@@ -0,0 +1,121 @@
+package tracking_plan
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+type TrackingPlanService struct {
+	ManagerID int32
+	Appid     int
+}
+
+type TrackingPlanInfo struct {
+	EnforceMode int  `json:"enforce_mode"`
+	Version     int  `json:"version"`
+	Plan        Plan `json:"plan"`
+}
+
+//读取指定版本的方案 version为0时读取当前生效的版本 没有方案时返回空方案
+func (this *TrackingPlanService) load(version int) (plan Plan, err error) {
+	if version == 0 {
+		trackingPlan := model.TrackingPlan{}
+		if err = trackingPlan.Find(this.Appid); err != nil {
+			return
+		}
+		if trackingPlan.Version == 0 {
+			return Plan{Events: []Event{}, UserProps: []Prop{}}, nil
+		}
+		version = trackingPlan.Version
+	}
+	planVersion := model.TrackingPlanVersion{Version: version}
+	if err = planVersion.Find(this.Appid); err != nil {
+		if err == sql.ErrNoRows {
+			return plan, errors.New("版本" + strconv.Itoa(version) + "不存在")
+		}
+		return
+	}
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	err = json.Unmarshal([]byte(planVersion.Content), &plan)
+	return
+}
+
+func (this *TrackingPlanService) Info(version int) (info TrackingPlanInfo, err error) {
+	trackingPlan := model.TrackingPlan{}
+	if err = trackingPlan.Find(this.Appid); err != nil {
+		return
+	}
+	if version == 0 {
+		version = trackingPlan.Version
+	}
+	info.EnforceMode = trackingPlan.EnforceMode
+	info.Version = version
+	info.Plan, err = this.load(version)
+	return
+}
+
+//保存为新版本并立即生效
+func (this *TrackingPlanService) save(plan Plan, remark string) (err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	content, err := json.Marshal(plan)
+	if err != nil {
+		return
+	}
+	remark = strings.TrimSpace(remark)
+	if len([]rune(remark)) > 255 {
+		return errors.New("版本说明不能超过255个字")
+	}
+	planVersion := model.TrackingPlanVersion{
+		Content: string(content),
+		Remark:  remark,
+	}
+	return planVersion.Insert(this.ManagerID, this.Appid)
+}
+
+func (this *TrackingPlanService) Import(reqData request.ImportTrackingPlan) (err error) {
+	plan, err := Decode(reqData.Format, reqData.Content)
+	if err != nil {
+		return
+	}
+	return this.save(plan, reqData.Remark)
+}
+
+func (this *TrackingPlanService) Export(reqData request.ExportTrackingPlan) (content string, err error) {
+	plan, err := this.load(reqData.Version)
+	if err != nil {
+		return
+	}
+	return Encode(reqData.Format, plan)
+}
+
+//回滚即以历史版本的内容生成新版本 保留完整的修改记录
+func (this *TrackingPlanService) Rollback(version int) (err error) {
+	if version <= 0 {
+		return errors.New("版本号不能为空")
+	}
+	plan, err := this.load(version)
+	if err != nil {
+		return
+	}
+	return this.save(plan, "回滚到版本"+strconv.Itoa(version))
+}
+
+func (this *TrackingPlanService) Versions() (list []model.TrackingPlanVersion, err error) {
+	planVersion := model.TrackingPlanVersion{}
+	return planVersion.List(this.Appid)
+}
+
+func (this *TrackingPlanService) SetMode(mode int) (err error) {
+	if !util.InArr([]int{model.TrackingPlanModeOff, model.TrackingPlanModeReport, model.TrackingPlanModeReject}, mode) {
+		return errors.New("校验方式有误")
+	}
+	trackingPlan := model.TrackingPlan{}
+	return trackingPlan.SetMode(this.ManagerID, this.Appid, mode)
+}
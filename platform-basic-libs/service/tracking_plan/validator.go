@@ -0,0 +1,162 @@
+package tracking_plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/model"
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+	"github.com/valyala/fastjson"
+)
+
+//单条数据最多返回的不合规项 避免错误原因过长
+const maxViolations = 5
+
+type compiledProp struct {
+	Prop
+	enum map[string]bool
+}
+
+//按方案中的顺序校验 保证不合规原因的顺序稳定
+type compiledProps struct {
+	list   []*compiledProp
+	byName map[string]*compiledProp
+}
+
+//编译后的方案 用于校验上报数据
+type Validator struct {
+	Mode      int
+	events    map[string]*compiledProps
+	userProps *compiledProps
+}
+
+func compileProps(props []Prop) *compiledProps {
+	m := &compiledProps{byName: make(map[string]*compiledProp, len(props))}
+	for _, prop := range props {
+		p := &compiledProp{Prop: prop}
+		if len(prop.Enum) > 0 {
+			p.enum = make(map[string]bool, len(prop.Enum))
+			for _, v := range prop.Enum {
+				if isNumberType(prop.DataType) {
+					f, _ := parseNumber(v)
+					v = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+				p.enum[v] = true
+			}
+		}
+		m.list = append(m.list, p)
+		m.byName[prop.Name] = p
+	}
+	return m
+}
+
+func NewValidator(mode int, plan Plan) *Validator {
+	validator := &Validator{
+		Mode:      mode,
+		events:    make(map[string]*compiledProps, len(plan.Events)),
+		userProps: compileProps(plan.UserProps),
+	}
+	for _, event := range plan.Events {
+		validator.events[event.EventName] = compileProps(event.Props)
+	}
+	return validator
+}
+
+//系统字段由sdk或sinker写入 不要求在方案中声明
+func isSysProp(name string) bool {
+	if _, ok := parser.SysColumn[name]; ok {
+		return true
+	}
+	return strings.HasPrefix(name, "xwl_")
+}
+
+//校验上报数据 返回不合规的原因 为空表示通过
+func (this *Validator) Validate(reportType int, eventName string, data []byte) (violations []string) {
+	if this == nil {
+		return nil
+	}
+
+	var props *compiledProps
+	switch reportType {
+	case model.EventReportType:
+		var ok bool
+		if props, ok = this.events[eventName]; !ok {
+			return []string{"事件" + eventName + "不在埋点方案中"}
+		}
+	case model.UserReportType:
+		props = this.userProps
+	default:
+		return nil
+	}
+
+	var p fastjson.Parser
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return []string{"数据格式有误:" + err.Error()}
+	}
+	obj, err := v.Object()
+	if err != nil {
+		return []string{"数据格式有误:" + err.Error()}
+	}
+
+	add := func(violation string) {
+		if len(violations) < maxViolations {
+			violations = append(violations, violation)
+		}
+	}
+
+	obj.Visit(func(key []byte, value *fastjson.Value) {
+		name := string(key)
+		if _, ok := props.byName[name]; !ok && !isSysProp(name) {
+			add("属性" + name + "不在埋点方案中")
+		}
+	})
+
+	for _, prop := range props.list {
+		value := obj.Get(prop.Name)
+		if value == nil || value.Type() == fastjson.TypeNull {
+			if prop.Required {
+				add("缺少必填属性" + prop.Name)
+			}
+			continue
+		}
+		if violation := prop.check(value); violation != "" {
+			add(violation)
+		}
+	}
+	return violations
+}
+
+//校验在脱敏前进行 不合规原因中不能包含上报的原始值
+func (this *compiledProp) check(value *fastjson.Value) string {
+	reportType := parser.FjDetectType(value)
+	if reportType != this.DataType {
+		//与入库时的类型检查一致 整数与浮点数可以互通 字符串类型的属性允许上报时间格式的字符串
+		if !(isNumberType(reportType) && isNumberType(this.DataType)) && !(reportType == parser.DateTime && this.DataType == parser.String) {
+			return fmt.Sprintf("%s的类型错误，方案类型为%v，上报类型为%v", this.Name, parser.TypeRemarkMap[this.DataType], parser.TypeRemarkMap[reportType])
+		}
+	}
+
+	if isNumberType(this.DataType) {
+		f, _ := value.Float64()
+		if value.Type() == fastjson.TypeTrue {
+			f = 1
+		}
+		if this.Min != nil && f < *this.Min {
+			return fmt.Sprintf("%s的值小于最小值%v", this.Name, formatLimit(this.Min))
+		}
+		if this.Max != nil && f > *this.Max {
+			return fmt.Sprintf("%s的值大于最大值%v", this.Name, formatLimit(this.Max))
+		}
+		if this.enum != nil && !this.enum[strconv.FormatFloat(f, 'f', -1, 64)] {
+			return fmt.Sprintf("%s的值不在枚举值中", this.Name)
+		}
+	} else if this.enum != nil {
+		s, _ := value.StringBytes()
+		if !this.enum[string(s)] {
+			return fmt.Sprintf("%s的值不在枚举值中", this.Name)
+		}
+	}
+	return ""
+}
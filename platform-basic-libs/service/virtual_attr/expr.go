@@ -0,0 +1,135 @@
+package virtual_attr
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+)
+
+const maxExpressionLen = 1000
+
+var attrNameReg = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+//表达式只能是对当前行的计算 不允许出现子查询与子句关键字
+var forbiddenWords = []string{
+	"select", "from", "join", "union", "with", "where", "prewhere", "having",
+	"limit", "settings", "format", "into", "insert", "alter", "drop", "global",
+}
+
+//可以读取其他表、文件、外部服务或服务器信息的函数
+var forbiddenFuncs = []string{
+	"file", "url", "remote", "remotesecure", "cluster", "clusterallreplicas", "s3", "s3cluster",
+	"hdfs", "mysql", "postgresql", "mongodb", "odbc", "jdbc", "input", "executable",
+	"getsetting", "getmacro", "currentuser", "currentdatabase", "hostname", "fqdn",
+	"globalvariable", "getserverport", "buildid",
+}
+
+var forbiddenFuncPrefix = []string{"dictget", "dicthas", "dictisin", "joinget"}
+
+//分析sql中使用的别名 虚拟属性作为分组字段时会被用作别名
+var reservedNames = []string{
+	"amount", "date_group", "data_group", "eventNameDisplay", "group_num", "serial_number",
+	"groupkey", "level_index", "levels", "count", "ui", "tmp", "value", "dates", "r",
+}
+
+func CheckAttrName(name string) (err error) {
+	if !attrNameReg.MatchString(name) {
+		return errors.New("属性名只能由字母、数字、下划线组成，并以字母开头，长度不超过64")
+	}
+	if strings.HasPrefix(strings.ToLower(name), "xwl_") {
+		return errors.New("属性名不能以xwl_开头")
+	}
+	if util.InstrArr(forbiddenWords, strings.ToLower(name)) || util.InstrArr(reservedNames, name) {
+		return errors.New("属性名" + name + "为保留字，请重新填写")
+	}
+	return nil
+}
+
+//对表达式做词法检查 确保替换进分析sql后仍是一个完整的表达式
+//类型与字段是否存在由clickhouse在保存时检查
+func CheckExpression(expr string) (err error) {
+	if strings.TrimSpace(expr) == "" {
+		return errors.New("表达式不能为空")
+	}
+	if len(expr) > maxExpressionLen {
+		return errors.New("表达式过长")
+	}
+	//clickhouse驱动绑定参数时不区分字符串字面量 ?与@在字符串中也会被当作占位符
+	if strings.ContainsAny(expr, "?@") {
+		return errors.New("表达式中不允许使用字符?和@")
+	}
+
+	runes := []rune(expr)
+	depth := 0
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'':
+			//字符串字面量 支持\'与''两种转义
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' {
+					i++
+					continue
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+						continue
+					}
+					closed = true
+					break
+				}
+			}
+			if !closed {
+				return errors.New("表达式中的字符串未闭合")
+			}
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i+1 < len(runes) && (runes[i+1] == '_' || unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) {
+				i++
+			}
+			word := strings.ToLower(string(runes[start : i+1]))
+			if isFuncCall(runes, i+1) {
+				if util.InstrArr(forbiddenFuncs, word) {
+					return errors.New("表达式中不允许使用函数" + string(runes[start:i+1]))
+				}
+				for _, prefix := range forbiddenFuncPrefix {
+					if strings.HasPrefix(word, prefix) {
+						return errors.New("表达式中不允许使用函数" + string(runes[start:i+1]))
+					}
+				}
+			} else if util.InstrArr(forbiddenWords, word) {
+				return errors.New("表达式中不允许使用关键字" + string(runes[start:i+1]))
+			}
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+			if depth < 0 {
+				return errors.New("表达式括号不匹配")
+			}
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-',
+			c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			return errors.New("表达式中不允许使用注释")
+		case strings.ContainsRune(";#`\"{}$", c):
+			return errors.New("表达式中不允许使用字符" + string(c))
+		}
+	}
+	if depth != 0 {
+		return errors.New("表达式括号不匹配")
+	}
+	return nil
+}
+
+func isFuncCall(runes []rune, i int) bool {
+	for ; i < len(runes); i++ {
+		if !unicode.IsSpace(runes[i]) {
+			return runes[i] == '('
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package virtual_attr
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	parser "github.com/1340691923/xwl_bi/platform-basic-libs/sinker/parse"
+)
+
+type VirtualAttrService struct {
+	ManagerID int32
+	Appid     int
+}
+
+//交给clickhouse推断表达式的类型 表达式有误或引用了不存在的字段时返回错误
+func (this *VirtualAttrService) Check(expression string) (dataType int, err error) {
+	if err = CheckExpression(expression); err != nil {
+		return
+	}
+
+	rows, err := db.ClickHouseSqlx.Queryx("DESC TABLE (SELECT (" + expression + ") AS v FROM xwl_event" + strconv.Itoa(this.Appid) + ")")
+	if err != nil {
+		return 0, errors.New("表达式有误:" + err.Error())
+	}
+	defer rows.Close()
+
+	typ := ""
+	for rows.Next() {
+		res := map[string]interface{}{}
+		if err = rows.MapScan(res); err != nil {
+			return
+		}
+		typ, _ = res["type"].(string)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	//LowCardinality只影响存储 按内部类型处理
+	if strings.HasPrefix(typ, "LowCardinality(") {
+		typ = typ[len("LowCardinality(") : len(typ)-1]
+	}
+	dataType, _ = parser.WhichType(typ)
+	if dataType == parser.TypeUnknown {
+		return 0, errors.New("不支持的表达式类型:" + typ)
+	}
+	return dataType, nil
+}
+
+func (this *VirtualAttrService) toModel(reqData request.VirtualAttr) (virtualAttr model.VirtualAttr, err error) {
+	virtualAttr = model.VirtualAttr{
+		Id:            reqData.Id,
+		AttributeName: strings.TrimSpace(reqData.AttributeName),
+		ShowName:      strings.TrimSpace(reqData.ShowName),
+		Expression:    strings.TrimSpace(reqData.Expression),
+	}
+	virtualAttr.DataType, err = this.Check(virtualAttr.Expression)
+	return
+}
+
+func (this *VirtualAttrService) Add(reqData request.VirtualAttr) (err error) {
+	virtualAttr, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	if err = CheckAttrName(virtualAttr.AttributeName); err != nil {
+		return
+	}
+
+	//与真实属性同名时分析中无法区分
+	var count int
+	err = db.Sqlx.Get(&count, "select count(*) from attribute where app_id = ? and attribute_name = ?", this.Appid, virtualAttr.AttributeName)
+	if err != nil {
+		return
+	}
+	if count > 0 {
+		return errors.New("已存在同名的属性" + virtualAttr.AttributeName + "，请重新填写")
+	}
+
+	return virtualAttr.Insert(this.ManagerID, this.Appid)
+}
+
+func (this *VirtualAttrService) Modify(reqData request.VirtualAttr) (err error) {
+	if reqData.Id == 0 {
+		return errors.New("虚拟属性ID不能为空")
+	}
+	virtualAttr, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	return virtualAttr.Modify(this.Appid)
+}
+
+func (this *VirtualAttrService) Delete(id int) (err error) {
+	virtualAttr := model.VirtualAttr{Id: id}
+	return virtualAttr.Delete(this.Appid)
+}
+
+func (this *VirtualAttrService) List() (list []model.VirtualAttr, err error) {
+	virtualAttr := model.VirtualAttr{}
+	return virtualAttr.List(this.Appid)
+}
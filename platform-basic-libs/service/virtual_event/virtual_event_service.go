@@ -0,0 +1,158 @@
+package virtual_event
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/request"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/service/analysis/utils"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const maxItems = 20
+
+var eventNameReg = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+type VirtualEventService struct {
+	ManagerID int32
+	Appid     int
+}
+
+type VirtualEventRes struct {
+	model.VirtualEvent
+	Items []request.VirtualEventItem `json:"items"`
+}
+
+//校验组成部分 并交给clickhouse检查筛选条件中的字段与类型
+func (this *VirtualEventService) check(reqData request.VirtualEvent) (err error) {
+	if len(reqData.Items) == 0 {
+		return errors.New("请选择组成虚拟事件的事件")
+	}
+	if len(reqData.Items) > maxItems {
+		return errors.New("组成虚拟事件的事件不能超过" + strconv.Itoa(maxItems) + "个")
+	}
+
+	eventNameList := []string{}
+	if err = db.Sqlx.Select(&eventNameList, "select event_name from meta_event where appid = ?", this.Appid); err != nil {
+		return
+	}
+	for _, item := range reqData.Items {
+		if !util.InstrArr(eventNameList, item.EventName) {
+			return errors.New("事件" + item.EventName + "不存在，虚拟事件只能由真实事件组成")
+		}
+	}
+
+	virtualAttrs, err := utils.GetVirtualAttrs(this.Appid)
+	if err != nil {
+		return
+	}
+	//筛选条件是切片 替换虚拟属性前先深拷贝 避免保存的定义中出现表达式
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+	var items []request.VirtualEventItem
+	b, err := json.Marshal(reqData.Items)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &items); err != nil {
+		return
+	}
+	for i := range items {
+		virtualAttrs.ReplaceFilter(&items[i].Filter)
+	}
+	virtualEvents := utils.VirtualEvents{reqData.EventName: utils.VirtualEvent{Items: items}}
+	SQL, args, err := virtualEvents.EventSql(reqData.EventName)
+	if err != nil {
+		return
+	}
+	rows, err := db.ClickHouseSqlx.Query("select 1 from xwl_event"+strconv.Itoa(this.Appid)+" prewhere "+SQL+" limit 0", args...)
+	if err != nil {
+		return errors.New("筛选条件有误:" + err.Error())
+	}
+	return rows.Close()
+}
+
+func (this *VirtualEventService) toModel(reqData request.VirtualEvent) (virtualEvent model.VirtualEvent, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	reqData.EventName = strings.TrimSpace(reqData.EventName)
+	if err = this.check(reqData); err != nil {
+		return
+	}
+	definition, err := json.Marshal(reqData.Items)
+	if err != nil {
+		return
+	}
+	virtualEvent = model.VirtualEvent{
+		Id:         reqData.Id,
+		EventName:  reqData.EventName,
+		ShowName:   strings.TrimSpace(reqData.ShowName),
+		Definition: string(definition),
+	}
+	return
+}
+
+func (this *VirtualEventService) Add(reqData request.VirtualEvent) (err error) {
+	if !eventNameReg.MatchString(strings.TrimSpace(reqData.EventName)) {
+		return errors.New("事件名只能由字母、数字、下划线组成，并以字母开头，长度不超过64")
+	}
+	virtualEvent, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+
+	//与真实事件同名时分析中无法区分
+	var count int
+	err = db.Sqlx.Get(&count, "select count(*) from meta_event where appid = ? and event_name = ?", this.Appid, virtualEvent.EventName)
+	if err != nil {
+		return
+	}
+	if count > 0 {
+		return errors.New("已存在同名的事件" + virtualEvent.EventName + "，请重新填写")
+	}
+
+	return virtualEvent.Insert(this.ManagerID, this.Appid)
+}
+
+func (this *VirtualEventService) Modify(reqData request.VirtualEvent) (err error) {
+	if reqData.Id == 0 {
+		return errors.New("虚拟事件ID不能为空")
+	}
+	old := model.VirtualEvent{Id: reqData.Id}
+	if err = old.FindById(this.Appid); err != nil {
+		return
+	}
+	reqData.EventName = old.EventName
+	virtualEvent, err := this.toModel(reqData)
+	if err != nil {
+		return
+	}
+	return virtualEvent.Modify(this.Appid)
+}
+
+func (this *VirtualEventService) Delete(id int) (err error) {
+	virtualEvent := model.VirtualEvent{Id: id}
+	return virtualEvent.Delete(this.Appid)
+}
+
+func (this *VirtualEventService) List() (res []VirtualEventRes, err error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	virtualEvent := model.VirtualEvent{}
+	list, err := virtualEvent.List(this.Appid)
+	if err != nil {
+		return
+	}
+	for _, v := range list {
+		item := VirtualEventRes{VirtualEvent: v}
+		if err = json.Unmarshal([]byte(v.Definition), &item.Items); err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+	}
+	return
+}
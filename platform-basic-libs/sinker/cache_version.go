@@ -0,0 +1,58 @@
+package sinker
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/util"
+	"github.com/garyburd/redigo/redis"
+	"go.uber.org/zap"
+)
+
+//管理端修改表结构后写入该key，sinker轮询发现变化后清空本地缓存
+const CacheVersionKey = "sinkerCacheVersion"
+
+//清除表结构的redis缓存并通知所有sinker清空本地缓存
+func InvalidateCache(database, table string) (err error) {
+	ClearDimsCacheByRedis(GetDimsCachekey(database, table))
+
+	redisConn := db.RedisPool.Get()
+	defer redisConn.Close()
+	_, err = redisConn.Do("set", CacheVersionKey, strconv.FormatInt(time.Now().UnixNano(), 10))
+	return
+}
+
+func getCacheVersion() (version string, err error) {
+	redisConn := db.RedisPool.Get()
+	defer redisConn.Close()
+	version, err = redis.String(redisConn.Do("get", CacheVersionKey))
+	if util.FilterRedisNilErr(err) {
+		return "", err
+	}
+	return version, nil
+}
+
+var lastCacheVersion string
+
+//检查缓存版本号 版本变化时清空表结构缓存并回调onChange清空其他元数据缓存
+func CheckCacheVersion(onChange func()) (err error) {
+	version, err := getCacheVersion()
+	if err != nil {
+		return
+	}
+	if version == lastCacheVersion {
+		return nil
+	}
+	lastCacheVersion = version
+	dimsCacheMap.Range(func(key, value interface{}) bool {
+		dimsCacheMap.Delete(key)
+		return true
+	})
+	if onChange != nil {
+		onChange()
+	}
+	logs.Logger.Info("sinker cache invalidated", zap.String("version", version))
+	return nil
+}
@@ -7,7 +7,6 @@ import (
 	"regexp"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/1340691923/xwl_bi/engine/db"
 	"github.com/1340691923/xwl_bi/engine/logs"
@@ -43,32 +42,13 @@ func GetDimsCachekey(database, table string) string {
 //sync.Map 在并发环境下使用，解决线程安全
 var dimsCacheMap sync.Map
 
-func ClearDimsCacheByTime(clearTime time.Duration) {
-
-	for {
-		time.Sleep(clearTime)
-		dimsCacheMap.Range(func(key, value interface{}) bool {
-			ClearDimsCacheByRedis(key.(string))
-			dimsCacheMap.Delete(key)
-			return true
-		})
-
-	}
-}
-
-func ClearDimsCacheByTimeBylocal(clearTime time.Duration) {
-
-	for {
-		time.Sleep(clearTime)
-
-		//使用 Range 配合一个回调函数进行遍历操作
-		dimsCacheMap.Range(func(key, value interface{}) bool {
-			ClearDimsCacheByRedis(key.(string)) //删除redis缓存
-			dimsCacheMap.Delete(key)            //删除
-			return true
-		})
-
-	}
+//清空表结构的本地缓存以及redis缓存
+func ClearDimsCache() {
+	dimsCacheMap.Range(func(key, value interface{}) bool {
+		ClearDimsCacheByRedis(key.(string)) //删除redis缓存
+		dimsCacheMap.Delete(key)            //删除
+		return true
+	})
 }
 
 func ClearDimsCacheByRedis(key string) {
@@ -182,25 +162,8 @@ func ChangeSchema(newKeys *sync.Map, dbname, table string, dims []*model2.Column
 		strKey, _ := key.(string)
 		intVal := value.(int)
 		var strVal string
-		switch intVal {
-		case parser.Int:
-			strVal = "Float64"
-		case parser.Float:
-			strVal = "Float64"
-		case parser.String:
-			strVal = "String"
-		case parser.DateTime:
-			strVal = "Nullable(DateTime)"
-		case parser.IntArray:
-			strVal = "Array(Int64)"
-		case parser.FloatArray:
-			strVal = "Array(Float64)"
-		case parser.StringArray:
-			strVal = "Array(String)"
-		case parser.DateTimeArray:
-			strVal = "Array(DateTime)"
-		default:
-			err = errors.Errorf("BUG: unsupported column type %s", strVal)
+		strVal, err = GetColumnTypeSql(intVal)
+		if err != nil {
 			return false
 		}
 		query := fmt.Sprintf("ALTER TABLE %s.%s %s ADD COLUMN IF NOT EXISTS `%s` %s", dbname, table, GetClusterSql(), strKey, strVal)
@@ -229,6 +192,31 @@ func ChangeSchema(newKeys *sync.Map, dbname, table string, dims []*model2.Column
 	return dims, nil
 }
 
+//将解析出的数据类型转换为ck列类型
+func GetColumnTypeSql(typ int) (strVal string, err error) {
+	switch typ {
+	case parser.Int:
+		strVal = "Float64"
+	case parser.Float:
+		strVal = "Float64"
+	case parser.String:
+		strVal = "String"
+	case parser.DateTime:
+		strVal = "Nullable(DateTime)"
+	case parser.IntArray:
+		strVal = "Array(Int64)"
+	case parser.FloatArray:
+		strVal = "Array(Float64)"
+	case parser.StringArray:
+		strVal = "Array(String)"
+	case parser.DateTimeArray:
+		strVal = "Array(DateTime)"
+	default:
+		err = errors.Errorf("BUG: unsupported column type %d", typ)
+	}
+	return
+}
+
 func GetClusterSql() string {
 	if model.GlobConfig.Comm.ClickHouse.ClusterName == "" {
 		return " "
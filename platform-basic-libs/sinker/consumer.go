@@ -0,0 +1,32 @@
+package sinker
+
+import (
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/model"
+)
+
+//消费者组 屏蔽kafka与redis stream的差异
+type ConsumerGroup interface {
+	/*
+		topicName toptic名称(redis为stream key)
+		consumerGroup 消费者组
+		putFn 每条消息的回调 处理完成后需调用markFn
+	*/
+	Init(topicName, consumerGroup string, putFn func(msg model.InputMessage, markFn func()), cleanupFn func()) error
+	Run()
+	Stop() error
+	Clone() ConsumerGroup
+	Description() string
+}
+
+//根据comm.mq.type创建消费者组
+func NewConsumerGroup() ConsumerGroup {
+	switch model.GlobConfig.GetMqType() {
+	case model.MqTypeRedis:
+		return NewRedisStream(db.RedisPool, model.GlobConfig.Comm.Mq.RedisStream)
+	case model.MqTypeLocal:
+		return NewLocalQueueConsumer(db.LocalMq)
+	default:
+		return NewKafkaSarama(model.GlobConfig.Comm.Kafka)
+	}
+}
@@ -0,0 +1,187 @@
+package sinker
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/xdg-go/scram"
+)
+
+const (
+	SyncProducer  = "sync"
+	AsyncProducer = "async"
+)
+
+//生成kafka客户端通用配置 消费者、生产者以及初始化topic共用
+func GetSaramaConfig(kfkCfg model.KafkaCfg) (sarCfg *sarama.Config, err error) {
+	sarCfg = sarama.NewConfig()
+	sarCfg.Version = sarama.V2_0_0_0
+	if kfkCfg.Version != "" {
+		if sarCfg.Version, err = sarama.ParseKafkaVersion(kfkCfg.Version); err != nil {
+			return nil, errors.Wrapf(err, "kafka version %s 不合法", kfkCfg.Version)
+		}
+	}
+	if kfkCfg.ClientID != "" {
+		sarCfg.ClientID = kfkCfg.ClientID
+	}
+	sarCfg.Consumer.Return.Errors = false
+	if kfkCfg.Tls.Enable {
+		sarCfg.Net.TLS.Enable = true
+		if sarCfg.Net.TLS.Config, err = newTlsConfig(kfkCfg.Tls); err != nil {
+			return nil, err
+		}
+	}
+	// check for authentication
+	if kfkCfg.Username != "" && kfkCfg.Password != "" {
+		sarCfg.Net.SASL.Enable = true
+		sarCfg.Net.SASL.User = kfkCfg.Username
+		sarCfg.Net.SASL.Password = kfkCfg.Password
+		sarCfg.Net.SASL.Handshake = true
+		switch strings.ToUpper(kfkCfg.Sasl.Mechanism) {
+		case "", sarama.SASLTypePlaintext:
+			sarCfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			sarCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			sarCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &xdgSCRAMClient{HashGeneratorFcn: sha256.New}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			sarCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			sarCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &xdgSCRAMClient{HashGeneratorFcn: sha512.New}
+			}
+		default:
+			return nil, fmt.Errorf("不支持的kafka sasl mechanism:%s", kfkCfg.Sasl.Mechanism)
+		}
+	}
+	sarCfg.ChannelBufferSize = 1024
+	return
+}
+
+//生成kafka生产者配置 producerType为sync或async，未配置的调优项沿用各自的默认值
+func GetSaramaProducerConfig(kfkCfg model.KafkaCfg, producerType string) (sarCfg *sarama.Config, err error) {
+	sarCfg, err = GetSaramaConfig(kfkCfg)
+	if err != nil {
+		return
+	}
+	sarCfg.Producer.Partitioner = sarama.NewRandomPartitioner // 新选出一个partition
+
+	switch producerType {
+	case SyncProducer:
+		sarCfg.Producer.Return.Successes = true          // 成功交付的消息将在success channel返回
+		sarCfg.Producer.RequiredAcks = sarama.WaitForAll // 发送完数据需要leader和follow都确认
+	case AsyncProducer:
+		sarCfg.Producer.RequiredAcks = sarama.NoResponse                        // Only wait for the leader to ack
+		sarCfg.Producer.Compression = sarama.CompressionSnappy                  // Compress messages
+		sarCfg.Producer.Flush.Frequency = time.Duration(500) * time.Millisecond // Flush batches every 500ms 不分区
+	default:
+		return nil, fmt.Errorf("不支持的kafka生产者类型:%s", producerType)
+	}
+
+	producerCfg := kfkCfg.Producer
+
+	if producerCfg.RequiredAcks != "" {
+		switch strings.ToLower(producerCfg.RequiredAcks) {
+		case "none", "0":
+			sarCfg.Producer.RequiredAcks = sarama.NoResponse
+		case "leader", "1":
+			sarCfg.Producer.RequiredAcks = sarama.WaitForLocal
+		case "all", "-1":
+			sarCfg.Producer.RequiredAcks = sarama.WaitForAll
+		default:
+			return nil, fmt.Errorf("不支持的kafka requiredAcks:%s", producerCfg.RequiredAcks)
+		}
+	}
+
+	if producerCfg.Compression != "" {
+		switch strings.ToLower(producerCfg.Compression) {
+		case "none":
+			sarCfg.Producer.Compression = sarama.CompressionNone
+		case "gzip":
+			sarCfg.Producer.Compression = sarama.CompressionGZIP
+		case "snappy":
+			sarCfg.Producer.Compression = sarama.CompressionSnappy
+		case "lz4":
+			sarCfg.Producer.Compression = sarama.CompressionLZ4
+		case "zstd":
+			sarCfg.Producer.Compression = sarama.CompressionZSTD
+		default:
+			return nil, fmt.Errorf("不支持的kafka compression:%s", producerCfg.Compression)
+		}
+	}
+
+	if producerCfg.FlushFrequency > 0 {
+		sarCfg.Producer.Flush.Frequency = time.Duration(producerCfg.FlushFrequency) * time.Millisecond
+	}
+
+	//幂等生产要求 acks=all 且同一连接只允许一个在途请求
+	if producerCfg.Idempotent {
+		sarCfg.Producer.Idempotent = true
+		sarCfg.Producer.RequiredAcks = sarama.WaitForAll
+		sarCfg.Net.MaxOpenRequests = 1
+	}
+
+	if err = sarCfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "kafka生产者配置不合法")
+	}
+	return
+}
+
+func newTlsConfig(tlsCfg model.KafkaTlsCfg) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: tlsCfg.InsecureSkipVerify}
+
+	if tlsCfg.CaFile != "" {
+		caCert, err := ioutil.ReadFile(tlsCfg.CaFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "读取kafka CA证书 %s 失败", tlsCfg.CaFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("kafka CA证书 %s 解析失败", tlsCfg.CaFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if tlsCfg.CertFile != "" && tlsCfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "加载kafka客户端证书失败")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+//sarama.SCRAMClient 的实现
+type xdgSCRAMClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (x *xdgSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	x.Client, err = x.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	x.ClientConversation = x.Client.NewConversation()
+	return nil
+}
+
+func (x *xdgSCRAMClient) Step(challenge string) (response string, err error) {
+	return x.ClientConversation.Step(challenge)
+}
+
+func (x *xdgSCRAMClient) Done() bool {
+	return x.ClientConversation.Done()
+}
@@ -26,12 +26,12 @@ type KafkaSarama struct {
 	cleanupFn func()
 }
 
-func NewKafkaSarama() *KafkaSarama {
-	return &KafkaSarama{}
+func NewKafkaSarama(cfg model.KafkaCfg) *KafkaSarama {
+	return &KafkaSarama{cfg: cfg}
 }
 
-func (k *KafkaSarama) Clone() *KafkaSarama {
-	return &KafkaSarama{}
+func (k *KafkaSarama) Clone() ConsumerGroup {
+	return &KafkaSarama{cfg: k.cfg}
 }
 
 type MyConsumerGroupHandler struct {
@@ -75,13 +75,12 @@ func (h MyConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, c
 }
 
 /*
-	cfg kafka配置结构体
 	topicName toptic名称
 	consumerGroup 消费者组
 
 */
-func (k *KafkaSarama) Init(cfg model.KafkaCfg, topicName, consumerGroup string, putFn func(msg model.InputMessage, markFn func()), cleanupFn func()) (err error) {
-	k.cfg = cfg
+func (k *KafkaSarama) Init(topicName, consumerGroup string, putFn func(msg model.InputMessage, markFn func()), cleanupFn func()) (err error) {
+	cfg := k.cfg
 	k.ctx, k.cancel = context.WithCancel(context.Background())
 	k.putFn = putFn
 	k.cleanupFn = cleanupFn
@@ -103,20 +102,6 @@ func (k *KafkaSarama) Init(cfg model.KafkaCfg, topicName, consumerGroup string,
 	return nil
 }
 
-func GetSaramaConfig(kfkCfg model.KafkaCfg) (sarCfg *sarama.Config, err error) {
-	sarCfg = sarama.NewConfig()
-	sarCfg.Version = sarama.V2_0_0_0
-	sarCfg.Consumer.Return.Errors = false
-	// check for authentication
-	if kfkCfg.Username != "" && kfkCfg.Password != "" {
-		sarCfg.Net.SASL.Enable = true
-		sarCfg.Net.SASL.User = kfkCfg.Username
-		sarCfg.Net.SASL.Password = kfkCfg.Password
-	}
-	sarCfg.ChannelBufferSize = 1024
-	return
-}
-
 func (k *KafkaSarama) Run() {
 	k.wgRun.Add(1)
 	defer k.wgRun.Done()
@@ -0,0 +1,100 @@
+package sinker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//基于本地持久化队列的消费者组 只能消费同一进程内生产的消息(单进程部署)
+type LocalQueueConsumer struct {
+	queue     *db.LocalQueue
+	reader    *db.LocalQueueReader
+	topic     string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wgRun     sync.WaitGroup
+	putFn     func(msg model.InputMessage, markFn func())
+	cleanupFn func()
+}
+
+func NewLocalQueueConsumer(queue *db.LocalQueue) *LocalQueueConsumer {
+	return &LocalQueueConsumer{queue: queue}
+}
+
+func (l *LocalQueueConsumer) Clone() ConsumerGroup {
+	return NewLocalQueueConsumer(l.queue)
+}
+
+func (l *LocalQueueConsumer) Init(topicName, consumerGroup string, putFn func(msg model.InputMessage, markFn func()), cleanupFn func()) (err error) {
+	if l.queue == nil {
+		return errors.New("本地队列未初始化")
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.topic = topicName
+	l.putFn = putFn
+	l.cleanupFn = cleanupFn
+	l.reader, err = l.queue.NewReader(topicName, consumerGroup)
+	return
+}
+
+func (l *LocalQueueConsumer) Run() {
+	l.wgRun.Add(2)
+	defer l.wgRun.Done()
+
+	//定时持久化消费位置
+	go func() {
+		defer l.wgRun.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.reader.Flush(); err != nil {
+					logs.Logger.Error("LocalQueueConsumer flush offset failed", zap.String("task", l.topic), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	for {
+		msg, err := l.reader.Next(l.ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, db.ErrLocalQueueClosed) {
+				logs.Logger.Info("LocalQueueConsumer.Run quit", zap.String("task", l.topic), zap.Error(err))
+				return
+			}
+			logs.Logger.Error("LocalQueueConsumer read failed", zap.String("task", l.topic), zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		next := msg.Next
+		l.putFn(model.InputMessage{
+			Topic:     l.topic,
+			Value:     msg.Value,
+			Offset:    msg.Offset,
+			Timestamp: &msg.Timestamp,
+		}, func() {
+			l.reader.Commit(next)
+		})
+	}
+}
+
+func (l *LocalQueueConsumer) Stop() error {
+	l.cancel()
+	l.wgRun.Wait()
+	l.cleanupFn()
+	return l.reader.Flush()
+}
+
+func (l *LocalQueueConsumer) Description() string {
+	return "local queue consumer of topic " + l.topic
+}
@@ -0,0 +1,257 @@
+package sinker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1340691923/xwl_bi/engine/db"
+	"github.com/1340691923/xwl_bi/engine/logs"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/garyburd/redigo/redis"
+	"go.uber.org/zap"
+)
+
+//基于redis stream的消费者组 用于无kafka的小型部署
+type RedisStream struct {
+	pool      *redis.Pool
+	cfg       model.RedisStreamConfig
+	stream    string
+	group     string
+	consumer  string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wgRun     sync.WaitGroup
+	putFn     func(msg model.InputMessage, markFn func())
+	cleanupFn func()
+}
+
+type streamEntry struct {
+	id    string
+	value []byte
+	//消息已被XDEL或MAXLEN裁剪
+	deleted bool
+}
+
+func NewRedisStream(pool *redis.Pool, cfg model.RedisStreamConfig) *RedisStream {
+	return &RedisStream{pool: pool, cfg: cfg}
+}
+
+func (r *RedisStream) Clone() ConsumerGroup {
+	return NewRedisStream(r.pool, r.cfg)
+}
+
+func (r *RedisStream) Init(topicName, consumerGroup string, putFn func(msg model.InputMessage, markFn func()), cleanupFn func()) (err error) {
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.stream = topicName
+	r.group = consumerGroup
+	r.putFn = putFn
+	r.cleanupFn = cleanupFn
+
+	hostname, _ := os.Hostname()
+	r.consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	//与kafka的OffsetOldest保持一致 从头开始消费
+	_, err = conn.Do("XGROUP", "CREATE", r.stream, r.group, "0", "MKSTREAM")
+	if err != nil && strings.Contains(err.Error(), "BUSYGROUP") {
+		err = nil
+	}
+	return
+}
+
+func (r *RedisStream) Run() {
+	r.wgRun.Add(1)
+	defer r.wgRun.Done()
+
+	claimIdle := time.Duration(r.cfg.GetClaimIdleMs()) * time.Millisecond
+	lastClaim := time.Time{}
+
+	for {
+		if r.ctx.Err() != nil {
+			logs.Logger.Info("RedisStream.Run quit due to context has been canceled", zap.String("task", r.stream))
+			return
+		}
+
+		//认领空闲过久的pending消息(消费者宕机或未ack)
+		if time.Since(lastClaim) >= claimIdle {
+			lastClaim = time.Now()
+			entries, err := r.claimPending(claimIdle)
+			if err != nil {
+				logs.Logger.Error("RedisStream claimPending failed", zap.String("task", r.stream), zap.Error(err))
+			}
+			r.dispatch(entries)
+		}
+
+		entries, err := r.readGroup()
+		if err != nil {
+			logs.Logger.Error("RedisStream XREADGROUP failed", zap.String("task", r.stream), zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		r.dispatch(entries)
+	}
+}
+
+func (r *RedisStream) readGroup() (entries []streamEntry, err error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.Values(conn.Do("XREADGROUP",
+		"GROUP", r.group, r.consumer,
+		"COUNT", r.cfg.GetBatchSize(),
+		"BLOCK", r.cfg.GetBlockMs(),
+		"STREAMS", r.stream, ">",
+	))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//[[stream, [[id, [field, value...]]...]]]
+	for _, s := range reply {
+		kv, err := redis.Values(s, nil)
+		if err != nil || len(kv) != 2 {
+			return nil, fmt.Errorf("XREADGROUP 返回格式异常:%v", err)
+		}
+		es, err := parseStreamEntries(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, es...)
+	}
+	return
+}
+
+func (r *RedisStream) claimPending(minIdle time.Duration) (entries []streamEntry, err error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	//[[id, consumer, idle, deliveries]...]
+	pending, err := redis.Values(conn.Do("XPENDING", r.stream, r.group, "-", "+", r.cfg.GetBatchSize()))
+	if err != nil {
+		return nil, err
+	}
+
+	args := redis.Args{r.stream, r.group, r.consumer, minIdle.Milliseconds()}
+	var found bool
+	for _, p := range pending {
+		item, err := redis.Values(p, nil)
+		if err != nil || len(item) < 3 {
+			continue
+		}
+		id, _ := redis.String(item[0], nil)
+		idle, _ := redis.Int64(item[2], nil)
+		if time.Duration(idle)*time.Millisecond >= minIdle {
+			args = args.Add(id)
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	reply, err := conn.Do("XCLAIM", args...)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = parseStreamEntries(reply)
+	if err != nil {
+		return nil, err
+	}
+	logs.Logger.Info("RedisStream claim pending entries", zap.String("task", r.stream), zap.Int("count", len(entries)))
+	return
+}
+
+func parseStreamEntries(reply interface{}) (entries []streamEntry, err error) {
+	items, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		e, err := redis.Values(item, nil)
+		if err != nil || len(e) != 2 {
+			return nil, fmt.Errorf("stream entry 格式异常:%v", err)
+		}
+		id, err := redis.String(e[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		entry := streamEntry{id: id}
+		if e[1] == nil {
+			entry.deleted = true
+			entries = append(entries, entry)
+			continue
+		}
+		fields, err := redis.ByteSlices(e[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if string(fields[i]) == db.RedisStreamValueField {
+				entry.value = fields[i+1]
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+func (r *RedisStream) dispatch(entries []streamEntry) {
+	for _, entry := range entries {
+		id := entry.id
+		if entry.deleted {
+			r.ack(id)
+			continue
+		}
+		ms, seq := parseStreamId(id)
+		ts := time.UnixMilli(ms)
+		r.putFn(model.InputMessage{
+			Topic: r.stream,
+			Key:   []byte(id),
+			Value: entry.value,
+			//redis stream 没有offset 用id换算出一个单调递增的值
+			Offset:    ms*1000 + seq,
+			Timestamp: &ts,
+		}, func() {
+			r.ack(id)
+		})
+	}
+}
+
+func (r *RedisStream) ack(id string) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("XACK", r.stream, r.group, id); err != nil {
+		logs.Logger.Error("RedisStream XACK failed", zap.String("task", r.stream), zap.String("id", id), zap.Error(err))
+	}
+}
+
+//stream id 格式为 {毫秒时间戳}-{序号}
+func parseStreamId(id string) (ms int64, seq int64) {
+	arr := strings.SplitN(id, "-", 2)
+	ms, _ = strconv.ParseInt(arr[0], 10, 64)
+	if len(arr) == 2 {
+		seq, _ = strconv.ParseInt(arr[1], 10, 64)
+	}
+	return
+}
+
+func (r *RedisStream) Stop() error {
+	r.cancel()
+	r.wgRun.Wait()
+	r.cleanupFn()
+	return nil
+}
+
+func (r *RedisStream) Description() string {
+	return "redis stream consumer of stream " + r.stream
+}
@@ -0,0 +1,30 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runAttrDict(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/attr_dict"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "上传属性字典", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.UploadAttrDict)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "保存属性字典同步地址", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.SaveUrlAttrDict)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "同步属性字典", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.SyncAttrDict)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "删除属性字典", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.DeleteAttrDict)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "属性字典列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.AttrDictList)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "属性字典内容", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), AttrDictController{}.AttrDictItems)
+	}
+}
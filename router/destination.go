@@ -0,0 +1,32 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runDestination(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/destination"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "新增事件转发", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.AddDestination)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "修改事件转发", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.ModifyDestination)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "启用或停用事件转发", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.ModifyDestinationStatus)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "删除事件转发", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.DeleteDestination)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "事件转发列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.DestinationList)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "测试事件转发", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.TestDestination)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "事件转发投递日志", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), DestinationController{}.DestinationLogList)
+	}
+}
@@ -56,6 +56,13 @@ func Init() *App {
 		runPannel,
 		runApp, //应用管理模块
 		runUserGroup,
+		runDestination,  //事件转发
+		runPiiRule,      //敏感信息脱敏
+		runVirtualAttr,  //虚拟属性
+		runVirtualEvent, //虚拟事件
+		runAttrDict,     //属性值字典
+		runTrackingPlan, //埋点方案
+		runJob,          //定时任务
 	)
 }
 
@@ -0,0 +1,24 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+//定时任务
+func runJob(app *fiber.App) {
+	apiRouterConfig := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/job"
+	appG := app.Group(AbsolutePath)
+	{
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "定时任务列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), JobController{}.JobList)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "定时任务执行历史", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), JobController{}.JobRuns)
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "手动触发定时任务", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), JobController{}.TriggerJob)
+	}
+}
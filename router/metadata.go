@@ -30,6 +30,18 @@ func runMetaData(app *fiber.App) {
 
 		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "修改属性显示名", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.UpdateAttrShowName)
 
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "修改属性类型", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.RetypeAttr)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "查看属性类型转换进度", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.AttrRetypeProgress)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "归档属性", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.ArchiveAttr)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "删除属性", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.DropAttr)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "事件近30天上报量", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.EventVolume)
+
+		apiRouterConfig.MountApi(api_config.MountApiBasePramas{Remark: "事件属性近30天上报量", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), MetaDataController{}.AttrVolume)
+
 	}
 
 }
@@ -0,0 +1,28 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runPiiRule(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/pii_rule"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "新增脱敏规则", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), PiiRuleController{}.AddPiiRule)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "修改脱敏规则", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), PiiRuleController{}.ModifyPiiRule)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "删除脱敏规则", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), PiiRuleController{}.DeletePiiRule)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "脱敏规则列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), PiiRuleController{}.PiiRuleList)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "预览脱敏效果", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), PiiRuleController{}.PreviewPiiRule)
+	}
+}
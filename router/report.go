@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net/http/pprof"
+	"time"
+
+	"github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/model"
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+//上报服务 report_server与allinone共用
+func InitReport() *fasthttp.Server {
+	//定义路由
+	router := fasthttprouter.New()
+
+	router.GET("/debug/pprof/", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Index))
+	router.GET("/debug/pprof/cmdline", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Cmdline))
+	router.GET("/debug/pprof/profile", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Profile))
+	router.GET("/debug/pprof/symbol", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Symbol))
+	router.GET("/debug/pprof/trace", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Trace))
+	router.GET("/debug/pprof/allocs", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("allocs").ServeHTTP))
+	router.GET("/debug/pprof/block", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("block").ServeHTTP))
+	router.GET("/debug/pprof/goroutine", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("goroutine").ServeHTTP))
+	router.GET("/debug/pprof/heap", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("heap").ServeHTTP))
+	router.GET("/debug/pprof/mutex", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("mutex").ServeHTTP))
+	router.GET("/debug/pprof/threadcreate", fasthttpadaptor.NewFastHTTPHandlerFunc(pprof.Handler("threadcreate").ServeHTTP))
+	router.POST("/test", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(`{"code":0}`)
+	})
+
+	router.GET("/GetWordParse", controller.GetWordParse)
+
+	//上报路由
+	//写着写着变成了flutter的嵌套语法哈哈哈
+	router.POST(
+		"/sync_json/:typ/:appid/:appkey/:eventName/:debug",
+		//过滤器:允许跨域，打印错误信息
+		middleware.Cors(
+			//过滤器:禁止黑名单UserAgent
+			middleware.WechatSpider(
+				controller.ReportController{}.ReportAction,
+			),
+		),
+	)
+
+	//创建上报服务
+	server := &fasthttp.Server{
+		Handler: router.Handler,
+	}
+
+	//响应读取超时事件
+	if model.GlobConfig.Report.ReadTimeout != 0 {
+		server.ReadTimeout = time.Duration(model.GlobConfig.Report.ReadTimeout) * time.Second
+	}
+
+	//写超时
+	if model.GlobConfig.Report.WriteTimeout != 0 {
+		server.WriteTimeout = time.Duration(model.GlobConfig.Report.WriteTimeout) * time.Second
+	}
+
+	//限制ip并发数
+	if model.GlobConfig.Report.MaxConnsPerIP != 0 {
+		server.MaxConnsPerIP = model.GlobConfig.Report.MaxConnsPerIP
+	}
+
+	//每个连接可以服务无限数量的请求
+	if model.GlobConfig.Report.MaxRequestsPerConn != 0 {
+		server.MaxRequestsPerConn = model.GlobConfig.Report.MaxRequestsPerConn
+	}
+
+	if model.GlobConfig.Report.IdleTimeout != 0 {
+		server.IdleTimeout = time.Duration(model.GlobConfig.Report.IdleTimeout) * time.Second
+	}
+
+	return server
+}
@@ -0,0 +1,32 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runTrackingPlan(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/tracking_plan"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "埋点方案详情", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.TrackingPlanInfo)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "导入埋点方案", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.ImportTrackingPlan)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "导出埋点方案", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.ExportTrackingPlan)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "埋点方案版本列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.TrackingPlanVersions)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "回滚埋点方案", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.RollbackTrackingPlan)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "设置埋点方案校验方式", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.SetTrackingPlanMode)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "埋点方案差异", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), TrackingPlanController{}.TrackingPlanDrift)
+	}
+}
@@ -0,0 +1,28 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runVirtualAttr(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/virtual_attr"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "新增虚拟属性", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualAttrController{}.AddVirtualAttr)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "修改虚拟属性", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualAttrController{}.ModifyVirtualAttr)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "删除虚拟属性", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualAttrController{}.DeleteVirtualAttr)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "虚拟属性列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualAttrController{}.VirtualAttrList)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "校验虚拟属性表达式", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualAttrController{}.CheckVirtualAttr)
+	}
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	. "github.com/1340691923/xwl_bi/controller"
+	"github.com/1340691923/xwl_bi/middleware"
+	"github.com/1340691923/xwl_bi/platform-basic-libs/api_config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runVirtualEvent(app *fiber.App) {
+	c := api_config.NewApiRouterConfig()
+	const AbsolutePath = "/api/virtual_event"
+	appG := app.Group(AbsolutePath).Use(middleware.FilterAppid)
+	{
+
+		appG = appG.Use(middleware.OperaterLog)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "新增虚拟事件", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualEventController{}.AddVirtualEvent)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "修改虚拟事件", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualEventController{}.ModifyVirtualEvent)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "删除虚拟事件", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualEventController{}.DeleteVirtualEvent)
+
+		c.MountApi(api_config.MountApiBasePramas{Remark: "虚拟事件列表", AbsolutePath: AbsolutePath}, appG.(*fiber.Group), VirtualEventController{}.VirtualEventList)
+	}
+}
@@ -34,6 +34,54 @@ export function FunnelList(data) {
   })
 }
 
+export function FunnelDropOffList(data) {
+  return request({
+    url: api + 'FunnelDropOffList',
+    method: 'post',
+    data
+  })
+}
+
+export function LifecycleList(data) {
+  return request({
+    url: api + 'LifecycleList',
+    method: 'post',
+    data
+  })
+}
+
+export function IntervalList(data) {
+  return request({
+    url: api + 'IntervalList',
+    method: 'post',
+    data
+  })
+}
+
+export function DistributionList(data) {
+  return request({
+    url: api + 'DistributionList',
+    method: 'post',
+    data
+  })
+}
+
+export function LtvList(data) {
+  return request({
+    url: api + 'LtvList',
+    method: 'post',
+    data
+  })
+}
+
+export function AttributionList(data) {
+  return request({
+    url: api + 'AttributionList',
+    method: 'post',
+    data
+  })
+}
+
 export function RetentionList(data) {
   return request({
     url: api + 'RetentionList',
@@ -0,0 +1,51 @@
+import request from '@/utils/request'
+
+var api = '/api/attr_dict/'
+
+export function UploadAttrDict(data) {
+  return request({
+    url: api + 'UploadAttrDict',
+    method: 'post',
+    data
+  })
+}
+
+export function SaveUrlAttrDict(data) {
+  return request({
+    url: api + 'SaveUrlAttrDict',
+    method: 'post',
+    data
+  })
+}
+
+export function SyncAttrDict(data) {
+  return request({
+    url: api + 'SyncAttrDict',
+    method: 'post',
+    data
+  })
+}
+
+export function DeleteAttrDict(data) {
+  return request({
+    url: api + 'DeleteAttrDict',
+    method: 'post',
+    data
+  })
+}
+
+export function AttrDictList(data) {
+  return request({
+    url: api + 'AttrDictList',
+    method: 'post',
+    data
+  })
+}
+
+export function AttrDictItems(data) {
+  return request({
+    url: api + 'AttrDictItems',
+    method: 'post',
+    data
+  })
+}
@@ -0,0 +1,59 @@
+import request from '@/utils/request'
+
+var api = '/api/destination/'
+
+export function AddDestination(data) {
+  return request({
+    url: api + 'AddDestination',
+    method: 'post',
+    data
+  })
+}
+
+export function ModifyDestination(data) {
+  return request({
+    url: api + 'ModifyDestination',
+    method: 'post',
+    data
+  })
+}
+
+export function ModifyDestinationStatus(data) {
+  return request({
+    url: api + 'ModifyDestinationStatus',
+    method: 'post',
+    data
+  })
+}
+
+export function DeleteDestination(data) {
+  return request({
+    url: api + 'DeleteDestination',
+    method: 'post',
+    data
+  })
+}
+
+export function DestinationList(data) {
+  return request({
+    url: api + 'DestinationList',
+    method: 'post',
+    data
+  })
+}
+
+export function TestDestination(data) {
+  return request({
+    url: api + 'TestDestination',
+    method: 'post',
+    data
+  })
+}
+
+export function DestinationLogList(data) {
+  return request({
+    url: api + 'DestinationLogList',
+    method: 'post',
+    data
+  })
+}
@@ -0,0 +1,27 @@
+import request from '@/utils/request'
+
+var api = '/api/job/'
+
+export function JobList(data) {
+  return request({
+    url: api + 'JobList',
+    method: 'post',
+    data
+  })
+}
+
+export function JobRuns(data) {
+  return request({
+    url: api + 'JobRuns',
+    method: 'post',
+    data
+  })
+}
+
+export function TriggerJob(data) {
+  return request({
+    url: api + 'TriggerJob',
+    method: 'post',
+    data
+  })
+}
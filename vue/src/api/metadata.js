@@ -64,3 +64,45 @@ export function UpdateAttrInvisible(data) {
     data
   })
 }
+export function RetypeAttr(data) {
+  return request({
+    url: api + 'RetypeAttr',
+    method: 'post',
+    data
+  })
+}
+export function AttrRetypeProgress(data) {
+  return request({
+    url: api + 'AttrRetypeProgress',
+    method: 'post',
+    data
+  })
+}
+export function ArchiveAttr(data) {
+  return request({
+    url: api + 'ArchiveAttr',
+    method: 'post',
+    data
+  })
+}
+export function DropAttr(data) {
+  return request({
+    url: api + 'DropAttr',
+    method: 'post',
+    data
+  })
+}
+export function EventVolume(data) {
+  return request({
+    url: api + 'EventVolume',
+    method: 'post',
+    data
+  })
+}
+export function AttrVolume(data) {
+  return request({
+    url: api + 'AttrVolume',
+    method: 'post',
+    data
+  })
+}
@@ -0,0 +1,43 @@
+import request from '@/utils/request'
+
+var api = '/api/pii_rule/'
+
+export function AddPiiRule(data) {
+  return request({
+    url: api + 'AddPiiRule',
+    method: 'post',
+    data
+  })
+}
+
+export function ModifyPiiRule(data) {
+  return request({
+    url: api + 'ModifyPiiRule',
+    method: 'post',
+    data
+  })
+}
+
+export function DeletePiiRule(data) {
+  return request({
+    url: api + 'DeletePiiRule',
+    method: 'post',
+    data
+  })
+}
+
+export function PiiRuleList(data) {
+  return request({
+    url: api + 'PiiRuleList',
+    method: 'post',
+    data
+  })
+}
+
+export function PreviewPiiRule(data) {
+  return request({
+    url: api + 'PreviewPiiRule',
+    method: 'post',
+    data
+  })
+}
@@ -0,0 +1,83 @@
+import request from '@/utils/request'
+import XLSX from 'xlsx'
+
+var api = '/api/tracking_plan/'
+
+export function TrackingPlanInfo(data) {
+  return request({
+    url: api + 'TrackingPlanInfo',
+    method: 'post',
+    data
+  })
+}
+
+export function ImportTrackingPlan(data) {
+  return request({
+    url: api + 'ImportTrackingPlan',
+    method: 'post',
+    data
+  })
+}
+
+export function ExportTrackingPlan(data) {
+  return request({
+    url: api + 'ExportTrackingPlan',
+    method: 'post',
+    data
+  })
+}
+
+export function TrackingPlanVersions(data) {
+  return request({
+    url: api + 'TrackingPlanVersions',
+    method: 'post',
+    data
+  })
+}
+
+export function RollbackTrackingPlan(data) {
+  return request({
+    url: api + 'RollbackTrackingPlan',
+    method: 'post',
+    data
+  })
+}
+
+export function SetTrackingPlanMode(data) {
+  return request({
+    url: api + 'SetTrackingPlanMode',
+    method: 'post',
+    data
+  })
+}
+
+export function TrackingPlanDrift(data) {
+  return request({
+    url: api + 'TrackingPlanDrift',
+    method: 'post',
+    data
+  })
+}
+
+// excel与csv列一致 导入前在浏览器中转换为csv
+export function ExcelToCsv(file) {
+  return new Promise((resolve, reject) => {
+    const reader = new FileReader()
+    reader.onload = e => {
+      try {
+        const wb = XLSX.read(new Uint8Array(e.target.result), { type: 'array' })
+        resolve(XLSX.utils.sheet_to_csv(wb.Sheets[wb.SheetNames[0]]))
+      } catch (err) {
+        reject(err)
+      }
+    }
+    reader.onerror = reject
+    reader.readAsArrayBuffer(file)
+  })
+}
+
+// 导出的csv转换为excel文件内容
+export function CsvToExcel(csv) {
+  const wb = XLSX.read(csv, { type: 'string', raw: true })
+  return XLSX.write(wb, { bookType: 'xlsx', type: 'array' })
+}
@@ -0,0 +1,43 @@
+import request from '@/utils/request'
+
+var api = '/api/virtual_attr/'
+
+export function AddVirtualAttr(data) {
+  return request({
+    url: api + 'AddVirtualAttr',
+    method: 'post',
+    data
+  })
+}
+
+export function ModifyVirtualAttr(data) {
+  return request({
+    url: api + 'ModifyVirtualAttr',
+    method: 'post',
+    data
+  })
+}
+
+export function DeleteVirtualAttr(data) {
+  return request({
+    url: api + 'DeleteVirtualAttr',
+    method: 'post',
+    data
+  })
+}
+
+export function VirtualAttrList(data) {
+  return request({
+    url: api + 'VirtualAttrList',
+    method: 'post',
+    data
+  })
+}
+
+export function CheckVirtualAttr(data) {
+  return request({
+    url: api + 'CheckVirtualAttr',
+    method: 'post',
+    data
+  })
+}
@@ -0,0 +1,35 @@
+import request from '@/utils/request'
+
+var api = '/api/virtual_event/'
+
+export function AddVirtualEvent(data) {
+  return request({
+    url: api + 'AddVirtualEvent',
+    method: 'post',
+    data
+  })
+}
+
+export function ModifyVirtualEvent(data) {
+  return request({
+    url: api + 'ModifyVirtualEvent',
+    method: 'post',
+    data
+  })
+}
+
+export function DeleteVirtualEvent(data) {
+  return request({
+    url: api + 'DeleteVirtualEvent',
+    method: 'post',
+    data
+  })
+}
+
+export function VirtualEventList(data) {
+  return request({
+    url: api + 'VirtualEventList',
+    method: 'post',
+    data
+  })
+}
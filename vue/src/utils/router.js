@@ -55,6 +55,52 @@ export const asyncRoutes = [
           dynamic: true,
           icon: 'el-icon-bicycle'
         }
+      },
+      {
+        path: 'lifecycle',
+        component: 'views/behavior-analysis/lifecycle',
+        name: 'lifecycle',
+        meta: {
+          title: '生命周期分析',
+          icon: 'el-icon-refresh'
+        }
+      },
+      {
+        path: 'interval',
+        component: 'views/behavior-analysis/interval',
+        name: 'interval',
+        meta: {
+          title: '间隔分析',
+          icon: 'el-icon-time'
+        }
+      },
+      {
+        path: 'distribution',
+        component: 'views/behavior-analysis/distribution',
+        name: 'distribution',
+        meta: {
+          title: '分布分析',
+          icon: 'el-icon-s-data'
+        }
+      },
+      {
+        path: 'ltv/:id',
+        component: 'views/behavior-analysis/ltv',
+        name: 'ltv',
+        meta: {
+          title: 'LTV分析',
+          dynamic: true,
+          icon: 'el-icon-money'
+        }
+      },
+      {
+        path: 'attribution',
+        component: 'views/behavior-analysis/attribution',
+        name: 'attribution',
+        meta: {
+          title: '归因分析',
+          icon: 'el-icon-aim'
+        }
       }
     ]
   },
@@ -176,6 +222,15 @@ export const asyncRoutes = [
           title: '操作日志列表',
           icon: 'el-icon-s-order'
         }
+      },
+      {
+        path: 'job',
+        component: 'views/permission/job',
+        name: 'job',
+        meta: {
+          title: '定时任务',
+          icon: 'el-icon-alarm-clock'
+        }
       }
     ]
   },
@@ -200,10 +255,16 @@ export const RoutesComponentmaps = {
   'views/permission/role': () => import('@/views/permission/role'),
   'views/permission/operater_log': () => import('@/views/permission/operater_log'),
   'views/permission/user': () => import('@/views/permission/user'),
+  'views/permission/job': () => import('@/views/permission/job'),
   'views/behavior-analysis/event': () => import('@/views/behavior-analysis/event'),
   'views/behavior-analysis/retention': () => import('@/views/behavior-analysis/retention'),
   'views/behavior-analysis/funnel': () => import('@/views/behavior-analysis/funnel'),
   'views/behavior-analysis/trace': () => import('@/views/behavior-analysis/trace'),
+  'views/behavior-analysis/lifecycle': () => import('@/views/behavior-analysis/lifecycle'),
+  'views/behavior-analysis/interval': () => import('@/views/behavior-analysis/interval'),
+  'views/behavior-analysis/distribution': () => import('@/views/behavior-analysis/distribution'),
+  'views/behavior-analysis/ltv': () => import('@/views/behavior-analysis/ltv'),
+  'views/behavior-analysis/attribution': () => import('@/views/behavior-analysis/attribution'),
   'views/user-analysis/index': () => import('@/views/user-analysis/index'),
   'views/user-analysis/group': () => import('@/views/user-analysis/group'),
   'views/user-analysis/user_info': () => import('@/views/user-analysis/user_info'),